@@ -6,10 +6,20 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
 )
 
+// Returned by account functions when the client has not been started.
+var ErrAccountNotLoaded = errors.New("account not loaded")
+
 type NewAccount struct {
 	Contact                []string        `json:"contact,omitempty"`
 	TermsOfServiceAgreed   bool            `json:"termsOfServiceAgreed,omitempty"`
@@ -17,41 +27,127 @@ type NewAccount struct {
 	ExternalAccountBinding json.RawMessage `json:"externalAccountBinding,omitempty"`
 }
 
+// Credentials provided by the certificate authority to associate the ACME
+// account with an existing account (RFC 8555 7.3.4).
+type ExternalAccountBindingCfg struct {
+	KeyId   string `json:"key_id"`
+	HMACKey string `json:"hmac_key"` // base64url-encoded
+}
+
+func (cfg *ExternalAccountBindingCfg) decodeHMACKey() ([]byte, error) {
+	// Some CAs (e.g. ZeroSSL) provide keys with padding even though RFC 8555
+	// mandates base64url without padding.
+	key, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(cfg.HMACKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid external account binding HMAC "+
+			"key: %w", err)
+	}
+
+	return key, nil
+}
+
+type AccountStatus string
+
+const (
+	AccountStatusValid       AccountStatus = "valid"
+	AccountStatusDeactivated AccountStatus = "deactivated"
+	AccountStatusRevoked     AccountStatus = "revoked"
+)
+
 type Account struct {
-	Status                 string          `json:"status"`
+	Status                 AccountStatus   `json:"status"`
 	Contact                []string        `json:"contact,omitempty"`
 	TermsOfServiceAgreed   bool            `json:"termsOfServiceAgreed,omitempty"`
 	ExternalAccountBinding json.RawMessage `json:"externalAccountBinding,omitempty"`
 	Orders                 string          `json:"orders"`
 }
 
-func (c *Client) createAccount(ctx context.Context) (*AccountData, error) {
+func (a *Account) resolveURIs(base *url.URL) error {
+	return resolveURI(base, &a.Orders)
+}
+
+// createAccount creates a new account on the server, generating a new
+// private key if privateKey is nil.
+func (c *Client) createAccount(ctx context.Context, privateKey crypto.Signer) (*AccountData, error) {
 	c.Log.Debug(1, "creating account")
 
-	privateKey, err := c.Cfg.GenerateAccountPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("cannot generate private key: %w", err)
+	if privateKey == nil {
+		var err error
+		privateKey, err = c.Config().GenerateAccountPrivateKey()
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate private key: %w", err)
+		}
 	}
 
 	accountData := AccountData{
 		PrivateKey: privateKey,
 	}
 
-	c.accountData = &accountData
+	// The URI of the endpoint is part of the external account binding: all
+	// values must come from the same version of the directory.
+	directory := c.Directory()
 
 	newAccount := NewAccount{
-		Contact:              c.Cfg.ContactURIs,
+		Contact:              c.Config().ContactURIs,
 		TermsOfServiceAgreed: true,
 	}
 
-	res, err := c.sendRequest(ctx, "POST", c.Directory.NewAccount,
-		&newAccount, nil)
+	if eabCfg := c.Config().ExternalAccountBinding; eabCfg != nil {
+		hmacKey, err := eabCfg.decodeHMACKey()
+		if err != nil {
+			return nil, err
+		}
+
+		binding, err := signExternalAccountBinding(privateKey.Public(),
+			directory.NewAccount, eabCfg.KeyId, hmacKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot sign external account binding: %w",
+				err)
+		}
+
+		newAccount.ExternalAccountBinding = binding
+	} else if directory.Meta.ExternalAccountRequired {
+		return nil, fmt.Errorf("the server requires an external account " +
+			"binding")
+	}
+
+	// The request is signed with the new key, without key identifier since
+	// the account does not exist yet.
+	reqBody := accountRequestBody{
+		AccountData: &accountData,
+		Body:        &newAccount,
+	}
+
+	res, err := c.sendRequest(ctx, "POST", directory.NewAccount, &reqBody,
+		nil)
 	if err != nil {
+		var problem *ProblemDetails
+		if c.Config().AdaptAccountKeyAlgorithm && errors.As(err, &problem) &&
+			problem.Type == ErrorTypeBadSignatureAlgorithm {
+			keyType, err2 := adaptPrivateKeyType(privateKey, problem.Algorithms)
+			if err2 != nil {
+				return nil, fmt.Errorf("%w (%w)", err, err2)
+			}
+
+			c.Log.Info("server rejected the signature algorithm of the "+
+				"account key, retrying with a %s key", keyType)
+
+			privateKey, err2 := GeneratePrivateKey(keyType)
+			if err2 != nil {
+				return nil, fmt.Errorf("cannot generate private key: %w", err2)
+			}
+
+			return c.createAccount(ctx, privateKey)
+		}
+
 		return nil, err
 	}
 
-	location := res.Header.Get("Location")
-	if location == "" {
+	location, err := responseLocation(res)
+	if err != nil {
+		return nil, err
+	} else if location == "" {
 		return nil, fmt.Errorf("missing or empty Location header field")
 	}
 
@@ -60,6 +156,308 @@ func (c *Client) createAccount(ctx context.Context) (*AccountData, error) {
 	return &accountData, nil
 }
 
+type AccountRecreationMode string
+
+const (
+	AccountRecreationNone    AccountRecreationMode = ""
+	AccountRecreationSameKey AccountRecreationMode = "same_key"
+	AccountRecreationNewKey  AccountRecreationMode = "new_key"
+)
+
+func (mode AccountRecreationMode) Validate() error {
+	switch mode {
+	case AccountRecreationNone, AccountRecreationSameKey,
+		AccountRecreationNewKey:
+		return nil
+	}
+
+	return fmt.Errorf("invalid account recreation mode %q", mode)
+}
+
+// recreateAccount replaces an account which does not exist anymore on the
+// server, e.g. after a reset of a staging environment. If multiple requests
+// fail at the same time, the account is only recreated once.
+func (c *Client) recreateAccount(ctx context.Context, oldURI string) error {
+	c.accountRecreationMutex.Lock()
+	defer c.accountRecreationMutex.Unlock()
+
+	oldAccountData := c.currentAccountData()
+	if oldAccountData.URI != oldURI {
+		return nil
+	}
+
+	c.Log.Info("account %q does not exist anymore, creating a new account",
+		oldURI)
+
+	var privateKey crypto.Signer
+	if c.Config().AccountRecreation == AccountRecreationSameKey {
+		privateKey = oldAccountData.PrivateKey
+	}
+
+	accountData, err := c.createAccount(ctx, privateKey)
+	if err != nil {
+		return fmt.Errorf("cannot create account: %w", err)
+	}
+
+	if err := c.dataStore.StoreAccountData(accountData); err != nil {
+		return fmt.Errorf("cannot store account data: %w", err)
+	}
+
+	c.setAccountData(accountData)
+
+	c.Log.Info("using account %q", accountData.URI)
+
+	if c.httpChallengeSolver != nil && privateKey == nil {
+		thumbprint, err := accountData.Thumbprint()
+		if err != nil {
+			return fmt.Errorf("cannot compute account thumbprint: %w", err)
+		}
+
+		c.httpChallengeSolver.setAccountThumbprint(thumbprint)
+	}
+
+	return nil
+}
+
+type AccountUpdate struct {
+	Contact []string      `json:"contact,omitempty"`
+	Status  AccountStatus `json:"status,omitempty"`
+}
+
+// RFC 8555 7.3.5. Account Key Rollover
+type AccountKeyChange struct {
+	Account string          `json:"account"`
+	OldKey  jose.JSONWebKey `json:"oldKey"`
+}
+
+func (c *Client) currentAccountData() *AccountData {
+	c.accountDataMutex.RLock()
+	defer c.accountDataMutex.RUnlock()
+
+	return c.accountData
+}
+
+func (c *Client) setAccountData(accountData *AccountData) {
+	c.accountDataMutex.Lock()
+	c.accountData = accountData
+	c.accountDataMutex.Unlock()
+}
+
+// AccountError is returned by Client.Start when the account referenced in the
+// data store cannot be used.
+type AccountError struct {
+	URI    string
+	Status AccountStatus // empty if the account is unknown to the server
+	Err    error
+}
+
+func (err *AccountError) Error() string {
+	var msg string
+	if err.Status != "" {
+		msg = fmt.Sprintf("account %q is %s", err.URI, err.Status)
+	} else {
+		msg = fmt.Sprintf("account %q cannot be used: %v", err.URI, err.Err)
+	}
+
+	return msg + " (check the directory URI; if the account is not " +
+		"supposed to be used anymore, delete it from the data store so that " +
+		"a new one is created)"
+}
+
+func (err *AccountError) Unwrap() error {
+	return err.Err
+}
+
+func (c *Client) checkAccount(ctx context.Context) error {
+	uri := c.currentAccountData().URI
+
+	account, err := c.Account(ctx)
+	if err != nil {
+		// The account may have been recreated, in which case the request
+		// was sent again with the new account to the URI of the old one.
+		if c.currentAccountData().URI != uri {
+			return nil
+		}
+
+		var problem *ProblemDetails
+		if errors.As(err, &problem) &&
+			(problem.Type == ErrorTypeAccountDoesNotExist ||
+				problem.Type == ErrorTypeUnauthorized) {
+			return &AccountError{URI: uri, Err: err}
+		}
+
+		return fmt.Errorf("cannot fetch account: %w", err)
+	}
+
+	if account.Status != AccountStatusValid {
+		return &AccountError{URI: uri, Status: account.Status}
+	}
+
+	return nil
+}
+
+// AccountThumbprint returns the JWK thumbprint of the public key of the
+// account (RFC 7638), as used in key authorizations, e.g. by external
+// challenge solvers.
+func (c *Client) AccountThumbprint() (string, error) {
+	accountData := c.currentAccountData()
+	if accountData == nil {
+		return "", ErrAccountNotLoaded
+	}
+
+	return accountData.Thumbprint()
+}
+
+// Account fetches the account object from the server.
+func (c *Client) Account(ctx context.Context) (*Account, error) {
+	accountData := c.currentAccountData()
+	if accountData == nil {
+		return nil, ErrAccountNotLoaded
+	}
+
+	var account Account
+
+	if _, err := c.sendRequest(ctx, "POST", accountData.URI, nil, &account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (c *Client) UpdateAccountContact(ctx context.Context, contactURIs []string) (*Account, error) {
+	for _, uri := range contactURIs {
+		if err := ValidateContactURI(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	c.Log.Debug(1, "updating account contact")
+
+	return c.updateAccount(ctx, &AccountUpdate{Contact: contactURIs})
+}
+
+// ValidateContactURI checks that a contact URI will be accepted by ACME
+// servers. Mailto URIs must contain a single email address without header
+// fields (RFC 8555 7.3).
+func ValidateContactURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid contact URI %q: %w", uri, err)
+	}
+
+	if u.Scheme == "" {
+		return fmt.Errorf("invalid contact URI %q: missing scheme", uri)
+	}
+
+	if u.Scheme != "mailto" {
+		return nil
+	}
+
+	if u.RawQuery != "" || u.ForceQuery {
+		return fmt.Errorf("invalid contact URI %q: mailto URIs cannot have "+
+			"header fields", uri)
+	}
+
+	address, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return fmt.Errorf("invalid contact URI %q: %w", uri, err)
+	}
+
+	if address == "" {
+		return fmt.Errorf("invalid contact URI %q: missing email address", uri)
+	}
+
+	if strings.Contains(address, ",") {
+		return fmt.Errorf("invalid contact URI %q: mailto URIs cannot "+
+			"contain multiple email addresses", uri)
+	}
+
+	if addr, err := mail.ParseAddress(address); err != nil ||
+		addr.Address != address {
+		return fmt.Errorf("invalid contact URI %q: invalid email address %q",
+			uri, address)
+	}
+
+	return nil
+}
+
+func (c *Client) DeactivateAccount(ctx context.Context) (*Account, error) {
+	c.Log.Debug(1, "deactivating account")
+
+	return c.updateAccount(ctx, &AccountUpdate{
+		Status: AccountStatusDeactivated,
+	})
+}
+
+func (c *Client) updateAccount(ctx context.Context, update *AccountUpdate) (*Account, error) {
+	var account Account
+
+	uri := c.currentAccountData().URI
+
+	if _, err := c.sendRequest(ctx, "POST", uri, update, &account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// RolloverAccountKey replaces the private key of the account by a new one,
+// both on the server and in the data store.
+func (c *Client) RolloverAccountKey(ctx context.Context, privateKey crypto.Signer) error {
+	c.Log.Debug(1, "changing account key")
+
+	accountData := c.currentAccountData()
+
+	// The URI of the endpoint is part of the inner JWS
+	directory := c.Directory()
+
+	keyChange := AccountKeyChange{
+		Account: accountData.URI,
+		OldKey:  jose.JSONWebKey{Key: accountData.PrivateKey.Public()},
+	}
+
+	keyChangeData, err := json.Marshal(keyChange)
+	if err != nil {
+		return fmt.Errorf("cannot encode key change: %w", err)
+	}
+
+	// The inner JWS is signed with the new key which is embedded in the
+	// header.
+	innerData, err := signJWS(keyChangeData, directory.KeyChange, "",
+		privateKey, "")
+	if err != nil {
+		return fmt.Errorf("cannot sign key change: %w", err)
+	}
+
+	_, err = c.sendRequest(ctx, "POST", directory.KeyChange,
+		json.RawMessage(innerData), nil)
+	if err != nil {
+		return err
+	}
+
+	newAccountData := AccountData{
+		URI:        accountData.URI,
+		PrivateKey: privateKey,
+	}
+
+	if err := c.dataStore.StoreAccountData(&newAccountData); err != nil {
+		return fmt.Errorf("cannot store account data: %w", err)
+	}
+
+	c.setAccountData(&newAccountData)
+
+	if c.httpChallengeSolver != nil {
+		thumbprint, err := newAccountData.Thumbprint()
+		if err != nil {
+			return fmt.Errorf("cannot compute account thumbprint: %w", err)
+		}
+
+		c.httpChallengeSolver.setAccountThumbprint(thumbprint)
+	}
+
+	return nil
+}
+
 func GenerateECDSAP256PrivateKey() (crypto.Signer, error) {
 	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 }
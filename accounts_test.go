@@ -1,8 +1,14 @@
 package acme
 
 import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
 	"testing"
 
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,3 +32,231 @@ func TestAccountManagement(t *testing.T) {
 			require.Equal(accountData.URI, c.accountData.URI)
 		})
 }
+
+func TestExternalAccountBinding(t *testing.T) {
+	require := require.New(t)
+
+	accountKey, err := GenerateECDSAP256PrivateKey()
+	require.NoError(err)
+
+	eabCfg := ExternalAccountBindingCfg{
+		KeyId:   "kid-1",
+		HMACKey: "zWNDZM6eQGHWpSRTPal5eIUYFTu7EajVIoguysqZ9wG44nMEtx3MUAsUDkMTQ12W",
+	}
+
+	hmacKey, err := eabCfg.decodeHMACKey()
+	require.NoError(err)
+
+	uri := "https://example.com/new-account"
+
+	data, err := signExternalAccountBinding(accountKey.Public(), uri,
+		eabCfg.KeyId, hmacKey)
+	require.NoError(err)
+
+	jws, err := jose.ParseSigned(string(data),
+		[]jose.SignatureAlgorithm{jose.HS256})
+	require.NoError(err)
+
+	header := jws.Signatures[0].Protected
+	require.Equal("kid-1", header.KeyID)
+	require.Equal(uri, header.ExtraHeaders["url"])
+
+	payload, err := jws.Verify(hmacKey)
+	require.NoError(err)
+
+	var jwk jose.JSONWebKey
+	require.NoError(jwk.UnmarshalJSON(payload))
+	require.True(jwk.IsPublic())
+}
+
+func TestAccountThumbprint(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		thumbprint, err := c.AccountThumbprint()
+		require.NoError(err)
+
+		key := jose.JSONWebKey{Key: c.accountData.PrivateKey.Public()}
+		data, err := key.Thumbprint(crypto.SHA256)
+		require.NoError(err)
+		assert.Equal(base64.RawURLEncoding.EncodeToString(data), thumbprint)
+
+		account, err := c.Account(context.Background())
+		require.NoError(err)
+		assert.Equal(AccountStatusValid, account.Status)
+	})
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	c, err := NewClient(ClientCfg{DataStore: dataStore})
+	require.NoError(err)
+
+	_, err = c.AccountThumbprint()
+	assert.ErrorIs(err, ErrAccountNotLoaded)
+}
+
+func TestAccountHealthCheck(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	setup := func(cfg *ClientCfg) {
+		cfg.DataStore = dataStore
+	}
+
+	// Create the account
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {})
+
+	// Load it again
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {})
+
+	startClient := func() error {
+		c, err := NewClient(ClientCfg{
+			HTTPClient:   s.server.Client(),
+			DataStore:    dataStore,
+			DirectoryURI: s.DirectoryURI(),
+		})
+		require.NoError(err)
+
+		return c.Start(context.Background())
+	}
+
+	var accountErr *AccountError
+
+	s.mutex.Lock()
+	s.AccountStatus = AccountStatusDeactivated
+	s.mutex.Unlock()
+
+	err = startClient()
+	require.True(errors.As(err, &accountErr))
+	assert.Equal(AccountStatusDeactivated, accountErr.Status)
+
+	s.mutex.Lock()
+	s.AccountStatus = ""
+	clear(s.accounts)
+	s.mutex.Unlock()
+
+	err = startClient()
+	require.True(errors.As(err, &accountErr))
+	assert.Equal(AccountStatus(""), accountErr.Status)
+}
+
+func TestAccountRecreation(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	resetAccounts := func() {
+		s.mutex.Lock()
+		clear(s.accounts)
+		s.mutex.Unlock()
+	}
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.DataStore = dataStore
+		cfg.AccountRecreation = AccountRecreationSameKey
+	}, func(c *Client) {
+		oldAccountData := c.currentAccountData()
+
+		resetAccounts()
+
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		accountData := c.currentAccountData()
+		assert.NotEqual(oldAccountData.URI, accountData.URI)
+		assert.Equal(oldAccountData.PrivateKey, accountData.PrivateKey)
+
+		storedAccountData, err := dataStore.LoadAccountData()
+		require.NoError(err)
+		assert.Equal(accountData.URI, storedAccountData.URI)
+	})
+
+	// The account is also recreated when the client starts
+	resetAccounts()
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.DataStore = dataStore
+		cfg.AccountRecreation = AccountRecreationNewKey
+	}, func(c *Client) {
+		storedAccountData, err := dataStore.LoadAccountData()
+		require.NoError(err)
+
+		accountData := c.currentAccountData()
+		assert.Equal(storedAccountData.URI, accountData.URI)
+
+		_, err = c.Account(context.Background())
+		assert.NoError(err)
+	})
+}
+
+func TestAdaptAccountKeyAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.SignatureAlgorithms = []jose.SignatureAlgorithm{jose.ES384, jose.RS256}
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.GenerateAccountPrivateKey = PrivateKeyGenerationFunc(
+			KeyTypeECDSAP256)
+		cfg.AdaptAccountKeyAlgorithm = true
+	}, func(c *Client) {
+		algorithm, err := signatureAlgorithm(c.currentAccountData().PrivateKey)
+		if assert.NoError(err) {
+			assert.Equal(jose.ES384, algorithm)
+		}
+
+		_, err = c.Account(context.Background())
+		assert.NoError(err)
+	})
+}
+
+func TestValidateContactURI(t *testing.T) {
+	assert := assert.New(t)
+
+	validURIs := []string{
+		"mailto:admin@example.com",
+		"mailto:admin%2Bacme@example.com",
+		"tel:+33123456789",
+	}
+
+	for _, uri := range validURIs {
+		assert.NoError(ValidateContactURI(uri), uri)
+	}
+
+	invalidURIs := []string{
+		"",
+		"admin@example.com",
+		"mailto:",
+		"mailto:a@example.com,b@example.com",
+		"mailto:admin@example.com?subject=acme",
+		"mailto:Admin <admin@example.com>",
+		"mailto:example.com",
+	}
+
+	for _, uri := range invalidURIs {
+		assert.Error(ValidateContactURI(uri), uri)
+	}
+}
@@ -3,14 +3,20 @@ package acme
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -43,6 +49,13 @@ const (
 	ErrorTypeUserActionRequired      ErrorType = "urn:ietf:params:acme:error:userActionRequired"
 )
 
+const DefaultMaxResponseSize = 1024 * 1024
+
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// The debug level at which request and response bodies are logged
+const bodyDebugLevel = 3
+
 type ProblemDetails struct {
 	// RFC 7807 3.1. Members of a Problem Details Object
 	Type     ErrorType `json:"type,omitempty"`
@@ -53,11 +66,126 @@ type ProblemDetails struct {
 
 	// RFC 8555 6.7.1. Subproblems
 	Subproblems []ProblemDetails `json:"subproblems,omitempty"`
+	Identifier  *Identifier      `json:"identifier,omitempty"`
+
+	// RFC 8555 6.2. Request Authentication (badSignatureAlgorithm errors)
+	Algorithms []string `json:"algorithms,omitempty"`
+
+	// RFC 7807 3.2. Extension Members: members unknown to the client, kept
+	// so that problems can be transmitted without losing information.
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+var problemDetailsMembers = []string{"type", "title", "status", "detail",
+	"instance", "subproblems", "identifier", "algorithms"}
+
+// ProblemDetailsFromError returns the problem details object contained in an
+// error chain, or nil if there is none.
+func ProblemDetailsFromError(err error) *ProblemDetails {
+	var details *ProblemDetails
+	if !errors.As(err, &details) {
+		return nil
+	}
+
+	return details
+}
+
+// ErrorCode returns the code of the problem details object contained in an
+// error chain, or an empty string if there is none.
+func ErrorCode(err error) string {
+	if details := ProblemDetailsFromError(err); details != nil {
+		return details.Code()
+	}
+
+	return ""
+}
+
+// Code returns a short stable identifier of the problem, i.e. the name of
+// the error for ACME error types (e.g. "badNonce") and the full type URI for
+// other types.
+func (err *ProblemDetails) Code() string {
+	if err.Type == "" {
+		// RFC 7807 4.2. Predefined Problem Types
+		return "about:blank"
+	}
+
+	code, found := strings.CutPrefix(string(err.Type),
+		"urn:ietf:params:acme:error:")
+	if !found {
+		return string(err.Type)
+	}
+
+	return code
+}
+
+func (err ProblemDetails) MarshalJSON() ([]byte, error) {
+	type ProblemDetails2 ProblemDetails
+
+	data, err2 := json.Marshal(ProblemDetails2(err))
+	if err2 != nil || len(err.Extensions) == 0 {
+		return data, err2
+	}
+
+	var obj map[string]json.RawMessage
+	if err2 := json.Unmarshal(data, &obj); err2 != nil {
+		return nil, err2
+	}
+
+	for name, value := range err.Extensions {
+		if _, found := obj[name]; !found {
+			obj[name] = value
+		}
+	}
+
+	return json.Marshal(obj)
+}
+
+func (err *ProblemDetails) UnmarshalJSON(data []byte) error {
+	type ProblemDetails2 ProblemDetails
+
+	var err2 ProblemDetails2
+	if err := json.Unmarshal(data, &err2); err != nil {
+		return err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	for _, name := range problemDetailsMembers {
+		delete(obj, name)
+	}
+
+	err2.Extensions = nil
+	if len(obj) > 0 {
+		err2.Extensions = obj
+	}
+
+	*err = ProblemDetails(err2)
+	return nil
+}
+
+// Problem details objects are represented as text using their JSON
+// representation, e.g. for log messages or configuration files.
+
+func (err ProblemDetails) MarshalText() ([]byte, error) {
+	return err.MarshalJSON()
+}
+
+func (err *ProblemDetails) UnmarshalText(data []byte) error {
+	return err.UnmarshalJSON(data)
 }
 
 func (err *ProblemDetails) FormatErrorString(buf *bytes.Buffer, indent string) {
+	buf.WriteString(indent)
+
+	if err.Identifier != nil {
+		buf.WriteString(err.Identifier.String())
+		buf.WriteString(": ")
+	}
+
 	if err.Type != "" {
-		buf.WriteString(indent)
 		buf.WriteString(string(err.Type))
 	}
 
@@ -89,20 +217,155 @@ func (err *ProblemDetails) FormatErrorString(buf *bytes.Buffer, indent string) {
 	}
 }
 
+// FailedIdentifiers returns the identifiers associated with subproblems,
+// i.e. the identifiers responsible for the failure of the request.
+func (err *ProblemDetails) FailedIdentifiers() []Identifier {
+	var ids []Identifier
+
+	for _, subproblem := range err.Subproblems {
+		if id := subproblem.Identifier; id != nil {
+			if !slices.Contains(ids, *id) {
+				ids = append(ids, *id)
+			}
+		}
+	}
+
+	return ids
+}
+
 func (err *ProblemDetails) Error() string {
 	var buf bytes.Buffer
 	err.FormatErrorString(&buf, "")
 	return buf.String()
 }
 
+// RFC 8555 7.4.2. Downloading the Certificate. The content type is kept since
+// some servers do not use the default PEM format.
+type certificateChainResponse struct {
+	ContentType string
+	Data        []byte
+}
+
+type HTTPClientCfg struct {
+	CACertPool *x509.CertPool `json:"-"`
+
+	// HTTP/2 is only used if the server supports it.
+	EnableHTTP2 bool `json:"enable_http2,omitempty"`
+
+	// The default value of MaxIdleConns is 10. MaxIdleConnsPerHost defaults
+	// to MaxIdleConns since the client usually talks to a single server.
+	MaxIdleConns        int `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+
+	// If set, TLS sessions are cached so that new connections can be
+	// established with an abbreviated handshake.
+	TLSSessionCacheSize int `json:"tls_session_cache_size,omitempty"`
+
+	// The minimum TLS version, e.g. tls.VersionTLS13. Defaults to the
+	// default of crypto/tls.
+	MinTLSVersion uint16 `json:"min_tls_version,omitempty"`
+
+	// If set, connections are only accepted if one of the certificates of
+	// the verified chain matches one of the pins, see PublicKeyPin and
+	// CertificatePin. Pinning usually goes with a CACertPool only containing
+	// the root certificate of the server so that the system root store is
+	// not trusted.
+	PinnedPublicKeys   []string `json:"pinned_public_keys,omitempty"`
+	PinnedCertificates []string `json:"pinned_certificates,omitempty"`
+}
+
+// PublicKeyPin returns the base64-encoded SHA-256 digest of the public key
+// (SubjectPublicKeyInfo) of a certificate, as used in
+// HTTPClientCfg.PinnedPublicKeys. Public key pins remain valid when the
+// certificate is renewed with the same key.
+func PublicKeyPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// CertificatePin returns the base64-encoded SHA-256 digest of a certificate,
+// as used in HTTPClientCfg.PinnedCertificates.
+func CertificatePin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.Raw)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func (cfg *HTTPClientCfg) Validate() error {
+	var v validator
+
+	switch cfg.MinTLSVersion {
+	case 0, tls.VersionTLS12, tls.VersionTLS13:
+	default:
+		v.add("MinTLSVersion", "unsupported TLS version 0x%04x",
+			cfg.MinTLSVersion)
+	}
+
+	checkPins := func(field string, pins []string) {
+		for _, pin := range pins {
+			data, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(data) != sha256.Size {
+				v.add(field, "invalid pin %q: pins must be base64-encoded "+
+					"SHA-256 digests", pin)
+			}
+		}
+	}
+
+	checkPins("PinnedPublicKeys", cfg.PinnedPublicKeys)
+	checkPins("PinnedCertificates", cfg.PinnedCertificates)
+
+	return v.err()
+}
+
+// verifyPins is used as tls.Config.VerifyConnection, which is called after
+// the certificate chain has been verified.
+func (cfg *HTTPClientCfg) verifyPins(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if slices.Contains(cfg.PinnedPublicKeys, PublicKeyPin(cert)) ||
+				slices.Contains(cfg.PinnedCertificates, CertificatePin(cert)) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no certificate of the chain of %q matches a pin",
+		cs.ServerName)
+}
+
 func NewHTTPClient(caCertPool *x509.CertPool) *http.Client {
+	return NewHTTPClientWithCfg(HTTPClientCfg{CACertPool: caCertPool})
+}
+
+func NewHTTPClientWithCfg(cfg HTTPClientCfg) *http.Client {
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = 10
+	}
+
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+
 	dialer := net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}
 
 	tlsCfg := tls.Config{
-		RootCAs: caCertPool,
+		RootCAs:    cfg.CACertPool,
+		MinVersion: cfg.MinTLSVersion,
+	}
+
+	if len(cfg.PinnedPublicKeys) > 0 || len(cfg.PinnedCertificates) > 0 {
+		tlsCfg.VerifyConnection = cfg.verifyPins
+	}
+
+	if cfg.EnableHTTP2 {
+		tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if cfg.TLSSessionCacheSize > 0 {
+		tlsCfg.ClientSessionCache =
+			tls.NewLRUClientSessionCache(cfg.TLSSessionCacheSize)
 	}
 
 	tlsDialer := tls.Dialer{
@@ -116,7 +379,16 @@ func NewHTTPClient(caCertPool *x509.CertPool) *http.Client {
 		DialContext:    dialer.DialContext,
 		DialTLSContext: tlsDialer.DialContext,
 
-		MaxIdleConns: 10,
+		// DialTLSContext is not used for HTTPS requests sent through a
+		// proxy: the TLS connection established after CONNECT uses
+		// TLSClientConfig.
+		TLSClientConfig: &tlsCfg,
+
+		// With custom dial functions, HTTP/2 must be explicitly enabled
+		ForceAttemptHTTP2: cfg.EnableHTTP2,
+
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
 
 		IdleConnTimeout: 60 * time.Second,
 	}
@@ -129,13 +401,21 @@ func NewHTTPClient(caCertPool *x509.CertPool) *http.Client {
 	return &client
 }
 
+// Request bodies are signed with the key of the current account, unless they
+// are wrapped in an accountRequestBody value, e.g. when creating an account.
+type accountRequestBody struct {
+	AccountData *AccountData
+	Body        any
+}
+
 func (c *Client) sendRequest(ctx context.Context, method, uri string, reqBody, resBody any) (*http.Response, error) {
 	nbAttempts := 3
-	if c.Cfg.DirectoryURI == PebbleDirectoryURI {
+	if c.Config().DirectoryURI == PebbleDirectoryURI {
 		nbAttempts = 100
 	}
 
 	var lastBadNonceError error
+	accountRecreated := false
 
 	for i := 0; i < nbAttempts; i++ {
 		nonce, err := c.nextNonce(ctx)
@@ -143,24 +423,70 @@ func (c *Client) sendRequest(ctx context.Context, method, uri string, reqBody, r
 			return nil, fmt.Errorf("cannot obtain nonce: %w", err)
 		}
 
-		res, err := c.sendRequestWithNonce(ctx, method, uri, reqBody, resBody, nonce)
+		accountData := c.currentAccountData()
+
+		res, err := c.sendRequestWithNonce(ctx, method, uri, reqBody, resBody,
+			nonce, i)
 		if err == nil {
 			return res, nil
-		} else {
-			var details *ProblemDetails
+		}
 
-			if !errors.As(err, &details) || details.Type != ErrorTypeBadNonce {
-				return nil, err
-			}
+		var details *ProblemDetails
+		if !errors.As(err, &details) {
+			return res, err
+		}
+
+		_, isAccountRequest := reqBody.(*accountRequestBody)
 
+		switch {
+		case details.Type == ErrorTypeBadNonce:
+			c.recordRejectedNonce(nonce)
 			lastBadNonceError = err
+
+		case details.Type == ErrorTypeAccountDoesNotExist &&
+			c.Config().AccountRecreation != AccountRecreationNone &&
+			!isAccountRequest && !accountRecreated && accountData != nil:
+			if err2 := c.recreateAccount(ctx, accountData.URI); err2 != nil {
+				return res, fmt.Errorf("%w (cannot recreate account: %w)",
+					err, err2)
+			}
+
+			accountRecreated = true
+
+		default:
+			return res, err
 		}
 	}
 
 	return nil, lastBadNonceError
 }
 
-func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, reqBody, resBody any, nonce string) (*http.Response, error) {
+func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, reqBody, resBody any, nonce string, attempt int) (*http.Response, error) {
+	hook := c.Config().RequestHook
+	if hook == nil {
+		return c.doSendRequest(ctx, method, uri, reqBody, resBody, nonce)
+	}
+
+	trace := newRequestTrace(method, uri, attempt)
+	ctx = httptrace.WithClientTrace(ctx, trace.ClientTrace())
+
+	res, err := c.doSendRequest(ctx, method, uri, reqBody, resBody, nonce)
+	hook(trace.Finish(res, err))
+
+	return res, err
+}
+
+func (c *Client) doSendRequest(ctx context.Context, method, uri string, reqBody, resBody any, nonce string) (*http.Response, error) {
+	if err := c.checkResourceURI(uri); err != nil {
+		return nil, err
+	}
+
+	accountData := c.currentAccountData()
+	if body, ok := reqBody.(*accountRequestBody); ok {
+		accountData = body.AccountData
+		reqBody = body.Body
+	}
+
 	var reqBodyData []byte
 	if reqBody != nil {
 		data, err := json.Marshal(reqBody)
@@ -173,16 +499,20 @@ func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, r
 
 	var reqBodyReader io.Reader
 
-	if method != "HEAD" && uri != c.Cfg.DirectoryURI {
+	if method != "HEAD" && uri != c.Config().DirectoryURI {
 		if nonce == "" {
 			return nil, fmt.Errorf("cannot sign request without a nonce")
 		}
 
-		signedData, err := c.signPayload(reqBodyData, uri, nonce)
+		signedData, err := c.signPayload(reqBodyData, uri, nonce,
+			accountData)
 		if err != nil {
 			return nil, fmt.Errorf("cannot sign request body data: %w", err)
 		}
 
+		c.Log.Debug(bodyDebugLevel, "request body: %s",
+			redactLogData(signedData))
+
 		reqBodyReader = bytes.NewReader(signedData)
 	}
 
@@ -191,10 +521,47 @@ func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, r
 		return nil, fmt.Errorf("cannot create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", c.Cfg.UserAgent)
+	cfg := c.Config()
+
+	for name, values := range cfg.RequestHeader {
+		req.Header[http.CanonicalHeaderKey(name)] = slices.Clone(values)
+	}
+
+	userAgent := cfg.UserAgent
+	if cfg.ApplicationUserAgent != "" {
+		userAgent += " " + cfg.ApplicationUserAgent
+	}
+
+	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Content-Type", "application/jose+json")
 
-	res, err := c.httpClient.Do(req)
+	if _, ok := resBody.(*certificateChainResponse); ok {
+		req.Header.Set("Accept", "application/pem-certificate-chain")
+	}
+
+	if cfg.RequestDecorator != nil {
+		cfg.RequestDecorator(req)
+	}
+
+	// Redirections must not let the server send requests to other hosts
+	httpClient := *cfg.HTTPClient
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := c.checkResourceURI(req.URL.String()); err != nil {
+			return err
+		}
+
+		if checkRedirect := cfg.HTTPClient.CheckRedirect; checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		return nil
+	}
+
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot send request: %w", err)
 	}
@@ -211,29 +578,58 @@ func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, r
 		}
 	}
 
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		return res, fmt.Errorf("cannot read response body: %w", err)
+	var body io.Reader = newSizeLimitedReader(res.Body,
+		c.Config().MaxResponseSize)
+
+	if c.Log.DebugLevel >= bodyDebugLevel {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return res, fmt.Errorf("cannot read response body: %w", err)
+		}
+
+		c.Log.Debug(bodyDebugLevel, "response body: %s", redactLogData(data))
+
+		body = bytes.NewReader(data)
 	}
 
 	if status := res.StatusCode; status < 200 || status > 300 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return res, fmt.Errorf("cannot read response body: %w", err)
+		}
+
 		var details ProblemDetails
 		if err := json.Unmarshal(data, &details); err == nil {
 			return res, &details
 		}
 
 		return res, fmt.Errorf("request failed with status %d: %s",
-			status, data)
+			status, redactLogData(data))
 	}
 
-	if resBody != nil {
-		switch dest := resBody.(type) {
-		case *[]byte:
-			*dest = data
+	switch dest := resBody.(type) {
+	case nil:
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return res, fmt.Errorf("cannot read response body: %w", err)
+		}
 
-		default:
-			if err := json.Unmarshal(data, dest); err != nil {
-				return res, fmt.Errorf("cannot decode response body: %w", err)
+	case *certificateChainResponse:
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(body); err != nil {
+			return res, fmt.Errorf("cannot read response body: %w", err)
+		}
+
+		dest.ContentType = res.Header.Get("Content-Type")
+		dest.Data = buf.Bytes()
+
+	default:
+		if err := json.NewDecoder(body).Decode(dest); err != nil {
+			return res, fmt.Errorf("cannot decode response body: %w", err)
+		}
+
+		if r, ok := dest.(uriResolver); ok {
+			if err := r.resolveURIs(res.Request.URL); err != nil {
+				return res, fmt.Errorf("invalid response body: %w", err)
 			}
 		}
 	}
@@ -241,9 +637,146 @@ func (c *Client) sendRequestWithNonce(ctx context.Context, method, uri string, r
 	return res, nil
 }
 
+// Resources containing URIs implement uriResolver so that relative
+// references, sent by some non-conforming servers, are resolved against the
+// URI of the request which returned them.
+type uriResolver interface {
+	resolveURIs(base *url.URL) error
+}
+
+func resolveURI(base *url.URL, uri *string) error {
+	if *uri == "" {
+		return nil
+	}
+
+	ref, err := url.Parse(*uri)
+	if err != nil {
+		return fmt.Errorf("invalid URI %q: %w", *uri, err)
+	}
+
+	if !ref.IsAbs() {
+		*uri = base.ResolveReference(ref).String()
+	}
+
+	return nil
+}
+
+// checkResourceURI makes sure that a request is sent to the ACME server and
+// not to an arbitrary host, whatever the directory and resources returned by
+// the server contain.
+func (c *Client) checkResourceURI(uri string) error {
+	cfg := c.Config()
+
+	if uri == cfg.DirectoryURI {
+		return nil
+	}
+
+	directoryURI, err := url.Parse(cfg.DirectoryURI)
+	if err != nil {
+		return fmt.Errorf("invalid directory URI: %w", err)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("invalid URI %q: %w", uri, err)
+	}
+
+	if u.Scheme != directoryURI.Scheme {
+		return fmt.Errorf("URI %q does not use the scheme of the directory",
+			uri)
+	}
+
+	host := uriHostPort(u)
+	if strings.EqualFold(host, uriHostPort(directoryURI)) {
+		return nil
+	}
+
+	for _, allowedHost := range cfg.AllowedResourceHosts {
+		if strings.EqualFold(u.Hostname(), allowedHost) ||
+			strings.EqualFold(host, allowedHost) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("URI %q does not refer to the host of the directory",
+		uri)
+}
+
+func uriHostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// responseLocation returns the value of the Location header field of a
+// response, or an empty string if there is none. Relative references, sent by
+// some non-conforming servers, are resolved against the URI of the request.
+func responseLocation(res *http.Response) (string, error) {
+	uri, err := res.Location()
+	if err != nil {
+		if errors.Is(err, http.ErrNoLocation) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("invalid Location header field: %w", err)
+	}
+
+	return uri.String(), nil
+}
+
+// Response bodies are read through a size limited reader so that a
+// misbehaving server cannot make us allocate an arbitrary amount of memory.
+// Contrary to io.LimitedReader, reaching the limit is an error.
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func newSizeLimitedReader(r io.Reader, limit int64) *sizeLimitedReader {
+	return &sizeLimitedReader{r: r, remaining: limit}
+}
+
+func (r *sizeLimitedReader) Read(data []byte) (int, error) {
+	if r.remaining <= 0 {
+		var buf [1]byte
+		if n, err := r.r.Read(buf[:]); n == 0 {
+			return 0, err
+		}
+
+		return 0, ErrResponseTooLarge
+	}
+
+	if int64(len(data)) > r.remaining {
+		data = data[:r.remaining]
+	}
+
+	n, err := r.r.Read(data)
+	r.remaining -= int64(n)
+
+	return n, err
+}
+
 func (c *Client) fetchNonce(ctx context.Context) (string, error) {
-	res, err := c.sendRequestWithNonce(ctx, "HEAD", c.Directory.NewNonce,
-		nil, nil, "")
+	newNonceEndpoint := func(d *Directory) string { return d.NewNonce }
+
+	uri := newNonceEndpoint(c.Directory())
+
+	res, err := c.sendRequestWithNonce(ctx, "HEAD", uri, nil, nil, "", 0)
+	if isNotFoundResponse(res, err) {
+		newURI := c.reloadDirectoryEndpoint(ctx, uri, newNonceEndpoint)
+		if newURI != "" {
+			res, err = c.sendRequestWithNonce(ctx, "HEAD", newURI, nil, nil,
+				"", 0)
+		}
+	}
 	if err != nil {
 		return "", fmt.Errorf("cannot send request: %w", err)
 	}
@@ -0,0 +1,503 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendRequestBadNonce(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ctx := context.Background()
+
+		// Requests are retried when the nonce is rejected.
+		s.mutex.Lock()
+		s.BadNonces = 2
+		s.mutex.Unlock()
+
+		_, err := c.Account(ctx)
+		require.NoError(err)
+
+		// But not forever.
+		s.mutex.Lock()
+		s.BadNonces = 3
+		s.mutex.Unlock()
+
+		_, err = c.Account(ctx)
+		require.Error(err)
+
+		var details *ProblemDetails
+		require.True(errors.As(err, &details))
+		assert.Equal(ErrorTypeBadNonce, details.Type)
+
+		c.noncesMutex.Lock()
+		metrics := c.nonceMetrics
+		c.noncesMutex.Unlock()
+
+		assert.Equal(uint64(5), metrics.rejected)
+		assert.GreaterOrEqual(metrics.consumed, uint64(6))
+	})
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := io.ReadAll(newSizeLimitedReader(strings.NewReader("abc"), 3))
+	assert.NoError(err)
+	assert.Equal("abc", string(data))
+
+	_, err = io.ReadAll(newSizeLimitedReader(strings.NewReader("abcd"), 3))
+	assert.ErrorIs(err, ErrResponseTooLarge)
+}
+
+func TestSendRequestMaxResponseSize(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	setup := func(cfg *ClientCfg) {
+		// Enough for JSON responses but not for certificate chains
+		cfg.MaxResponseSize = 1024
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		assert.ErrorIs(ev.Error, ErrResponseTooLarge)
+	})
+}
+
+func TestRequestHook(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	var infos []RequestInfo
+	var infosMutex sync.Mutex
+
+	setup := func(cfg *ClientCfg) {
+		cfg.RequestHook = func(info *RequestInfo) {
+			infosMutex.Lock()
+			infos = append(infos, *info)
+			infosMutex.Unlock()
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		s.mutex.Lock()
+		s.BadNonces = 1
+		s.mutex.Unlock()
+
+		infosMutex.Lock()
+		infos = nil
+		infosMutex.Unlock()
+
+		_, err := c.Account(context.Background())
+		require.NoError(err)
+
+		infosMutex.Lock()
+		defer infosMutex.Unlock()
+
+		require.Len(infos, 2)
+
+		assert.Equal(0, infos[0].Attempt)
+		assert.Equal(http.StatusBadRequest, infos[0].StatusCode)
+		assert.Error(infos[0].Error)
+
+		assert.Equal(1, infos[1].Attempt)
+		assert.Equal(http.StatusOK, infos[1].StatusCode)
+		assert.NoError(infos[1].Error)
+		assert.Equal("POST", infos[1].Method)
+		assert.True(infos[1].ConnectionReused)
+		assert.Greater(infos[1].FirstByteDuration, time.Duration(0))
+		assert.GreaterOrEqual(infos[1].Duration, infos[1].FirstByteDuration)
+	})
+}
+
+func TestRequestHeader(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	setup := func(cfg *ClientCfg) {
+		cfg.ApplicationUserAgent = "test/1.0"
+		cfg.RequestHeader = http.Header{"x-proxy-id": {"foo"}}
+		cfg.RequestDecorator = func(req *http.Request) {
+			req.Header.Set("X-Request-URI", req.URL.Path)
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		_, err := c.Account(context.Background())
+		require.NoError(err)
+
+		s.mutex.Lock()
+		header := s.LastRequestHeader
+		s.mutex.Unlock()
+
+		assert.Equal(DefaultUserAgent+" test/1.0", header.Get("User-Agent"))
+		assert.Equal("foo", header.Get("X-Proxy-Id"))
+		assert.Equal("/account/1", header.Get("X-Request-URI"))
+	})
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	_, err = NewClient(ClientCfg{
+		DataStore:     dataStore,
+		RequestHeader: http.Header{"User-Agent": {"foo"}},
+	})
+	assert.Error(err)
+}
+
+func TestProblemDetailsSubproblems(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	data := `{
+  "type": "urn:ietf:params:acme:error:malformed",
+  "detail": "Some of the identifiers requested were rejected",
+  "subproblems": [
+    {
+      "type": "urn:ietf:params:acme:error:malformed",
+      "detail": "Invalid underscore in DNS name \"_example.org\"",
+      "identifier": {"type": "dns", "value": "_example.org"}
+    },
+    {
+      "type": "urn:ietf:params:acme:error:rejectedIdentifier",
+      "detail": "This CA will not issue for \"example.net\"",
+      "identifier": {"type": "dns", "value": "example.net"}
+    }
+  ]
+}`
+
+	var details ProblemDetails
+	require.NoError(json.Unmarshal([]byte(data), &details))
+
+	assert.Equal([]Identifier{
+		DNSIdentifier("_example.org"),
+		DNSIdentifier("example.net"),
+	}, details.FailedIdentifiers())
+
+	assert.Contains(details.Error(),
+		"dns:example.net: "+string(ErrorTypeRejectedIdentifier))
+}
+
+func TestProblemDetailsSerialization(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	data := `{"detail":"too many orders","retryAfter":"2025-01-01T00:00:00Z","status":429,"type":"urn:ietf:params:acme:error:rateLimited"}`
+
+	var details ProblemDetails
+	require.NoError(json.Unmarshal([]byte(data), &details))
+
+	assert.Equal("rateLimited", details.Code())
+	assert.Equal(map[string]json.RawMessage{
+		"retryAfter": json.RawMessage(`"2025-01-01T00:00:00Z"`),
+	}, details.Extensions)
+
+	data2, err := json.Marshal(&details)
+	require.NoError(err)
+	assert.JSONEq(data, string(data2))
+
+	text, err := details.MarshalText()
+	require.NoError(err)
+
+	var details2 ProblemDetails
+	require.NoError(details2.UnmarshalText(text))
+	assert.Equal(details, details2)
+
+	err = fmt.Errorf("cannot submit order: %w", &details)
+	assert.Equal("rateLimited", ErrorCode(err))
+	assert.Equal(&details, ProblemDetailsFromError(err))
+	assert.Equal("", ErrorCode(errors.New("test")))
+
+	assert.Equal("about:blank", (&ProblemDetails{}).Code())
+}
+
+func TestNewHTTPClientWithCfg(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(req.Proto))
+		}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(server.Certificate())
+
+	protocol := func(cfg HTTPClientCfg) string {
+		cfg.CACertPool = caCertPool
+
+		client := NewHTTPClientWithCfg(cfg)
+		defer client.CloseIdleConnections()
+
+		res, err := client.Get(server.URL)
+		require.NoError(err)
+		defer res.Body.Close()
+
+		data, err := io.ReadAll(res.Body)
+		require.NoError(err)
+
+		return string(data)
+	}
+
+	assert.Equal("HTTP/1.1", protocol(HTTPClientCfg{}))
+	assert.Equal("HTTP/2.0", protocol(HTTPClientCfg{
+		EnableHTTP2:         true,
+		MaxIdleConnsPerHost: 20,
+		TLSSessionCacheSize: 64,
+	}))
+}
+
+func TestHTTPClientPinning(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	cert := server.Certificate()
+
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(cert)
+
+	proxy := newTestConnectProxy(t)
+	defer proxy.Close()
+
+	proxyURI, err := url.Parse(proxy.URL)
+	require.NoError(err)
+
+	get := func(cfg HTTPClientCfg, useProxy bool) error {
+		require.NoError(cfg.Validate())
+
+		cfg.CACertPool = caCertPool
+
+		client := NewHTTPClientWithCfg(cfg)
+		defer client.CloseIdleConnections()
+
+		if useProxy {
+			transport := client.Transport.(*http.Transport)
+			transport.Proxy = http.ProxyURL(proxyURI)
+		}
+
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		return nil
+	}
+
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	for _, useProxy := range []bool{false, true} {
+		assert.NoError(get(HTTPClientCfg{
+			PinnedPublicKeys: []string{otherPin, PublicKeyPin(cert)},
+		}, useProxy))
+		assert.NoError(get(HTTPClientCfg{
+			PinnedCertificates: []string{CertificatePin(cert)},
+		}, useProxy))
+		assert.Error(get(HTTPClientCfg{
+			PinnedPublicKeys: []string{otherPin},
+		}, useProxy))
+		assert.Error(get(HTTPClientCfg{MinTLSVersion: tls.VersionTLS13},
+			useProxy))
+	}
+
+	assert.Equal(4, proxy.nbConnections())
+
+	cfg := HTTPClientCfg{PinnedPublicKeys: []string{"foo"}}
+	assert.Error(cfg.Validate())
+}
+
+func TestResolveResourceURIs(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	data := `{
+  "status": "pending",
+  "authorizations": ["/authz/1", "https://acme.example.com/authz/2"],
+  "finalize": "finalize/1"
+}`
+
+	var order Order
+	require.NoError(json.Unmarshal([]byte(data), &order))
+
+	base, err := url.Parse("https://acme.example.com/order/1")
+	require.NoError(err)
+
+	require.NoError(order.resolveURIs(base))
+
+	assert.Equal([]string{
+		"https://acme.example.com/authz/1",
+		"https://acme.example.com/authz/2",
+	}, order.Authorizations)
+	assert.Equal("https://acme.example.com/order/finalize/1", order.Finalize)
+	assert.Nil(order.Certificate)
+}
+
+func TestCheckResourceURI(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	c, err := NewClient(ClientCfg{
+		DataStore:            dataStore,
+		DirectoryURI:         "https://acme.example.com/directory",
+		AllowedResourceHosts: []string{"certs.example.com"},
+	})
+	require.NoError(err)
+
+	assert.NoError(c.checkResourceURI("https://acme.example.com/order/1"))
+	assert.NoError(c.checkResourceURI("https://ACME.example.com:443/order/1"))
+	assert.NoError(c.checkResourceURI("https://certs.example.com/cert/1"))
+
+	assert.Error(c.checkResourceURI("http://acme.example.com/order/1"))
+	assert.Error(c.checkResourceURI("https://acme.example.com:8443/order/1"))
+	assert.Error(c.checkResourceURI("https://169.254.169.254/latest"))
+}
+
+type testConnectProxy struct {
+	*httptest.Server
+
+	connections      int
+	connectionsMutex sync.Mutex
+}
+
+// newTestConnectProxy starts an HTTP proxy only supporting CONNECT requests.
+func newTestConnectProxy(t *testing.T) *testConnectProxy {
+	var p testConnectProxy
+
+	p.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodConnect {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			p.connectionsMutex.Lock()
+			p.connections++
+			p.connectionsMutex.Unlock()
+
+			conn, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer conn.Close()
+
+			clientConn, buf, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Errorf("cannot hijack connection: %v", err)
+				return
+			}
+			defer clientConn.Close()
+
+			clientConn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+
+			go io.Copy(conn, buf)
+			io.Copy(clientConn, conn)
+		}))
+
+	return &p
+}
+
+func (p *testConnectProxy) nbConnections() int {
+	p.connectionsMutex.Lock()
+	defer p.connectionsMutex.Unlock()
+
+	return p.connections
+}
+
+func TestSendRequestRedirect(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	var nbInternalRequests atomic.Int32
+
+	internalServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			nbInternalRequests.Add(1)
+		}))
+	defer internalServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/directory":
+				http.Redirect(w, req, "/directory2", http.StatusFound)
+			case "/directory2":
+				w.Write([]byte(`{}`))
+			case "/internal":
+				http.Redirect(w, req, internalServer.URL, http.StatusFound)
+			}
+		}))
+	defer server.Close()
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	send := func(directoryURI string) error {
+		c, err := NewClient(ClientCfg{
+			DataStore:    dataStore,
+			DirectoryURI: directoryURI,
+		})
+		require.NoError(err)
+
+		var directory Directory
+		_, err = c.doSendRequest(context.Background(), "GET", directoryURI,
+			nil, &directory, "")
+		return err
+	}
+
+	assert.NoError(send(server.URL + "/directory"))
+
+	assert.Error(send(server.URL + "/internal"))
+	assert.Equal(int32(0), nbInternalRequests.Load())
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -27,6 +28,16 @@ type Authorization struct {
 	Wildcard   bool                `json:"wildcard,omitempty"`
 }
 
+func (a *Authorization) resolveURIs(base *url.URL) error {
+	for _, c := range a.Challenges {
+		if err := c.resolveURIs(base); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (a *Authorization) findChallenge(cType ChallengeType) *Challenge {
 	for _, c := range a.Challenges {
 		if c.Type == cType {
@@ -49,16 +60,22 @@ func (c *Client) fetchAuthorization(ctx context.Context, uri string) (*Authoriza
 }
 
 func (c *Client) selectAuthorizationChallenge(auth *Authorization) *Challenge {
-	if c.httpChallengeSolver != nil {
+	if c.httpChallengeSolver != nil && !c.Config().DNSOnly {
 		if ch := auth.findChallenge(ChallengeTypeHTTP01); ch != nil {
 			return ch
 		}
 	}
 
-	return auth.findChallenge(ChallengeTypeDNS01)
+	if c.dnsSolver() != nil {
+		if ch := auth.findChallenge(ChallengeTypeDNS01); ch != nil {
+			return ch
+		}
+	}
+
+	return nil
 }
 
-func (c *Client) waitForAuthorizationValid(ctx context.Context, uri string) error {
+func (c *Client) waitForAuthorizationValid(ctx context.Context, uri string, expires time.Time) error {
 	for {
 		auth, res, err := c.fetchAuthorization(ctx, uri)
 		if err != nil {
@@ -89,7 +106,7 @@ func (c *Client) waitForAuthorizationValid(ctx context.Context, uri string) erro
 			return fmt.Errorf("unknown authorization status %q", auth.Status)
 		}
 
-		if err := c.waitForVerification(ctx, delay); err != nil {
+		if err := c.waitForVerification(ctx, delay, expires); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,81 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// AutocertManager exposes a client with the same interface as
+// golang.org/x/crypto/acme/autocert.Manager to simplify migration.
+//
+// Certificates are either requested explicitly with Client.RequestCertificate
+// or obtained on demand if the OnDemand client setting is set. To answer HTTP
+// challenges with HTTPHandler, the client must have been configured with an
+// HTTP challenge solver, usually with the NoServer setting.
+type AutocertManager struct {
+	Client *Client
+
+	getCertificate GetTLSCertificateFunc
+}
+
+func NewAutocertManager(client *Client) *AutocertManager {
+	m := AutocertManager{
+		Client: client,
+
+		getCertificate: client.GetAnyTLSCertificateFunc(),
+	}
+
+	return &m
+}
+
+func (m *AutocertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.getCertificate(hello)
+}
+
+func (m *AutocertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	if solver := m.Client.httpChallengeSolver; solver != nil {
+		return solver.Handler(fallback)
+	}
+
+	if fallback == nil {
+		fallback = http.HandlerFunc(redirectToHTTPS)
+	}
+
+	return fallback
+}
+
+func (m *AutocertManager) TLSConfig() *tls.Config {
+	cfg := m.Client.TLSConfig()
+	cfg.GetCertificate = m.GetCertificate
+
+	return cfg
+}
+
+// Listener returns a listener on port 443 using the manager for TLS
+// certificates. As for autocert.Manager, listening errors are reported when
+// accepting connections.
+func (m *AutocertManager) Listener() net.Listener {
+	listener, err := net.Listen("tcp", ":443")
+	if err != nil {
+		return &errorListener{err: err}
+	}
+
+	return tls.NewListener(listener, m.TLSConfig())
+}
+
+type errorListener struct {
+	err error
+}
+
+func (l *errorListener) Accept() (net.Conn, error) {
+	return nil, l.err
+}
+
+func (l *errorListener) Close() error {
+	return nil
+}
+
+func (l *errorListener) Addr() net.Addr {
+	return &net.TCPAddr{Port: 443}
+}
@@ -0,0 +1,98 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutocertManagerHTTPHandler(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	sendRequest := func(h http.Handler, method, uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, nil)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without HTTP challenge solver
+	c, err := NewClient(ClientCfg{DataStore: dataStore})
+	require.NoError(err)
+
+	m := NewAutocertManager(c)
+
+	w := sendRequest(m.HTTPHandler(nil), "GET", "http://example.com/foo")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://example.com/foo", w.Header().Get("Location"))
+
+	// With HTTP challenge solver
+	c, err = NewClient(ClientCfg{
+		DataStore:           dataStore,
+		HTTPChallengeSolver: &HTTPChallengeSolverCfg{NoServer: true},
+	})
+	require.NoError(err)
+
+	require.NoError(c.httpChallengeSolver.addToken("abc", time.Time{}))
+
+	m = NewAutocertManager(c)
+	h := m.HTTPHandler(nil)
+
+	w = sendRequest(h, "GET", "http://example.com/.well-known/acme-challenge/abc")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.True(strings.HasPrefix(w.Body.String(), "abc."))
+
+	w = sendRequest(h, "GET", "http://example.com/.well-known/acme-challenge/def")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = sendRequest(h, "GET", "http://example.com/foo")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://example.com/foo", w.Header().Get("Location"))
+
+	// Other requests are passed to the fallback handler
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	h = m.HTTPHandler(fallback)
+
+	w = sendRequest(h, "GET", "http://example.com/foo")
+	assert.Equal(http.StatusTeapot, w.Code)
+
+	w = sendRequest(h, "GET", "http://example.com/.well-known/acme-challenge/abc")
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	assert := assert.New(t)
+
+	sendRequest := func(method, uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, nil)
+
+		w := httptest.NewRecorder()
+		redirectToHTTPS(w, req)
+		return w
+	}
+
+	w := sendRequest("GET", "http://example.com:8080/a/b?c=d")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://example.com/a/b?c=d", w.Header().Get("Location"))
+
+	w = sendRequest("HEAD", "http://[::1]:80/")
+	assert.Equal(http.StatusFound, w.Code)
+	assert.Equal("https://[::1]/", w.Header().Get("Location"))
+
+	w = sendRequest("POST", "http://example.com/form")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Empty(w.Header().Get("Location"))
+}
@@ -0,0 +1,199 @@
+package acme
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Certificate bundles let an instance hand a certificate over to another one,
+// e.g. during a blue/green deployment where the new instance takes over
+// renewals. A bundle contains the certificate data (private key, chain and
+// metadata) encrypted with AES-256-GCM in a JWE object (RFC 7516) using a
+// key shared by both instances. Authenticated encryption guarantees that
+// bundles were produced by an instance knowing the key and have not been
+// modified.
+
+const CertificateBundleKeySize = 32
+
+var ErrCertificateBundleOutdated = errors.New("certificate bundle older " +
+	"than the stored certificate")
+
+var ErrCertificateBundleManaged = errors.New("certificate bundle for a " +
+	"certificate managed by the client")
+
+type certificateBundle struct {
+	ExportedAt      time.Time        `json:"exported_at"`
+	CertificateData *CertificateData `json:"certificate_data"`
+}
+
+// GenerateCertificateBundleKey returns a new random key for certificate
+// bundles, base64url-encoded.
+func GenerateCertificateBundleKey() (string, error) {
+	key := make([]byte, CertificateBundleKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("cannot generate random data: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// DecodeCertificateBundleKey decodes a base64url-encoded key for certificate
+// bundles.
+func DecodeCertificateBundleKey(s string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url data: %w", err)
+	}
+
+	if len(key) != CertificateBundleKeySize {
+		return nil, fmt.Errorf("invalid key size %d (must be %d bytes)",
+			len(key), CertificateBundleKeySize)
+	}
+
+	return key, nil
+}
+
+func EncodeCertificateBundle(certData *CertificateData, key []byte) ([]byte, error) {
+	if !certData.ContainsCertificate() {
+		return nil, fmt.Errorf("no certificate available for %q",
+			certData.Name)
+	}
+
+	bundle := certificateBundle{
+		ExportedAt:      time.Now().UTC(),
+		CertificateData: certData,
+	}
+
+	payload, err := json.Marshal(&bundle)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode bundle: %w", err)
+	}
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM,
+		jose.Recipient{Algorithm: jose.DIRECT, Key: key}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create encrypter: %w", err)
+	}
+
+	obj, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt bundle: %w", err)
+	}
+
+	data, err := obj.CompactSerialize()
+	if err != nil {
+		return nil, fmt.Errorf("cannot serialize bundle: %w", err)
+	}
+
+	return []byte(data), nil
+}
+
+func DecodeCertificateBundle(data, key []byte) (*CertificateData, error) {
+	obj, err := jose.ParseEncryptedCompact(strings.TrimSpace(string(data)),
+		[]jose.KeyAlgorithm{jose.DIRECT},
+		[]jose.ContentEncryption{jose.A256GCM})
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse bundle: %w", err)
+	}
+
+	payload, err := obj.Decrypt(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt bundle: %w", err)
+	}
+
+	var bundle certificateBundle
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		return nil, fmt.Errorf("cannot decode bundle: %w", err)
+	}
+
+	certData := bundle.CertificateData
+	if certData == nil || !certData.ContainsCertificate() {
+		return nil, fmt.Errorf("bundle does not contain any certificate")
+	}
+
+	if err := certData.Verify(); err != nil {
+		return nil, err
+	}
+
+	certData.updateCertificateIdentifiers()
+
+	return certData, nil
+}
+
+// ExportCertificateBundle encodes the certificate stored under a name in a
+// bundle which can be imported by another instance with
+// ImportCertificateBundle.
+func (c *Client) ExportCertificateBundle(name string, key []byte) ([]byte, error) {
+	certData, err := c.dataStore.LoadCertificateData(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load certificate %q: %w", name, err)
+	}
+
+	return EncodeCertificateBundle(certData, key)
+}
+
+// ImportCertificateBundle decodes a bundle, stores the certificate it
+// contains in the data store (atomically for the file system data store) and
+// makes it available to TLS servers using the client. If a certificate
+// requested later has the same name, identifiers and validity, it is renewed
+// by the client when it should be instead of being ordered again.
+//
+// Bundles containing a certificate older than the one already stored under
+// the same name are rejected with ErrCertificateBundleOutdated, so that a
+// stale bundle cannot undo a renewal. Bundles for a certificate currently
+// managed by a worker of the client are rejected with
+// ErrCertificateBundleManaged: the worker would not use the imported
+// certificate and could replace it at any time.
+//
+// Other processes using the same data store are not coordinated with: a
+// renewed certificate they store during the import can be replaced by the
+// bundle.
+func (c *Client) ImportCertificateBundle(data, key []byte) (*CertificateData, error) {
+	certData, err := DecodeCertificateBundle(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	name := certData.Name
+
+	// Workers cannot be started while the mutex is locked, and imports are
+	// serialized, so the comparison with the stored certificate cannot be
+	// invalidated before the bundle is stored.
+	c.workersMutex.Lock()
+	defer c.workersMutex.Unlock()
+
+	if c.findWorker(name) != nil {
+		return nil, fmt.Errorf("%w: %q", ErrCertificateBundleManaged, name)
+	}
+
+	currentData, err := c.dataStore.LoadCertificateData(name)
+	if err != nil && !errors.Is(err, ErrCertificateNotFound) {
+		return nil, fmt.Errorf("cannot load certificate %q: %w", name, err)
+	}
+
+	if currentData != nil && currentData.ContainsCertificate() {
+		notBefore := certData.LeafCertificate().NotBefore
+		currentNotBefore := currentData.LeafCertificate().NotBefore
+
+		if notBefore.Before(currentNotBefore) {
+			return nil, ErrCertificateBundleOutdated
+		}
+	}
+
+	if err := c.dataStore.StoreCertificateData(certData); err != nil {
+		return nil, fmt.Errorf("cannot store certificate %q: %w", name, err)
+	}
+
+	c.Log.Info("certificate %q imported from bundle", name)
+
+	c.storeCertificate(certData)
+
+	return certData, nil
+}
@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateBundle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	keyString, err := GenerateCertificateBundleKey()
+	require.NoError(err)
+
+	key, err := DecodeCertificateBundleKey(keyString)
+	require.NoError(err)
+
+	_, err = DecodeCertificateBundleKey("Zm9v")
+	assert.Error(err)
+
+	// Export from the first instance
+	dataStore1, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	certData := testCertificateData(t)
+	certData.Identifiers = []Identifier{DNSIdentifier("example.com")}
+	require.NoError(dataStore1.StoreCertificateData(certData))
+
+	client1, err := NewOfflineClient(dataStore1)
+	require.NoError(err)
+	defer client1.Stop()
+
+	data, err := client1.ExportCertificateBundle("example", key)
+	require.NoError(err)
+
+	// Bundles cannot be read or modified without the key
+	otherKey := make([]byte, CertificateBundleKeySize)
+
+	_, err = DecodeCertificateBundle(data, otherKey)
+	assert.Error(err)
+
+	tamperedData := slices.Clone(data)
+	tamperedData[len(tamperedData)-30] ^= 0x01
+
+	_, err = DecodeCertificateBundle(tamperedData, key)
+	assert.Error(err)
+
+	// Import into the second instance
+	dataStore2, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	client2, err := NewOfflineClient(dataStore2)
+	require.NoError(err)
+	defer client2.Stop()
+
+	certData2, err := client2.ImportCertificateBundle(data, key)
+	require.NoError(err)
+	assert.Equal(certData.Checksum(), certData2.Checksum())
+	assert.Equal(certData.Identifiers, certData2.Identifiers)
+
+	storedData, err := dataStore2.LoadCertificateData("example")
+	require.NoError(err)
+	assert.Equal(certData.Checksum(), storedData.Checksum())
+
+	getCertificate := client2.GetTLSCertificateFunc("example")
+
+	cert, err := getCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(err)
+	assert.Equal(certData.LeafCertificate().Raw, cert.Leaf.Raw)
+
+	// Importing the same bundle again is harmless
+	_, err = client2.ImportCertificateBundle(data, key)
+	assert.NoError(err)
+}
+
+func TestCertificateBundleManagedCertificate(t *testing.T) {
+	require := require.New(t)
+
+	key := make([]byte, CertificateBundleKeySize)
+
+	certData := testCertificateData(t)
+	certData.Name = "test"
+
+	data, err := EncodeCertificateBundle(certData, key)
+	require.NoError(err)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+
+		_, err = c.ImportCertificateBundle(data, key)
+		require.ErrorIs(err, ErrCertificateBundleManaged)
+	})
+}
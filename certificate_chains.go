@@ -0,0 +1,127 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CertificateChains downloads the chain of the last certificate obtained for
+// a certificate and the alternate chains offered by the server. The first
+// chain is the default one.
+func (c *Client) CertificateChains(ctx context.Context, name string) ([][]*x509.Certificate, error) {
+	certData, err := c.dataStore.LoadCertificateData(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load certificate: %w", err)
+	}
+
+	if certData.CertificateURI == "" {
+		return nil, fmt.Errorf("unknown certificate URI")
+	}
+
+	chain, alternateURIs, err := c.downloadCertificate(ctx,
+		certData.CertificateURI)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download certificate: %w", err)
+	}
+
+	chains := [][]*x509.Certificate{chain}
+
+	for _, uri := range alternateURIs {
+		chain, _, err := c.downloadCertificate(ctx, uri)
+		if err != nil {
+			return nil, fmt.Errorf("cannot download alternate chain %q: %w",
+				uri, err)
+		}
+
+		chains = append(chains, chain)
+	}
+
+	return chains, nil
+}
+
+// ChainIssuer returns the common name of the issuer of the topmost
+// certificate of a chain, i.e. usually the name of the root certificate.
+func ChainIssuer(chain []*x509.Certificate) string {
+	if len(chain) == 0 {
+		return ""
+	}
+
+	return chain[len(chain)-1].Issuer.CommonName
+}
+
+func (w *CertificateWorker) selectChain(ctx context.Context, chain []*x509.Certificate, alternateURIs []string, preferredChain string) []*x509.Certificate {
+	if ChainIssuer(chain) == preferredChain {
+		return chain
+	}
+
+	for _, uri := range alternateURIs {
+		alternateChain, _, err := w.Client.downloadCertificate(ctx, uri)
+		if err != nil {
+			w.Log.Error("cannot download alternate chain %q: %v", uri, err)
+			continue
+		}
+
+		if ChainIssuer(alternateChain) == preferredChain {
+			w.Log.Debug(1, "using alternate chain %q", uri)
+			return alternateChain
+		}
+	}
+
+	w.Log.Info("no chain issued by %q, using default chain", preferredChain)
+
+	return chain
+}
+
+func alternateLinks(header http.Header, baseURI string) []string {
+	return headerLinks(header, "alternate", baseURI)
+}
+
+func headerLinks(header http.Header, rel, baseURI string) []string {
+	// RFC 8288 3. Link Serialisation in HTTP Headers. We only support what
+	// ACME servers actually send, e.g. `<uri>;rel="alternate"`.
+
+	base, err := url.Parse(baseURI)
+	if err != nil {
+		return nil
+	}
+
+	var uris []string
+
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = target[1 : len(target)-1]
+
+			matches := false
+			for _, param := range parts[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "rel") &&
+					strings.Trim(value, `"`) == rel {
+					matches = true
+				}
+			}
+
+			if !matches {
+				continue
+			}
+
+			uri, err := base.Parse(target)
+			if err != nil {
+				continue
+			}
+
+			uris = append(uris, uri.String())
+		}
+	}
+
+	return uris
+}
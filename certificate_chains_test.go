@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlternateLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	header := make(http.Header)
+	header.Add("Link", `<https://example.com/directory>;rel="index"`)
+	header.Add("Link", `<https://example.com/cert/1/1>;rel="alternate"`)
+	header.Add("Link", `</cert/1/2>; rel=alternate, <https://example.com/x>;rel="up"`)
+
+	assert.Equal([]string{
+		"https://example.com/cert/1/1",
+		"https://example.com/cert/1/2",
+	}, alternateLinks(header, "https://example.com/cert/1"))
+
+	assert.Empty(alternateLinks(make(http.Header), "https://example.com"))
+}
+
+func TestDERCertificateChain(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.DERCertificates = true
+
+	withFakeTestClient(t, s, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		chain := ev.CertificateData.Certificate
+		require.Len(chain, 2)
+		assert.Equal([]string{"example.com"}, chain[0].DNSNames)
+		assert.Equal("fake ACME root", chain[1].Subject.CommonName)
+
+		assert.Equal(1, s.Requests("issuer"))
+	})
+}
@@ -3,26 +3,55 @@ package acme
 import (
 	"bytes"
 	"crypto"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"slices"
-	"strconv"
-	"strings"
 	"time"
 )
 
+// CertificateData contains a certificate chain, its private key and the
+// information required to renew it.
+//
+// PrivateKey and Certificate are the only in-memory representation of the
+// key and chain. PrivateKeyData and CertificateData are only used for
+// serialization: they are filled by MarshalJSON in the encoded value and
+// cleared by UnmarshalJSON once decoded so that we do not keep two copies of
+// each certificate in memory. They are always empty in values obtained from
+// the client; use EncodePEMPrivateKey and EncodePEMCertificateChain to obtain
+// PEM data.
 type CertificateData struct {
 	Name string `json:"name"`
 
-	Identifiers []Identifier `json:"identifiers"`
-	Validity    int          `json:"validity"` // days
+	CertificateRequest
 
 	PrivateKey      crypto.Signer       `json:"-"`
 	PrivateKeyData  []byte              `json:"private_key"`
 	Certificate     []*x509.Certificate `json:"-"`
 	CertificateData string              `json:"certificate"`
+	CertificateURI  string              `json:"certificate_uri,omitempty"`
+
+	// Derived from the leaf certificate when it is obtained or loaded. The
+	// serial number is hex-encoded; ARICertID is empty if the certificate
+	// does not have an authority key identifier.
+	SerialNumber string `json:"serial_number,omitempty"`
+	ARICertID    string `json:"ari_cert_id,omitempty"`
+
+	// The time the first certificate was obtained for this name, and the
+	// time and number of renewals since then. IssuedAt is not known for
+	// certificates obtained by older versions.
+	IssuedAt     time.Time `json:"issued_at"`
+	RenewedAt    time.Time `json:"renewed_at"`
+	RenewalCount int       `json:"renewal_count,omitempty"`
+
+	// Built once when the certificate is stored by the client so that TLS
+	// handshakes do not allocate anything.
+	tlsCertificate *tls.Certificate
+	checksum       string
 }
 
 func (c *CertificateData) LeafCertificate() *x509.Certificate {
@@ -33,31 +62,99 @@ func (c *CertificateData) LeafCertificate() *x509.Certificate {
 	return c.Certificate[0]
 }
 
+// ARICertID returns the identifier of a certificate used for ACME Renewal
+// Information (RFC 9773), e.g. in the replaces field of orders.
+func ARICertID(cert *x509.Certificate) (string, error) {
+	if len(cert.AuthorityKeyId) == 0 {
+		return "", fmt.Errorf("missing authority key identifier")
+	}
+
+	// The DER encoding of the serial number without tag and length, i.e.
+	// with a leading zero byte if the most significant bit is set.
+	serial := cert.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(cert.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial), nil
+}
+
+func (c *CertificateData) updateCertificateIdentifiers() {
+	c.SerialNumber = ""
+	c.ARICertID = ""
+
+	cert := c.LeafCertificate()
+	if cert == nil {
+		return
+	}
+
+	c.SerialNumber = cert.SerialNumber.Text(16)
+
+	if id, err := ARICertID(cert); err == nil {
+		c.ARICertID = id
+	}
+}
+
 func (c *CertificateData) ContainsCertificate() bool {
 	return c.PrivateKey != nil && len(c.Certificate) > 0
 }
 
-func (c *CertificateData) LeafCertificateFingerprint(hash crypto.Hash) string {
-	cert := c.LeafCertificate()
+type FingerprintFormat struct {
+	Hash        crypto.Hash // SHA-256 if not set
+	Lowercase   bool
+	NoSeparator bool
+}
+
+func FormatFingerprint(data []byte, format FingerprintFormat) string {
+	hash := format.Hash
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
 
 	h := hash.New()
-	h.Write(cert.Raw)
+	h.Write(data)
 	checksum := h.Sum(nil)
 
+	digits := "0123456789ABCDEF"
+	if format.Lowercase {
+		digits = "0123456789abcdef"
+	}
+
 	var buf bytes.Buffer
 	for i, b := range checksum {
-		if i > 0 {
+		if i > 0 && !format.NoSeparator {
 			buf.WriteByte(':')
 		}
 
-		s := strconv.FormatInt(int64(b), 16)
-		buf.WriteString(strings.ToUpper(s))
+		buf.WriteByte(digits[b>>4])
+		buf.WriteByte(digits[b&0x0f])
 	}
 
 	return buf.String()
 }
 
+func (c *CertificateData) FormatLeafCertificateFingerprint(format FingerprintFormat) string {
+	return FormatFingerprint(c.LeafCertificate().Raw, format)
+}
+
+// Kept for compatibility, prefer FormatLeafCertificateFingerprint.
+func (c *CertificateData) LeafCertificateFingerprint(hash crypto.Hash) string {
+	return c.FormatLeafCertificateFingerprint(FingerprintFormat{Hash: hash})
+}
+
+// TLSCertificate returns the certificate chain and private key in the format
+// used by crypto/tls. For certificates obtained through the client, the value
+// is shared by all callers and must not be modified.
 func (c *CertificateData) TLSCertificate() *tls.Certificate {
+	if c.tlsCertificate != nil {
+		return c.tlsCertificate
+	}
+
+	return c.newTLSCertificate()
+}
+
+func (c *CertificateData) newTLSCertificate() *tls.Certificate {
 	certsData := make([][]byte, len(c.Certificate))
 	for i, cert := range c.Certificate {
 		certsData[i] = cert.Raw
@@ -72,6 +169,42 @@ func (c *CertificateData) TLSCertificate() *tls.Certificate {
 	return &cert
 }
 
+// Checksum returns a hex-encoded SHA-256 digest of the certificate chain and
+// private key. It does not depend on the way the certificate is stored, so
+// two certificate data values have the same checksum if and only if
+// deploying one in place of the other changes nothing.
+func (c *CertificateData) Checksum() string {
+	if c.checksum != "" {
+		return c.checksum
+	}
+
+	return c.computeChecksum()
+}
+
+func (c *CertificateData) computeChecksum() string {
+	h := sha256.New()
+
+	// Each value is prefixed by its length so that different sequences of
+	// values cannot produce the same data.
+	write := func(data []byte) {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+		h.Write(data)
+	}
+
+	for _, cert := range c.Certificate {
+		write(cert.Raw)
+	}
+
+	// Encoding fails for unsupported key types, in which case the checksum
+	// only covers the certificate chain.
+	if c.PrivateKey != nil {
+		keyData, _ := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+		write(keyData)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (c *CertificateData) MarshalJSON() ([]byte, error) {
 	type CertificateData2 CertificateData
 	c2 := CertificateData2(*c)
@@ -91,6 +224,33 @@ func (c *CertificateData) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c2)
 }
 
+// Verify checks that the private key matches the leaf certificate and that
+// each certificate of the chain is signed by the next one.
+func (c *CertificateData) Verify() error {
+	if len(c.Certificate) == 0 {
+		return nil
+	}
+
+	if c.PrivateKey == nil {
+		return fmt.Errorf("%w: missing private key", ErrCorruptedCertificateData)
+	}
+
+	if err := checkPrivateKeyMatch(c.PrivateKey, c.Certificate[0]); err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptedCertificateData, err)
+	}
+
+	for i := 0; i < len(c.Certificate)-1; i++ {
+		cert, issuer := c.Certificate[i], c.Certificate[i+1]
+
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("%w: certificate %d of the chain is not signed "+
+				"by the next one: %w", ErrCorruptedCertificateData, i, err)
+		}
+	}
+
+	return nil
+}
+
 func (c *CertificateData) UnmarshalJSON(data []byte) error {
 	type CertificateData2 CertificateData
 
@@ -116,7 +276,19 @@ func (c *CertificateData) UnmarshalJSON(data []byte) error {
 	}
 	c2.Certificate = cert
 
+	// The parsed certificates reference their own DER data, the serialized
+	// form is not needed anymore.
+	c2.PrivateKeyData = nil
+	c2.CertificateData = ""
+
 	*c = CertificateData(c2)
+
+	// Certificate data stored by older versions does not contain these
+	// identifiers.
+	if c.SerialNumber == "" {
+		c.updateCertificateIdentifiers()
+	}
+
 	return nil
 }
 
@@ -134,11 +306,18 @@ func (c *CertificateData) extractCopy() *CertificateData {
 	c2 := CertificateData{
 		Name: c.Name,
 
-		Identifiers: slices.Clone(c.Identifiers),
-		Validity:    c.Validity,
+		CertificateRequest: c.CertificateRequest.Clone(),
 
-		PrivateKey:  c.PrivateKey,
-		Certificate: c.Certificate,
+		PrivateKey:     c.PrivateKey,
+		Certificate:    c.Certificate,
+		CertificateURI: c.CertificateURI,
+
+		SerialNumber: c.SerialNumber,
+		ARICertID:    c.ARICertID,
+
+		IssuedAt:     c.IssuedAt,
+		RenewedAt:    c.RenewedAt,
+		RenewalCount: c.RenewalCount,
 	}
 
 	c.Certificate = nil
@@ -151,9 +330,24 @@ func CertificateRenewalTime(data *CertificateData) time.Time {
 	cert := data.LeafCertificate()
 	expirationTime := cert.NotAfter
 
-	if data.Validity > 1 {
-		return expirationTime.AddDate(0, 0, max(data.Validity/2, 1))
-	} else {
-		return expirationTime.Add(-12 * time.Hour)
+	var renewalTime time.Time
+
+	switch {
+	case data.ValidityDuration > 0:
+		renewalTime = expirationTime.Add(-data.ValidityDuration / 2)
+	case data.Validity > 1:
+		renewalTime = expirationTime.AddDate(0, 0, -max(data.Validity/2, 1))
+	default:
+		renewalTime = expirationTime.Add(-12 * time.Hour)
+	}
+
+	// The server may have issued a certificate shorter than requested, e.g.
+	// when it ignores the validity period of orders. We never renew before
+	// the middle of the actual validity period.
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	if midTime := cert.NotBefore.Add(lifetime / 2); renewalTime.Before(midTime) {
+		renewalTime = midTime
 	}
+
+	return renewalTime
 }
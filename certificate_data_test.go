@@ -0,0 +1,196 @@
+package acme
+
+import (
+	"crypto"
+	_ "crypto/md5"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte("hello")
+
+	// Bytes lower than 0x10 (e.g. 0x0e and 0x04) must be zero-padded.
+	assert.Equal("2C:F2:4D:BA:5F:B0:A3:0E:26:E8:3B:2A:C5:B9:E2:9E:"+
+		"1B:16:1E:5C:1F:A7:42:5E:73:04:33:62:93:8B:98:24",
+		FormatFingerprint(data, FingerprintFormat{}))
+
+	assert.Equal("5D:41:40:2A:BC:4B:2A:76:B9:71:9D:91:10:17:C5:92",
+		FormatFingerprint(data, FingerprintFormat{Hash: crypto.MD5}))
+
+	assert.Equal("5d41402abc4b2a76b9719d911017c592",
+		FormatFingerprint(data, FingerprintFormat{
+			Hash:        crypto.MD5,
+			Lowercase:   true,
+			NoSeparator: true,
+		}))
+
+	assert.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		FormatFingerprint(data, FingerprintFormat{
+			Lowercase:   true,
+			NoSeparator: true,
+		}))
+}
+
+func TestCertificateRenewalTime(t *testing.T) {
+	assert := assert.New(t)
+
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	certData := func(validity int) *CertificateData {
+		cert := x509.Certificate{
+			NotBefore: notBefore,
+			NotAfter:  notBefore.AddDate(0, 0, validity),
+		}
+
+		return &CertificateData{
+			CertificateRequest: CertificateRequest{Validity: validity},
+			Certificate:        []*x509.Certificate{&cert},
+		}
+	}
+
+	assert.Equal(notBefore.AddDate(0, 0, 45),
+		CertificateRenewalTime(certData(90)))
+	assert.Equal(notBefore.AddDate(0, 0, 2),
+		CertificateRenewalTime(certData(3)))
+	assert.Equal(notBefore.Add(12*time.Hour),
+		CertificateRenewalTime(certData(1)))
+
+	hourCertData := certData(0)
+	hourCertData.ValidityDuration = 6 * time.Hour
+	hourCertData.Certificate[0].NotAfter = notBefore.Add(6 * time.Hour)
+	assert.Equal(notBefore.Add(3*time.Hour),
+		CertificateRenewalTime(hourCertData))
+
+	// Certificates shorter than requested are never renewed before the
+	// middle of their validity period.
+	shortCertData := certData(30)
+	shortCertData.Certificate[0].NotAfter = notBefore.Add(24 * time.Hour)
+	assert.Equal(notBefore.Add(12*time.Hour),
+		CertificateRenewalTime(shortCertData))
+}
+
+func TestARICertID(t *testing.T) {
+	assert := assert.New(t)
+
+	// RFC 9773 example
+	cert := x509.Certificate{
+		AuthorityKeyId: []byte{
+			0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3,
+			0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4,
+		},
+		SerialNumber: big.NewInt(0x87654321),
+	}
+
+	id, err := ARICertID(&cert)
+	assert.NoError(err)
+	assert.Equal("aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", id)
+
+	cert.AuthorityKeyId = nil
+	_, err = ARICertID(&cert)
+	assert.Error(err)
+}
+
+func TestCertificateDataSerialNumber(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	certData := testCertificateData(t)
+
+	data, err := json.Marshal(certData)
+	require.NoError(err)
+
+	var certData2 CertificateData
+	require.NoError(json.Unmarshal(data, &certData2))
+
+	assert.Equal(certData.LeafCertificate().SerialNumber.Text(16),
+		certData2.SerialNumber)
+}
+
+func TestCertificateDataSerialization(t *testing.T) {
+	type CertificateData2 struct {
+		PrivateKeyData  []byte `json:"private_key"`
+		CertificateData string `json:"certificate"`
+	}
+
+	require := require.New(t)
+	assert := assert.New(t)
+
+	certData := testCertificateData(t)
+
+	data, err := json.Marshal(certData)
+	require.NoError(err)
+
+	var certData2 CertificateData
+	require.NoError(json.Unmarshal(data, &certData2))
+
+	// The serialized form must not be kept once decoded
+	assert.Empty(certData2.PrivateKeyData)
+	assert.Empty(certData2.CertificateData)
+
+	require.Len(certData2.Certificate, 1)
+	assert.Equal(certData.LeafCertificate().Raw,
+		certData2.LeafCertificate().Raw)
+	assert.NoError(certData2.Verify())
+
+	// PEM data must still be available through accessors
+	keyData, err := certData2.EncodePEMPrivateKey()
+	require.NoError(err)
+	privateKey, err := DecodePEMPrivateKey(keyData)
+	require.NoError(err)
+	assert.True(privateKey.(interface{ Equal(crypto.PrivateKey) bool }).
+		Equal(certData.PrivateKey))
+
+	chainData, err := certData2.EncodePEMCertificateChain()
+	require.NoError(err)
+	chain, err := decodePEMCertificateChain([]byte(chainData))
+	require.NoError(err)
+	require.Len(chain, 1)
+	assert.Equal(certData.LeafCertificate().Raw, chain[0].Raw)
+
+	// Encoding again must produce the same PEM data
+	data2, err := json.Marshal(&certData2)
+	require.NoError(err)
+
+	var certData3 CertificateData2
+	require.NoError(json.Unmarshal(data2, &certData3))
+
+	var certData4 CertificateData2
+	require.NoError(json.Unmarshal(data, &certData4))
+
+	assert.Equal(certData4.CertificateData, certData3.CertificateData)
+	assert.Equal(certData4.PrivateKeyData, certData3.PrivateKeyData)
+}
+
+func TestCertificateDataChecksum(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	certData := testCertificateData(t)
+	checksum := certData.Checksum()
+	assert.Len(checksum, 64)
+
+	// The checksum does not depend on serialization or metadata
+	data, err := json.Marshal(certData)
+	require.NoError(err)
+
+	var certData2 CertificateData
+	require.NoError(json.Unmarshal(data, &certData2))
+	certData2.RenewalCount = 3
+
+	assert.Equal(checksum, certData2.Checksum())
+
+	// Same certificate, different private key
+	certData3 := testCertificateData(t)
+	certData3.Certificate = certData.Certificate
+
+	assert.NotEqual(checksum, certData3.Checksum())
+}
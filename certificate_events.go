@@ -0,0 +1,164 @@
+package acme
+
+import (
+	"slices"
+	"sync"
+)
+
+// The number of events buffered for each subscriber. If a subscriber does not
+// read events fast enough, the oldest events are discarded so that the
+// certificate worker is never blocked.
+const CertificateEventBufferSize = 16
+
+// The default number of recent events kept for each certificate.
+const DefaultEventHistorySize = 16
+
+type CertificateSubscription struct {
+	C <-chan *CertificateEvent
+
+	client *Client
+	name   string
+
+	eventChan chan *CertificateEvent
+	closed    bool
+	mutex     sync.Mutex
+}
+
+func newCertificateSubscription(c *Client, name string) *CertificateSubscription {
+	eventChan := make(chan *CertificateEvent, CertificateEventBufferSize)
+
+	s := CertificateSubscription{
+		C: eventChan,
+
+		client: c,
+		name:   name,
+
+		eventChan: eventChan,
+	}
+
+	return &s
+}
+
+// SubscribeCertificateEvents returns a subscription to all events for a
+// certificate, including certificates obtained or loaded by workers started
+// after the subscription. The channel of the subscription is closed when the
+// subscription is cancelled or when the client is stopped.
+func (c *Client) SubscribeCertificateEvents(name string) *CertificateSubscription {
+	s := newCertificateSubscription(c, name)
+
+	c.subscriptionsMutex.Lock()
+	c.subscriptions[name] = append(c.subscriptions[name], s)
+	c.subscriptionsMutex.Unlock()
+
+	return s
+}
+
+func (s *CertificateSubscription) Unsubscribe() {
+	c := s.client
+
+	c.subscriptionsMutex.Lock()
+	c.subscriptions[s.name] = slices.DeleteFunc(c.subscriptions[s.name],
+		func(s2 *CertificateSubscription) bool {
+			return s2 == s
+		})
+	if len(c.subscriptions[s.name]) == 0 {
+		delete(c.subscriptions, s.name)
+	}
+	c.subscriptionsMutex.Unlock()
+
+	s.close()
+}
+
+func (s *CertificateSubscription) send(ev *CertificateEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	for {
+		select {
+		case s.eventChan <- ev:
+			return
+		default:
+		}
+
+		// The buffer is full, discard the oldest event
+		select {
+		case <-s.eventChan:
+		default:
+		}
+	}
+}
+
+func (s *CertificateSubscription) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		close(s.eventChan)
+		s.closed = true
+	}
+}
+
+func (c *Client) publishCertificateEvent(name string, ev *CertificateEvent) {
+	names := []string{name}
+
+	c.certificatesMutex.RLock()
+	for alias, name2 := range c.certificateAliases {
+		if name2 == name {
+			names = append(names, alias)
+		}
+	}
+	c.certificatesMutex.RUnlock()
+
+	historySize := c.Config().EventHistorySize
+
+	c.subscriptionsMutex.Lock()
+	history := append(c.eventHistory[name], ev)
+	if n := len(history) - historySize; n > 0 {
+		history = slices.Delete(history, 0, n)
+	}
+	c.eventHistory[name] = history
+
+	var subscriptions []*CertificateSubscription
+	for _, name := range names {
+		subscriptions = append(subscriptions, c.subscriptions[name]...)
+	}
+	c.subscriptionsMutex.Unlock()
+
+	for _, s := range subscriptions {
+		s.send(ev)
+	}
+}
+
+// RecentEvents returns the last events sent for a certificate, oldest first,
+// so that consumers subscribing late (e.g. an administration interface) can
+// display recent history. The number of events kept is set by
+// ClientCfg.EventHistorySize.
+func (c *Client) RecentEvents(name string) []*CertificateEvent {
+	c.certificatesMutex.RLock()
+	if name2, found := c.certificateAliases[name]; found {
+		name = name2
+	}
+	c.certificatesMutex.RUnlock()
+
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+
+	return slices.Clone(c.eventHistory[name])
+}
+
+func (c *Client) closeSubscriptions() {
+	c.subscriptionsMutex.Lock()
+	subscriptions := c.subscriptions
+	c.subscriptions = make(map[string][]*CertificateSubscription)
+	c.subscriptionsMutex.Unlock()
+
+	for _, ss := range subscriptions {
+		for _, s := range ss {
+			s.close()
+		}
+	}
+}
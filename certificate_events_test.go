@@ -0,0 +1,126 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateSubscriptionBuffering(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newCertificateSubscription(nil, "test")
+
+	nbEvents := CertificateEventBufferSize + 4
+	for i := range nbEvents {
+		s.send(&CertificateEvent{Error: errors.New(fmt.Sprintf("%d", i))})
+	}
+
+	s.close()
+
+	var errs []string
+	for ev := range s.C {
+		errs = append(errs, ev.Error.Error())
+	}
+
+	if assert.Len(errs, CertificateEventBufferSize) {
+		assert.Equal("4", errs[0])
+		assert.Equal(fmt.Sprintf("%d", nbEvents-1), errs[len(errs)-1])
+	}
+
+	// Sending to a closed subscription must not panic
+	s.send(&CertificateEvent{})
+}
+
+func TestCertificateEventKinds(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{
+				Identifiers: []Identifier{DNSIdentifier("example.com")},
+				Validity:    1,
+			})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindIssued, ev.Kind)
+
+		issuedAt := ev.CertificateData.IssuedAt
+		assert.False(issuedAt.IsZero())
+		assert.Zero(ev.CertificateData.RenewalCount)
+
+		require.NoError(c.RenewCertificateNow("test"))
+
+		ev = <-eventChan
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindRenewed, ev.Kind)
+
+		assert.Equal(issuedAt, ev.CertificateData.IssuedAt)
+		assert.False(ev.CertificateData.RenewedAt.Before(issuedAt))
+		assert.Equal(1, ev.CertificateData.RenewalCount)
+
+		storedData, err := c.Cfg.DataStore.LoadCertificateData("test")
+		require.NoError(err)
+		assert.True(issuedAt.Equal(storedData.IssuedAt))
+		assert.Equal(1, storedData.RenewalCount)
+
+		// Subscribers receive the current certificate first
+		eventChan2, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{
+				Identifiers: []Identifier{DNSIdentifier("example.com")},
+				Validity:    1,
+			})
+		require.NoError(err)
+
+		ev = <-eventChan2
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindLoaded, ev.Kind)
+	})
+}
+
+func TestRecentEvents(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.EventHistorySize = 2
+	}, func(c *Client) {
+		assert.Empty(c.RecentEvents("test"))
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{
+				Identifiers: []Identifier{DNSIdentifier("example.com")},
+				Validity:    1,
+			})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+
+		for range 2 {
+			require.NoError(c.RenewCertificateNow("test"))
+
+			ev = <-eventChan
+			require.NoError(ev.Error)
+		}
+
+		events := c.RecentEvents("test")
+		if assert.Len(events, 2) {
+			assert.Equal(CertificateEventKindRenewed, events[0].Kind)
+			assert.Equal(CertificateEventKindRenewed, events[1].Kind)
+			assert.Equal(2, events[1].CertificateData.RenewalCount)
+			assert.False(events[1].Time.Before(events[0].Time))
+		}
+	})
+}
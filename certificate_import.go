@@ -0,0 +1,131 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+type publicKey interface {
+	Equal(crypto.PublicKey) bool
+}
+
+func NewCertificateDataFromPEM(name string, chainData, privateKeyData []byte) (*CertificateData, error) {
+	chain, err := decodePEMCertificateChain(chainData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode certificate chain: %w", err)
+	} else if len(chain) == 0 {
+		return nil, fmt.Errorf("empty certificate chain")
+	}
+
+	privateKey, err := DecodePEMPrivateKey(privateKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode private key: %w", err)
+	}
+
+	leaf := chain[0]
+
+	if err := checkPrivateKeyMatch(privateKey, leaf); err != nil {
+		return nil, err
+	}
+
+	ids := make([]Identifier, 0, len(leaf.DNSNames)+len(leaf.IPAddresses))
+	for _, dnsName := range leaf.DNSNames {
+		ids = append(ids, DNSIdentifier(dnsName))
+	}
+	for _, ip := range leaf.IPAddresses {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			return nil, fmt.Errorf("invalid ip address %v", ip)
+		}
+
+		ids = append(ids, IPIdentifier(addr))
+	}
+
+	validity := int(leaf.NotAfter.Sub(leaf.NotBefore) / (24 * time.Hour))
+
+	certData := CertificateData{
+		Name: name,
+
+		CertificateRequest: CertificateRequest{
+			Identifiers: ids,
+			Validity:    max(validity, 1),
+		},
+
+		PrivateKey:  privateKey,
+		Certificate: chain,
+	}
+
+	certData.updateCertificateIdentifiers()
+
+	return &certData, nil
+}
+
+func checkPrivateKeyMatch(privateKey crypto.Signer, cert *x509.Certificate) error {
+	pub, ok := privateKey.Public().(publicKey)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	if !pub.Equal(cert.PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+
+	return nil
+}
+
+func (c *CertificateData) EncodePEMCertificateChain() (string, error) {
+	return encodePEMCertificateChain(c.Certificate)
+}
+
+func (c *CertificateData) EncodePEMPrivateKey() ([]byte, error) {
+	data, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode private key: %w", err)
+	}
+
+	block := pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: data,
+	}
+
+	return pem.EncodeToMemory(&block), nil
+}
+
+// DecodePEMPrivateKey decodes a PEM private key in PKCS #8, PKCS #1 (RSA
+// PRIVATE KEY) or SEC 1 (EC PRIVATE KEY) format.
+func DecodePEMPrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var privateKey any
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unknown PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key of type %T cannot be used to "+
+			"sign data", privateKey)
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCertificateDataFromPEM(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(err)
+
+	ids := []Identifier{
+		DNSIdentifier("example.com"),
+		IPIdentifier(netip.MustParseAddr("192.0.2.1")),
+		IPIdentifier(netip.MustParseAddr("2001:db8::1")),
+	}
+
+	cert, err := GenerateSelfSignedCertificate(ids, privateKey, 72*time.Hour)
+	require.NoError(err)
+
+	chainData, err := encodePEMCertificateChain([]*x509.Certificate{cert})
+	require.NoError(err)
+
+	certData := CertificateData{PrivateKey: privateKey}
+	privateKeyData, err := certData.EncodePEMPrivateKey()
+	require.NoError(err)
+
+	certData2, err := NewCertificateDataFromPEM("example", []byte(chainData),
+		privateKeyData)
+	require.NoError(err)
+
+	assert.Equal("example", certData2.Name)
+	assert.Equal(ids, certData2.Identifiers)
+	assert.Equal(3, certData2.Validity)
+	assert.Equal(cert.SerialNumber.Text(16), certData2.SerialNumber)
+	assert.NoError(certData2.Verify())
+
+	// Key mismatch
+	privateKey2, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(err)
+
+	certData.PrivateKey = privateKey2
+	privateKeyData2, err := certData.EncodePEMPrivateKey()
+	require.NoError(err)
+
+	_, err = NewCertificateDataFromPEM("example", []byte(chainData),
+		privateKeyData2)
+	assert.ErrorContains(err, "does not match")
+
+	// Empty chain
+	_, err = NewCertificateDataFromPEM("example", nil, privateKeyData)
+	assert.ErrorContains(err, "empty certificate chain")
+}
+
+func TestDecodePEMPrivateKey(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	encode := func(blockType string, data []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data})
+	}
+
+	ecdsaKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(err)
+
+	rsaKey, err := GeneratePrivateKey(KeyTypeRSA2048)
+	require.NoError(err)
+
+	pkcs8Data, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(err)
+
+	sec1Data, err := x509.MarshalECPrivateKey(ecdsaKey.(*ecdsa.PrivateKey))
+	require.NoError(err)
+
+	pkcs1Data := x509.MarshalPKCS1PrivateKey(rsaKey.(*rsa.PrivateKey))
+
+	key, err := DecodePEMPrivateKey(encode("PRIVATE KEY", pkcs8Data))
+	require.NoError(err)
+	assert.True(rsaKey.(*rsa.PrivateKey).Equal(key))
+
+	key, err = DecodePEMPrivateKey(encode("RSA PRIVATE KEY", pkcs1Data))
+	require.NoError(err)
+	assert.True(rsaKey.(*rsa.PrivateKey).Equal(key))
+
+	key, err = DecodePEMPrivateKey(encode("EC PRIVATE KEY", sec1Data))
+	require.NoError(err)
+	assert.True(ecdsaKey.(*ecdsa.PrivateKey).Equal(key))
+
+	_, err = DecodePEMPrivateKey(encode("CERTIFICATE", pkcs8Data))
+	assert.ErrorContains(err, "unknown PEM block")
+
+	_, err = DecodePEMPrivateKey(encode("EC PRIVATE KEY", pkcs1Data))
+	assert.Error(err)
+
+	_, err = DecodePEMPrivateKey([]byte("foo"))
+	assert.ErrorContains(err, "no PEM block")
+}
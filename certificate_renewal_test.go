@@ -0,0 +1,57 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateRenewalFailure(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	withTestClient(t, func(c *Client) {
+		name := "test"
+		ids := []Identifier{DNSIdentifier("localhost")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), name,
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		certData := ev.CertificateData
+
+		// Once the server cannot be reached, renewals fail. The worker must
+		// report each failure and keep serving the current certificate
+		// instead of stopping after the first one.
+		c.Cfg.HTTPClient.Transport = failingTransport{}
+
+		for range 2 {
+			require.NoError(c.RenewCertificateNow(name))
+
+			select {
+			case ev, ok := <-eventChan:
+				require.True(ok, "certificate worker stopped")
+				assert.Error(ev.Error)
+			case <-time.After(30 * time.Second):
+				require.Fail("no event received")
+			}
+
+			assert.Same(certData, c.Certificate(name))
+		}
+	})
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
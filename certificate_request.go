@@ -0,0 +1,174 @@
+package acme
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// A certificate request contains the parameters used to order a certificate.
+// It is stored with the certificate so that renewals use the same
+// parameters.
+type CertificateRequest struct {
+	Identifiers []Identifier `json:"identifiers"`
+	Validity    int          `json:"validity"` // days
+
+	// If set, overrides Validity, e.g. for private CAs issuing certificates
+	// valid for a few hours.
+	ValidityDuration time.Duration `json:"validity_duration,omitempty"`
+
+	// The type of the private key. If not set, private keys are generated
+	// with ClientCfg.GenerateCertificatePrivateKey.
+	KeyType KeyType `json:"key_type,omitempty"`
+
+	// The certificate profile requested to the server, for servers
+	// supporting profiles.
+	Profile string `json:"profile,omitempty"`
+
+	// If set, overrides ClientCfg.PreferredChain.
+	PreferredChain string `json:"preferred_chain,omitempty"`
+
+	// A fixed validity period. If not set, certificates are requested for
+	// Validity days starting when the order is submitted.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+
+	// If set, renewed certificates use the private key of the previous
+	// certificate instead of a new one.
+	ReuseKey bool `json:"reuse_key,omitempty"`
+
+	// If set, overrides ClientCfg.RenewalPolicy.
+	RenewalPolicy *RenewalPolicy `json:"renewal_policy,omitempty"`
+
+	// Arbitrary metadata attached to the certificate, e.g. the team or
+	// service it belongs to. Labels are stored with the certificate and
+	// exported in metrics; they do not change the certificate ordered.
+	// Label names must be valid Prometheus label names.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (r *CertificateRequest) Check() error {
+	if len(r.Identifiers) == 0 {
+		return fmt.Errorf("missing identifiers")
+	}
+
+	if r.KeyType != "" {
+		if err := r.KeyType.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if r.Validity < 0 {
+		return fmt.Errorf("invalid negative validity")
+	}
+
+	if r.ValidityDuration < 0 {
+		return fmt.Errorf("invalid negative validity duration")
+	}
+
+	if r.NotBefore != nil && r.NotAfter != nil &&
+		!r.NotAfter.After(*r.NotBefore) {
+		return fmt.Errorf("end of validity period is not after its start")
+	}
+
+	for name := range r.Labels {
+		if !labelNameRE.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+
+	return nil
+}
+
+// ValidityPeriod returns the requested validity of certificates, ignoring
+// NotBefore and NotAfter.
+func (r *CertificateRequest) ValidityPeriod() time.Duration {
+	if r.ValidityDuration > 0 {
+		return r.ValidityDuration
+	}
+
+	return time.Duration(r.Validity) * 24 * time.Hour
+}
+
+func (r *CertificateRequest) validityEnd(start time.Time) time.Time {
+	if r.ValidityDuration > 0 {
+		return start.Add(r.ValidityDuration)
+	}
+
+	return start.AddDate(0, 0, r.Validity)
+}
+
+func (r *CertificateRequest) Clone() CertificateRequest {
+	r2 := *r
+
+	r2.Identifiers = slices.Clone(r.Identifiers)
+
+	if r.NotBefore != nil {
+		t := *r.NotBefore
+		r2.NotBefore = &t
+	}
+
+	if r.NotAfter != nil {
+		t := *r.NotAfter
+		r2.NotAfter = &t
+	}
+
+	if r.RenewalPolicy != nil {
+		policy := *r.RenewalPolicy
+		r2.RenewalPolicy = &policy
+	}
+
+	r2.Labels = maps.Clone(r.Labels)
+
+	return r2
+}
+
+// Equal returns true if two requests would yield equivalent certificates.
+// The order of identifiers does not matter, and labels are ignored.
+func (r *CertificateRequest) Equal(r2 *CertificateRequest) bool {
+	timeEqual := func(t1, t2 *time.Time) bool {
+		if t1 == nil || t2 == nil {
+			return t1 == t2
+		}
+
+		return t1.Equal(*t2)
+	}
+
+	return sameIdentifierSet(r.Identifiers, r2.Identifiers) &&
+		r.Validity == r2.Validity &&
+		r.ValidityDuration == r2.ValidityDuration &&
+		r.KeyType == r2.KeyType &&
+		r.Profile == r2.Profile &&
+		r.PreferredChain == r2.PreferredChain &&
+		timeEqual(r.NotBefore, r2.NotBefore) &&
+		timeEqual(r.NotAfter, r2.NotAfter) &&
+		r.ReuseKey == r2.ReuseKey &&
+		reflect.DeepEqual(r.RenewalPolicy, r2.RenewalPolicy)
+}
+
+func (c *Client) certificateRenewalPolicy(r *CertificateRequest) RenewalPolicy {
+	policy := c.Config().RenewalPolicy
+
+	if r.RenewalPolicy != nil {
+		policy = *r.RenewalPolicy
+
+		if policy.MaxRetryDelay == 0 {
+			policy.MaxRetryDelay = DefaultMaxRetryDelay
+		}
+	}
+
+	return policy
+}
+
+func (c *Client) certificatePreferredChain(r *CertificateRequest) string {
+	if r.PreferredChain != "" {
+		return r.PreferredChain
+	}
+
+	return c.Config().PreferredChain
+}
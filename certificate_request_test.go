@@ -0,0 +1,117 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateRequest(t *testing.T) {
+	s := newFakeACMEServer(t)
+
+	renew := func(t *testing.T, request CertificateRequest) (*CertificateData, *CertificateData) {
+		require := require.New(t)
+
+		var certData1, certData2 *CertificateData
+
+		withFakeTestClient(t, s, func(c *Client) {
+			eventChan, err := c.RequestCertificate(context.Background(),
+				"test", request)
+			require.NoError(err)
+
+			ev := <-eventChan
+			require.NoError(ev.Error)
+			certData1 = ev.CertificateData
+
+			require.NoError(c.RenewCertificateNow("test"))
+
+			ev = <-eventChan
+			require.NoError(ev.Error)
+			certData2 = ev.CertificateData
+
+			// The request is stored with the certificate
+			storedData, err := c.Cfg.DataStore.LoadCertificateData("test")
+			require.NoError(err)
+			require.True(request.Equal(&storedData.CertificateRequest))
+		})
+
+		return certData1, certData2
+	}
+
+	t.Run("NewKey", func(t *testing.T) {
+		assert := assert.New(t)
+
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+			KeyType:     KeyTypeRSA2048,
+		}
+
+		certData1, certData2 := renew(t, request)
+
+		assert.IsType(&rsa.PublicKey{}, certData1.LeafCertificate().PublicKey)
+		assert.False(certData1.PrivateKey.Public().(*rsa.PublicKey).Equal(
+			certData2.PrivateKey.Public()))
+	})
+
+	t.Run("ReuseKey", func(t *testing.T) {
+		assert := assert.New(t)
+
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+			ReuseKey:    true,
+		}
+
+		certData1, certData2 := renew(t, request)
+
+		assert.NotEqual(certData1.LeafCertificate().SerialNumber,
+			certData2.LeafCertificate().SerialNumber)
+		assert.Equal(certData1.PrivateKey, certData2.PrivateKey)
+	})
+}
+
+func TestCertificateLabels(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+			Labels:      map[string]string{"team": "web", "env": "prod"},
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+		assert.Equal(request.Labels, ev.CertificateData.Labels)
+
+		storedData, err := c.Cfg.DataStore.LoadCertificateData("test")
+		require.NoError(err)
+		assert.Equal(request.Labels, storedData.Labels)
+
+		var buf bytes.Buffer
+		require.NoError(c.WriteMetrics(&buf))
+		assert.Contains(buf.String(), `acme_certificate_labels{`+
+			`certificate="test",label_env="prod",label_team="web"} 1`)
+
+		// Labels do not change the certificate
+		request2 := request.Clone()
+		request2.Labels = nil
+		assert.True(request.Equal(&request2))
+
+		request2.Labels = map[string]string{"team-name": "web"}
+		_, err = c.RequestCertificate(context.Background(), "test2", request2)
+		assert.Error(err)
+	})
+}
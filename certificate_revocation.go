@@ -0,0 +1,80 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+)
+
+// RFC 5280 5.3.1. Reason Code
+type RevocationReason int
+
+const (
+	RevocationReasonUnspecified          RevocationReason = 0
+	RevocationReasonKeyCompromise        RevocationReason = 1
+	RevocationReasonCACompromise         RevocationReason = 2
+	RevocationReasonAffiliationChanged   RevocationReason = 3
+	RevocationReasonSuperseded           RevocationReason = 4
+	RevocationReasonCessationOfOperation RevocationReason = 5
+	RevocationReasonCertificateHold      RevocationReason = 6
+	RevocationReasonRemoveFromCRL        RevocationReason = 8
+	RevocationReasonPrivilegeWithdrawn   RevocationReason = 9
+	RevocationReasonAACompromise         RevocationReason = 10
+)
+
+var revocationReasonStrings = map[RevocationReason]string{
+	RevocationReasonUnspecified:          "unspecified",
+	RevocationReasonKeyCompromise:        "keyCompromise",
+	RevocationReasonCACompromise:         "cACompromise",
+	RevocationReasonAffiliationChanged:   "affiliationChanged",
+	RevocationReasonSuperseded:           "superseded",
+	RevocationReasonCessationOfOperation: "cessationOfOperation",
+	RevocationReasonCertificateHold:      "certificateHold",
+	RevocationReasonRemoveFromCRL:        "removeFromCRL",
+	RevocationReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	RevocationReasonAACompromise:         "aACompromise",
+}
+
+func (r RevocationReason) String() string {
+	if s, found := revocationReasonStrings[r]; found {
+		return s
+	}
+
+	return strconv.Itoa(int(r))
+}
+
+func (r *RevocationReason) Parse(s string) error {
+	for r2, s2 := range revocationReasonStrings {
+		if s == s2 {
+			*r = r2
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown revocation reason %q", s)
+}
+
+// RFC 8555 7.6. Certificate Revocation
+type CertificateRevocation struct {
+	Certificate string            `json:"certificate"`
+	Reason      *RevocationReason `json:"reason,omitempty"`
+}
+
+func (c *Client) RevokeCertificate(ctx context.Context, cert *x509.Certificate, reason RevocationReason) error {
+	c.Log.Debug(1, "revoking certificate %s (reason: %v)",
+		cert.SerialNumber.Text(16), reason)
+
+	payload := CertificateRevocation{
+		Certificate: base64.RawURLEncoding.EncodeToString(cert.Raw),
+	}
+
+	if reason != RevocationReasonUnspecified {
+		payload.Reason = &reason
+	}
+
+	_, err := c.sendDirectoryRequest(ctx, "POST",
+		func(d *Directory) string { return d.RevokeCert }, &payload, nil)
+	return err
+}
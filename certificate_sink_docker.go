@@ -0,0 +1,345 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DockerSecretSink stores certificates in Docker Swarm secrets. Swarm secrets
+// are immutable, so each deployment creates new secrets whose name is the
+// configured name followed by a version, and updates services so that they
+// reference the new secrets instead of the previous versions. Services are
+// then restarted by Swarm according to their update configuration.
+
+const (
+	DefaultDockerEndpoint = "unix:///var/run/docker.sock"
+
+	dockerAPIVersion = "v1.41"
+
+	// The label used to find all versions of a secret.
+	dockerSecretLabel = "net.n16f.acme.secret"
+)
+
+type DockerSecretSinkCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// Either "unix://<path>" or "http://<host>:<port>". The default value
+	// is DefaultDockerEndpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	CertificateSecret string `json:"certificate_secret"`
+	PrivateKeySecret  string `json:"private_key_secret"`
+
+	// The names or identifiers of the services to update.
+	Services []string `json:"services,omitempty"`
+}
+
+type DockerSecretSink struct {
+	Cfg DockerSecretSinkCfg
+
+	baseURI string
+}
+
+type dockerSecret struct {
+	ID   string           `json:"ID"`
+	Spec dockerSecretSpec `json:"Spec"`
+}
+
+type dockerSecretSpec struct {
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels,omitempty"`
+	Data   []byte            `json:"Data,omitempty"`
+}
+
+type dockerService struct {
+	ID      string `json:"ID"`
+	Version struct {
+		Index int64 `json:"Index"`
+	} `json:"Version"`
+
+	// We only modify secret references and must send back everything else
+	// unchanged.
+	Spec map[string]any `json:"Spec"`
+}
+
+type dockerError struct {
+	Message string `json:"message"`
+}
+
+func NewDockerSecretSink(cfg DockerSecretSinkCfg) (*DockerSecretSink, error) {
+	if cfg.CertificateSecret == "" {
+		return nil, fmt.Errorf("missing certificate secret name")
+	}
+
+	if cfg.PrivateKeySecret == "" {
+		return nil, fmt.Errorf("missing private key secret name")
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultDockerEndpoint
+	}
+
+	endpointURI, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", cfg.Endpoint, err)
+	}
+
+	var baseURI string
+
+	switch endpointURI.Scheme {
+	case "unix":
+		socketPath := endpointURI.Path
+
+		if cfg.HTTPClient == nil {
+			var dialer net.Dialer
+
+			transport := http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			}
+
+			cfg.HTTPClient = &http.Client{
+				Timeout:   30 * time.Second,
+				Transport: &transport,
+			}
+		}
+
+		baseURI = "http://docker"
+
+	case "http", "https":
+		if cfg.HTTPClient == nil {
+			cfg.HTTPClient = NewHTTPClient(nil)
+		}
+
+		baseURI = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	default:
+		return nil, fmt.Errorf("invalid endpoint %q: unsupported scheme",
+			cfg.Endpoint)
+	}
+
+	s := DockerSecretSink{
+		Cfg: cfg,
+
+		baseURI: baseURI + "/" + dockerAPIVersion,
+	}
+
+	return &s, nil
+}
+
+func (s *DockerSecretSink) DeployCertificate(ctx context.Context, certData *CertificateData) error {
+	chainData, err := certData.EncodePEMCertificateChain()
+	if err != nil {
+		return fmt.Errorf("cannot encode certificate chain: %w", err)
+	}
+
+	keyData, err := certData.EncodePEMPrivateKey()
+	if err != nil {
+		return fmt.Errorf("cannot encode private key: %w", err)
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+
+	secrets := []struct {
+		name string
+		data []byte
+	}{
+		{s.Cfg.CertificateSecret, []byte(chainData)},
+		{s.Cfg.PrivateKeySecret, keyData},
+	}
+
+	// Previous versions, identified by secret identifier, and secrets created
+	// manually before the first deployment, identified by the base name, are
+	// mapped to the new secrets.
+	replacements := make(map[string]dockerSecret)
+	var oldSecretIds []string
+
+	for _, secret := range secrets {
+		oldSecrets, err := s.listSecretVersions(ctx, secret.name)
+		if err != nil {
+			return err
+		}
+
+		newSecret, err := s.createSecret(ctx, secret.name, version,
+			secret.data)
+		if err != nil {
+			return err
+		}
+
+		for _, oldSecret := range oldSecrets {
+			replacements[oldSecret.ID] = *newSecret
+			oldSecretIds = append(oldSecretIds, oldSecret.ID)
+		}
+
+		replacements[secret.name] = *newSecret
+	}
+
+	for _, service := range s.Cfg.Services {
+		if err := s.updateService(ctx, service, replacements); err != nil {
+			return fmt.Errorf("cannot update service %q: %w", service, err)
+		}
+	}
+
+	// Swarm refuses to delete secrets still used by a service. Since
+	// services are updated asynchronously, this is expected for the secrets
+	// we just replaced: they will be deleted during the next deployment.
+	for _, id := range oldSecretIds {
+		s.sendRequest(ctx, "DELETE", "/secrets/"+url.PathEscape(id), nil, nil)
+	}
+
+	return nil
+}
+
+func (s *DockerSecretSink) listSecretVersions(ctx context.Context, name string) ([]dockerSecret, error) {
+	filters, err := json.Marshal(map[string][]string{
+		"label": {dockerSecretLabel + "=" + name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode filters: %w", err)
+	}
+
+	uriPath := "/secrets?filters=" + url.QueryEscape(string(filters))
+
+	var secrets []dockerSecret
+	if err := s.sendRequest(ctx, "GET", uriPath, nil, &secrets); err != nil {
+		return nil, fmt.Errorf("cannot list secrets: %w", err)
+	}
+
+	return secrets, nil
+}
+
+func (s *DockerSecretSink) createSecret(ctx context.Context, name, version string, data []byte) (*dockerSecret, error) {
+	spec := dockerSecretSpec{
+		Name:   name + "-" + version,
+		Labels: map[string]string{dockerSecretLabel: name},
+		Data:   data,
+	}
+
+	var res struct {
+		ID string `json:"ID"`
+	}
+
+	if err := s.sendRequest(ctx, "POST", "/secrets/create", spec, &res); err != nil {
+		return nil, fmt.Errorf("cannot create secret %q: %w", spec.Name, err)
+	}
+
+	secret := dockerSecret{
+		ID:   res.ID,
+		Spec: dockerSecretSpec{Name: spec.Name},
+	}
+
+	return &secret, nil
+}
+
+func (s *DockerSecretSink) updateService(ctx context.Context, name string, replacements map[string]dockerSecret) error {
+	var service dockerService
+
+	uriPath := "/services/" + url.PathEscape(name)
+	if err := s.sendRequest(ctx, "GET", uriPath, nil, &service); err != nil {
+		return fmt.Errorf("cannot fetch service: %w", err)
+	}
+
+	taskTemplate, _ := service.Spec["TaskTemplate"].(map[string]any)
+	containerSpec, _ := taskTemplate["ContainerSpec"].(map[string]any)
+	secretRefs, _ := containerSpec["Secrets"].([]any)
+
+	modified := false
+
+	for _, value := range secretRefs {
+		ref, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		id, _ := ref["SecretID"].(string)
+		secretName, _ := ref["SecretName"].(string)
+
+		newSecret, found := replacements[id]
+		if !found {
+			newSecret, found = replacements[secretName]
+		}
+
+		if found {
+			ref["SecretID"] = newSecret.ID
+			ref["SecretName"] = newSecret.Spec.Name
+			modified = true
+		}
+	}
+
+	if !modified {
+		return fmt.Errorf("service does not reference any version of the " +
+			"certificate or private key secrets")
+	}
+
+	// The version index prevents concurrent modifications of the service
+	uriPath = "/services/" + url.PathEscape(service.ID) + "/update?version=" +
+		strconv.FormatInt(service.Version.Index, 10)
+
+	if err := s.sendRequest(ctx, "POST", uriPath, service.Spec, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *DockerSecretSink) sendRequest(ctx context.Context, method, uriPath string, reqBody, resBody any) error {
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("cannot encode request body: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURI+uriPath, body)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := s.Cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(newSizeLimitedReader(res.Body,
+		DefaultMaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var dockerErr dockerError
+		if err := json.Unmarshal(data, &dockerErr); err == nil &&
+			dockerErr.Message != "" {
+			return fmt.Errorf("request failed with status %d: %s",
+				res.StatusCode, dockerErr.Message)
+		}
+
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	if resBody != nil {
+		if err := json.Unmarshal(data, resBody); err != nil {
+			return fmt.Errorf("cannot decode response body: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// KubernetesSecretSink writes certificates to a "kubernetes.io/tls" secret,
+// creating it if it does not exist. Secrets are written with server-side
+// apply so that labels and annotations set by other tools are preserved.
+
+const KubernetesFieldManager = "go-acme"
+
+type KubernetesSecretSinkCfg struct {
+	Kubernetes KubernetesCfg `json:"kubernetes"`
+
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type KubernetesSecretSink struct {
+	Cfg KubernetesSecretSinkCfg
+
+	client *KubernetesClient
+}
+
+func NewKubernetesSecretSink(cfg KubernetesSecretSinkCfg) (*KubernetesSecretSink, error) {
+	if cfg.Namespace == "" {
+		return nil, fmt.Errorf("missing namespace")
+	}
+
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("missing secret name")
+	}
+
+	client, err := NewKubernetesClient(cfg.Kubernetes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create Kubernetes client: %w", err)
+	}
+
+	s := KubernetesSecretSink{
+		Cfg: cfg,
+
+		client: client,
+	}
+
+	return &s, nil
+}
+
+func (s *KubernetesSecretSink) DeployCertificate(ctx context.Context, certData *CertificateData) error {
+	chainData, err := certData.EncodePEMCertificateChain()
+	if err != nil {
+		return fmt.Errorf("cannot encode certificate chain: %w", err)
+	}
+
+	keyData, err := certData.EncodePEMPrivateKey()
+	if err != nil {
+		return fmt.Errorf("cannot encode private key: %w", err)
+	}
+
+	// Secret data values are base64-encoded, which encoding/json does for
+	// byte slices.
+	secret := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]any{
+			"namespace": s.Cfg.Namespace,
+			"name":      s.Cfg.Name,
+		},
+		"type": "kubernetes.io/tls",
+		"data": map[string][]byte{
+			"tls.crt": []byte(chainData),
+			"tls.key": keyData,
+		},
+	}
+
+	query := url.Values{}
+	query.Set("fieldManager", KubernetesFieldManager)
+	query.Set("force", "true")
+
+	uriPath := "/api/v1/namespaces/" + url.PathEscape(s.Cfg.Namespace) +
+		"/secrets/" + url.PathEscape(s.Cfg.Name) + "?" + query.Encode()
+
+	// JSON is a subset of YAML, so the apply patch can be sent as JSON.
+	header := http.Header{}
+	header.Set("Content-Type", "application/apply-patch+yaml")
+
+	err = s.client.sendRequest(ctx, "PATCH", uriPath, header, secret, nil)
+	if err != nil {
+		return fmt.Errorf("cannot apply secret %s/%s: %w",
+			s.Cfg.Namespace, s.Cfg.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// SSHSink copies certificates to remote hosts with the OpenSSH client and
+// optionally runs a command to reload the servers using them. Using the ssh
+// program means that the usual configuration (~/.ssh/config, known hosts,
+// agents) applies.
+
+const DefaultSSHCommand = "ssh"
+
+type SSHSinkCfg struct {
+	// The ssh program; the default value is DefaultSSHCommand.
+	Command string `json:"command,omitempty"`
+
+	// Additional ssh options, e.g. []string{"-i", "/etc/acme/id_ed25519"}.
+	// Batch mode is always enabled so that ssh never prompts for anything.
+	Options []string `json:"options,omitempty"`
+
+	// Destinations, either "[user@]host" or "ssh://[user@]host[:port]".
+	Hosts []string `json:"hosts"`
+
+	// Remote paths.
+	CertificatePath string `json:"certificate_path"`
+	PrivateKeyPath  string `json:"private_key_path"`
+
+	// A shell command executed on each host after files have been copied.
+	ReloadCommand string `json:"reload_command,omitempty"`
+}
+
+type SSHSink struct {
+	Cfg SSHSinkCfg
+}
+
+func NewSSHSink(cfg SSHSinkCfg) (*SSHSink, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, fmt.Errorf("missing hosts")
+	}
+
+	if cfg.CertificatePath == "" {
+		return nil, fmt.Errorf("missing certificate path")
+	}
+
+	if cfg.PrivateKeyPath == "" {
+		return nil, fmt.Errorf("missing private key path")
+	}
+
+	if cfg.Command == "" {
+		cfg.Command = DefaultSSHCommand
+	}
+
+	s := SSHSink{
+		Cfg: cfg,
+	}
+
+	return &s, nil
+}
+
+// DeployCertificate deploys the certificate to all hosts, even if some of
+// them fail, so that one unreachable host does not block the others.
+func (s *SSHSink) DeployCertificate(ctx context.Context, certData *CertificateData) error {
+	chainData, err := certData.EncodePEMCertificateChain()
+	if err != nil {
+		return fmt.Errorf("cannot encode certificate chain: %w", err)
+	}
+
+	keyData, err := certData.EncodePEMPrivateKey()
+	if err != nil {
+		return fmt.Errorf("cannot encode private key: %w", err)
+	}
+
+	var errs []error
+
+	for _, host := range s.Cfg.Hosts {
+		err := s.deploy(ctx, host, []byte(chainData), keyData)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot deploy certificate to "+
+				"%q: %w", host, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *SSHSink) deploy(ctx context.Context, host string, chainData, keyData []byte) error {
+	// As for local files, write the private key first, and replace files
+	// atomically.
+	err := s.writeFile(ctx, host, s.Cfg.PrivateKeyPath, keyData, "077")
+	if err != nil {
+		return err
+	}
+
+	err = s.writeFile(ctx, host, s.Cfg.CertificatePath, chainData, "022")
+	if err != nil {
+		return err
+	}
+
+	if s.Cfg.ReloadCommand != "" {
+		if err := s.run(ctx, host, s.Cfg.ReloadCommand, nil); err != nil {
+			return fmt.Errorf("cannot run reload command: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SSHSink) writeFile(ctx context.Context, host, filePath string, data []byte, umask string) error {
+	tmpPath := filePath + ".tmp"
+
+	command := fmt.Sprintf("umask %s && cat >%s && mv -f %s %s", umask,
+		shellQuote(tmpPath), shellQuote(tmpPath), shellQuote(filePath))
+
+	if err := s.run(ctx, host, command, data); err != nil {
+		return fmt.Errorf("cannot write %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+func (s *SSHSink) run(ctx context.Context, host, command string, stdin []byte) error {
+	args := []string{"-o", "BatchMode=yes"}
+	args = append(args, s.Cfg.Options...)
+	args = append(args, "--", host, command)
+
+	cmd := exec.CommandContext(ctx, s.Cfg.Command, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		output = bytes.TrimSpace(output)
+		if len(output) > 0 {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
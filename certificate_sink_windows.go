@@ -0,0 +1,145 @@
+//go:build windows
+
+package acme
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// WindowsCertificateStoreSink imports certificates and their private key in
+// a certificate store of the local machine with certutil, and optionally
+// binds them to HTTP.sys endpoints with netsh, which is what IIS uses for
+// HTTPS bindings.
+
+const (
+	DefaultWindowsCertificateStore = "MY"
+
+	// The application identifier used by IIS for its SSL bindings.
+	IISApplicationId = "{4dc3e181-e14b-4a21-b022-59fc669b0914}"
+)
+
+type WindowsCertificateStoreSinkCfg struct {
+	// The name of the certificate store; the default value is
+	// DefaultWindowsCertificateStore, i.e. the personal store.
+	Store string `json:"store,omitempty"`
+
+	// HTTP.sys endpoints to bind the certificate to, either "<ip>:<port>"
+	// or "<hostname>:<port>" for SNI bindings.
+	Bindings []string `json:"bindings,omitempty"`
+
+	// The application identifier associated with bindings; the default
+	// value is IISApplicationId.
+	ApplicationId string `json:"application_id,omitempty"`
+}
+
+type WindowsCertificateStoreSink struct {
+	Cfg WindowsCertificateStoreSinkCfg
+}
+
+func NewWindowsCertificateStoreSink(cfg WindowsCertificateStoreSinkCfg) (*WindowsCertificateStoreSink, error) {
+	if cfg.Store == "" {
+		cfg.Store = DefaultWindowsCertificateStore
+	}
+
+	if cfg.ApplicationId == "" {
+		cfg.ApplicationId = IISApplicationId
+	}
+
+	for _, binding := range cfg.Bindings {
+		if _, _, err := net.SplitHostPort(binding); err != nil {
+			return nil, fmt.Errorf("invalid binding %q: %w", binding, err)
+		}
+	}
+
+	s := WindowsCertificateStoreSink{
+		Cfg: cfg,
+	}
+
+	return &s, nil
+}
+
+func (s *WindowsCertificateStoreSink) DeployCertificate(ctx context.Context, certData *CertificateData) error {
+	leafCert := certData.LeafCertificate()
+	if leafCert == nil {
+		return fmt.Errorf("missing certificate")
+	}
+
+	// certutil only imports private keys from PKCS #12 files. The file only
+	// exists during the import and is protected by a random password.
+	passwordData := make([]byte, 16)
+	if _, err := rand.Read(passwordData); err != nil {
+		return fmt.Errorf("cannot generate password: %w", err)
+	}
+
+	password := hex.EncodeToString(passwordData)
+
+	pfxData, err := pkcs12.Modern.Encode(certData.PrivateKey, leafCert,
+		certData.Certificate[1:], password)
+	if err != nil {
+		return fmt.Errorf("cannot encode PKCS #12 data: %w", err)
+	}
+
+	dirPath, err := os.MkdirTemp("", "go-acme-")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dirPath)
+
+	pfxPath := filepath.Join(dirPath, "certificate.pfx")
+	if err := os.WriteFile(pfxPath, pfxData, 0600); err != nil {
+		return fmt.Errorf("cannot write %q: %w", pfxPath, err)
+	}
+
+	err = runWindowsCommand(ctx, "certutil", "-f", "-p", password,
+		"-importpfx", s.Cfg.Store, pfxPath, "NoExport")
+	if err != nil {
+		return fmt.Errorf("cannot import certificate: %w", err)
+	}
+
+	thumbprint := sha1.Sum(leafCert.Raw)
+	certHash := hex.EncodeToString(thumbprint[:])
+
+	for _, binding := range s.Cfg.Bindings {
+		if err := s.bind(ctx, binding, certHash); err != nil {
+			return fmt.Errorf("cannot bind certificate to %q: %w", binding, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *WindowsCertificateStoreSink) bind(ctx context.Context, binding, certHash string) error {
+	host, _, _ := net.SplitHostPort(binding)
+
+	endpoint := "ipport=" + binding
+	if net.ParseIP(host) == nil {
+		endpoint = "hostnameport=" + binding
+	}
+
+	// netsh cannot add a binding which already exists, and "update" fails
+	// if it does not exist: delete it first, ignoring errors.
+	runWindowsCommand(ctx, "netsh", "http", "delete", "sslcert", endpoint)
+
+	return runWindowsCommand(ctx, "netsh", "http", "add", "sslcert",
+		endpoint, "certhash="+certHash, "appid="+s.Cfg.ApplicationId,
+		"certstorename="+s.Cfg.Store)
+}
+
+func runWindowsCommand(ctx context.Context, name string, args ...string) error {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", name, err, output)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+package acme
+
+import (
+	"context"
+)
+
+// A certificate sink deploys certificates to an external system each time
+// they are issued, e.g. a Kubernetes secret used by ingress controllers.
+type CertificateSink interface {
+	DeployCertificate(ctx context.Context, certData *CertificateData) error
+}
@@ -0,0 +1,348 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetesSecretSink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var secret struct {
+		Kind     string            `json:"kind"`
+		Type     string            `json:"type"`
+		Metadata map[string]string `json:"metadata"`
+		Data     map[string][]byte `json:"data"`
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("PATCH /api/v1/namespaces/web/secrets/example-tls", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer k8s-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"kind":"Status","message":"Unauthorized"}`)
+			return
+		}
+
+		assert.Equal("application/apply-patch+yaml",
+			req.Header.Get("Content-Type"))
+		assert.Equal(KubernetesFieldManager,
+			req.URL.Query().Get("fieldManager"))
+		assert.Equal("true", req.URL.Query().Get("force"))
+
+		assert.NoError(json.NewDecoder(req.Body).Decode(&secret))
+
+		io.WriteString(w, `{}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	certData := testCertificateData(t)
+
+	ctx := context.Background()
+
+	sink, err := NewKubernetesSecretSink(KubernetesSecretSinkCfg{
+		Kubernetes: KubernetesCfg{
+			APIServerURI: server.URL,
+			Token:        StaticSecret("k8s-token"),
+		},
+		Namespace: "web",
+		Name:      "example-tls",
+	})
+	require.NoError(err)
+
+	require.NoError(sink.DeployCertificate(ctx, certData))
+
+	chainData, err := certData.EncodePEMCertificateChain()
+	require.NoError(err)
+	keyData, err := certData.EncodePEMPrivateKey()
+	require.NoError(err)
+
+	assert.Equal("Secret", secret.Kind)
+	assert.Equal("kubernetes.io/tls", secret.Type)
+	assert.Equal("web", secret.Metadata["namespace"])
+	assert.Equal("example-tls", secret.Metadata["name"])
+	assert.Equal(chainData, string(secret.Data["tls.crt"]))
+	assert.Equal(keyData, secret.Data["tls.key"])
+
+	// Authentication failure
+	sink.client.Cfg.Token = StaticSecret("invalid-token")
+
+	err = sink.DeployCertificate(ctx, certData)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Unauthorized")
+	}
+}
+
+func TestDockerSecretSink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secrets := map[string]dockerSecret{
+		"s1": {
+			ID: "s1",
+			Spec: dockerSecretSpec{
+				Name:   "example-crt-20240101000000",
+				Labels: map[string]string{dockerSecretLabel: "example-crt"},
+			},
+		},
+	}
+
+	service := map[string]any{
+		"ID":      "svc1",
+		"Version": map[string]any{"Index": 42},
+		"Spec": map[string]any{
+			"Name": "web",
+			"TaskTemplate": map[string]any{
+				"ContainerSpec": map[string]any{
+					"Image": "nginx",
+					"Secrets": []any{
+						map[string]any{
+							"SecretID":   "s1",
+							"SecretName": "example-crt-20240101000000",
+							"File":       map[string]any{"Name": "tls.crt"},
+						},
+						map[string]any{
+							"SecretID":   "manual-key",
+							"SecretName": "example-key",
+							"File":       map[string]any{"Name": "tls.key"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var updatedSpec map[string]any
+	var deletedSecrets []string
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1.41/secrets", func(w http.ResponseWriter, req *http.Request) {
+		var filters map[string][]string
+		json.Unmarshal([]byte(req.URL.Query().Get("filters")), &filters)
+
+		var res []dockerSecret
+		for _, secret := range secrets {
+			label := dockerSecretLabel + "=" +
+				secret.Spec.Labels[dockerSecretLabel]
+			if slices.Contains(filters["label"], label) {
+				res = append(res, secret)
+			}
+		}
+
+		json.NewEncoder(w).Encode(res)
+	})
+
+	mux.HandleFunc("POST /v1.41/secrets/create", func(w http.ResponseWriter, req *http.Request) {
+		var spec dockerSecretSpec
+		assert.NoError(json.NewDecoder(req.Body).Decode(&spec))
+
+		id := "new-" + spec.Labels[dockerSecretLabel]
+		secrets[id] = dockerSecret{ID: id, Spec: spec}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	})
+
+	mux.HandleFunc("DELETE /v1.41/secrets/{id}", func(w http.ResponseWriter, req *http.Request) {
+		deletedSecrets = append(deletedSecrets, req.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /v1.41/services/web", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(service)
+	})
+
+	mux.HandleFunc("POST /v1.41/services/svc1/update", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal("42", req.URL.Query().Get("version"))
+		assert.NoError(json.NewDecoder(req.Body).Decode(&updatedSpec))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	certData := testCertificateData(t)
+
+	sink, err := NewDockerSecretSink(DockerSecretSinkCfg{
+		Endpoint:          server.URL,
+		CertificateSecret: "example-crt",
+		PrivateKeySecret:  "example-key",
+		Services:          []string{"web"},
+	})
+	require.NoError(err)
+
+	require.NoError(sink.DeployCertificate(context.Background(), certData))
+
+	chainData, err := certData.EncodePEMCertificateChain()
+	require.NoError(err)
+	assert.Equal(chainData, string(secrets["new-example-crt"].Spec.Data))
+
+	require.NotNil(updatedSpec)
+	assert.Equal("web", updatedSpec["Name"])
+
+	containerSpec := updatedSpec["TaskTemplate"].(map[string]any)["ContainerSpec"].(map[string]any)
+	assert.Equal("nginx", containerSpec["Image"])
+
+	refs := containerSpec["Secrets"].([]any)
+	require.Len(refs, 2)
+
+	crtRef := refs[0].(map[string]any)
+	assert.Equal("new-example-crt", crtRef["SecretID"])
+	assert.Equal(secrets["new-example-crt"].Spec.Name, crtRef["SecretName"])
+	assert.Equal("tls.crt", crtRef["File"].(map[string]any)["Name"])
+
+	keyRef := refs[1].(map[string]any)
+	assert.Equal("new-example-key", keyRef["SecretID"])
+
+	assert.Equal([]string{"s1"}, deletedSecrets)
+}
+
+func TestSSHSink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The fake ssh program executes commands locally, recording hosts
+	dirPath := path.Join(t.TempDir(), "it's")
+	require.NoError(os.Mkdir(dirPath, 0700))
+
+	logPath := path.Join(dirPath, "hosts.log")
+
+	script := `#!/bin/sh
+while [ "$1" != "--" ]; do shift; done
+shift
+echo "$1" >>"` + logPath + `"
+if [ "$1" = "down.example.com" ]; then
+  echo "connection refused" >&2
+  exit 255
+fi
+exec /bin/sh -c "$2"
+`
+
+	scriptPath := path.Join(dirPath, "ssh")
+	require.NoError(os.WriteFile(scriptPath, []byte(script), 0700))
+
+	certData := testCertificateData(t)
+
+	sink, err := NewSSHSink(SSHSinkCfg{
+		Command:         scriptPath,
+		Options:         []string{"-p", "2222"},
+		Hosts:           []string{"down.example.com", "www.example.com"},
+		CertificatePath: path.Join(dirPath, "example.crt"),
+		PrivateKeyPath:  path.Join(dirPath, "example.key"),
+		ReloadCommand:   "touch " + shellQuote(path.Join(dirPath, "reloaded")),
+	})
+	require.NoError(err)
+
+	err = sink.DeployCertificate(context.Background(), certData)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "down.example.com")
+		assert.Contains(err.Error(), "connection refused")
+		assert.NotContains(err.Error(), "www.example.com")
+	}
+
+	chainData, err := certData.EncodePEMCertificateChain()
+	require.NoError(err)
+
+	data, err := os.ReadFile(path.Join(dirPath, "example.crt"))
+	require.NoError(err)
+	assert.Equal(chainData, string(data))
+
+	info, err := os.Stat(path.Join(dirPath, "example.key"))
+	require.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	assert.FileExists(path.Join(dirPath, "reloaded"))
+
+	data, err = os.ReadFile(logPath)
+	require.NoError(err)
+	assert.Equal("down.example.com\n"+strings.Repeat("www.example.com\n", 3),
+		string(data))
+}
+
+func TestLoadKubeconfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dirPath := t.TempDir()
+
+	data := `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+  - name: dev
+    cluster:
+      server: https://dev.example.com:6443
+      insecure-skip-tls-verify: true
+  - name: prod
+    cluster:
+      server: https://prod.example.com:6443
+contexts:
+  - name: dev
+    context:
+      cluster: dev
+      user: dev
+  - name: prod
+    context:
+      cluster: prod
+      user: prod
+users:
+  - name: dev
+    user:
+      token: dev-token
+  - name: prod
+    user:
+      tokenFile: prod-token
+`
+
+	filePath := path.Join(dirPath, "config")
+	require.NoError(os.WriteFile(filePath, []byte(data), 0600))
+
+	cfg, err := LoadKubeconfig(filePath, "")
+	require.NoError(err)
+	assert.Equal("https://dev.example.com:6443", cfg.APIServerURI)
+	assert.Equal(StaticSecret("dev-token"), cfg.Token)
+
+	cfg, err = LoadKubeconfig(filePath, "prod")
+	require.NoError(err)
+	assert.Equal("https://prod.example.com:6443", cfg.APIServerURI)
+	if assert.IsType(&FileSecret{}, cfg.Token) {
+		assert.Equal(path.Join(dirPath, "prod-token"),
+			cfg.Token.(*FileSecret).Path)
+	}
+
+	_, err = LoadKubeconfig(filePath, "staging")
+	assert.Error(err)
+}
+
+func testCertificateData(t testing.TB) *CertificateData {
+	privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(t, err)
+
+	ids := []Identifier{DNSIdentifier("example.com")}
+	cert, err := GenerateSelfSignedCertificate(ids, privateKey, time.Hour)
+	require.NoError(t, err)
+
+	certData := CertificateData{
+		Name:        "example",
+		PrivateKey:  privateKey,
+		Certificate: []*x509.Certificate{cert},
+	}
+
+	return &certData
+}
@@ -2,24 +2,137 @@ package acme
 
 import (
 	"context"
+	"crypto"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.n16f.net/log"
 )
 
+const DefaultMaxRetryDelay = time.Minute
+
+type RenewalPolicy struct {
+	// If set, workers keep trying to obtain the first certificate after a
+	// failure instead of stopping.
+	RetryInitialOrder bool `json:"retry_initial_order,omitempty"`
+
+	// The maximal delay between two attempts to order a certificate after
+	// failures. Defaults to DefaultMaxRetryDelay.
+	MaxRetryDelay time.Duration `json:"max_retry_delay,omitempty"`
+}
+
+// The maximal duration of each phase of an order, independently of the
+// context of the worker, so that a server leaving resources pending forever
+// causes a retry instead of blocking the worker.
+type OrderTimeouts struct {
+	// For each authorization: solving the challenge and waiting for the
+	// authorization to be valid.
+	Authorization time.Duration `json:"authorization,omitempty"`
+
+	// Waiting for the order to be ready, finalizing it and waiting for it to
+	// be valid.
+	Finalization time.Duration `json:"finalization,omitempty"`
+
+	Download time.Duration `json:"download,omitempty"`
+}
+
+const (
+	DefaultAuthorizationTimeout = 10 * time.Minute
+	DefaultFinalizationTimeout  = 10 * time.Minute
+	DefaultDownloadTimeout      = 2 * time.Minute
+)
+
+// max returns the longest timeout, used for operations which are not part of
+// a phase, e.g. submitting an order.
+func (t OrderTimeouts) max() time.Duration {
+	return max(t.Authorization, t.Finalization, t.Download)
+}
+
+type OrderPhase string
+
+const (
+	OrderPhaseAuthorization OrderPhase = "authorization"
+	OrderPhaseFinalization  OrderPhase = "finalization"
+	OrderPhaseDownload      OrderPhase = "download"
+)
+
+type OrderPhaseTimeoutError struct {
+	Phase   OrderPhase
+	Timeout time.Duration
+}
+
+func (err *OrderPhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout (%v)", err.Phase, err.Timeout)
+}
+
+func (err *OrderPhaseTimeoutError) Unwrap() error {
+	return ErrVerificationTimeout
+}
+
+const (
+	// The minimal delay between the start of the validity period of a
+	// certificate and its renewal.
+	minRenewalDelay = time.Hour
+
+	// The delay before renewing a certificate which needs to be renewed as
+	// soon as it has been obtained, usually because the system clock is
+	// wrong.
+	clockSkewRetryDelay = time.Hour
+
+	// The maximal delay between two checks of the system clock while waiting
+	// for the renewal time.
+	clockCheckInterval = 10 * time.Minute
+
+	// The delay before restarting a worker after a panic, doubled after each
+	// panic.
+	workerRestartDelay    = time.Second
+	maxWorkerRestartDelay = time.Hour
+)
+
+// CertificateOrderState describes the order currently processed by the worker
+// managing a certificate.
+type CertificateOrderState struct {
+	URI     string    `json:"uri,omitempty"`
+	Expires time.Time `json:"expires"`
+
+	// The number of orders abandoned because they were about to expire
+	// before being valid.
+	ExpiredOrders int `json:"expired_orders"`
+}
+
 type CertificateWorker struct {
 	Log    *log.Logger
 	Client *Client
 
 	ctx            context.Context
+	name           string
+	request        CertificateRequest
 	certData       *CertificateData
 	orderURI       string
+	orderExpires   time.Time // zero if the server did not provide it
 	certificateURI string
-	eventChan      chan *CertificateEvent
+
+	orderState      CertificateOrderState
+	orderStateMutex sync.Mutex
+
+	subscriptions      []*CertificateSubscription
+	subscriptionsMutex sync.Mutex
+
+	renewalChan chan struct{}
+	done        chan struct{}
+
+	// See recordProgress
+	progressTime  atomic.Int64 // Unix time in nanoseconds
+	progressBound atomic.Int64 // nanoseconds, 0 while waiting
 }
 
-func (c *Client) startCertificateWorker(ctx context.Context, certData *CertificateData, eventChan chan *CertificateEvent) {
+func (c *Client) startCertificateWorker(ctx context.Context, certData *CertificateData) *CertificateWorker {
 	logData := log.Data{
 		"certificate": certData.Name,
 	}
@@ -30,91 +143,416 @@ func (c *Client) startCertificateWorker(ctx context.Context, certData *Certifica
 		Log:    log,
 		Client: c,
 
-		ctx:       ctx,
-		certData:  certData,
-		eventChan: eventChan,
+		ctx:      ctx,
+		name:     certData.Name,
+		request:  certData.CertificateRequest.Clone(),
+		certData: certData,
+
+		renewalChan: make(chan struct{}, 1),
+		done:        make(chan struct{}),
 	}
 
+	w.recordProgress(c.Config().OrderTimeouts.max())
+
+	c.workers[w.name] = &w
+
 	c.wg.Add(1)
 	go w.main()
+
+	return &w
+}
+
+// RenewCertificateNow interrupts the worker managing a certificate if it is
+// waiting, either for the renewal time or before retrying after a failure, so
+// that a new certificate is ordered immediately.
+func (c *Client) RenewCertificateNow(name string) error {
+	c.workersMutex.Lock()
+	w := c.findWorker(name)
+	c.workersMutex.Unlock()
+
+	if w == nil {
+		return fmt.Errorf("%w: %q", ErrUnknownCertificate, name)
+	}
+
+	select {
+	case w.renewalChan <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// CertificateOrderState returns the state of the order currently processed by
+// the worker managing a certificate. The URI and expiration time are empty
+// when no order is in progress.
+func (c *Client) CertificateOrderState(name string) (*CertificateOrderState, error) {
+	c.workersMutex.Lock()
+	w := c.findWorker(name)
+	c.workersMutex.Unlock()
+
+	if w == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCertificate, name)
+	}
+
+	w.orderStateMutex.Lock()
+	state := w.orderState
+	w.orderStateMutex.Unlock()
+
+	return &state, nil
+}
+
+func (w *CertificateWorker) setOrder(uri string, expires time.Time) {
+	w.orderStateMutex.Lock()
+	w.orderState.URI = uri
+	w.orderState.Expires = expires
+	w.orderStateMutex.Unlock()
+}
+
+// StalledCertificateWorkers returns the names of the certificates whose
+// worker has not made any progress for more than twice the timeout of what it
+// is doing (see OrderTimeouts). Phases are interrupted when their timeout
+// expires, so such a worker is blocked, e.g. by a DNS provider ignoring the
+// cancellation of its context.
+func (c *Client) StalledCertificateWorkers() []string {
+	now := time.Now()
+
+	c.workersMutex.Lock()
+	defer c.workersMutex.Unlock()
+
+	var names []string
+	for name, w := range c.workers {
+		if w.stalled(now) {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// recordProgress is called each time the worker starts doing something which
+// should not take longer than timeout, or with a zero timeout when it starts
+// waiting.
+func (w *CertificateWorker) recordProgress(timeout time.Duration) {
+	w.progressTime.Store(time.Now().UnixNano())
+	w.progressBound.Store(int64(2 * timeout))
+}
+
+func (w *CertificateWorker) stalled(now time.Time) bool {
+	bound := w.progressBound.Load()
+	if bound == 0 {
+		return false
+	}
+
+	return now.UnixNano()-w.progressTime.Load() > bound
+}
+
+// Must be called with c.workersMutex locked.
+func (c *Client) findWorker(name string) *CertificateWorker {
+	if w := c.workers[name]; w != nil {
+		return w
+	}
+
+	c.certificatesMutex.RLock()
+	name2, found := c.certificateAliases[name]
+	c.certificatesMutex.RUnlock()
+
+	if found {
+		return c.workers[name2]
+	}
+
+	return nil
+}
+
+// Must be called with c.workersMutex locked.
+func (c *Client) findWorkerByRequest(request *CertificateRequest) *CertificateWorker {
+	for _, w := range c.workers {
+		if w.request.Equal(request) {
+			return w
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) unregisterWorker(w *CertificateWorker) {
+	c.workersMutex.Lock()
+	if c.workers[w.name] == w {
+		delete(c.workers, w.name)
+	}
+	c.workersMutex.Unlock()
+
+	c.certificatesMutex.Lock()
+	maps.DeleteFunc(c.certificateAliases, func(alias, name string) bool {
+		return name == w.name
+	})
+	c.certificatesMutex.Unlock()
+}
+
+// Must be called with c.workersMutex locked so that the worker cannot exit
+// before the subscription has been added.
+func (w *CertificateWorker) subscribe() *CertificateSubscription {
+	s := newCertificateSubscription(w.Client, w.name)
+
+	w.subscriptionsMutex.Lock()
+	w.subscriptions = append(w.subscriptions, s)
+	w.subscriptionsMutex.Unlock()
+
+	return s
+}
+
+func (w *CertificateWorker) unsubscribe(s *CertificateSubscription) {
+	w.subscriptionsMutex.Lock()
+	w.subscriptions = slices.DeleteFunc(w.subscriptions,
+		func(s2 *CertificateSubscription) bool {
+			return s2 == s
+		})
+	w.subscriptionsMutex.Unlock()
+
+	s.close()
+}
+
+func (w *CertificateWorker) closeSubscriptions() {
+	w.subscriptionsMutex.Lock()
+	for _, s := range w.subscriptions {
+		s.close()
+	}
+	w.subscriptions = nil
+	w.subscriptionsMutex.Unlock()
 }
 
 func (w *CertificateWorker) main() {
 	defer w.Client.wg.Done()
-	defer close(w.eventChan)
+	defer close(w.done)
+	defer w.closeSubscriptions()
+	defer w.Client.unregisterWorker(w)
+
+	// A panic is a bug, but giving up would mean that the certificate is
+	// never renewed again and expires weeks later. We restart the worker
+	// instead, waiting longer after each panic.
+	restartDelay := workerRestartDelay
+
+	for {
+		err := w.run()
+		if err == nil {
+			return
+		}
+
+		w.Client.recordPanic(w.name)
+
+		w.sendEvent(&CertificateEvent{
+			Error:           err,
+			NextAttemptTime: time.Now().Add(restartDelay),
+		})
+
+		w.Log.Info("restarting in %v", restartDelay)
+		if !w.wait(restartDelay) {
+			return
+		}
+
+		restartDelay = min(restartDelay*2, maxWorkerRestartDelay)
+	}
+}
 
+// run returns an error if the worker panicked.
+func (w *CertificateWorker) run() (err error) {
 	defer func() {
 		if v := recover(); v != nil {
 			msg := recoverValueString(v)
 			trace := stackTrace(2, 20)
 
 			w.Log.Error("panic: %s\n%s", msg, trace)
-			err := fmt.Errorf("panic: %s", msg)
-
-			w.sendEvent(&CertificateEvent{Error: err})
+			err = fmt.Errorf("%w: %s", ErrCertificateWorkerPanic, msg)
 		}
 	}()
 
 	renewalTime := time.Now()
 
 	if w.certData.ContainsCertificate() {
-		renewalTime = w.Client.Cfg.CertificateRenewalTime(w.certData)
+		renewalTime = w.nextRenewalTime(w.certData)
+		w.Client.recordRenewalTime(w.name, renewalTime)
 
 		// If we already have a certificate (loaded from the data store), signal
 		// its existence immediately.
-		w.onCertificateDataReady()
+		w.onCertificateDataReady(CertificateEventKindLoaded)
+	} else if certData := w.currentCertificate(); certData != nil {
+		// We are restarting after a panic and the certificate has already
+		// been made available.
+		renewalTime = w.nextRenewalTime(certData)
+		w.Client.recordRenewalTime(w.name, renewalTime)
+	}
+
+	now := time.Now()
+	if delay := w.Client.startupDelay(w.name, now); delay > 0 {
+		if t := now.Add(delay); t.After(renewalTime) {
+			renewalTime = t
+		}
 	}
 
 	for {
-		now := time.Now()
-		if renewalTime.After(now) {
+		if renewalTime.After(time.Now()) {
 			w.Log.Info("waiting until %v for renewal",
 				renewalTime.Format(time.RFC3339))
 
-			if !w.wait(renewalTime.Sub(now)) {
-				return
+			if !w.waitUntil(renewalTime) {
+				return nil
 			}
 		}
 
 		// Order a new certificate, retrying regularly if something goes wrong.
 		retryDelay := time.Second
+		orderExpired := false
 
 	retryLoop:
 		for {
-			if err := w.orderCertificate(); err != nil {
+			// The configuration of the client may have been updated since
+			// the last attempt.
+			policy := w.Client.certificateRenewalPolicy(&w.request)
+			retryDelay = min(retryDelay, policy.MaxRetryDelay)
+
+			w.orderURI = ""
+
+			orderStart := time.Now()
+
+			err := w.orderCertificate()
+			w.Client.recordOrder(w.name, err)
+			w.setOrder("", time.Time{})
+
+			if err == nil {
+				w.Client.recordIssuanceDuration(time.Since(orderStart))
+
+				w.logOrderEvent(&OrderLogEntry{
+					Event: OrderLogEventCertificateIssued,
+				}, nil)
+
+				w.Client.logIssuanceEvent(IssuanceLogEventCertificateIssued,
+					w.request.Identifiers)
+			} else {
+				w.logOrderEvent(&OrderLogEntry{
+					Event: OrderLogEventOrderFailed,
+				}, err)
+			}
+
+			// An order about to expire is replaced immediately, once: if
+			// the new one expires too, something else is wrong.
+			if errors.Is(err, ErrOrderExpired) && !orderExpired {
+				orderExpired = true
+
+				w.orderStateMutex.Lock()
+				w.orderState.ExpiredOrders++
+				w.orderStateMutex.Unlock()
+
+				w.Log.Info("%v, submitting a new order", err)
+				continue retryLoop
+			}
+
+			orderExpired = errors.Is(err, ErrOrderExpired)
+
+			if err != nil {
 				// If we cannot obtain a certificate and we do not have one,
-				// stop right now: if we are trying to start a server, we cannot
-				// do anything until we have this first certificate.
-				if !w.certData.ContainsCertificate() {
-					w.sendError(err)
-					return
+				// stop right now unless the renewal policy says otherwise: if
+				// we are trying to start a server, we cannot do anything until
+				// we have this first certificate. Note that w.certData does
+				// not contain the certificate chain anymore once it has been
+				// made available.
+				if !policy.RetryInitialOrder &&
+					w.Client.Certificate(w.name) == nil {
+					w.sendError(err, time.Time{})
+					return nil
 				}
 
-				w.Log.Debug(1, "retrying in %v", retryDelay)
-				if !w.wait(retryDelay) {
-					return
+				// There is no point in retrying before the local rate limit
+				// allows it.
+				delay := retryDelay
+
+				var rlErr *RateLimitError
+				if errors.As(err, &rlErr) {
+					delay = max(time.Until(rlErr.RetryTime), delay)
+				} else {
+					retryDelay = min(retryDelay*2, policy.MaxRetryDelay)
+				}
+
+				w.sendError(err, time.Now().Add(delay))
+
+				w.Log.Debug(1, "retrying in %v", delay)
+				if !w.wait(delay) {
+					return nil
 				}
 
-				retryDelay = min(retryDelay*2, 60*time.Second)
 				continue retryLoop
 			}
 
 			break
 		}
 
-		renewalTime = w.Client.Cfg.CertificateRenewalTime(w.certData)
+		renewalTime = w.nextRenewalTime(w.certData)
+
+		// A certificate which must be renewed as soon as it is obtained means
+		// that the system clock is ahead of the clock of the server. Renewing
+		// immediately would only yield the same result again and again.
+		if now := time.Now(); !renewalTime.After(now) {
+			w.Log.Error("new certificate already due for renewal, the "+
+				"system clock may be wrong; retrying in %v",
+				clockSkewRetryDelay)
+			renewalTime = now.Add(clockSkewRetryDelay)
+		}
+
+		w.Client.recordRenewalTime(w.name, renewalTime)
+
+		kind := CertificateEventKindIssued
+		if w.certData.RenewalCount > 0 {
+			kind = CertificateEventKindRenewed
+		}
+
+		w.onCertificateDataReady(kind)
+	}
+}
 
-		w.onCertificateDataReady()
+// startupDelay returns the delay before the first order of a worker started
+// during the startup window. The offset is derived from the name of the
+// certificate so that it does not change when the client is restarted.
+func (c *Client) startupDelay(name string, now time.Time) time.Duration {
+	window := c.Config().StartupWindow
+	if window <= 0 || c.startTime.IsZero() {
+		return 0
 	}
+
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	offset := time.Duration(h.Sum64() % uint64(window))
+
+	return max(c.startTime.Add(offset).Sub(now), 0)
+}
+
+func (w *CertificateWorker) nextRenewalTime(certData *CertificateData) time.Time {
+	renewalTime := w.Client.Config().CertificateRenewalTime(certData)
+
+	// Never renew a certificate before it has been valid for some time, even
+	// if the renewal time function says otherwise: when the system clock is
+	// behind the one of the server, the certificate may not even be valid
+	// yet and a new one would not be any better.
+	minRenewalTime := certData.LeafCertificate().NotBefore.Add(minRenewalDelay)
+	if renewalTime.Before(minRenewalTime) {
+		renewalTime = minRenewalTime
+	}
+
+	return renewalTime
 }
 
 func (w *CertificateWorker) wait(d time.Duration) bool {
+	w.recordProgress(0)
+	defer w.recordProgress(w.Client.Config().OrderTimeouts.max())
+
 	t := time.NewTimer(d)
 	defer t.Stop()
 
 	select {
 	case <-t.C:
 		return true
+	case <-w.renewalChan:
+		w.Log.Info("renewal requested")
+		return true
 	case <-w.Client.stopChan:
 		return false
 	case <-w.ctx.Done():
@@ -122,20 +560,58 @@ func (w *CertificateWorker) wait(d time.Duration) bool {
 	}
 }
 
-func (w *CertificateWorker) sendEvent(res *CertificateEvent) {
-	select {
-	case w.eventChan <- res:
-	case <-w.Client.stopChan:
-	case <-w.ctx.Done():
+// waitUntil waits until a point in time of the system clock. Timers use the
+// monotonic clock, so we wake up regularly to take changes of the system clock
+// into account, e.g. after an NTP synchronization on a machine which just
+// booted.
+func (w *CertificateWorker) waitUntil(t time.Time) bool {
+	w.recordProgress(0)
+	defer w.recordProgress(w.Client.Config().OrderTimeouts.max())
+
+	for {
+		d := time.Until(t)
+		if d <= 0 {
+			return true
+		}
+
+		timer := time.NewTimer(min(d, clockCheckInterval))
+
+		select {
+		case <-timer.C:
+		case <-w.renewalChan:
+			timer.Stop()
+			w.Log.Info("renewal requested")
+			return true
+		case <-w.Client.stopChan:
+			timer.Stop()
+			return false
+		case <-w.ctx.Done():
+			timer.Stop()
+			return false
+		}
 	}
 }
 
-func (w *CertificateWorker) sendError(err error) {
+func (w *CertificateWorker) sendEvent(ev *CertificateEvent) {
+	ev.Time = time.Now()
+
+	w.subscriptionsMutex.Lock()
+	subscriptions := slices.Clone(w.subscriptions)
+	w.subscriptionsMutex.Unlock()
+
+	for _, s := range subscriptions {
+		s.send(ev)
+	}
+
+	w.Client.publishCertificateEvent(w.name, ev)
+}
+
+func (w *CertificateWorker) sendError(err error, nextAttemptTime time.Time) {
 	w.Log.Error("%v", err)
-	w.sendEvent(&CertificateEvent{Error: err})
+	w.sendEvent(&CertificateEvent{Error: err, NextAttemptTime: nextAttemptTime})
 }
 
-func (w *CertificateWorker) onCertificateDataReady() {
+func (w *CertificateWorker) onCertificateDataReady(kind CertificateEventKind) {
 	// Create the final certificate data structure, store in the client and send
 	// it as an event.
 	//
@@ -145,20 +621,44 @@ func (w *CertificateWorker) onCertificateDataReady() {
 	certData := w.certData.extractCopy()
 
 	w.Client.storeCertificate(certData)
-	w.sendEvent(&CertificateEvent{CertificateData: certData})
+	w.sendEvent(&CertificateEvent{CertificateData: certData, Kind: kind})
 }
 
 func (w *CertificateWorker) orderCertificate() error {
 	w.Log.Info("submitting order")
 
-	now := time.Now()
-	notBefore := now
-	notAfter := now.AddDate(0, 0, w.certData.Validity)
-
 	newOrder := NewOrder{
-		Identifiers: w.certData.Identifiers,
-		NotBefore:   &notBefore,
-		NotAfter:    &notAfter,
+		Identifiers: w.request.Identifiers,
+		NotBefore:   w.request.NotBefore,
+		NotAfter:    w.request.NotAfter,
+		Profile:     w.request.Profile,
+	}
+
+	// Some servers, e.g. Let's Encrypt, reject orders with a validity
+	// period; an explicit one in the request is still sent.
+	if !w.Client.Config().OmitValidityPeriod {
+		now := time.Now()
+
+		if newOrder.NotBefore == nil {
+			newOrder.NotBefore = &now
+		}
+
+		if newOrder.NotAfter == nil {
+			notAfter := w.request.validityEnd(now)
+			newOrder.NotAfter = &notAfter
+		}
+	}
+
+	if rlCfg := w.Client.Config().RateLimits; rlCfg != nil {
+		err := w.Client.checkRateLimits(rlCfg, w.request.Identifiers)
+		if err != nil {
+			var rlErr *RateLimitError
+			if !errors.As(err, &rlErr) || rlCfg.Defer {
+				return err
+			}
+
+			w.Log.Error("%v; submitting order anyway", err)
+		}
 	}
 
 	orderURI, err := w.Client.submitOrder(w.ctx, &newOrder)
@@ -166,10 +666,17 @@ func (w *CertificateWorker) orderCertificate() error {
 		return err
 	}
 
+	w.Client.logIssuanceEvent(IssuanceLogEventOrderSubmitted,
+		w.request.Identifiers)
+
 	w.orderURI = orderURI
+	w.orderExpires = time.Time{}
+	w.setOrder(orderURI, time.Time{})
 
 	w.Log.Debug(1, "created order %q", w.orderURI)
 
+	w.logOrderEvent(&OrderLogEntry{Event: OrderLogEventOrderSubmitted}, nil)
+
 	return w.validateAuthorizations()
 }
 
@@ -179,26 +686,87 @@ func (w *CertificateWorker) validateAuthorizations() error {
 		return fmt.Errorf("cannot fetch order: %w", err)
 	}
 
+	if !order.Expires.IsZero() {
+		w.Log.Debug(1, "order expires at %v",
+			order.Expires.Format(time.RFC3339))
+
+		w.orderExpires = order.Expires
+		w.setOrder(w.orderURI, order.Expires)
+	}
+
 	for _, authURI := range order.Authorizations {
 		auth, _, err := w.Client.fetchAuthorization(w.ctx, authURI)
 		if err != nil {
 			return fmt.Errorf("cannot fetch authorization: %w", err)
 		}
 
-		if err := w.validateAuthorization(authURI, auth); err != nil {
+		timeout := w.Client.Config().OrderTimeouts.Authorization
+
+		err = w.runPhase(OrderPhaseAuthorization, timeout,
+			func(ctx context.Context) error {
+				return w.validateAuthorization(ctx, authURI, auth)
+			})
+		if err != nil {
 			return fmt.Errorf("cannot validate authorization %q: %w",
 				auth.Identifier, err)
 		}
 	}
 
-	return w.finalizeOrder()
+	timeouts := w.Client.Config().OrderTimeouts
+
+	var privateKey crypto.Signer
+
+	err = w.runPhase(OrderPhaseFinalization, timeouts.Finalization,
+		func(ctx context.Context) (err error) {
+			privateKey, err = w.finalizeOrder(ctx)
+			return
+		})
+	if err != nil {
+		return err
+	}
+
+	return w.runPhase(OrderPhaseDownload, timeouts.Download,
+		func(ctx context.Context) error {
+			return w.downloadCertificate(ctx, privateKey)
+		})
+}
+
+// runPhase runs a phase of the processing of an order, returning an
+// OrderPhaseTimeoutError if it did not complete in time.
+func (w *CertificateWorker) runPhase(phase OrderPhase, timeout time.Duration, fn func(context.Context) error) error {
+	timeoutErr := &OrderPhaseTimeoutError{Phase: phase, Timeout: timeout}
+
+	ctx, cancel := context.WithTimeoutCause(w.ctx, timeout, timeoutErr)
+	defer cancel()
+
+	w.recordProgress(timeout)
+	defer w.recordProgress(w.Client.Config().OrderTimeouts.max())
+
+	start := time.Now()
+
+	err := fn(ctx)
+	if err != nil && w.ctx.Err() == nil &&
+		errors.Is(context.Cause(ctx), timeoutErr) {
+		return timeoutErr
+	}
+
+	if err == nil {
+		w.Client.recordOrderPhaseDuration(phase, time.Since(start))
+	}
+
+	return err
 }
 
-func (w *CertificateWorker) validateAuthorization(authURI string, auth *Authorization) error {
+func (w *CertificateWorker) validateAuthorization(ctx context.Context, authURI string, auth *Authorization) error {
 	w.Log.Info("validating authorization %q", auth.Identifier)
 
 	challenge := w.Client.selectAuthorizationChallenge(auth)
 	if challenge == nil {
+		if w.Client.Config().DNSOnly {
+			return fmt.Errorf("no %s challenge available (DNS-only mode)",
+				ChallengeTypeDNS01)
+		}
+
 		return fmt.Errorf("no supported challenge available")
 	}
 
@@ -208,104 +776,183 @@ func (w *CertificateWorker) validateAuthorization(authURI string, auth *Authoriz
 		return nil
 	}
 
-	if err := w.solveChallenge(challenge, auth); err != nil {
+	entry := OrderLogEntry{
+		Identifier:    auth.Identifier.String(),
+		ChallengeType: challenge.Type,
+	}
+
+	records, err := w.solveChallenge(ctx, challenge, auth)
+	if err != nil {
+		entry.Event = OrderLogEventAuthorizationInvalid
+		w.logOrderEvent(&entry, err)
 		return fmt.Errorf("cannot solve challenge: %w", err)
 	}
 
-	if err := w.Client.waitForAuthorizationValid(w.ctx, authURI); err != nil {
+	entry.ValidationRecord = records
+
+	err = w.Client.waitForAuthorizationValid(ctx, authURI, w.orderExpires)
+	if err != nil {
+		entry.Event = OrderLogEventAuthorizationInvalid
+		w.logOrderEvent(&entry, err)
 		return err
 	}
 
+	entry.Event = OrderLogEventAuthorizationValid
+	w.logOrderEvent(&entry, nil)
+
 	w.Log.Debug(1, "authorization %q ready", auth.Identifier)
 
 	return nil
 }
 
-func (w *CertificateWorker) solveChallenge(challenge *Challenge, auth *Authorization) error {
+func (w *CertificateWorker) solveChallenge(ctx context.Context, challenge *Challenge, auth *Authorization) ([]ValidationRecord, error) {
 	w.Log.Info("solving challenge %q for authorization %q",
 		challenge.Type, auth.Identifier)
 
-	if err := w.Client.setupChallenge(w.ctx, challenge); err != nil {
-		return err
+	err := w.Client.setupChallenge(ctx, challenge, auth, w.orderExpires)
+	if err != nil {
+		return nil, err
 	}
 
 	defer func() {
-		if err := w.Client.teardownChallenge(w.ctx, challenge); err != nil {
+		if err := w.Client.teardownChallenge(w.ctx, challenge, auth); err != nil {
 			w.Log.Error("cannot teardown challenge: %v", err)
 		}
 	}()
 
-	if err := w.Client.submitChallenge(w.ctx, challenge.URL); err != nil {
-		return fmt.Errorf("cannot submit challenge: %w", err)
+	if err := w.Client.submitChallenge(ctx, challenge.URL); err != nil {
+		return nil, fmt.Errorf("cannot submit challenge: %w", err)
 	}
 
-	if err := w.Client.waitForChallengeValid(w.ctx, challenge.URL); err != nil {
-		return err
+	validChallenge, err := w.Client.waitForChallengeValid(ctx, challenge.URL,
+		w.orderExpires)
+	if err != nil {
+		var challengeErr *ChallengeError
+		if errors.As(err, &challengeErr) {
+			challengeErr.Identifier = auth.Identifier
+			challengeErr.SolverState = w.Client.challengeSolverState(challenge,
+				auth)
+		}
+
+		return nil, err
 	}
 
-	w.Log.Debug(1, "challenge %q solved", challenge.Type)
+	records := validChallenge.ValidationRecord
 
-	return nil
+	if len(records) > 0 {
+		w.Log.Debug(1, "challenge %q solved (%s)", challenge.Type,
+			FormatValidationRecords(records))
+	} else {
+		w.Log.Debug(1, "challenge %q solved", challenge.Type)
+	}
+
+	return records, nil
 }
 
-func (w *CertificateWorker) finalizeOrder() error {
+func (w *CertificateWorker) finalizeOrder(ctx context.Context) (crypto.Signer, error) {
 	w.Log.Info("finalizing order")
 
-	order, err := w.Client.waitForOrderReady(w.ctx, w.orderURI)
+	order, err := w.Client.waitForOrderReady(ctx, w.orderURI, w.orderExpires)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	w.Log.Debug(1, "order ready")
 
-	if w.certData.PrivateKey == nil {
-		privateKey, err := w.Client.Cfg.GenerateCertificatePrivateKey()
+	// The private key of the worker is only replaced once the new
+	// certificate has been obtained.
+	privateKey := w.certData.PrivateKey
+	if privateKey == nil || !w.request.ReuseKey {
+		privateKey, err = w.generatePrivateKey()
 		if err != nil {
-			return fmt.Errorf("cannot generate private key: %w", err)
+			return nil, fmt.Errorf("cannot generate private key: %w", err)
 		}
-		w.certData.PrivateKey = privateKey
 	}
 
-	csr, err := w.Client.generateCSR(w.certData.Identifiers,
-		w.certData.PrivateKey)
+	csr, err := w.Client.generateCSR(w.request.Identifiers, privateKey)
 	if err != nil {
-		return fmt.Errorf("cannot generate certificate request: %w", err)
+		return nil, fmt.Errorf("cannot generate certificate request: %w", err)
 	}
 
-	order, err = w.Client.finalizeOrder(w.ctx, order.Finalize, csr)
+	order, err = w.Client.finalizeOrder(ctx, order.Finalize, csr)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	w.Log.Debug(1, "order finalized")
 
-	order, err = w.Client.waitForOrderValid(w.ctx, w.orderURI)
+	order, err = w.Client.waitForOrderValid(ctx, w.orderURI, w.orderExpires)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	w.Log.Debug(1, "order valid")
 
 	if order.Certificate == nil {
-		return fmt.Errorf("valid order does not contain a certificate URI")
+		return nil, fmt.Errorf("valid order does not contain a certificate URI")
 	}
 
 	w.certificateURI = *order.Certificate
 
-	return w.downloadCertificate()
+	return privateKey, nil
 }
 
-func (w *CertificateWorker) downloadCertificate() error {
+func (w *CertificateWorker) generatePrivateKey() (crypto.Signer, error) {
+	if keyType := w.request.KeyType; keyType != "" {
+		return GeneratePrivateKey(keyType)
+	}
+
+	return w.Client.Config().GenerateCertificatePrivateKey()
+}
+
+// currentCertificate returns the certificate available for the name of the
+// worker if it was obtained for the current request. It ignores a previous
+// certificate served while the first certificate for a modified request is
+// being obtained.
+func (w *CertificateWorker) currentCertificate() *CertificateData {
+	certData := w.Client.Certificate(w.name)
+	if certData == nil {
+		return nil
+	}
+
+	if !sameIdentifierSet(certData.Identifiers, w.request.Identifiers) ||
+		certData.ValidityPeriod() != w.request.ValidityPeriod() {
+		return nil
+	}
+
+	return certData
+}
+
+func (w *CertificateWorker) downloadCertificate(ctx context.Context, privateKey crypto.Signer) error {
 	w.Log.Info("downloading certificate")
 
-	cert, err := w.Client.downloadCertificate(w.ctx, w.certificateURI)
+	chain, alternateURIs, err := w.Client.downloadCertificate(ctx,
+		w.certificateURI)
 	if err != nil {
 		return err
 	}
 
-	w.certData.Certificate = cert
+	preferredChain := w.Client.certificatePreferredChain(&w.request)
+	if preferredChain != "" {
+		chain = w.selectChain(ctx, chain, alternateURIs, preferredChain)
+	}
+
+	// Certificates loaded from the data store may have been obtained before
+	// IssuedAt was introduced.
+	now := time.Now()
+	if w.currentCertificate() != nil || !w.certData.IssuedAt.IsZero() {
+		w.certData.RenewedAt = now
+		w.certData.RenewalCount++
+	} else {
+		w.certData.IssuedAt = now
+	}
+
+	w.certData.PrivateKey = privateKey
+	w.certData.Certificate = chain
+	w.certData.CertificateURI = w.certificateURI
+	w.certData.updateCertificateIdentifiers()
 
-	dataStore := w.Client.Cfg.DataStore
+	dataStore := w.Client.Config().DataStore
 	if err := dataStore.StoreCertificateData(w.certData); err != nil {
 		return fmt.Errorf("cannot store certificate data: %w", err)
 	}
@@ -0,0 +1,456 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateWorkerFakeServer(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		leaf := ev.CertificateData.LeafCertificate()
+		assert.Equal([]string{"example.com"}, leaf.DNSNames)
+
+		// Challenge records must have been deleted.
+		assert.Empty(s.DNSProvider.TXTRecords("_acme-challenge.example.com"))
+
+		entries, err := c.OrderLog("test")
+		require.NoError(err)
+
+		i := slices.IndexFunc(entries, func(entry *OrderLogEntry) bool {
+			return entry.Event == OrderLogEventAuthorizationValid
+		})
+		require.GreaterOrEqual(i, 0)
+		assert.Equal([]ValidationRecord{{Hostname: "example.com"}},
+			entries[i].ValidationRecord)
+	})
+}
+
+func TestCertificateWorkerValidityPeriod(t *testing.T) {
+	ids := []Identifier{DNSIdentifier("example.com")}
+
+	obtainCertificate := func(setup func(*ClientCfg), request CertificateRequest) *x509.Certificate {
+		s := newFakeACMEServer(t)
+
+		var leaf *x509.Certificate
+
+		withFakeTestClientCfg(t, s, setup, func(c *Client) {
+			eventChan, err := c.RequestCertificate(context.Background(),
+				"test", request)
+			require.NoError(t, err)
+
+			ev := <-eventChan
+			require.NotNil(t, ev)
+			require.NoError(t, ev.Error)
+
+			leaf = ev.CertificateData.LeafCertificate()
+		})
+
+		return leaf
+	}
+
+	validity := func(cert *x509.Certificate) time.Duration {
+		return cert.NotAfter.Sub(cert.NotBefore)
+	}
+
+	leaf := obtainCertificate(func(cfg *ClientCfg) {},
+		CertificateRequest{Identifiers: ids, ValidityDuration: 6 * time.Hour})
+	assert.InDelta(t, 6*time.Hour, validity(leaf), float64(time.Second))
+
+	// Without validity period, the fake server issues certificates for 90
+	// days.
+	leaf = obtainCertificate(func(cfg *ClientCfg) {
+		cfg.OmitValidityPeriod = true
+	}, CertificateRequest{Identifiers: ids, Validity: 1})
+	assert.InDelta(t, 90*24*time.Hour, validity(leaf), float64(time.Second))
+
+	notAfter := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+
+	leaf = obtainCertificate(func(cfg *ClientCfg) {
+		cfg.OmitValidityPeriod = true
+	}, CertificateRequest{Identifiers: ids, NotAfter: &notAfter})
+	assert.True(t, notAfter.Equal(leaf.NotAfter))
+}
+
+func TestCertificateWorkerRateLimited(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.RateLimitedOrders = 1
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		// Without any existing certificate, the worker gives up after the
+		// first failure.
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.Error(ev.Error)
+
+		var details *ProblemDetails
+		require.True(errors.As(ev.Error, &details))
+		assert.Equal(ErrorTypeRateLimited, details.Type)
+		assert.True(ev.NextAttemptTime.IsZero())
+
+		_, open := <-eventChan
+		assert.False(open)
+
+		assert.Equal(1, s.Requests("new-order"))
+	})
+}
+
+func TestCertificateWorkerRetryInitialOrder(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.RateLimitedOrders = 2
+
+	setup := func(cfg *ClientCfg) {
+		cfg.RenewalPolicy = RenewalPolicy{
+			RetryInitialOrder: true,
+			MaxRetryDelay:     10 * time.Millisecond,
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		for range 2 {
+			ev := <-eventChan
+			require.NotNil(ev)
+			require.Error(ev.Error)
+			assert.False(ev.NextAttemptTime.IsZero())
+		}
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		assert.Equal(3, s.Requests("new-order"))
+	})
+}
+
+func TestCertificateWorkerPendingForever(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeACMEServer(t)
+	s.PendingForever = true
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			200*time.Millisecond)
+		defer cancel()
+
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(ctx, "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.ErrorIs(ev.Error, ErrVerificationTimeout)
+	})
+}
+
+func TestCertificateWorkerChallengeError(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.DNSProvider.IgnoredCreations = 1
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+
+		var challengeErr *ChallengeError
+		require.ErrorAs(ev.Error, &challengeErr)
+
+		assert.Equal(ids[0], challengeErr.Identifier)
+		assert.Equal(ChallengeTypeDNS01, challengeErr.ChallengeType)
+		assert.Equal([]ValidationRecord{{Hostname: "example.com"}},
+			challengeErr.ValidationRecord)
+		assert.Equal("_acme-challenge.example.com",
+			challengeErr.SolverState.DNSRecordName)
+		assert.NotEmpty(challengeErr.SolverState.DNSRecordValue)
+
+		var problem *ProblemDetails
+		require.ErrorAs(ev.Error, &problem)
+		assert.Equal(ErrorTypeIncorrectResponse, problem.Type)
+	})
+}
+
+func TestCertificateWorkerProcessingOrder(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeACMEServer(t)
+	s.ProcessingOrders = 2
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+	})
+}
+
+func TestCertificateWorkerOrderExpiration(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.PendingForever = true
+	s.OrderLifetime = 500 * time.Millisecond
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.ErrorIs(ev.Error, ErrOrderExpired)
+
+		// The first order is replaced immediately, the worker gives up
+		// when the second one expires.
+		assert.Equal(2, s.Requests("new-order"))
+	})
+}
+
+func TestCertificateWorkerPhaseTimeout(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.PendingForever = true
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.OrderTimeouts.Authorization = 200 * time.Millisecond
+	}, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+
+		var timeoutErr *OrderPhaseTimeoutError
+		require.ErrorAs(ev.Error, &timeoutErr)
+		assert.Equal(OrderPhaseAuthorization, timeoutErr.Phase)
+		assert.ErrorIs(ev.Error, ErrVerificationTimeout)
+	})
+}
+
+// blockingDNSProvider blocks when creating a record, ignoring the context,
+// until it is released.
+type blockingDNSProvider struct {
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingDNSProvider) SetTXTRecord(ctx context.Context, name, value string) error {
+	select {
+	case p.blocked <- struct{}{}:
+	default:
+	}
+
+	<-p.release
+	return errors.New("released")
+}
+
+func (p *blockingDNSProvider) DeleteTXTRecord(ctx context.Context, name, value string) error {
+	return nil
+}
+
+func TestCertificateWorkerStalled(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	provider := blockingDNSProvider{
+		blocked: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.OrderTimeouts.Authorization = 100 * time.Millisecond
+		cfg.DNSChallengeSolver = &DNSChallengeSolverCfg{Provider: &provider}
+		cfg.RenewalPolicy.RetryInitialOrder = true
+	}, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		<-provider.blocked
+		assert.Empty(c.StalledCertificateWorkers())
+
+		// The authorization phase has timed out but the worker is still
+		// blocked.
+		assert.Eventually(func() bool {
+			return slices.Equal(c.StalledCertificateWorkers(),
+				[]string{"test"})
+		}, 5*time.Second, 10*time.Millisecond)
+
+		close(provider.release)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.Error(ev.Error)
+
+		// The worker is now waiting before retrying
+		assert.Empty(c.StalledCertificateWorkers())
+	})
+}
+
+func TestCertificateWorkerClockSkew(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	// With a system clock two days ahead of the server, a certificate valid
+	// for one day has already expired when we obtain it.
+	s := newFakeACMEServer(t)
+	s.ClockOffset = -48 * time.Hour
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		time.Sleep(100 * time.Millisecond)
+
+		assert.Equal(1, s.Requests("new-order"))
+
+		c.metricsMutex.Lock()
+		renewalTime := c.metrics["test"].renewalTime
+		c.metricsMutex.Unlock()
+
+		assert.WithinDuration(time.Now().Add(clockSkewRetryDelay),
+			renewalTime, time.Minute)
+	})
+}
+
+func TestCertificateWorkerPanic(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	var nbCalls atomic.Int32
+
+	setup := func(cfg *ClientCfg) {
+		cfg.CertificateRenewalTime = func(certData *CertificateData) time.Time {
+			if nbCalls.Add(1) == 1 {
+				panic("test")
+			}
+
+			return CertificateRenewalTime(certData)
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.ErrorIs(ev.Error, ErrCertificateWorkerPanic)
+
+		// The worker is restarted and uses the certificate it obtained
+		// before panicking.
+		ev = <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+
+		assert.Equal(1, s.Requests("new-order"))
+
+		c.metricsMutex.Lock()
+		nbPanics := c.metrics["test"].workerPanics
+		c.metricsMutex.Unlock()
+
+		assert.Equal(uint64(1), nbPanics)
+	})
+}
+
+func TestCertificateWorkerStartupDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.StartupWindow = time.Hour
+	}, func(c *Client) {
+		now := c.startTime
+
+		delay1 := c.startupDelay("foo", now)
+		delay2 := c.startupDelay("bar", now)
+
+		assert.Less(delay1, time.Hour)
+		assert.Less(delay2, time.Hour)
+		assert.NotEqual(delay1, delay2)
+
+		// Offsets are stable and consumed as time passes
+		assert.Equal(delay1, c.startupDelay("foo", now))
+		assert.Equal(time.Duration(0),
+			c.startupDelay("foo", now.Add(time.Hour)))
+	})
+}
@@ -1,34 +1,67 @@
 package acme
 
 import (
-	"bytes"
 	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"reflect"
+	"maps"
+	"net/netip"
 	"slices"
+	"strings"
+	"time"
 
 	"golang.org/x/net/idna"
 )
 
+var (
+	ErrCertificateAlreadyRequested = errors.New("certificate already requested with different parameters")
+	ErrUnknownCertificate          = errors.New("unknown certificate")
+	ErrCertificateWorkerPanic      = errors.New("panic")
+)
+
 // See the GetCertificate field of tls.Config.
 type GetTLSCertificateFunc func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 
+type CertificateEventKind string
+
+const (
+	// The certificate was already available, e.g. loaded from the data
+	// store when the client started.
+	CertificateEventKindLoaded CertificateEventKind = "loaded"
+
+	CertificateEventKindIssued  CertificateEventKind = "issued"
+	CertificateEventKindRenewed CertificateEventKind = "renewed"
+)
+
 type CertificateEvent struct {
 	// An event contains either certificate data or an error. This is why we
 	// need sum types...
 
 	CertificateData *CertificateData
 	Error           error
+
+	// For certificate data, whether the certificate is new or not.
+	Kind CertificateEventKind
+
+	// For errors, the time of the next attempt to obtain the certificate,
+	// or the zero time if the worker gave up.
+	NextAttemptTime time.Time
+
+	// The time the event was sent.
+	Time time.Time
 }
 
 func (c *Client) GetTLSCertificateFunc(name string) GetTLSCertificateFunc {
 	return func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
 		certData := c.Certificate(name)
+		if certData == nil {
+			certData = c.fallbackCertificate(name)
+		}
 		if certData == nil {
 			return nil, fmt.Errorf("no certificate available")
 		}
@@ -37,18 +70,86 @@ func (c *Client) GetTLSCertificateFunc(name string) GetTLSCertificateFunc {
 	}
 }
 
+func (c *Client) GetAnyTLSCertificateFunc() GetTLSCertificateFunc {
+	return func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		certData := c.CertificateForHost(info.ServerName)
+		if certData != nil {
+			return certData.TLSCertificate(), nil
+		}
+
+		var onDemandErr error
+		if c.Config().OnDemand != nil {
+			certData, onDemandErr = c.obtainOnDemandCertificate(
+				info.Context(), info.ServerName)
+			if onDemandErr == nil {
+				return certData.TLSCertificate(), nil
+			}
+		}
+
+		if certData := c.findFallbackCertificateForHost(info.ServerName); certData != nil {
+			return certData.TLSCertificate(), nil
+		}
+
+		if onDemandErr != nil {
+			return nil, fmt.Errorf("cannot obtain certificate for %q: %w",
+				info.ServerName, onDemandErr)
+		}
+
+		return nil, fmt.Errorf("no certificate available for %q",
+			info.ServerName)
+	}
+}
+
+// CertificateForHost returns a certificate whose identifiers match a host
+// name, or nil if there is none. Host names are normalized (trailing dot,
+// IDNA, case), and exact matches are preferred over wildcard matches.
+func (c *Client) CertificateForHost(host string) *CertificateData {
+	host, err := normalizeHost(host)
+	if err != nil || host == "" {
+		return nil
+	}
+
+	// Exact matches always win over wildcard matches, whatever the order of
+	// certificates.
+	var wildcardMatch *CertificateData
+
+	for _, certData := range *c.certificates.Load() {
+		for _, id := range certData.Identifiers {
+			switch matchIdentifier(id, host) {
+			case identifierMatchExact:
+				return certData
+			case identifierMatchWildcard:
+				wildcardMatch = certData
+			}
+		}
+	}
+
+	return wildcardMatch
+}
+
 func (c *Client) Certificate(name string) *CertificateData {
-	c.certificatesMutex.RLock()
-	certData := c.certificates[name]
-	c.certificatesMutex.RUnlock()
+	return (*c.certificates.Load())[name]
+}
+
+// CertificateVersion returns the checksum of the current certificate
+// identified by name (see CertificateData.Checksum), or an empty string if
+// there is no certificate. It lets applications detect whether a certificate
+// has actually changed, e.g. after a renewal reusing the private key which
+// returned the same certificate chain.
+func (c *Client) CertificateVersion(name string) string {
+	if certData := c.Certificate(name); certData != nil {
+		return certData.Checksum()
+	}
 
-	return certData
+	return ""
 }
 
 func (c *Client) WaitForCertificate(ctx context.Context, name string) *CertificateData {
+	// Certificates are stored with the mutex locked, so we cannot miss one
+	// between the lookup and the addition of the waiter.
 	c.certificatesMutex.Lock()
 
-	if certData := c.certificates[name]; certData != nil {
+	if certData := c.Certificate(name); certData != nil {
 		c.certificatesMutex.Unlock()
 		return certData
 	}
@@ -57,10 +158,7 @@ func (c *Client) WaitForCertificate(ctx context.Context, name string) *Certifica
 
 	c.certificatesMutex.Unlock()
 
-	defer func() {
-		c.removeCertificateWaiter(name, ch)
-		close(ch)
-	}()
+	defer c.removeCertificateWaiter(name, ch)
 
 	select {
 	case certData := <-ch:
@@ -73,7 +171,10 @@ func (c *Client) WaitForCertificate(ctx context.Context, name string) *Certifica
 }
 
 func (c *Client) addCertificateWaiter(name string) chan *CertificateData {
-	ch := make(chan *CertificateData)
+	// The channel is buffered and written to without blocking: a waiter only
+	// needs a single certificate, and we do not want a waiter which is
+	// leaving to block the worker.
+	ch := make(chan *CertificateData, 1)
 
 	c.certificateWaitersMutex.Lock()
 
@@ -98,47 +199,309 @@ func (c *Client) removeCertificateWaiter(name string, ch chan *CertificateData)
 }
 
 func (c *Client) storeCertificate(certData *CertificateData) {
-	name := certData.Name
-
 	c.certificatesMutex.Lock()
+	defer c.certificatesMutex.Unlock()
+
+	names := []string{certData.Name}
+	for alias, name := range c.certificateAliases {
+		if name == certData.Name {
+			names = append(names, alias)
+		}
+	}
+
+	c.storeCertificateUnderNames(names, certData)
+}
+
+// Must be called with c.certificatesMutex locked.
+func (c *Client) storeCertificateUnderNames(names []string, certData *CertificateData) {
+	// Certificate data are never modified once stored, so this is the only
+	// place where cached values can be set without a race.
+	if certData.tlsCertificate == nil {
+		certData.tlsCertificate = certData.newTLSCertificate()
+	}
 
-	c.certificates[name] = certData
+	if certData.checksum == "" {
+		certData.checksum = certData.computeChecksum()
+	}
+
+	certs := maps.Clone(*c.certificates.Load())
+	for _, name := range names {
+		certs[name] = certData
+	}
+	c.certificates.Store(&certs)
+
+	for _, name := range names {
+		c.discardFallbackCertificate(name)
+	}
 
 	c.certificateWaitersMutex.Lock()
-	for _, ch := range c.certificateWaiters[name] {
-		ch <- certData
+	for _, name := range names {
+		for _, ch := range c.certificateWaiters[name] {
+			select {
+			case ch <- certData:
+			default:
+			}
+		}
 	}
 	c.certificateWaitersMutex.Unlock()
+}
 
-	c.certificatesMutex.Unlock()
+// RequestCertificate starts a worker obtaining and renewing a certificate,
+// and returns a channel receiving its events.
+//
+// The context controls the worker: once it is cancelled, the certificate is
+// not renewed anymore and the channels of all subscribers are closed. If the
+// certificate is already managed by a worker (or with DeduplicateCertificates,
+// a certificate with the same request), the caller only subscribes to its
+// events: cancelling the context closes the channel returned but does not
+// stop the worker.
+func (c *Client) RequestCertificate(ctx context.Context, name string, request CertificateRequest) (<-chan *CertificateEvent, error) {
+	if c.Config().MonitorOnly {
+		return nil, ErrMonitorOnly
+	}
+
+	if err := request.Check(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request: %w", err)
+	}
+
+	request = request.Clone()
+
+	c.workersMutex.Lock()
+	eventChan, found, err := c.attachToWorker(ctx, name, &request)
+	c.workersMutex.Unlock()
+
+	if found || err != nil {
+		return eventChan, err
+	}
+
+	// Loading certificate data and generating the fallback certificate are
+	// done without workersMutex locked so that other requests are not
+	// blocked.
+	certData, corruptionErr, err := c.prepareCertificateData(name, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.workersMutex.Lock()
+	defer c.workersMutex.Unlock()
+
+	// A concurrent request may have started a worker in the meantime
+	eventChan, found, err = c.attachToWorker(ctx, name, &request)
+	if found || err != nil {
+		return eventChan, err
+	}
+
+	w := c.startCertificateWorker(ctx, certData)
+
+	s := w.subscribe()
+
+	if corruptionErr != nil {
+		now := time.Now()
+
+		ev := CertificateEvent{
+			Error:           corruptionErr,
+			NextAttemptTime: now,
+			Time:            now,
+		}
+
+		s.send(&ev)
+		c.publishCertificateEvent(name, &ev)
+	}
+
+	return s.C, nil
+}
+
+// attachToWorker subscribes to the events of the worker managing a
+// certificate. It returns false if there is no such worker.
+//
+// Must be called with c.workersMutex locked.
+func (c *Client) attachToWorker(ctx context.Context, name string, request *CertificateRequest) (<-chan *CertificateEvent, bool, error) {
+	// If the certificate is already managed by a worker, we simply subscribe
+	// to its events instead of ordering the same certificate twice.
+	if w := c.findWorker(name); w != nil {
+		if !w.request.Equal(request) {
+			return nil, true, fmt.Errorf("%w: %q",
+				ErrCertificateAlreadyRequested, name)
+		}
+
+		return c.subscribeToWorker(ctx, w, name), true, nil
+	}
+
+	// If a worker already manages a certificate with the same identifiers,
+	// we do not start a new one: the name becomes an alias and certificates
+	// obtained by the worker are made available under both names. Note that
+	// the Name field of these certificates is always the name of the
+	// original certificate.
+	if c.Config().DeduplicateCertificates {
+		if w := c.findWorkerByRequest(request); w != nil {
+			c.Log.Info("using certificate %q for %q", w.name, name)
+
+			c.certificatesMutex.Lock()
+			c.certificateAliases[name] = w.name
+			c.certificatesMutex.Unlock()
+
+			return c.subscribeToWorker(ctx, w, name), true, nil
+		}
+	}
+
+	return nil, false, nil
 }
 
-func (c *Client) RequestCertificate(ctx context.Context, name string, identifiers []Identifier, validity int) (<-chan *CertificateEvent, error) {
-	certData, err := c.Cfg.DataStore.LoadCertificateData(name)
-	if err != nil && err != ErrCertificateNotFound {
-		return nil, fmt.Errorf("cannot load certificate: %w", err)
+// prepareCertificateData returns the certificate data a new worker starts
+// with. If stored data are corrupted, they are quarantined and the
+// corruption error is returned so that it can be reported to subscribers.
+func (c *Client) prepareCertificateData(name string, request *CertificateRequest) (certData *CertificateData, corruptionErr, err error) {
+	certData, err = c.loadCertificateData(name)
+	if err != nil && !errors.Is(err, ErrCorruptedCertificateData) {
+		return nil, nil, fmt.Errorf("cannot load certificate: %w", err)
 	}
 
+	// Serving a broken certificate would be worse than serving none: the
+	// data is moved away and a new certificate is ordered.
+	corruptionErr = err
+	if corruptionErr != nil {
+		c.Log.Error("%v", corruptionErr)
+		c.quarantineCertificateData(name)
+	}
+
+	// A stored certificate is only reused if it has the same identifiers and
+	// validity; other parameters only apply to the next renewal.
 	var sameIds, sameValidity bool
 	if certData != nil {
-		sameIds = reflect.DeepEqual(certData.Identifiers, identifiers)
-		sameValidity = certData.Validity == validity
+		sameIds = sameIdentifierSet(certData.Identifiers, request.Identifiers)
+		sameValidity = certData.ValidityPeriod() == request.ValidityPeriod()
 	}
 
 	if certData == nil || !sameIds || !sameValidity {
+		// If the request changed, the previous certificate is still better
+		// than nothing for the identifiers it covers: it is served until
+		// the new one has been obtained.
+		if certData != nil && keepPreviousCertificate(certData, request) {
+			c.Log.Info("request changed for certificate %q, using the "+
+				"previous certificate until a new one is obtained", name)
+			c.storeCertificate(certData)
+		}
+
 		certData = &CertificateData{
 			Name: name,
+		}
+	}
+
+	certData.CertificateRequest = *request
+
+	if c.Config().SelfSignedFallback && !certData.ContainsCertificate() {
+		if err := c.createFallbackCertificate(name, request.Identifiers); err != nil {
+			return nil, nil, fmt.Errorf("cannot create fallback "+
+				"certificate: %w", err)
+		}
+	}
+
+	return certData, corruptionErr, nil
+}
+
+func keepPreviousCertificate(certData *CertificateData, request *CertificateRequest) bool {
+	if !certData.ContainsCertificate() {
+		return false
+	}
+
+	if !time.Now().Before(certData.LeafCertificate().NotAfter) {
+		return false
+	}
+
+	return slices.ContainsFunc(certData.Identifiers, func(id Identifier) bool {
+		return slices.Contains(request.Identifiers, id)
+	})
+}
+
+// loadCertificateData loads and verifies certificate data from the data
+// store. It returns a nil value without error if there is no certificate.
+func (c *Client) loadCertificateData(name string) (*CertificateData, error) {
+	certData, err := c.Config().DataStore.LoadCertificateData(name)
+	if err != nil {
+		if errors.Is(err, ErrCertificateNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if err := certData.Verify(); err != nil {
+		return nil, fmt.Errorf("invalid certificate %q: %w", name, err)
+	}
+
+	return certData, nil
+}
+
+// DeleteCertificateData deletes the data of a certificate from the data
+// store. It returns ErrUnsupportedDataStoreOperation if the data store does
+// not implement CertificateDataDeleter.
+func (c *Client) DeleteCertificateData(name string) error {
+	store, ok := c.Config().DataStore.(CertificateDataDeleter)
+	if !ok {
+		return fmt.Errorf("%w: certificate deletion",
+			ErrUnsupportedDataStoreOperation)
+	}
+
+	return store.DeleteCertificateData(name)
+}
+
+func (c *Client) quarantineCertificateData(name string) {
+	store, ok := c.Config().DataStore.(CertificateDataQuarantiner)
+	if !ok {
+		return
+	}
+
+	if err := store.QuarantineCertificateData(name); err != nil {
+		c.Log.Error("cannot quarantine certificate data %q: %v", name, err)
+		return
+	}
+
+	c.Log.Info("quarantined certificate data %q", name)
+}
+
+// Must be called with c.workersMutex locked.
+func (c *Client) subscribeToWorker(ctx context.Context, w *CertificateWorker, name string) <-chan *CertificateEvent {
+	s := w.subscribe()
+
+	// The worker belongs to the caller which started it; the context of
+	// other callers only controls their subscription.
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.unsubscribe(s)
+			case <-w.done:
+			}
+		}()
+	}
 
-			Identifiers: slices.Clone(identifiers),
-			Validity:    validity,
+	c.certificatesMutex.Lock()
+	defer c.certificatesMutex.Unlock()
+
+	if certData := c.Certificate(w.name); certData != nil {
+		if name != w.name {
+			c.storeCertificateUnderNames([]string{name}, certData)
 		}
+
+		s.send(&CertificateEvent{
+			CertificateData: certData,
+			Kind:            CertificateEventKindLoaded,
+			Time:            time.Now(),
+		})
 	}
 
-	eventChan := make(chan *CertificateEvent)
+	return s.C
+}
 
-	c.startCertificateWorker(ctx, certData, eventChan)
+func sameIdentifierSet(ids1, ids2 []Identifier) bool {
+	cmp := func(id1, id2 Identifier) int {
+		return strings.Compare(id1.String(), id2.String())
+	}
+
+	ids1 = slices.SortedFunc(slices.Values(ids1), cmp)
+	ids2 = slices.SortedFunc(slices.Values(ids2), cmp)
 
-	return eventChan, nil
+	return slices.Equal(ids1, ids2)
 }
 
 func (c *Client) generateCSR(ids []Identifier, privateKey crypto.Signer) ([]byte, error) {
@@ -155,6 +518,15 @@ func (c *Client) generateCSR(ids []Identifier, privateKey crypto.Signer) ([]byte
 
 			tpl.DNSNames = append(tpl.DNSNames, encodedName)
 
+		case IdentifierTypeIP:
+			addr, err := netip.ParseAddr(id.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip address %q: %w",
+					id.Value, err)
+			}
+
+			tpl.IPAddresses = append(tpl.IPAddresses, addr.AsSlice())
+
 		default:
 			return nil, fmt.Errorf("unhandled identifier type %q", id.Type)
 		}
@@ -164,7 +536,17 @@ func (c *Client) generateCSR(ids []Identifier, privateKey crypto.Signer) ([]byte
 }
 
 func encodePEMCertificateChain(chain []*x509.Certificate) (string, error) {
-	var buf bytes.Buffer
+	// Allocate the whole output at once: base64 data (4 bytes for every 3
+	// bytes, plus one newline every 64 characters), PEM headers and blank
+	// lines.
+	size := 0
+	for _, cert := range chain {
+		n := (len(cert.Raw) + 2) / 3 * 4
+		size += n + n/64 + 64
+	}
+
+	var buf strings.Builder
+	buf.Grow(size)
 
 	for _, cert := range chain {
 		block := pem.Block{
@@ -172,7 +554,10 @@ func encodePEMCertificateChain(chain []*x509.Certificate) (string, error) {
 			Bytes: cert.Raw,
 		}
 
-		buf.Write(pem.EncodeToMemory(&block))
+		if err := pem.Encode(&buf, &block); err != nil {
+			return "", fmt.Errorf("cannot encode certificate: %w", err)
+		}
+
 		buf.WriteByte('\n')
 	}
 
@@ -2,7 +2,12 @@ package acme
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +25,8 @@ func TestRequestCertificate(t *testing.T) {
 			ids := []Identifier{DNSIdentifier("localhost")}
 			validity := 1
 
-			eventChan, err := c.RequestCertificate(ctx, name, ids, validity)
+			eventChan, err := c.RequestCertificate(ctx, name,
+				CertificateRequest{Identifiers: ids, Validity: validity})
 			require.NoError(err)
 
 			ev := <-eventChan
@@ -60,7 +66,8 @@ func TestWaitForCertificate(t *testing.T) {
 		func(c *Client) {
 			ctx := context.Background()
 
-			eventChan, err := c.RequestCertificate(ctx, name, ids, validity)
+			eventChan, err := c.RequestCertificate(ctx, name,
+				CertificateRequest{Identifiers: ids, Validity: validity})
 			require.NoError(err)
 
 			go checkEvents(eventChan)
@@ -76,7 +83,8 @@ func TestWaitForCertificate(t *testing.T) {
 		func(c *Client) {
 			ctx := context.Background()
 
-			eventChan, err := c.RequestCertificate(ctx, name, ids, validity)
+			eventChan, err := c.RequestCertificate(ctx, name,
+				CertificateRequest{Identifiers: ids, Validity: validity})
 			require.NoError(err)
 
 			go checkEvents(eventChan)
@@ -87,3 +95,413 @@ func TestWaitForCertificate(t *testing.T) {
 			assert.Equal(name, data.Name)
 		})
 }
+
+func TestCertificateForHost(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		requests := map[string][]Identifier{
+			"wildcard": {DNSIdentifier("*.example.com")},
+			"www":      {DNSIdentifier("www.example.com")},
+			"idn":      {DNSIdentifier("xn--bcher-kva.example")},
+		}
+
+		for name, ids := range requests {
+			eventChan, err := c.RequestCertificate(context.Background(), name,
+				CertificateRequest{Identifiers: ids, Validity: 1})
+			require.NoError(t, err)
+
+			ev := <-eventChan
+			require.NotNil(t, ev)
+			require.NoError(t, ev.Error)
+		}
+
+		certName := func(host string) string {
+			if certData := c.CertificateForHost(host); certData != nil {
+				return certData.Name
+			}
+
+			return ""
+		}
+
+		assert.Equal("www", certName("www.example.com"))
+		assert.Equal("www", certName("WWW.example.com."))
+		assert.Equal("wildcard", certName("foo.example.com"))
+		assert.Equal("idn", certName("bücher.example"))
+		assert.Equal("", certName("example.com"))
+		assert.Equal("", certName("a.b.example.com"))
+	})
+}
+
+func TestRequestCertificateCorruptedData(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		// A certificate whose private key does not match
+		certData := testCertificateData(t)
+		certData.Name = "test"
+		certData.Identifiers = []Identifier{DNSIdentifier("example.com")}
+		certData.Validity = 1
+
+		privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+		require.NoError(err)
+		certData.PrivateKey = privateKey
+
+		require.NoError(c.dataStore.StoreCertificateData(certData))
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: certData.Identifiers, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.ErrorIs(ev.Error, ErrCorruptedCertificateData)
+
+		ev = <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindIssued, ev.Kind)
+		assert.NoError(ev.CertificateData.Verify())
+
+		assert.Equal(1, s.Requests("new-order"))
+
+		// The corrupted file was kept aside
+		fsStore := c.dataStore.(*FileSystemDataStore)
+		matches, err := filepath.Glob(
+			fsStore.certificatePath("test") + ".corrupted-*")
+		require.NoError(err)
+		assert.Len(matches, 1)
+	})
+}
+
+func TestRequestCertificateChangedIdentifiers(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		prevCertData := testCertificateData(t)
+		prevCertData.Name = "test"
+		prevCertData.Identifiers = []Identifier{DNSIdentifier("example.com")}
+		prevCertData.Validity = 1
+
+		require.NoError(c.dataStore.StoreCertificateData(prevCertData))
+
+		ids := []Identifier{
+			DNSIdentifier("example.com"),
+			DNSIdentifier("www.example.com"),
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		// The previous certificate is available until the new one has been
+		// obtained.
+		certData := c.Certificate("test")
+		require.NotNil(certData)
+		assert.Equal(prevCertData.Identifiers, certData.Identifiers)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindIssued, ev.Kind)
+		assert.Equal(ids, ev.CertificateData.Identifiers)
+
+		assert.Equal(ev.CertificateData, c.Certificate("test"))
+	})
+}
+
+func TestRequestCertificateReorderedIdentifiers(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ids := []Identifier{
+			DNSIdentifier("example.com"),
+			DNSIdentifier("www.example.com"),
+		}
+
+		privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+		require.NoError(err)
+
+		cert, err := GenerateSelfSignedCertificate(ids, privateKey,
+			72*time.Hour)
+		require.NoError(err)
+
+		prevCertData := CertificateData{
+			Name:               "test",
+			CertificateRequest: CertificateRequest{Identifiers: ids},
+			PrivateKey:         privateKey,
+			Certificate:        []*x509.Certificate{cert},
+		}
+
+		require.NoError(c.dataStore.StoreCertificateData(&prevCertData))
+
+		// The order of identifiers does not matter: the stored certificate
+		// is reused instead of being ordered again.
+		ids2 := []Identifier{ids[1], ids[0]}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids2})
+		require.NoError(err)
+
+		var ev *CertificateEvent
+		select {
+		case ev = <-eventChan:
+		case <-time.After(10 * time.Second):
+			require.FailNow("certificate not loaded")
+		}
+
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindLoaded, ev.Kind)
+		assert.Equal(cert.Raw, ev.CertificateData.LeafCertificate().Raw)
+
+		assert.Empty(s.Requests("new-order"))
+	})
+}
+
+func TestGetTLSCertificateAllocations(t *testing.T) {
+	var c Client
+	c.certificates.Store(&map[string]*CertificateData{})
+
+	certData := testCertificateData(t)
+
+	c.certificatesMutex.Lock()
+	c.storeCertificateUnderNames([]string{"example"}, certData)
+	c.certificatesMutex.Unlock()
+
+	getCertificate := c.GetTLSCertificateFunc("example")
+
+	var info tls.ClientHelloInfo
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := getCertificate(&info); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	assert.Zero(t, allocs)
+	assert.Same(t, certData.TLSCertificate(), certData.TLSCertificate())
+}
+
+func BenchmarkGetTLSCertificate(b *testing.B) {
+	var c Client
+	c.certificates.Store(&map[string]*CertificateData{})
+
+	certData := testCertificateData(b)
+
+	names := make([]string, 1000)
+	for i := range names {
+		names[i] = "cert-" + strconv.Itoa(i)
+	}
+
+	c.certificatesMutex.Lock()
+	c.storeCertificateUnderNames(names, certData)
+	c.certificatesMutex.Unlock()
+
+	getCertificate := c.GetTLSCertificateFunc("cert-42")
+
+	b.Run("read-only", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := getCertificate(&tls.ClientHelloInfo{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
+	b.Run("concurrent-stores", func(b *testing.B) {
+		stopChan := make(chan struct{})
+		defer close(stopChan)
+
+		go func() {
+			for {
+				select {
+				case <-stopChan:
+					return
+				default:
+				}
+
+				c.certificatesMutex.Lock()
+				c.storeCertificateUnderNames(names[:1], certData)
+				c.certificatesMutex.Unlock()
+			}
+		}()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := getCertificate(&tls.ClientHelloInfo{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+func TestCertificateVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		assert.Equal("", c.CertificateVersion("test"))
+
+		certData := testCertificateData(t)
+		certData.Name = "test"
+		c.storeCertificate(certData)
+
+		assert.Equal(certData.Checksum(), c.CertificateVersion("test"))
+	})
+}
+
+func TestRequestCertificateOrderLocation(t *testing.T) {
+	for _, mode := range []string{"relative", "body"} {
+		t.Run(mode, func(t *testing.T) {
+			require := require.New(t)
+
+			s := newFakeACMEServer(t)
+			s.OrderLocation = mode
+
+			withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+				cfg.OrderURIFromBody = true
+			}, func(c *Client) {
+				eventChan, err := c.RequestCertificate(context.Background(),
+					"test", CertificateRequest{
+						Identifiers: []Identifier{DNSIdentifier("example.com")},
+						Validity:    1,
+					})
+				require.NoError(err)
+
+				ev := <-eventChan
+				require.NotNil(ev)
+				require.NoError(ev.Error)
+			})
+		})
+	}
+}
+
+func TestRequestCertificateDeduplication(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	setup := func(cfg *ClientCfg) {
+		cfg.DeduplicateCertificates = true
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "a",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+		certData := ev.CertificateData
+
+		// Identical requests use the existing worker
+		eventChan2, err := c.RequestCertificate(context.Background(), "b",
+			request)
+		require.NoError(err)
+
+		ev = <-eventChan2
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindLoaded, ev.Kind)
+		assert.Equal("a", ev.CertificateData.Name)
+		assert.Same(certData, c.Certificate("b"))
+
+		c.workersMutex.Lock()
+		assert.Len(c.workers, 1)
+		c.workersMutex.Unlock()
+
+		// Cancelling the context of an alias only ends its subscription
+		ctx, cancel := context.WithCancel(context.Background())
+
+		eventChan3, err := c.RequestCertificate(ctx, "c", request)
+		require.NoError(err)
+
+		<-eventChan3
+		cancel()
+
+		for range eventChan3 {
+		}
+
+		require.NoError(c.RenewCertificateNow("b"))
+
+		ev = <-eventChan
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindRenewed, ev.Kind)
+
+		ev = <-eventChan2
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindRenewed, ev.Kind)
+		assert.Same(ev.CertificateData, c.Certificate("b"))
+	})
+}
+
+func TestRequestCertificateExistingWorker(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+		certData := ev.CertificateData
+
+		// A second request subscribes to the worker
+		eventChan2, err := c.RequestCertificate(context.Background(), "test",
+			request.Clone())
+		require.NoError(err)
+
+		ev = <-eventChan2
+		require.NoError(ev.Error)
+		assert.Equal(CertificateEventKindLoaded, ev.Kind)
+		assert.Same(certData, ev.CertificateData)
+
+		require.NoError(c.RenewCertificateNow("test"))
+
+		for _, ch := range []<-chan *CertificateEvent{eventChan, eventChan2} {
+			ev = <-ch
+			require.NoError(ev.Error)
+			assert.Equal(CertificateEventKindRenewed, ev.Kind)
+		}
+
+		// A different request for the same name is rejected
+		request2 := request.Clone()
+		request2.Identifiers = append(request2.Identifiers,
+			DNSIdentifier("www.example.com"))
+
+		_, err = c.RequestCertificate(context.Background(), "test", request2)
+		assert.ErrorIs(err, ErrCertificateAlreadyRequested)
+
+		c.workersMutex.Lock()
+		assert.Len(c.workers, 1)
+		c.workersMutex.Unlock()
+	})
+}
@@ -1,11 +1,14 @@
 package acme
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -35,9 +38,110 @@ type Challenge struct {
 	Validated *time.Time      `json:"validated,omitempty"`
 	Error     *ProblemDetails `json:"error,omitempty"`
 
+	// Not part of RFC 8555 but sent by Boulder (Let's Encrypt) and Pebble
+	ValidationRecord []ValidationRecord `json:"validationRecord,omitempty"`
+
 	Data any `json:"-"`
 }
 
+func (c *Challenge) resolveURIs(base *url.URL) error {
+	return resolveURI(base, &c.URL)
+}
+
+type ValidationRecord struct {
+	URL               string   `json:"url,omitempty"`
+	Hostname          string   `json:"hostname,omitempty"`
+	Port              string   `json:"port,omitempty"`
+	AddressesResolved []string `json:"addressesResolved,omitempty"`
+	AddressUsed       string   `json:"addressUsed,omitempty"`
+}
+
+func (r *ValidationRecord) String() string {
+	var buf bytes.Buffer
+
+	switch {
+	case r.URL != "":
+		buf.WriteString(r.URL)
+	case r.Hostname != "":
+		buf.WriteString(r.Hostname)
+	}
+
+	if r.AddressUsed != "" {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString("via ")
+		buf.WriteString(r.AddressUsed)
+	}
+
+	return buf.String()
+}
+
+// FormatValidationRecords returns a short description of the requests sent by
+// the server to validate a challenge, e.g. to know which address was used
+// for an identifier with multiple IPv4 and IPv6 addresses.
+func FormatValidationRecords(records []ValidationRecord) string {
+	parts := make([]string, len(records))
+	for i, r := range records {
+		parts[i] = r.String()
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// ChallengeSolverState is the state of the local challenge solver when the
+// validation of a challenge failed.
+type ChallengeSolverState struct {
+	// HTTP-01: the path the server was supposed to fetch and the number of
+	// requests the local solver received for the token.
+	HTTPPath     string `json:"http_path,omitempty"`
+	HTTPRequests int    `json:"http_requests,omitempty"`
+
+	// DNS-01: the record the server was supposed to find.
+	DNSRecordName  string `json:"dns_record_name,omitempty"`
+	DNSRecordValue string `json:"dns_record_value,omitempty"`
+}
+
+// ChallengeError is returned when the server reports a challenge as invalid.
+// It contains everything available to understand what the server tried.
+type ChallengeError struct {
+	Identifier       Identifier           `json:"identifier"`
+	ChallengeType    ChallengeType        `json:"challenge_type"`
+	ChallengeURL     string               `json:"challenge_url"`
+	Problem          *ProblemDetails      `json:"problem,omitempty"`
+	ValidationRecord []ValidationRecord   `json:"validation_record,omitempty"`
+	SolverState      ChallengeSolverState `json:"solver_state"`
+}
+
+func (err *ChallengeError) Error() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s challenge failed", err.ChallengeType)
+
+	if len(err.ValidationRecord) > 0 {
+		fmt.Fprintf(&buf, " (%s)", FormatValidationRecords(err.ValidationRecord))
+	}
+
+	buf.WriteString(": ")
+
+	if err.Problem != nil {
+		buf.WriteString(err.Problem.Error())
+	} else {
+		buf.WriteString("unknown error")
+	}
+
+	return buf.String()
+}
+
+func (err *ChallengeError) Unwrap() error {
+	if err.Problem == nil {
+		return nil
+	}
+
+	return err.Problem
+}
+
 type ChallengeDataHTTP01 struct {
 	Token string `json:"token"`
 }
@@ -71,14 +175,14 @@ func (c *Challenge) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (c *Client) setupChallenge(ctx context.Context, challenge *Challenge) error {
+func (c *Client) setupChallenge(ctx context.Context, challenge *Challenge, auth *Authorization, expires time.Time) error {
 	var err error
 
 	switch challenge.Type {
 	case ChallengeTypeHTTP01:
-		err = c.setupChallengeHTTP01(ctx, challenge)
+		err = c.setupChallengeHTTP01(ctx, challenge, expires)
 	case ChallengeTypeDNS01:
-		err = c.setupChallengeDNS01(ctx, challenge)
+		err = c.setupChallengeDNS01(ctx, challenge, auth)
 	default:
 		err = fmt.Errorf("unknown challenge type %q", challenge.Type)
 	}
@@ -86,14 +190,14 @@ func (c *Client) setupChallenge(ctx context.Context, challenge *Challenge) error
 	return err
 }
 
-func (c *Client) teardownChallenge(ctx context.Context, challenge *Challenge) error {
+func (c *Client) teardownChallenge(ctx context.Context, challenge *Challenge, auth *Authorization) error {
 	var err error
 
 	switch challenge.Type {
 	case ChallengeTypeHTTP01:
 		err = c.teardownChallengeHTTP01(ctx, challenge)
 	case ChallengeTypeDNS01:
-		err = c.teardownChallengeDNS01(ctx, challenge)
+		err = c.teardownChallengeDNS01(ctx, challenge, auth)
 	default:
 		err = fmt.Errorf("unknown challenge type %q", challenge.Type)
 	}
@@ -101,10 +205,9 @@ func (c *Client) teardownChallenge(ctx context.Context, challenge *Challenge) er
 	return err
 }
 
-func (c *Client) setupChallengeHTTP01(ctx context.Context, challenge *Challenge) error {
+func (c *Client) setupChallengeHTTP01(ctx context.Context, challenge *Challenge, expires time.Time) error {
 	data := challenge.Data.(*ChallengeDataHTTP01)
-	c.httpChallengeSolver.addToken(data.Token)
-	return nil
+	return c.httpChallengeSolver.addToken(data.Token, expires)
 }
 
 func (c *Client) teardownChallengeHTTP01(ctx context.Context, challenge *Challenge) error {
@@ -113,14 +216,51 @@ func (c *Client) teardownChallengeHTTP01(ctx context.Context, challenge *Challen
 	return nil
 }
 
-func (c *Client) setupChallengeDNS01(ctx context.Context, challenge *Challenge) error {
-	// TODO Solve DNS-01 challenges
-	return errors.New("not implemented yet")
+func (c *Client) setupChallengeDNS01(ctx context.Context, challenge *Challenge, auth *Authorization) error {
+	data := challenge.Data.(*ChallengeDataDNS01)
+
+	thumbprint, err := c.AccountThumbprint()
+	if err != nil {
+		return fmt.Errorf("cannot compute account thumbprint: %w", err)
+	}
+
+	return c.dnsSolver().setupChallenge(ctx, auth.Identifier.Value,
+		data.Token, thumbprint)
 }
 
-func (c *Client) teardownChallengeDNS01(ctx context.Context, challenge *Challenge) error {
-	// TODO Solve DNS-01 challenges
-	return errors.New("not implemented yet")
+func (c *Client) teardownChallengeDNS01(ctx context.Context, challenge *Challenge, auth *Authorization) error {
+	data := challenge.Data.(*ChallengeDataDNS01)
+
+	thumbprint, err := c.AccountThumbprint()
+	if err != nil {
+		return fmt.Errorf("cannot compute account thumbprint: %w", err)
+	}
+
+	return c.dnsSolver().teardownChallenge(ctx, auth.Identifier.Value,
+		data.Token, thumbprint)
+}
+
+func (c *Client) challengeSolverState(challenge *Challenge, auth *Authorization) ChallengeSolverState {
+	var state ChallengeSolverState
+
+	switch data := challenge.Data.(type) {
+	case *ChallengeDataHTTP01:
+		state.HTTPPath = "/.well-known/acme-challenge/" + data.Token
+
+		if c.httpChallengeSolver != nil {
+			state.HTTPRequests = c.httpChallengeSolver.tokenRequests(data.Token)
+		}
+
+	case *ChallengeDataDNS01:
+		state.DNSRecordName = dnsChallengeRecordName(auth.Identifier.Value)
+
+		if thumbprint, err := c.AccountThumbprint(); err == nil {
+			state.DNSRecordValue = dnsChallengeRecordValue(data.Token,
+				thumbprint)
+		}
+	}
+
+	return state
 }
 
 func (c *Client) submitChallenge(ctx context.Context, uri string) error {
@@ -141,11 +281,11 @@ func (c *Client) fetchChallenge(ctx context.Context, uri string) (*Challenge, *h
 	return &challenge, res, nil
 }
 
-func (c *Client) waitForChallengeValid(ctx context.Context, uri string) error {
+func (c *Client) waitForChallengeValid(ctx context.Context, uri string, expires time.Time) (*Challenge, error) {
 	for {
 		challenge, res, err := c.fetchChallenge(ctx, uri)
 		if err != nil {
-			return fmt.Errorf("cannot fetch challenge: %w", err)
+			return nil, fmt.Errorf("cannot fetch challenge: %w", err)
 		}
 
 		delay := c.waitDelay(res)
@@ -156,20 +296,23 @@ func (c *Client) waitForChallengeValid(ctx context.Context, uri string) error {
 		case ChallengeStatusProcessing:
 
 		case ChallengeStatusValid:
-			return nil
+			return challenge, nil
 
 		case ChallengeStatusInvalid:
-			if challenge.Error != nil {
-				return challenge.Error
+			return nil, &ChallengeError{
+				ChallengeType:    challenge.Type,
+				ChallengeURL:     challenge.URL,
+				Problem:          challenge.Error,
+				ValidationRecord: challenge.ValidationRecord,
 			}
-			return errors.New("unknown error")
 
 		default:
-			return fmt.Errorf("unknown challenge status %q", challenge.Status)
+			return nil, fmt.Errorf("unknown challenge status %q",
+				challenge.Status)
 		}
 
-		if err := c.waitForVerification(ctx, delay); err != nil {
-			return err
+		if err := c.waitForVerification(ctx, delay, expires); err != nil {
+			return nil, err
 		}
 	}
 }
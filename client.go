@@ -5,17 +5,29 @@ import (
 	"crypto"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"net/http"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.n16f.net/log"
 )
 
+const (
+	DefaultMinPollDelay = time.Second
+	DefaultMaxPollDelay = 5 * time.Minute
+)
+
+const DefaultUserAgent = "go-acme (https://github.com/galdor/go-acme)"
+
 type AccountPrivateKeyGenerationFunc func() (crypto.Signer, error)
 type CertificatePrivateKeyGenerationFunc func() (crypto.Signer, error)
 type CertificateRenewalTimeFunc func(*CertificateData) time.Time
+type RequestDecoratorFunc func(*http.Request)
 
 type ClientCfg struct {
 	Log                           *log.Logger                         `json:"-"`
@@ -25,47 +37,303 @@ type ClientCfg struct {
 	GenerateCertificatePrivateKey CertificatePrivateKeyGenerationFunc `json:"-"`
 	CertificateRenewalTime        CertificateRenewalTimeFunc          `json:"-"`
 
-	UserAgent    string   `json:"user_agent"`
+	// If set, called after each request sent to the ACME server, e.g. to
+	// collect metrics. The function can be called concurrently.
+	RequestHook RequestHookFunc `json:"-"`
+
+	// Settings used to create the HTTP client if HTTPClient is not set.
+	HTTPClientCfg *HTTPClientCfg `json:"http_client,omitempty"`
+
+	// The User-Agent header field of requests sent to the ACME server
+	// starts with UserAgent (DefaultUserAgent by default), followed by
+	// ApplicationUserAgent if it is set. Applications should identify
+	// themselves with ApplicationUserAgent (e.g. "myapp/1.2") and keep the
+	// default user agent, which lets CAs know which client is in use.
+	UserAgent            string `json:"user_agent"`
+	ApplicationUserAgent string `json:"application_user_agent,omitempty"`
+
+	// Header fields added to all requests sent to the ACME server, e.g. for
+	// HTTP proxies requiring authentication. Fields set by the client
+	// (User-Agent, Content-Type, Accept) cannot be used.
+	RequestHeader http.Header `json:"request_header,omitempty"`
+
+	// If set, called for each request sent to the ACME server just before
+	// sending it, e.g. to add header fields whose value changes over time.
+	// The function can be called concurrently.
+	RequestDecorator RequestDecoratorFunc `json:"-"`
+
 	DirectoryURI string   `json:"directory_uri"`
 	ContactURIs  []string `json:"contact_uris"`
 
+	// Requests are only sent to the host of the directory, so that a
+	// malicious or misbehaving server cannot make the client send requests
+	// to other hosts (e.g. internal services). Servers hosting resources on
+	// other hosts require these hosts (with an optional port) to be listed
+	// here.
+	AllowedResourceHosts []string `json:"allowed_resource_hosts,omitempty"`
+
+	ExternalAccountBinding *ExternalAccountBindingCfg `json:"external_account_binding,omitempty"`
+
+	// If set, the chain whose topmost certificate is issued by this common
+	// name is selected among the chains offered by the server (RFC 8555
+	// 7.4.2). The default chain is used if none matches.
+	PreferredChain string `json:"preferred_chain,omitempty"`
+
+	// If set, adapts the configuration to an internal ACME server, see
+	// ServerPreset.
+	ServerPreset ServerPreset `json:"server_preset,omitempty"`
+
+	// If set, orders only contain the NotBefore and NotAfter fields of
+	// certificate requests and not the validity period derived from
+	// Validity. Required for servers which do not support custom validity
+	// periods; always set for Let's Encrypt.
+	OmitValidityPeriod bool `json:"omit_validity_period,omitempty"`
+
+	// If set and the server does not return the URI of new orders in the
+	// Location header field, it is read from the "url" field of the
+	// response body, as sent by some non-conforming servers.
+	OrderURIFromBody bool `json:"order_uri_from_body,omitempty"`
+
 	HTTPChallengeSolver *HTTPChallengeSolverCfg `json:"http_challenge_solver,omitempty"`
+	DNSChallengeSolver  *DNSChallengeSolverCfg  `json:"dns_challenge_solver,omitempty"`
+
+	// If set, authorizations are only validated with DNS-01 challenges,
+	// e.g. for servers behind a CDN terminating TLS, which ACME servers
+	// cannot reach directly. A DNS challenge solver is then required and
+	// the HTTP challenge solver cannot be used.
+	DNSOnly bool `json:"dns_only,omitempty"`
+
+	// If set, serve a self-signed certificate for certificates which have
+	// been requested but are not available yet.
+	SelfSignedFallback bool `json:"self_signed_fallback,omitempty"`
+
+	// If set, certificates are requested on the fly during TLS handshakes
+	// for server names which are not covered by existing certificates.
+	OnDemand *OnDemandCfg `json:"on_demand,omitempty"`
+
+	// If set, requesting a certificate with the same identifiers and validity
+	// as an existing certificate reuses it instead of ordering a new one.
+	DeduplicateCertificates bool `json:"deduplicate_certificates,omitempty"`
+
+	RenewalPolicy RenewalPolicy `json:"renewal_policy"`
+	OrderTimeouts OrderTimeouts `json:"order_timeouts"`
+
+	// Limits evaluated locally before submitting orders. Let's Encrypt
+	// limits are used by default with the Let's Encrypt production server.
+	RateLimits *RateLimitsCfg `json:"rate_limits,omitempty"`
+
+	// The maximum size of the body of a response sent by the server, in
+	// bytes. Requests whose response is larger fail with
+	// ErrResponseTooLarge.
+	MaxResponseSize int64 `json:"max_response_size,omitempty"`
+
+	// If set, the client never contacts the ACME server and certificates
+	// cannot be requested. Certificates are loaded from the data store, see
+	// MonitorCertificates.
+	MonitorOnly bool `json:"monitor_only,omitempty"`
+
+	// The interval at which the directory is fetched again to take into
+	// account changes of endpoint URIs. The default value is
+	// DefaultDirectoryRefreshInterval. The directory is also fetched again
+	// when an endpoint does not exist anymore.
+	DirectoryRefreshInterval time.Duration `json:"directory_refresh_interval,omitempty"`
+
+	// The bounds of the delay between two requests when polling orders,
+	// authorizations and challenges, whatever the Retry-After header field
+	// sent by the server says. The default values are DefaultMinPollDelay
+	// and DefaultMaxPollDelay.
+	MinPollDelay time.Duration `json:"min_poll_delay,omitempty"`
+	MaxPollDelay time.Duration `json:"max_poll_delay,omitempty"`
+
+	// If set, a new account is created when the server reports that the
+	// current account does not exist anymore (e.g. after a reset of a
+	// staging environment), and the failed request is sent again.
+	AccountRecreation AccountRecreationMode `json:"account_recreation,omitempty"`
+
+	// If set and the server rejects the signature algorithm of the private
+	// key of a new account, a private key is generated for one of the
+	// algorithms listed by the server and account creation is retried.
+	AdaptAccountKeyAlgorithm bool `json:"adapt_account_key_algorithm,omitempty"`
+
+	// If set, workers started during this period after the start of the
+	// client, e.g. when a daemon starts with many certificates, delay their
+	// first order by an offset within the period derived from the name of
+	// the certificate, so that orders are not all submitted at once.
+	StartupWindow time.Duration `json:"startup_window,omitempty"`
+
+	// The number of recent events kept for each certificate, see
+	// RecentEvents. The default value is DefaultEventHistorySize.
+	EventHistorySize int `json:"event_history_size,omitempty"`
 }
 
 type Client struct {
-	Cfg       ClientCfg
-	Log       *log.Logger
-	Directory *Directory
+	Cfg ClientCfg
+	Log *log.Logger
+
+	directory atomic.Pointer[Directory]
+
+	// Cfg and dnsChallengeSolver can be modified with UpdateConfig
+	cfgMutex       sync.RWMutex
+	cfgUpdateMutex sync.Mutex
 
-	httpClient          *http.Client
 	httpChallengeSolver *HTTPChallengeSolver
+	dnsChallengeSolver  *DNSChallengeSolver
 	dataStore           DataStore
-	accountData         *AccountData
 
-	nonces      []string
-	noncesMutex sync.Mutex
+	accountData      *AccountData
+	accountDataMutex sync.RWMutex
+
+	accountRecreationMutex sync.Mutex
+
+	jwsSigner      *jwsSigner
+	jwsSignerMutex sync.Mutex
 
-	certificates      map[string]*CertificateData
-	certificatesMutex sync.RWMutex
+	nonces       []string
+	nonceMetrics nonceMetrics
+	noncesMutex  sync.Mutex
+
+	// Certificates are read on every TLS handshake. The map is never
+	// modified once stored, writers (with certificatesMutex locked) replace
+	// it by a modified copy so that readers do not have to lock.
+	certificates       atomic.Pointer[map[string]*CertificateData]
+	certificateAliases map[string]string
+	certificatesMutex  sync.RWMutex
 
 	certificateWaiters      map[string][]chan *CertificateData
 	certificateWaitersMutex sync.Mutex
 
-	stopChan chan struct{}
-	wg       sync.WaitGroup
+	workers      map[string]*CertificateWorker
+	workersMutex sync.Mutex
+
+	subscriptions      map[string][]*CertificateSubscription
+	eventHistory       map[string][]*CertificateEvent
+	subscriptionsMutex sync.Mutex
+
+	fallbackCertificates      map[string]*CertificateData
+	fallbackCertificatesMutex sync.Mutex
+
+	onDemandHosts      map[string]*onDemandHost
+	onDemandHostsMutex sync.Mutex
+
+	metrics             map[string]*certificateMetrics
+	issuanceDurations   durationHistogram
+	orderPhaseDurations map[OrderPhase]*durationHistogram
+	metricsMutex        sync.Mutex
+
+	startTime time.Time
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
 }
 
 func NewClient(cfg ClientCfg) (*Client, error) {
+	var v validator
+
+	v.check("", cfg.prepare())
+
+	if sCfg := cfg.HTTPChallengeSolver; sCfg != nil {
+		v.check("HTTPChallengeSolver", sCfg.Validate())
+	}
+
+	if sCfg := cfg.DNSChallengeSolver; sCfg != nil {
+		v.check("DNSChallengeSolver", sCfg.Validate())
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	c := Client{
+		Log: cfg.Log,
+		Cfg: cfg,
+
+		dataStore: cfg.DataStore,
+
+		certificateAliases: make(map[string]string),
+
+		certificateWaiters: make(map[string][]chan *CertificateData),
+
+		workers: make(map[string]*CertificateWorker),
+
+		subscriptions: make(map[string][]*CertificateSubscription),
+		eventHistory:  make(map[string][]*CertificateEvent),
+
+		fallbackCertificates: make(map[string]*CertificateData),
+
+		onDemandHosts: make(map[string]*onDemandHost),
+
+		metrics:             make(map[string]*certificateMetrics),
+		orderPhaseDurations: make(map[OrderPhase]*durationHistogram),
+
+		stopChan: make(chan struct{}),
+	}
+
+	c.certificates.Store(&map[string]*CertificateData{})
+
+	if sCfg := cfg.HTTPChallengeSolver; sCfg != nil {
+		if sCfg.Log == nil {
+			sCfg.Log = cfg.Log
+		}
+
+		solver, err := NewHTTPChallengeSolver(*sCfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create HTTP challenge solver: %w",
+				err)
+		}
+
+		c.httpChallengeSolver = solver
+	}
+
+	if sCfg := cfg.DNSChallengeSolver; sCfg != nil {
+		if sCfg.Log == nil {
+			sCfg.Log = cfg.Log
+		}
+
+		solver, err := NewDNSChallengeSolver(*sCfg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create DNS challenge solver: %w",
+				err)
+		}
+
+		c.dnsChallengeSolver = solver
+	}
+
+	return &c, nil
+}
+
+// prepare validates the configuration and sets default values. Errors are
+// returned as ValidationErrors. Challenge solver configurations are validated
+// separately since they cannot change after the client has been created.
+func (cfg *ClientCfg) prepare() error {
+	var v validator
+
 	if cfg.Log == nil {
 		cfg.Log = log.DefaultLogger("acme")
 	}
 
+	if cfg.ServerPreset != "" {
+		if err := cfg.ServerPreset.Validate(); err != nil {
+			v.check("ServerPreset", err)
+		} else {
+			cfg.ServerPreset.apply(cfg, &v)
+		}
+	}
+
 	if cfg.HTTPClient == nil {
-		cfg.HTTPClient = NewHTTPClient(nil)
+		var httpClientCfg HTTPClientCfg
+		if cfg.HTTPClientCfg != nil {
+			httpClientCfg = *cfg.HTTPClientCfg
+			v.check("HTTPClientCfg", httpClientCfg.Validate())
+		}
+
+		cfg.HTTPClient = NewHTTPClientWithCfg(httpClientCfg)
 	}
 
 	if cfg.DataStore == nil {
-		return nil, fmt.Errorf("missing data store")
+		v.add("DataStore", "missing data store")
+	}
+
+	for i, uri := range cfg.ContactURIs {
+		v.check(fmt.Sprintf("ContactURIs[%d]", i), ValidateContactURI(uri))
 	}
 
 	if cfg.GenerateAccountPrivateKey == nil {
@@ -80,52 +348,141 @@ func NewClient(cfg ClientCfg) (*Client, error) {
 		cfg.CertificateRenewalTime = CertificateRenewalTime
 	}
 
-	if cfg.UserAgent == "" {
-		cfg.UserAgent = "go-acme (https://github.com/galdor/go-acme)"
+	if cfg.RateLimits == nil && cfg.DirectoryURI == LetsEncryptDirectoryURI {
+		cfg.RateLimits = LetsEncryptRateLimitsCfg()
 	}
 
-	c := Client{
-		Log: cfg.Log,
-		Cfg: cfg,
+	// Let's Encrypt rejects orders containing a validity period
+	if cfg.DirectoryURI == LetsEncryptDirectoryURI ||
+		cfg.DirectoryURI == LetsEncryptStagingDirectoryURI {
+		cfg.OmitValidityPeriod = true
+	}
 
-		httpClient: cfg.HTTPClient,
-		dataStore:  cfg.DataStore,
+	if cfg.RateLimits != nil {
+		v.check("RateLimits", cfg.RateLimits.Check())
+	}
 
-		certificates: make(map[string]*CertificateData),
+	if cfg.MaxResponseSize == 0 {
+		cfg.MaxResponseSize = DefaultMaxResponseSize
+	}
 
-		certificateWaiters: make(map[string][]chan *CertificateData),
+	v.check("AccountRecreation", cfg.AccountRecreation.Validate())
 
-		stopChan: make(chan struct{}),
+	if cfg.DirectoryRefreshInterval == 0 {
+		cfg.DirectoryRefreshInterval = DefaultDirectoryRefreshInterval
+	} else if cfg.DirectoryRefreshInterval < 0 {
+		v.add("DirectoryRefreshInterval", "invalid negative interval")
 	}
 
-	if sCfg := cfg.HTTPChallengeSolver; sCfg != nil {
-		if sCfg.Log == nil {
-			sCfg.Log = cfg.Log
+	if cfg.MinPollDelay == 0 {
+		cfg.MinPollDelay = DefaultMinPollDelay
+	}
+
+	if cfg.MaxPollDelay == 0 {
+		cfg.MaxPollDelay = DefaultMaxPollDelay
+	}
+
+	if cfg.MinPollDelay < 0 {
+		v.add("MinPollDelay", "invalid negative delay")
+	} else if cfg.MaxPollDelay < cfg.MinPollDelay {
+		v.add("MaxPollDelay", "delay must be greater or equal to MinPollDelay")
+	}
+
+	if cfg.StartupWindow < 0 {
+		v.add("StartupWindow", "invalid negative window")
+	}
+
+	if cfg.EventHistorySize == 0 {
+		cfg.EventHistorySize = DefaultEventHistorySize
+	} else if cfg.EventHistorySize < 0 {
+		v.add("EventHistorySize", "invalid negative size")
+	}
+
+	if cfg.RenewalPolicy.MaxRetryDelay == 0 {
+		cfg.RenewalPolicy.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+
+	if cfg.OrderTimeouts.Authorization == 0 {
+		cfg.OrderTimeouts.Authorization = DefaultAuthorizationTimeout
+	}
+
+	if cfg.OrderTimeouts.Finalization == 0 {
+		cfg.OrderTimeouts.Finalization = DefaultFinalizationTimeout
+	}
+
+	if cfg.OrderTimeouts.Download == 0 {
+		cfg.OrderTimeouts.Download = DefaultDownloadTimeout
+	}
+
+	if cfg.DNSOnly {
+		if cfg.HTTPChallengeSolver != nil {
+			v.add("HTTPChallengeSolver", "the HTTP challenge solver cannot "+
+				"be used in DNS-only mode")
 		}
 
-		solver, err := NewHTTPChallengeSolver(*sCfg)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create HTTP challenge solver: %w",
-				err)
+		if cfg.DNSChallengeSolver == nil {
+			v.add("DNSChallengeSolver", "DNS-only mode requires a DNS "+
+				"challenge solver")
 		}
+	}
 
-		c.httpChallengeSolver = solver
+	if cfg.MonitorOnly && cfg.OnDemand != nil {
+		v.add("OnDemand", "on-demand issuance cannot be used in "+
+			"monitor-only mode")
 	}
 
-	return &c, nil
+	if odCfg := cfg.OnDemand; odCfg != nil {
+		if odCfg.Validity == 0 {
+			odCfg.Validity = 30
+		}
+
+		if odCfg.MinAttemptInterval == 0 {
+			odCfg.MinAttemptInterval = 10 * time.Minute
+		}
+	}
+
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+
+	for name := range cfg.RequestHeader {
+		switch http.CanonicalHeaderKey(name) {
+		case "User-Agent", "Content-Type", "Accept":
+			v.add("RequestHeader", "header field %q is set by the client",
+				name)
+		}
+	}
+
+	return v.err()
 }
 
 func (c *Client) Start(ctx context.Context) error {
+	c.startTime = time.Now()
+
+	if c.Config().MonitorOnly {
+		c.Log.Info("starting in monitor-only mode")
+
+		if _, err := c.loadStoredCertificates(); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
 	if err := c.updateDirectory(ctx); err != nil {
 		return fmt.Errorf("cannot update directory: %w", err)
 	}
 
 	c.Log.Debug(1, "loading account data")
 
+	accountCreated := false
+
 	accountData, err := c.dataStore.LoadAccountData()
 	if err != nil {
 		if errors.Is(err, ErrAccountNotFound) {
-			accountData, err = c.createAccount(ctx)
+			accountCreated = true
+
+			accountData, err = c.createAccount(ctx, nil)
 			if err != nil {
 				return fmt.Errorf("cannot create account: %w", err)
 			}
@@ -141,7 +498,18 @@ func (c *Client) Start(ctx context.Context) error {
 	c.Log.Data["account"] = accountData.URI
 	c.Log.Info("using account %q", accountData.URI)
 
-	c.accountData = accountData
+	c.setAccountData(accountData)
+
+	// Make sure an existing account is still usable, since failing on the
+	// first order with an unauthorized error would be much more confusing.
+	if !accountCreated {
+		if err := c.checkAccount(ctx); err != nil {
+			return err
+		}
+	}
+
+	c.wg.Add(1)
+	go c.refreshDirectory()
 
 	if c.httpChallengeSolver != nil {
 		accountThumbprint, err := accountData.Thumbprint()
@@ -157,6 +525,29 @@ func (c *Client) Start(ctx context.Context) error {
 	return nil
 }
 
+// CheckChallengeSolvers makes sure that local challenge solvers are reachable
+// the way ACME servers will try to reach them. Solvers which cannot be probed,
+// e.g. DNS solvers, are ignored.
+func (c *Client) CheckChallengeSolvers(ctx context.Context) error {
+	if c.httpChallengeSolver != nil {
+		if err := c.httpChallengeSolver.Healthy(ctx); err != nil {
+			return fmt.Errorf("unhealthy HTTP challenge solver: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// HTTPChallengeTokens returns the tokens currently answered by the HTTP
+// challenge solver if there is one.
+func (c *Client) HTTPChallengeTokens() []HTTPChallengeToken {
+	if c.httpChallengeSolver == nil {
+		return nil
+	}
+
+	return c.httpChallengeSolver.Tokens()
+}
+
 func (c *Client) Stop() {
 	if c.httpChallengeSolver != nil {
 		c.httpChallengeSolver.Stop()
@@ -165,7 +556,102 @@ func (c *Client) Stop() {
 	close(c.stopChan)
 	c.wg.Wait()
 
-	c.httpClient.CloseIdleConnections()
+	c.closeSubscriptions()
+
+	c.Config().HTTPClient.CloseIdleConnections()
+}
+
+// Config returns a copy of the current configuration of the client. It must
+// be used instead of accessing Cfg directly if UpdateConfig can be called
+// concurrently.
+func (c *Client) Config() ClientCfg {
+	c.cfgMutex.RLock()
+	defer c.cfgMutex.RUnlock()
+
+	return c.Cfg
+}
+
+// UpdateConfig changes the configuration of a running client. The update
+// function is called with a copy of the current configuration; pointer
+// fields must be replaced and not modified in place. The logger, directory
+// URI, data store, HTTP challenge solver and monitor-only mode cannot be
+// changed. If contact
+// URIs change, the account is updated on the server.
+//
+// Changes apply to requests sent and orders submitted after the update,
+// including those of existing certificate workers.
+func (c *Client) UpdateConfig(ctx context.Context, update func(*ClientCfg)) error {
+	c.cfgUpdateMutex.Lock()
+	defer c.cfgUpdateMutex.Unlock()
+
+	oldCfg := c.Config()
+
+	cfg := oldCfg
+	update(&cfg)
+
+	if err := cfg.prepare(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	switch {
+	case cfg.Log != oldCfg.Log:
+		return fmt.Errorf("logger cannot be changed")
+	case cfg.DirectoryURI != oldCfg.DirectoryURI:
+		return fmt.Errorf("directory URI cannot be changed")
+	case cfg.DataStore != oldCfg.DataStore:
+		return fmt.Errorf("data store cannot be changed")
+	case cfg.HTTPChallengeSolver != oldCfg.HTTPChallengeSolver:
+		return fmt.Errorf("HTTP challenge solver cannot be changed")
+	case cfg.MonitorOnly != oldCfg.MonitorOnly:
+		return fmt.Errorf("monitor-only mode cannot be changed")
+	}
+
+	dnsSolver := c.dnsSolver()
+
+	if cfg.DNSChallengeSolver != oldCfg.DNSChallengeSolver {
+		dnsSolver = nil
+
+		if sCfg := cfg.DNSChallengeSolver; sCfg != nil {
+			if sCfg.Log == nil {
+				sCfg.Log = cfg.Log
+			}
+
+			solver, err := NewDNSChallengeSolver(*sCfg)
+			if err != nil {
+				return fmt.Errorf("cannot create DNS challenge solver: %w",
+					err)
+			}
+
+			dnsSolver = solver
+		}
+	}
+
+	if !slices.Equal(cfg.ContactURIs, oldCfg.ContactURIs) &&
+		c.currentAccountData() != nil {
+		if _, err := c.UpdateAccountContact(ctx, cfg.ContactURIs); err != nil {
+			return fmt.Errorf("cannot update account contact URIs: %w", err)
+		}
+	}
+
+	c.cfgMutex.Lock()
+	c.Cfg = cfg
+	c.dnsChallengeSolver = dnsSolver
+	c.cfgMutex.Unlock()
+
+	if cfg.HTTPClient != oldCfg.HTTPClient {
+		oldCfg.HTTPClient.CloseIdleConnections()
+	}
+
+	c.Log.Info("configuration updated")
+
+	return nil
+}
+
+func (c *Client) dnsSolver() *DNSChallengeSolver {
+	c.cfgMutex.RLock()
+	defer c.cfgMutex.RUnlock()
+
+	return c.dnsChallengeSolver
 }
 
 func (c *Client) storeNonce(nonce string) {
@@ -174,11 +660,24 @@ func (c *Client) storeNonce(nonce string) {
 	c.noncesMutex.Unlock()
 }
 
+func (c *Client) clearNonces() {
+	c.noncesMutex.Lock()
+	n := len(c.nonces)
+	c.nonces = nil
+	c.nonceMetrics.discarded += uint64(n)
+	c.noncesMutex.Unlock()
+
+	if n > 0 {
+		c.Log.Debug(1, "discarded %d stale nonce(s)", n)
+	}
+}
+
 func (c *Client) nextNonce(ctx context.Context) (string, error) {
 	c.noncesMutex.Lock()
 	if len(c.nonces) > 0 {
 		nonce := c.nonces[0]
 		c.nonces = c.nonces[1:]
+		c.nonceMetrics.consumed++
 		c.noncesMutex.Unlock()
 		return nonce, nil
 	}
@@ -189,13 +688,41 @@ func (c *Client) nextNonce(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("cannot fetch nonce: %w", err)
 	}
 
+	c.Log.Debug(2, "fetched nonce %q", nonce)
+
+	c.noncesMutex.Lock()
+	c.nonceMetrics.fetched++
+	c.nonceMetrics.consumed++
+	c.noncesMutex.Unlock()
+
 	return nonce, nil
 }
 
+func (c *Client) recordRejectedNonce(nonce string) {
+	c.Log.Debug(1, "nonce %q rejected by the server", nonce)
+
+	c.noncesMutex.Lock()
+	c.nonceMetrics.rejected++
+	c.noncesMutex.Unlock()
+}
+
+// waitDelay returns the delay before polling a resource again. Servers
+// sometimes return absurd Retry-After values, e.g. zero or hours, so the
+// delay is bounded; jitter avoids synchronized polling by many workers.
 func (c *Client) waitDelay(res *http.Response) time.Duration {
+	cfg := c.Config()
+
+	delay := retryAfterDelay(res.Header.Get("Retry-After"))
+
+	delay = min(delay, cfg.MaxPollDelay)
+	delay += rand.N(delay/10 + 1)
+
+	return min(max(delay, cfg.MinPollDelay), cfg.MaxPollDelay)
+}
+
+func retryAfterDelay(s string) time.Duration {
 	defaultDelay := time.Second
 
-	s := res.Header.Get("Retry-After")
 	if s == "" {
 		return defaultDelay
 	}
@@ -204,6 +731,10 @@ func (c *Client) waitDelay(res *http.Response) time.Duration {
 
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil && i >= 0 {
+		if i > int64(math.MaxInt64/time.Second) {
+			return math.MaxInt64
+		}
+
 		return time.Duration(i) * time.Second
 	}
 
@@ -215,7 +746,15 @@ func (c *Client) waitDelay(res *http.Response) time.Duration {
 	return defaultDelay
 }
 
-func (c *Client) waitForVerification(ctx context.Context, delay time.Duration) error {
+// waitForVerification waits before polling a resource again. If expires is
+// not zero, it is the expiration time of the order the resource belongs to,
+// and waiting past it fails with ErrOrderExpired.
+func (c *Client) waitForVerification(ctx context.Context, delay time.Duration, expires time.Time) error {
+	if !expires.IsZero() && time.Now().Add(delay).After(expires) {
+		return fmt.Errorf("%w at %v", ErrOrderExpired,
+			expires.Format(time.RFC3339))
+	}
+
 	timer := time.NewTimer(delay)
 	defer timer.Stop()
 
@@ -2,34 +2,62 @@ package acme
 
 import (
 	"context"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// Tests expect Pebble to be running with pebble-challtestsrv as DNS server
+// (see docker-compose.yaml).
+
 func withTestClient(t *testing.T, fn func(c *Client)) {
 	withTestClientWithDataStorePath(t, t.TempDir(), fn)
 }
 
 func withTestClientWithDataStorePath(t *testing.T, dataStorePath string, fn func(c *Client)) {
-	dataStore, err := NewFileSystemDataStore(dataStorePath)
+	httpChallengeSolver := HTTPChallengeSolverCfg{
+		Address: PebbleHTTPChallengeSolverAddress,
+	}
+
+	withTestClientCfg(t, dataStorePath, func(cfg *ClientCfg) {
+		cfg.HTTPChallengeSolver = &httpChallengeSolver
+	}, fn)
+}
+
+// withDNSTestClient uses DNS-01 challenges validated by Pebble against
+// pebble-challtestsrv.
+func withDNSTestClient(t *testing.T, fn func(c *Client)) {
+	dnsProvider, err := NewPebbleDNSProvider(PebbleDNSProviderCfg{})
 	if err != nil {
-		t.Fatalf("cannot create data store: %v", err)
+		t.Fatalf("cannot create DNS provider: %v", err)
 	}
 
-	httpClient := NewHTTPClient(PebbleCACertificatePool())
+	dnsChallengeSolver := DNSChallengeSolverCfg{
+		Provider: dnsProvider,
+	}
 
-	httpChallengeSolver := HTTPChallengeSolverCfg{
-		Address: PebbleHTTPChallengeSolverAddress,
+	withTestClientCfg(t, t.TempDir(), func(cfg *ClientCfg) {
+		cfg.DNSChallengeSolver = &dnsChallengeSolver
+	}, fn)
+}
+
+func withTestClientCfg(t *testing.T, dataStorePath string, setup func(*ClientCfg), fn func(c *Client)) {
+	dataStore, err := NewFileSystemDataStore(dataStorePath)
+	if err != nil {
+		t.Fatalf("cannot create data store: %v", err)
 	}
 
 	clientCfg := ClientCfg{
-		HTTPClient:          httpClient,
-		DataStore:           dataStore,
-		DirectoryURI:        PebbleDirectoryURI,
-		ContactURIs:         []string{"mailto:test@example.com"},
-		HTTPChallengeSolver: &httpChallengeSolver,
+		HTTPClient:   NewHTTPClient(PebbleCACertificatePool()),
+		DataStore:    dataStore,
+		DirectoryURI: PebbleDirectoryURI,
+		ContactURIs:  []string{"mailto:test@example.com"},
 	}
 
-	clientCfg.HTTPClient = NewHTTPClient(PebbleCACertificatePool())
+	setup(&clientCfg)
 
 	client, err := NewClient(clientCfg)
 	if err != nil {
@@ -44,3 +72,187 @@ func withTestClientWithDataStorePath(t *testing.T, dataStorePath string, fn func
 
 	fn(client)
 }
+
+func TestClientUpdateConfig(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ctx := context.Background()
+
+		err := c.UpdateConfig(ctx, func(cfg *ClientCfg) {
+			cfg.DirectoryURI = "http://localhost/directory"
+		})
+		assert.Error(err)
+
+		// Contact URIs are updated on the server
+		nbAccountRequests := s.Requests("account")
+
+		err = c.UpdateConfig(ctx, func(cfg *ClientCfg) {
+			cfg.ContactURIs = []string{"mailto:admin@example.com"}
+		})
+		require.NoError(err)
+
+		assert.Equal(nbAccountRequests+1, s.Requests("account"))
+		assert.Equal([]string{"mailto:admin@example.com"},
+			c.Config().ContactURIs)
+
+		// The renewal policy is used by workers
+		err = c.UpdateConfig(ctx, func(cfg *ClientCfg) {
+			cfg.RenewalPolicy.RetryInitialOrder = true
+		})
+		require.NoError(err)
+
+		s.mutex.Lock()
+		s.RateLimitedOrders = 1
+		s.mutex.Unlock()
+
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(ctx, "test", request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.Error(ev.Error)
+		assert.False(ev.NextAttemptTime.IsZero())
+
+		ev = <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+	})
+}
+
+func TestWaitDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.MinPollDelay = 2 * time.Second
+		cfg.MaxPollDelay = time.Minute
+	}, func(c *Client) {
+		waitDelay := func(retryAfter string) time.Duration {
+			header := make(http.Header)
+			if retryAfter != "" {
+				header.Set("Retry-After", retryAfter)
+			}
+
+			return c.waitDelay(&http.Response{Header: header})
+		}
+
+		assert.Equal(2*time.Second, waitDelay("0"))
+		assert.Equal(time.Minute, waitDelay("86400"))
+		assert.Equal(time.Minute, waitDelay("99999999999999999"))
+
+		delay := waitDelay("10")
+		assert.GreaterOrEqual(delay, 10*time.Second)
+		assert.LessOrEqual(delay, 11*time.Second)
+	})
+}
+
+func TestClientDNSOnly(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	_, err = NewClient(ClientCfg{
+		DataStore:           dataStore,
+		DNSOnly:             true,
+		HTTPChallengeSolver: &HTTPChallengeSolverCfg{NoServer: true},
+	})
+	assert.Error(err)
+
+	_, err = NewClient(ClientCfg{
+		DataStore: dataStore,
+		DNSOnly:   true,
+	})
+	assert.Error(err)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.DNSOnly = true
+	}, func(c *Client) {
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{
+				Identifiers: []Identifier{DNSIdentifier("example.com")},
+				Validity:    1,
+			})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+	})
+}
+
+func TestClientCfgValidation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := NewClient(ClientCfg{
+		StartupWindow: -time.Second,
+		HTTPChallengeSolver: &HTTPChallengeSolverCfg{
+			Address:        "localhost",
+			ListenOnDemand: true,
+			NoServer:       true,
+		},
+		DNSChallengeSolver: &DNSChallengeSolverCfg{},
+	})
+
+	var errs ValidationErrors
+	require.ErrorAs(err, &errs)
+
+	fields := make([]string, len(errs))
+	for i, err := range errs {
+		fields[i] = err.Field
+	}
+
+	assert.Equal([]string{
+		"DataStore",
+		"StartupWindow",
+		"HTTPChallengeSolver.ListenOnDemand",
+		"DNSChallengeSolver.Provider",
+	}, fields)
+
+	_, err = NewHTTPChallengeSolver(HTTPChallengeSolverCfg{Address: "localhost"})
+	assert.ErrorAs(err, &errs)
+	assert.Equal("Address", errs[0].Field)
+}
+
+func TestClientLetsEncryptDefaults(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	newClient := func(directoryURI string) *Client {
+		c, err := NewClient(ClientCfg{
+			DataStore:    dataStore,
+			DirectoryURI: directoryURI,
+		})
+		require.NoError(err)
+
+		return c
+	}
+
+	c := newClient(LetsEncryptDirectoryURI)
+	assert.True(c.Config().OmitValidityPeriod)
+	assert.NotNil(c.Config().RateLimits)
+
+	c = newClient(LetsEncryptStagingDirectoryURI)
+	assert.True(c.Config().OmitValidityPeriod)
+	assert.Nil(c.Config().RateLimits)
+
+	c = newClient(PebbleDirectoryURI)
+	assert.False(c.Config().OmitValidityPeriod)
+}
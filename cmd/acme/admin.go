@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+)
+
+// The admin server serves the control API over TCP so that dashboards and
+// orchestration tools can manage the daemon remotely. Access to the control
+// socket is restricted by file permissions; admin requests must instead be
+// authenticated with a bearer token. The admin server also serves a
+// read-only status page, which browsers can access with basic authentication.
+
+type AdminServer struct {
+	daemon *Daemon
+	cfg    *DaemonAdminAPICfg
+
+	controlServer *ControlServer
+	token         acme.SecretSource
+	server        *http.Server
+	done          chan struct{}
+}
+
+func NewAdminServer(d *Daemon, cfg *DaemonAdminAPICfg) *AdminServer {
+	s := AdminServer{
+		daemon: d,
+		cfg:    cfg,
+
+		done: make(chan struct{}),
+	}
+
+	if cfg.TokenFile != "" {
+		s.token = acme.NewFileSecret(cfg.TokenFile)
+	} else {
+		s.token = acme.StaticSecret(cfg.Token)
+	}
+
+	s.controlServer = NewControlServer(d)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.authenticate(s.controlServer.handler, false))
+	mux.Handle("GET /{$}", s.authenticate(http.HandlerFunc(s.hStatusPage),
+		true))
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          d.Log.StdLogger(log.LevelError),
+	}
+
+	return &s
+}
+
+func (s *AdminServer) Start() error {
+	address := s.cfg.Address
+
+	if s.cfg.CertificatePath != "" {
+		cert, err := tls.LoadX509KeyPair(s.cfg.CertificatePath,
+			s.cfg.PrivateKeyPath)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %w", err)
+		}
+
+		s.server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	if s.server.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.server.TLSConfig)
+	}
+
+	s.daemon.Log.Info("serving admin API on %q", address)
+
+	go func() {
+		defer close(s.done)
+
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.daemon.Log.Error("cannot serve admin API: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *AdminServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.server.Shutdown(ctx)
+
+	<-s.done
+}
+
+// authenticate checks the bearer token of requests. Basic authentication, with
+// the token as password, is only accepted for the status page: browsers
+// resend basic credentials automatically, so allowing them for requests
+// modifying the state of the daemon would make them vulnerable to CSRF.
+func (s *AdminServer) authenticate(h http.Handler, allowBasicAuth bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, err := s.token.Secret(req.Context())
+		if err != nil {
+			s.daemon.Log.Error("cannot read admin API token: %v", err)
+			s.controlServer.replyError(w, http.StatusInternalServerError,
+				"internal error")
+			return
+		}
+
+		var reqToken string
+		var found bool
+
+		scheme, value, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			reqToken, found = strings.TrimSpace(value), true
+		} else if allowBasicAuth {
+			_, reqToken, found = req.BasicAuth()
+		}
+
+		if !found ||
+			subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) != 1 {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="acme"`)
+			if allowBasicAuth {
+				w.Header().Add("WWW-Authenticate", `Basic realm="acme"`)
+			}
+			s.controlServer.replyError(w, http.StatusUnauthorized,
+				"missing or invalid token")
+			return
+		}
+
+		h.ServeHTTP(w, req)
+	})
+}
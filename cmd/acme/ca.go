@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"go.n16f.net/acme"
+)
+
+var caDirectoryURIs = map[string]string{
+	"letsencrypt":         acme.LetsEncryptDirectoryURI,
+	"letsencrypt-staging": acme.LetsEncryptStagingDirectoryURI,
+	"zerossl":             acme.ZeroSSLDirectoryURI,
+	"google":              acme.GoogleDirectoryURI,
+	"google-staging":      acme.GoogleStagingDirectoryURI,
+	"pebble":              acme.PebbleDirectoryURI,
+}
+
+func caNames() []string {
+	var names []string
+	for name := range caDirectoryURIs {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// CADirectoryURI returns the directory URI of a certificate authority
+// identified either by its name or by a custom directory URI.
+func CADirectoryURI(s string) (string, error) {
+	if uri, found := caDirectoryURIs[s]; found {
+		return uri, nil
+	}
+
+	uri, err := url.Parse(s)
+	if err != nil || (uri.Scheme != "https" && uri.Scheme != "http") ||
+		uri.Host == "" {
+		return "", fmt.Errorf("unknown certificate authority %q (known "+
+			"authorities: %s; a custom directory URI can also be used)", s,
+			strings.Join(caNames(), ", "))
+	}
+
+	return s, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/program"
+)
+
+func addAccountCommands() {
+	var c *program.Command
+
+	p.AddCommand("account show", "print information about the account",
+		cmdAccountShow)
+
+	c = p.AddCommand("account update-contact",
+		"replace the contact URIs of the account", cmdAccountUpdateContact)
+
+	c.AddTrailingArgument("uri", "a contact URI (e.g. \"mailto:a@example.com\")")
+
+	p.AddCommand("account rollover",
+		"replace the private key of the account by a new one",
+		cmdAccountRollover)
+
+	p.AddCommand("account deactivate", "permanently deactivate the account",
+		cmdAccountDeactivate)
+}
+
+func cmdAccountShow(p *program.Program) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	account, err := client.Account(ctx)
+	if err != nil {
+		p.Fatal("cannot fetch account: %v", err)
+	}
+
+	printAccount(account)
+}
+
+func cmdAccountUpdateContact(p *program.Program) {
+	contactURIs := p.TrailingArgumentValues("uri")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	account, err := client.UpdateAccountContact(ctx, contactURIs)
+	if err != nil {
+		p.Fatal("cannot update account: %v", err)
+	}
+
+	printAccount(account)
+}
+
+func cmdAccountRollover(p *program.Program) {
+	privateKey, err := client.Cfg.GenerateAccountPrivateKey()
+	if err != nil {
+		p.Fatal("cannot generate private key: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := client.RolloverAccountKey(ctx, privateKey); err != nil {
+		p.Fatal("cannot change account key: %v", err)
+	}
+
+	p.Info("account key replaced")
+}
+
+func cmdAccountDeactivate(p *program.Program) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	account, err := client.DeactivateAccount(ctx)
+	if err != nil {
+		p.Fatal("cannot deactivate account: %v", err)
+	}
+
+	printAccount(account)
+}
+
+func printAccount(account *acme.Account) {
+	thumbprint, err := client.AccountThumbprint()
+	if err != nil {
+		p.Fatal("cannot compute account thumbprint: %v", err)
+	}
+
+	t := program.NewKeyValueTable()
+
+	t.AddRow("status", string(account.Status))
+	t.AddRow("thumbprint", thumbprint)
+	t.AddRow("contact URIs", strings.Join(account.Contact, "\n"))
+	t.AddRow("terms of service agreed", account.TermsOfServiceAgreed)
+	t.AddRow("orders URI", account.Orders)
+
+	t.Print()
+}
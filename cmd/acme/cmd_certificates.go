@@ -2,11 +2,11 @@ package main
 
 import (
 	"context"
-	"crypto"
 	"math"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,10 +22,54 @@ func addCertificateCommands() {
 
 	c.AddOption("v", "validity", "duration", "30",
 		"the validity duration of the certificate in days")
+	c.AddOption("k", "key-type", "type", "",
+		"the type of the private key of the certificate (ecdsa-p256, "+
+			"ecdsa-p384, rsa-2048, rsa-3072 or rsa-4096)")
+	c.AddOption("", "profile", "name", "",
+		"the certificate profile to request if the server supports profiles")
+	c.AddFlag("", "reuse-key",
+		"keep the same private key when the certificate is renewed")
+	c.AddOption("l", "labels", "labels", "",
+		"a comma-separated list of name=value labels attached to the "+
+			"certificate")
+	addPreferredChainOption(c)
 
 	c.AddArgument("name", "the name of the certificate")
 	c.AddTrailingArgument("domain",
 		"a domain identifier the certificate will be associated with")
+
+	c = p.AddCommand("revoke-certificate", "revoke a certificate",
+		cmdRevokeCertificate)
+
+	c.AddOption("r", "reason", "reason", "unspecified",
+		"the reason of the revocation (e.g. \"keyCompromise\")")
+	c.AddFlag("", "reissue",
+		"order a new certificate with a new private key after revocation")
+	addPreferredChainOption(c)
+
+	c.AddArgument("name", "the name of the certificate")
+
+	c = p.AddCommand("show-chain",
+		"print the certificate chain of a certificate and the alternate "+
+			"chains offered by the server", cmdShowChain)
+
+	c.AddArgument("name", "the name of the certificate")
+
+	c = p.AddCommand("delete-certificate",
+		"delete a certificate from the data store", cmdDeleteCertificate)
+
+	c.AddFlag("", "revoke", "revoke the certificate before deleting it")
+	c.AddOption("r", "reason", "reason", "unspecified",
+		"the reason of the revocation (e.g. \"keyCompromise\")")
+
+	c.AddArgument("name", "the name of the certificate")
+}
+
+func addPreferredChainOption(c *program.Command) {
+	c.AddOption("", "preferred-chain", "issuer", "",
+		"the common name of the issuer of the topmost certificate of the "+
+			"chain to use if the server offers several chains (e.g. "+
+			"\"ISRG Root X1\")")
 }
 
 func cmdOrderCertificate(p *program.Program) {
@@ -47,11 +91,183 @@ func cmdOrderCertificate(p *program.Program) {
 		}
 	}
 
+	request := acme.CertificateRequest{
+		Identifiers: ids,
+		Validity:    validity,
+		KeyType:     acme.KeyType(p.OptionValue("key-type")),
+		Profile:     p.OptionValue("profile"),
+		ReuseKey:    p.IsOptionSet("reuse-key"),
+	}
+
+	if s := p.OptionValue("labels"); s != "" {
+		request.Labels = make(map[string]string)
+
+		for _, label := range strings.Split(s, ",") {
+			name, value, found := strings.Cut(label, "=")
+			if !found {
+				p.Fatal("invalid label %q", label)
+			}
+
+			request.Labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	orderCertificate(name, request)
+}
+
+func cmdRevokeCertificate(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	var reason acme.RevocationReason
+	if err := reason.Parse(p.OptionValue("reason")); err != nil {
+		p.Fatal("invalid revocation reason: %v", err)
+	}
+
+	dataStore := client.Cfg.DataStore
+
+	certData, err := dataStore.LoadCertificateData(name)
+	if err != nil {
+		p.Fatal("cannot load certificate %q: %v", name, err)
+	}
+
+	cert := certData.LeafCertificate()
+	if cert == nil {
+		p.Fatal("no certificate available for %q", name)
+	}
+
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if err := client.RevokeCertificate(ctx, cert, reason); err != nil {
+		p.Fatal("cannot revoke certificate: %v", err)
+	}
+
+	p.Info("certificate %q (%s) revoked", name,
+		certData.FormatLeafCertificateFingerprint(acme.FingerprintFormat{}))
+
+	if !p.IsOptionSet("reissue") {
+		return
+	}
+
+	// Replace the private key and drop the revoked certificate so that the
+	// certificate worker immediately orders a new certificate. The private
+	// key must never be reused after revocation since it may have been
+	// compromised.
+	privateKey, err := client.Cfg.GenerateCertificatePrivateKey()
+	if err != nil {
+		p.Fatal("cannot generate private key: %v", err)
+	}
+
+	certData.PrivateKey = privateKey
+	certData.Certificate = nil
+	certData.SerialNumber = ""
+	certData.ARICertID = ""
+
+	if err := dataStore.StoreCertificateData(certData); err != nil {
+		p.Fatal("cannot store certificate data: %v", err)
+	}
+
+	orderCertificate(name, certData.CertificateRequest)
+}
+
+func cmdShowChain(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	chains, err := client.CertificateChains(ctx, name)
+	if err != nil {
+		p.Fatal("cannot fetch certificate chains: %v", err)
+	}
+
+	certData, err := client.Cfg.DataStore.LoadCertificateData(name)
+	if err != nil {
+		p.Fatal("cannot load certificate %q: %v", name, err)
+	}
+	currentIssuer := acme.ChainIssuer(certData.Certificate)
+
+	t := program.NewTable()
+
+	t.AddColumn(program.TableColumn{Label: "chain"})
+	t.AddColumn(program.TableColumn{Label: "issuer"})
+	t.AddColumn(program.TableColumn{Label: "certificates"})
+
+	for i, chain := range chains {
+		label := strconv.Itoa(i)
+		if i == 0 {
+			label += " (default)"
+		}
+
+		issuer := acme.ChainIssuer(chain)
+		if issuer == currentIssuer {
+			label += " (current)"
+		}
+
+		var subjects []string
+		for _, cert := range chain {
+			subject := cert.Subject.String()
+			if subject == "" {
+				// Leaf certificates often only have subject alternative names
+				subject = strings.Join(cert.DNSNames, ", ")
+			}
+
+			subjects = append(subjects, subject)
+		}
+
+		t.AddRow(label, issuer, strings.Join(subjects, "\n"))
+	}
+
+	t.Print()
+}
+
+func cmdDeleteCertificate(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	dataStore := client.Cfg.DataStore
+
+	if p.IsOptionSet("revoke") {
+		var reason acme.RevocationReason
+		if err := reason.Parse(p.OptionValue("reason")); err != nil {
+			p.Fatal("invalid revocation reason: %v", err)
+		}
+
+		certData, err := dataStore.LoadCertificateData(name)
+		if err != nil {
+			p.Fatal("cannot load certificate %q: %v", name, err)
+		}
+
+		if cert := certData.LeafCertificate(); cert != nil {
+			ctx := context.Background()
+			ctx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+
+			if err := client.RevokeCertificate(ctx, cert, reason); err != nil {
+				p.Fatal("cannot revoke certificate: %v", err)
+			}
+
+			p.Info("certificate %q revoked", name)
+		}
+	}
+
+	if err := client.DeleteCertificateData(name); err != nil {
+		p.Fatal("cannot delete certificate %q: %v", name, err)
+	}
+
+	p.Info("certificate %q deleted", name)
+}
+
+func orderCertificate(name string, request acme.CertificateRequest) {
+	if preferredChain := p.OptionValue("preferred-chain"); preferredChain != "" {
+		request.PreferredChain = preferredChain
+	}
+
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
-	eventChan, err := client.RequestCertificate(ctx, name, ids, validity)
+	eventChan, err := client.RequestCertificate(ctx, name, request)
 	if err != nil {
 		p.Fatal("cannot order certificate: %v", err)
 	}
@@ -64,7 +280,8 @@ func cmdOrderCertificate(p *program.Program) {
 		if ev.Error == nil {
 			certData := ev.CertificateData
 			p.Info("certificate %q (%s) ready", name,
-				certData.LeafCertificateFingerprint(crypto.MD5))
+				certData.FormatLeafCertificateFingerprint(
+					acme.FingerprintFormat{}))
 		} else {
 			p.Fatal("cannot order certificate: %v", ev.Error)
 		}
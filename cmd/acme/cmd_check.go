@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/program"
+)
+
+// Exit codes follow the conventions of Nagios plugins.
+const (
+	checkStatusOK       = 0
+	checkStatusWarning  = 1
+	checkStatusCritical = 2
+	checkStatusUnknown  = 3
+)
+
+var checkStatusLabels = map[int]string{
+	checkStatusOK:       "OK",
+	checkStatusWarning:  "WARNING",
+	checkStatusCritical: "CRITICAL",
+	checkStatusUnknown:  "UNKNOWN",
+}
+
+type checkResult struct {
+	status  int
+	message string
+}
+
+func addCheckCommand() {
+	var c *program.Command
+
+	c = p.AddCommand("check",
+		"check the expiration of certificates and the result of their last "+
+			"renewal, exiting with status 0 (OK), 1 (WARNING), 2 (CRITICAL) "+
+			"or 3 (UNKNOWN)", cmdCheck)
+
+	c.AddOption("", "warning", "days", "14",
+		"the number of days before expiration below which a certificate is "+
+			"in warning state")
+	c.AddOption("", "critical", "days", "7",
+		"the number of days before expiration below which a certificate is "+
+			"in critical state")
+	addSocketOption(c)
+
+	c.AddOptionalArgument("name",
+		"the name of the certificate (default: all certificates)")
+}
+
+func cmdCheck(p *program.Program) {
+	warningDays := checkDaysOption(p, "warning")
+	criticalDays := checkDaysOption(p, "critical")
+
+	dataStore, err := acme.NewFileSystemDataStore(p.OptionValue("data-store"))
+	if err != nil {
+		checkExit(checkStatusUnknown, "cannot open data store: %v", err)
+	}
+
+	var names []string
+	if name := p.OptionalArgumentValue("name"); name != nil {
+		names = []string{*name}
+	} else {
+		names, err = dataStore.CertificateNames()
+		if err != nil {
+			checkExit(checkStatusUnknown, "cannot list certificates: %v", err)
+		}
+
+		if len(names) == 0 {
+			checkExit(checkStatusUnknown, "no certificate found")
+		}
+	}
+
+	// The result of the last renewal is only known to the daemon. If it is
+	// not running, we only check expiration dates.
+	controlClient := newControlClient(p)
+
+	daemonStatuses := make(map[string]*CertificateStatus)
+	statuses, err := controlClient.Status()
+	if err == nil {
+		for _, status := range statuses {
+			daemonStatuses[status.Name] = status
+		}
+	}
+
+	var results []checkResult
+
+	// Without a reachable challenge solver, the next renewal will fail
+	if err == nil {
+		if err := controlClient.Health(); err != nil {
+			results = append(results, checkResult{checkStatusWarning,
+				fmt.Sprintf("daemon unhealthy: %v", err)})
+		}
+	}
+
+	now := time.Now()
+
+	for _, name := range names {
+		certData, err := dataStore.LoadCertificateData(name)
+		if err != nil {
+			results = append(results, checkResult{checkStatusUnknown,
+				fmt.Sprintf("cannot load certificate %q: %v", name, err)})
+			continue
+		}
+
+		results = append(results, checkCertificate(certData,
+			daemonStatuses[name], now, warningDays, criticalDays))
+	}
+
+	status := checkStatusOK
+	for _, result := range results {
+		status = max(status, result.status)
+	}
+
+	if status == checkStatusOK {
+		fmt.Printf("%s - %d certificate(s) valid\n",
+			checkStatusLabels[status], len(results))
+	} else {
+		fmt.Printf("%s\n", checkStatusLabels[status])
+	}
+
+	for _, result := range results {
+		fmt.Printf("%s: %s\n", checkStatusLabels[result.status],
+			result.message)
+	}
+
+	os.Exit(status)
+}
+
+func checkCertificate(certData *acme.CertificateData, daemonStatus *CertificateStatus, now time.Time, warningDays, criticalDays int) checkResult {
+	name := certData.Name
+
+	if !certData.ContainsCertificate() {
+		return checkResult{checkStatusCritical,
+			fmt.Sprintf("certificate %q has not been issued", name)}
+	}
+
+	notAfter := certData.LeafCertificate().NotAfter
+	days := notAfter.Sub(now).Hours() / 24
+
+	result := checkResult{
+		status: checkStatusOK,
+		message: fmt.Sprintf("certificate %q expires in %.1f days", name,
+			days),
+	}
+
+	switch {
+	case days < 0:
+		result.status = checkStatusCritical
+		result.message = fmt.Sprintf("certificate %q expired on %s", name,
+			notAfter.Format(time.RFC3339))
+	case days < float64(criticalDays):
+		result.status = checkStatusCritical
+	case days < float64(warningDays):
+		result.status = checkStatusWarning
+	}
+
+	if s := daemonStatus; s != nil && s.LastError != "" &&
+		s.LastErrorTime.After(s.LastDeployTime) {
+		result.status = max(result.status, checkStatusWarning)
+		result.message += fmt.Sprintf(", last renewal failed: %s",
+			s.LastError)
+	}
+
+	return result
+}
+
+func checkDaysOption(p *program.Program, name string) int {
+	s := p.OptionValue(name)
+
+	i64, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i64 < 0 || i64 > 3650 {
+		checkExit(checkStatusUnknown, "invalid --%s value %q", name, s)
+	}
+
+	return int(i64)
+}
+
+func checkExit(status int, format string, args ...any) {
+	fmt.Printf("%s - %s\n", checkStatusLabels[status],
+		fmt.Sprintf(format, args...))
+	os.Exit(status)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"go.n16f.net/program"
+)
+
+func addControlCommands() {
+	var c *program.Command
+
+	c = p.AddCommand("status",
+		"print the state of the certificates managed by a running daemon",
+		cmdStatus)
+
+	addSocketOption(c)
+
+	c = p.AddCommand("renew-now", "make the daemon renew a certificate now",
+		cmdRenewNow)
+
+	addSocketOption(c)
+	c.AddArgument("name", "the name of the certificate")
+
+	c = p.AddCommand("pause",
+		"make the daemon stop ordering and renewing a certificate", cmdPause)
+
+	addSocketOption(c)
+	c.AddArgument("name", "the name of the certificate")
+
+	c = p.AddCommand("resume", "resume a paused certificate", cmdResume)
+
+	addSocketOption(c)
+	c.AddArgument("name", "the name of the certificate")
+}
+
+func addSocketOption(c *program.Command) {
+	c.AddOption("", "socket", "path", "",
+		"the path of the control socket of the daemon (default: "+
+			"control.sock in the data store directory)")
+}
+
+func newControlClient(p *program.Program) *ControlClient {
+	socketPath := p.OptionValue("socket")
+	if socketPath == "" {
+		socketPath = DefaultControlSocketPath(p.OptionValue("data-store"))
+	}
+
+	return NewControlClient(socketPath)
+}
+
+func cmdStatus(p *program.Program) {
+	statuses, err := newControlClient(p).Status()
+	if err != nil {
+		p.Fatal("cannot fetch status: %v", err)
+	}
+
+	t := program.NewTable()
+
+	t.AddColumn(program.TableColumn{Label: "name"})
+	t.AddColumn(program.TableColumn{Label: "identifiers"})
+	t.AddColumn(program.TableColumn{Label: "state"})
+	t.AddColumn(program.TableColumn{Label: "expiration"})
+	t.AddColumn(program.TableColumn{Label: "renewal"})
+	t.AddColumn(program.TableColumn{Label: "last error"})
+	t.AddColumn(program.TableColumn{Label: "labels"})
+
+	for _, status := range statuses {
+		state, renewalTime := status.State()
+
+		var lastError string
+		if status.LastError != "" {
+			lastError = formatStatusTime(status.LastErrorTime) + " " +
+				status.LastError
+		}
+
+		t.AddRow(status.Name, strings.Join(status.Identifiers, " "), state,
+			formatStatusTime(status.NotAfter),
+			formatStatusTime(renewalTime), lastError,
+			formatLabels(status.Labels))
+	}
+
+	t.Print()
+}
+
+func cmdRenewNow(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	if _, err := newControlClient(p).CertificateAction(name, "renew"); err != nil {
+		p.Fatal("cannot renew certificate: %v", err)
+	}
+
+	p.Info("renewal of certificate %q requested", name)
+}
+
+func cmdPause(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	if _, err := newControlClient(p).CertificateAction(name, "pause"); err != nil {
+		p.Fatal("cannot pause certificate: %v", err)
+	}
+
+	p.Info("certificate %q paused", name)
+}
+
+func cmdResume(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	if _, err := newControlClient(p).CertificateAction(name, "resume"); err != nil {
+		p.Fatal("cannot resume certificate: %v", err)
+	}
+
+	p.Info("certificate %q resumed", name)
+}
+
+func formatLabels(labels map[string]string) string {
+	names := slices.Sorted(maps.Keys(labels))
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + labels[name]
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
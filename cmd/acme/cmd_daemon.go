@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.n16f.net/log"
+	"go.n16f.net/program"
+)
+
+func addDaemonCommand() {
+	var c *program.Command
+
+	c = p.AddCommand("daemon",
+		"run continuously, maintaining the certificates listed in a "+
+			"configuration file", cmdDaemon)
+
+	c.AddOption("", "config", "path", "acme.yaml",
+		"the path of the configuration file")
+}
+
+func cmdDaemon(p *program.Program) {
+	cfgPath := p.OptionValue("config")
+
+	cfg, err := LoadDaemonCfg(cfgPath)
+	if err != nil {
+		p.Fatal("cannot load configuration: %v", err)
+	}
+
+	logger := log.DefaultLogger("acme")
+	logger.DebugLevel = p.DebugLevel
+
+	d := NewDaemon(cfg, logger)
+
+	if err := d.Start(); err != nil {
+		p.Fatal("cannot start daemon: %v", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for signo := range sigChan {
+		if signo == syscall.SIGHUP {
+			cfg, err := LoadDaemonCfg(cfgPath)
+			if err != nil {
+				logger.Error("cannot reload configuration: %v", err)
+				continue
+			}
+
+			d.Reload(cfg)
+			continue
+		}
+
+		p.Info("\nreceived signal %d (%v)", signo, signo)
+		break
+	}
+
+	d.Stop()
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -34,9 +32,12 @@ func cmdDemo(p *program.Program) {
 	// Request a certificate
 	ctx := context.Background()
 
-	ids := []acme.Identifier{acme.DNSIdentifier(hostname)}
+	request := acme.CertificateRequest{
+		Identifiers: []acme.Identifier{acme.DNSIdentifier(hostname)},
+		Validity:    1,
+	}
 
-	eventChan, err := client.RequestCertificate(ctx, "demo", ids, 1)
+	eventChan, err := client.RequestCertificate(ctx, "demo", request)
 	if err != nil {
 		p.Fatal("cannot order certificate: %v", err)
 	}
@@ -50,10 +51,6 @@ func cmdDemo(p *program.Program) {
 	}()
 
 	// Create an HTTP server
-	tlsCfg := tls.Config{
-		GetCertificate: client.GetTLSCertificateFunc("demo"),
-	}
-
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(200)
@@ -63,24 +60,23 @@ func cmdDemo(p *program.Program) {
 	logger := log.DefaultLogger("http_server")
 
 	server := http.Server{
-		Addr:      addr,
-		TLSConfig: &tlsCfg,
-		Handler:   mux,
-		ErrorLog:  logger.StdLogger(log.LevelError),
+		Addr:     addr,
+		Handler:  mux,
+		ErrorLog: logger.StdLogger(log.LevelError),
 	}
 
 	// Wait for a certificate and start the HTTP server
 	client.WaitForCertificate(ctx, "demo")
 
-	listener, err := net.Listen("tcp", addr)
+	listener, err := client.Listen(addr, "demo")
 	if err != nil {
-		p.Fatal("cannot listen on %q: %v", addr, err)
+		p.Fatal("%v", err)
 	}
 
 	p.Info("listening on %q", addr)
 
 	go func() {
-		if err := server.ServeTLS(listener, "", ""); err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
 			p.Fatal("cannot run HTTP server: %v", err)
 		}
 	}()
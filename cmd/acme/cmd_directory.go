@@ -12,7 +12,7 @@ func addDirectoryCommand() {
 }
 
 func cmdDirectory(p *program.Program) {
-	d := client.Directory
+	d := client.Directory()
 
 	t := program.NewKeyValueTable()
 
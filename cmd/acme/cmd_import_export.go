@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/program"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func addImportExportCommands() {
+	var c *program.Command
+
+	c = p.AddCommand("export-certificate",
+		"export a certificate and its private key to files",
+		cmdExportCertificate)
+
+	c.AddOption("f", "format", "format", "pem",
+		"the output format (\"pem\", \"der\", \"p12\" or \"bundle\")")
+	c.AddOption("o", "out", "path", ".",
+		"the directory to write files to")
+	c.AddOption("", "password-file", "path", "",
+		"the path of a file containing the password used to encrypt "+
+			"PKCS #12 files (\"-\" for the standard input)")
+	c.AddOption("", "bundle-key-file", "path", "",
+		"the path of a file containing the base64url-encoded key used to "+
+			"encrypt certificate bundles (\"-\" for the standard input, "+
+			"default: $ACME_BUNDLE_KEY)")
+
+	c.AddArgument("name", "the name of the certificate")
+
+	c = p.AddCommand("import-certificate",
+		"import a certificate and its private key into the data store",
+		cmdImportCertificate)
+
+	c.AddOption("", "cert", "path", "",
+		"the path of the PEM certificate chain file")
+	c.AddOption("", "key", "path", "",
+		"the path of the PEM private key file")
+	c.AddOption("", "bundle", "path", "",
+		"the path of a certificate bundle exported by another instance")
+	c.AddOption("", "bundle-key-file", "path", "",
+		"the path of a file containing the base64url-encoded key used to "+
+			"decrypt the certificate bundle (\"-\" for the standard input, "+
+			"default: $ACME_BUNDLE_KEY)")
+
+	c.AddArgument("name", "the name of the certificate")
+
+	p.AddCommand("generate-bundle-key",
+		"generate a key for certificate bundles", cmdGenerateBundleKey)
+}
+
+func cmdExportCertificate(p *program.Program) {
+	name := p.ArgumentValue("name")
+	format := p.OptionValue("format")
+	dirPath := p.OptionValue("out")
+
+	certData, err := client.Cfg.DataStore.LoadCertificateData(name)
+	if err != nil {
+		p.Fatal("cannot load certificate %q: %v", name, err)
+	}
+
+	if !certData.ContainsCertificate() {
+		p.Fatal("no certificate available for %q", name)
+	}
+
+	if err := os.MkdirAll(dirPath, 0700); err != nil {
+		p.Fatal("cannot create directory %q: %v", dirPath, err)
+	}
+
+	writeFile := func(fileName string, data []byte) {
+		filePath := path.Join(dirPath, fileName)
+
+		if err := os.WriteFile(filePath, data, 0600); err != nil {
+			p.Fatal("cannot write %q: %v", filePath, err)
+		}
+
+		p.Info("%s written", filePath)
+	}
+
+	switch format {
+	case "pem":
+		chainData, err := certData.EncodePEMCertificateChain()
+		if err != nil {
+			p.Fatal("cannot encode certificate chain: %v", err)
+		}
+
+		privateKeyData, err := certData.EncodePEMPrivateKey()
+		if err != nil {
+			p.Fatal("%v", err)
+		}
+
+		writeFile(name+".crt", []byte(chainData))
+		writeFile(name+".key", privateKeyData)
+
+	case "der":
+		privateKeyData, err := x509.MarshalPKCS8PrivateKey(certData.PrivateKey)
+		if err != nil {
+			p.Fatal("cannot encode private key: %v", err)
+		}
+
+		writeFile(name+".der", certData.LeafCertificate().Raw)
+		writeFile(name+".key.der", privateKeyData)
+
+	case "p12":
+		var password string
+		if p.IsOptionSet("password-file") {
+			password = readSecretFile(p, p.OptionValue("password-file"))
+		}
+
+		data, err := pkcs12.Modern.Encode(certData.PrivateKey,
+			certData.LeafCertificate(), certData.Certificate[1:], password)
+		if err != nil {
+			p.Fatal("cannot encode PKCS #12 data: %v", err)
+		}
+
+		writeFile(name+".p12", data)
+
+	case "bundle":
+		data, err := acme.EncodeCertificateBundle(certData, bundleKey(p))
+		if err != nil {
+			p.Fatal("cannot encode certificate bundle: %v", err)
+		}
+
+		writeFile(name+".bundle", data)
+
+	default:
+		p.Fatal("unknown format %q", format)
+	}
+}
+
+func cmdImportCertificate(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	if p.IsOptionSet("bundle") {
+		importCertificateBundle(p, name)
+		return
+	}
+
+	if !p.IsOptionSet("cert") || !p.IsOptionSet("key") {
+		p.Fatal("missing --cert or --key option")
+	}
+
+	readFile := func(filePath string) []byte {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			p.Fatal("cannot read %q: %v", filePath, err)
+		}
+
+		return data
+	}
+
+	chainData := readFile(p.OptionValue("cert"))
+	privateKeyData := readFile(p.OptionValue("key"))
+
+	certData, err := acme.NewCertificateDataFromPEM(name, chainData,
+		privateKeyData)
+	if err != nil {
+		p.Fatal("invalid certificate: %v", err)
+	}
+
+	if err := client.Cfg.DataStore.StoreCertificateData(certData); err != nil {
+		p.Fatal("cannot store certificate data: %v", err)
+	}
+
+	p.Info("certificate %q (%s) imported", name,
+		certData.FormatLeafCertificateFingerprint(acme.FingerprintFormat{}))
+}
+
+func importCertificateBundle(p *program.Program, name string) {
+	filePath := p.OptionValue("bundle")
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		p.Fatal("cannot read %q: %v", filePath, err)
+	}
+
+	key := bundleKey(p)
+
+	certData, err := acme.DecodeCertificateBundle(data, key)
+	if err != nil {
+		p.Fatal("invalid certificate bundle: %v", err)
+	}
+
+	if certData.Name != name {
+		p.Fatal("bundle contains certificate %q, not %q", certData.Name, name)
+	}
+
+	if _, err := client.ImportCertificateBundle(data, key); err != nil {
+		p.Fatal("cannot import certificate bundle: %v", err)
+	}
+
+	p.Info("certificate %q (%s) imported", name,
+		certData.FormatLeafCertificateFingerprint(acme.FingerprintFormat{}))
+}
+
+func cmdGenerateBundleKey(p *program.Program) {
+	key, err := acme.GenerateCertificateBundleKey()
+	if err != nil {
+		p.Fatal("cannot generate key: %v", err)
+	}
+
+	fmt.Println(key)
+}
+
+func bundleKey(p *program.Program) []byte {
+	var value string
+
+	if p.IsOptionSet("bundle-key-file") {
+		value = readSecretFile(p, p.OptionValue("bundle-key-file"))
+	} else if value = os.Getenv("ACME_BUNDLE_KEY"); value == "" {
+		p.Fatal("missing --bundle-key-file option or ACME_BUNDLE_KEY " +
+			"environment variable")
+	}
+
+	key, err := acme.DecodeCertificateBundleKey(value)
+	if err != nil {
+		p.Fatal("invalid bundle key: %v", err)
+	}
+
+	return key
+}
+
+// readSecretFile reads a secret from a file, or from the standard input if
+// the path is "-", so that it does not appear in the command line. Trailing
+// newline characters are ignored.
+func readSecretFile(p *program.Program, filePath string) string {
+	var data []byte
+	var err error
+
+	if filePath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filePath)
+	}
+	if err != nil {
+		p.Fatal("cannot read %q: %v", filePath, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+	"go.n16f.net/program"
+)
+
+func addMonitorCommand() {
+	var c *program.Command
+
+	c = p.AddCommand("monitor",
+		"report the expiration and optionally the OCSP status of "+
+			"certificates in the data store without contacting the ACME "+
+			"server", cmdMonitor)
+
+	c.AddFlag("", "ocsp", "query the OCSP responder of each certificate")
+	c.AddOption("", "interval", "duration", "",
+		"report again at regular intervals instead of exiting")
+	c.AddOption("", "warning", "days", "14",
+		"the number of days before expiration below which a certificate is "+
+			"reported as expiring")
+}
+
+func cmdMonitor(p *program.Program) {
+	checkOCSP := p.IsOptionSet("ocsp")
+	warningDays := checkDaysOption(p, "warning")
+
+	var interval time.Duration
+	if s := p.OptionValue("interval"); s != "" {
+		var err error
+		interval, err = time.ParseDuration(s)
+		if err != nil || interval <= 0 {
+			p.Fatal("invalid interval %q", s)
+		}
+	}
+
+	logger := log.DefaultLogger("acme")
+	logger.DebugLevel = p.DebugLevel
+
+	dataStore, err := acme.NewFileSystemDataStore(p.OptionValue("data-store"))
+	if err != nil {
+		p.Fatal("cannot open data store: %v", err)
+	}
+
+	client, err := acme.NewClient(acme.ClientCfg{
+		Log:         logger,
+		DataStore:   dataStore,
+		MonitorOnly: true,
+	})
+	if err != nil {
+		p.Fatal("cannot create client: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer cancel()
+
+	if err := client.Start(ctx); err != nil {
+		p.Fatal("cannot start client: %v", err)
+	}
+	defer client.Stop()
+
+	warningDelay := time.Duration(warningDays) * 24 * time.Hour
+
+	for {
+		reports, err := client.MonitorCertificates(ctx, checkOCSP)
+		if err != nil {
+			p.Error("cannot monitor certificates: %v", err)
+		} else {
+			printCertificateReports(reports, warningDelay, checkOCSP)
+		}
+
+		if interval == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func printCertificateReports(reports []*acme.CertificateReport, warningDelay time.Duration, checkOCSP bool) {
+	now := time.Now()
+
+	t := program.NewTable()
+
+	t.AddColumn(program.TableColumn{Label: "name"})
+	t.AddColumn(program.TableColumn{Label: "identifiers"})
+	t.AddColumn(program.TableColumn{Label: "expiration"})
+	t.AddColumn(program.TableColumn{Label: "status"})
+	t.AddColumn(program.TableColumn{Label: "labels"})
+	if checkOCSP {
+		t.AddColumn(program.TableColumn{Label: "ocsp"})
+	}
+
+	for _, report := range reports {
+		ids := make([]string, len(report.Identifiers))
+		for i, id := range report.Identifiers {
+			ids[i] = id.Value
+		}
+
+		timeLeft := report.TimeLeft(now)
+
+		status := fmt.Sprintf("valid (%.1f days left)",
+			timeLeft.Hours()/24)
+		switch {
+		case timeLeft < 0:
+			status = "expired"
+		case timeLeft < warningDelay:
+			status = fmt.Sprintf("expiring (%.1f days left)",
+				timeLeft.Hours()/24)
+		}
+
+		row := []any{report.Name, strings.Join(ids, ", "),
+			report.NotAfter.Local().Format(time.DateTime), status,
+			formatLabels(report.Labels)}
+
+		if checkOCSP {
+			var ocspStatus string
+
+			switch {
+			case errors.Is(report.OCSPError, acme.ErrNoOCSPServer):
+				ocspStatus = "-"
+			case report.OCSPError != nil:
+				ocspStatus = "error: " + report.OCSPError.Error()
+			case report.OCSP.Status == acme.OCSPStatusRevoked:
+				ocspStatus = fmt.Sprintf("revoked on %s",
+					report.OCSP.RevokedAt.Local().Format(time.DateTime))
+			default:
+				ocspStatus = string(report.OCSP.Status)
+			}
+
+			row = append(row, ocspStatus)
+		}
+
+		t.AddRow(row...)
+	}
+
+	t.Print()
+}
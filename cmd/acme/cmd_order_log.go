@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/program"
+)
+
+func addOrderLogCommand() {
+	var c *program.Command
+
+	c = p.AddCommand("order-log",
+		"print the orders submitted for a certificate and their outcome",
+		cmdOrderLog)
+
+	c.AddArgument("name", "the name of the certificate")
+}
+
+func cmdOrderLog(p *program.Program) {
+	name := p.ArgumentValue("name")
+
+	dataStore, err := acme.NewFileSystemDataStore(p.OptionValue("data-store"))
+	if err != nil {
+		p.Fatal("cannot open data store: %v", err)
+	}
+
+	entries, err := dataStore.LoadOrderLog(name)
+	if err != nil {
+		p.Fatal("cannot load order log: %v", err)
+	}
+
+	if len(entries) == 0 {
+		p.Info("no order found for certificate %q", name)
+		return
+	}
+
+	t := program.NewTable()
+
+	t.AddColumn(program.TableColumn{Label: "time"})
+	t.AddColumn(program.TableColumn{Label: "event"})
+	t.AddColumn(program.TableColumn{Label: "identifier"})
+	t.AddColumn(program.TableColumn{Label: "details"})
+
+	for _, entry := range entries {
+		identifier := entry.Identifier
+		if entry.ChallengeType != "" {
+			identifier += " (" + string(entry.ChallengeType) + ")"
+		}
+
+		details := entry.Message
+		if entry.Problem != nil {
+			details = entry.Problem.Error()
+		} else if entry.Event == acme.OrderLogEventOrderSubmitted {
+			details = entry.OrderURI
+		}
+
+		if len(entry.ValidationRecord) > 0 {
+			records := acme.FormatValidationRecords(entry.ValidationRecord)
+
+			if details == "" {
+				details = "validated: " + records
+			} else {
+				details += " (validated: " + records + ")"
+			}
+		}
+
+		t.AddRow(entry.Time.Local().Format(time.DateTime),
+			strings.ReplaceAll(string(entry.Event), "_", " "), identifier,
+			details)
+	}
+
+	t.Print()
+}
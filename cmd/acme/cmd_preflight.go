@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/program"
+)
+
+func addPreflightCommand() {
+	var c *program.Command
+
+	c = p.AddCommand("preflight",
+		"check that certificates can be ordered for a set of domains without "+
+			"submitting any order, exiting with status 1 if a check failed",
+		cmdPreflight)
+
+	c.AddTrailingArgument("domain", "a domain name (e.g. \"*.example.com\")")
+}
+
+func cmdPreflight(p *program.Program) {
+	domains := p.TrailingArgumentValues("domain")
+
+	checks, err := client.Preflight(context.Background(), domains,
+		acme.PreflightCfg{})
+	if err != nil {
+		p.Fatal("cannot run checks: %v", err)
+	}
+
+	t := program.NewTable()
+
+	t.AddColumn(program.TableColumn{Label: "identifier"})
+	t.AddColumn(program.TableColumn{Label: "check"})
+	t.AddColumn(program.TableColumn{Label: "status"})
+	t.AddColumn(program.TableColumn{Label: "message"})
+
+	failed := false
+
+	for _, check := range checks {
+		t.AddRow(check.Identifier, check.Name, string(check.Status),
+			check.Message)
+
+		if check.Status == acme.PreflightStatusError {
+			failed = true
+		}
+	}
+
+	t.Print()
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+)
+
+// The control socket exposes a small HTTP API over a unix-domain socket. It
+// is used by the status, renew-now, pause and resume commands to interact
+// with a running daemon. The same API can be served over TCP with
+// authentication, see AdminServer.
+
+type CertificateStatus struct {
+	Name        string            `json:"name"`
+	Identifiers []string          `json:"identifiers"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Paused      bool              `json:"paused,omitempty"`
+
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	RenewalTime time.Time `json:"renewal_time"`
+
+	LastDeployTime time.Time `json:"last_deploy_time"`
+	LastError      string    `json:"last_error,omitempty"`
+	LastErrorTime  time.Time `json:"last_error_time"`
+
+	// Set if the last error was reported by the ACME server
+	LastProblem *acme.ProblemDetails `json:"last_problem,omitempty"`
+
+	// Set when the last attempt to obtain the certificate failed.
+	NextAttemptTime time.Time `json:"next_attempt_time"`
+
+	// Set while an order is being processed.
+	OrderExpires  time.Time `json:"order_expires"`
+	ExpiredOrders int       `json:"expired_orders,omitempty"`
+}
+
+// State returns a description of the state of the certificate and the time
+// of the next attempt to obtain it.
+func (status *CertificateStatus) State() (string, time.Time) {
+	state := "active"
+	renewalTime := status.RenewalTime
+
+	if status.Paused {
+		state = "paused"
+	} else if !status.OrderExpires.IsZero() {
+		state = "ordering (order expires " +
+			formatStatusTime(status.OrderExpires) + ")"
+	} else if !status.NextAttemptTime.IsZero() {
+		state = "retrying"
+		renewalTime = status.NextAttemptTime
+	}
+
+	if status.ExpiredOrders > 0 {
+		state += fmt.Sprintf(", %d expired orders", status.ExpiredOrders)
+	}
+
+	return state, renewalTime
+}
+
+type ControlRevocationRequest struct {
+	Reason string `json:"reason,omitempty"` // default: unspecified
+}
+
+type ControlError struct {
+	Message string `json:"error"`
+}
+
+type ControlServer struct {
+	daemon *Daemon
+
+	handler  http.Handler
+	listener net.Listener
+	server   *http.Server
+	wg       sync.WaitGroup
+}
+
+func DefaultControlSocketPath(dataStorePath string) string {
+	return path.Join(dataStorePath, "control.sock")
+}
+
+func NewControlServer(d *Daemon) *ControlServer {
+	s := ControlServer{
+		daemon: d,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.hStatus)
+	mux.HandleFunc("GET /health", s.hHealth)
+	mux.HandleFunc("GET /certificates", s.hStatus)
+	mux.HandleFunc("GET /certificates/{name}", s.hCertificate)
+	mux.HandleFunc("GET /certificates/{name}/order-log", s.hOrderLog)
+	mux.HandleFunc("POST /certificates/{name}/renew", s.hRenew)
+	mux.HandleFunc("POST /certificates/{name}/pause", s.hPause)
+	mux.HandleFunc("POST /certificates/{name}/resume", s.hResume)
+	mux.HandleFunc("POST /certificates/{name}/revoke", s.hRevoke)
+
+	s.handler = mux
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          d.Log.StdLogger(log.LevelError),
+	}
+
+	return &s
+}
+
+func (s *ControlServer) Start(socketPath string) error {
+	// A socket file left by a daemon which was not stopped properly would
+	// prevent us from listening.
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot delete %q: %w", socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %q: %w", socketPath, err)
+	}
+
+	// Anyone able to connect to the socket can control the daemon
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("cannot change permissions of %q: %w",
+			socketPath, err)
+	}
+
+	s.daemon.Log.Info("listening for control requests on %q", socketPath)
+
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return nil
+}
+
+func (s *ControlServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.server.Shutdown(ctx)
+
+	s.wg.Wait()
+}
+
+func (s *ControlServer) serve() {
+	defer s.wg.Done()
+
+	err := s.server.Serve(s.listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.daemon.Log.Error("cannot serve control requests: %v", err)
+	}
+}
+
+func (s *ControlServer) hStatus(w http.ResponseWriter, req *http.Request) {
+	s.reply(w, http.StatusOK, s.daemon.CertificateStatuses())
+}
+
+func (s *ControlServer) hHealth(w http.ResponseWriter, req *http.Request) {
+	if err := s.daemon.Health(req.Context()); err != nil {
+		s.replyError(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, struct{}{})
+}
+
+func (s *ControlServer) hCertificate(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	s.reply(w, http.StatusOK, cert.Status())
+}
+
+func (s *ControlServer) hOrderLog(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	entries, err := s.daemon.client.OrderLog(cert.Cfg().Name)
+	if err != nil {
+		s.replyError(w, http.StatusInternalServerError,
+			"cannot load order log: %v", err)
+		return
+	}
+
+	if entries == nil {
+		entries = []*acme.OrderLogEntry{}
+	}
+
+	s.reply(w, http.StatusOK, entries)
+}
+
+func (s *ControlServer) hRenew(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	if err := cert.RenewNow(); err != nil {
+		s.replyError(w, http.StatusConflict, "%v", err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, cert.Status())
+}
+
+func (s *ControlServer) hPause(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	cert.Pause()
+
+	s.reply(w, http.StatusOK, cert.Status())
+}
+
+func (s *ControlServer) hResume(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	cert.Resume()
+
+	s.reply(w, http.StatusOK, cert.Status())
+}
+
+func (s *ControlServer) hRevoke(w http.ResponseWriter, req *http.Request) {
+	cert := s.certificate(w, req)
+	if cert == nil {
+		return
+	}
+
+	var revocationReq ControlRevocationRequest
+	if req.ContentLength != 0 {
+		body := http.MaxBytesReader(w, req.Body, 1024)
+
+		if err := json.NewDecoder(body).Decode(&revocationReq); err != nil {
+			s.replyError(w, http.StatusBadRequest,
+				"cannot decode request body: %v", err)
+			return
+		}
+	}
+
+	reason := acme.RevocationReasonUnspecified
+	if revocationReq.Reason != "" {
+		if err := reason.Parse(revocationReq.Reason); err != nil {
+			s.replyError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), time.Minute)
+	defer cancel()
+
+	if err := cert.Revoke(ctx, reason); err != nil {
+		s.replyError(w, http.StatusConflict, "%v", err)
+		return
+	}
+
+	s.reply(w, http.StatusOK, cert.Status())
+}
+
+func (s *ControlServer) certificate(w http.ResponseWriter, req *http.Request) *DaemonCertificate {
+	name := req.PathValue("name")
+
+	cert := s.daemon.Certificate(name)
+	if cert == nil {
+		s.replyError(w, http.StatusNotFound, "unknown certificate %q", name)
+		return nil
+	}
+
+	return cert
+}
+
+func (s *ControlServer) reply(w http.ResponseWriter, status int, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.daemon.Log.Error("cannot encode response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *ControlServer) replyError(w http.ResponseWriter, status int, format string, args ...any) {
+	s.reply(w, status, &ControlError{Message: fmt.Sprintf(format, args...)})
+}
+
+type ControlClient struct {
+	httpClient *http.Client
+}
+
+func NewControlClient(socketPath string) *ControlClient {
+	transport := http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	c := ControlClient{
+		httpClient: &http.Client{
+			Transport: &transport,
+			Timeout:   30 * time.Second,
+		},
+	}
+
+	return &c
+}
+
+func (c *ControlClient) Status() ([]*CertificateStatus, error) {
+	var statuses []*CertificateStatus
+	if err := c.sendRequest("GET", "/status", &statuses); err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+func (c *ControlClient) Health() error {
+	var result struct{}
+	return c.sendRequest("GET", "/health", &result)
+}
+
+func (c *ControlClient) CertificateAction(name, action string) (*CertificateStatus, error) {
+	uriPath := "/certificates/" + url.PathEscape(name) + "/" + action
+
+	var status CertificateStatus
+	if err := c.sendRequest("POST", uriPath, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (c *ControlClient) sendRequest(method, uriPath string, dest any) error {
+	// The host is ignored since we always connect to the socket
+	req, err := http.NewRequest(method, "http://daemon"+uriPath, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var controlErr ControlError
+		if err := json.Unmarshal(data, &controlErr); err != nil ||
+			controlErr.Message == "" {
+			return fmt.Errorf("request failed with status %d", res.StatusCode)
+		}
+
+		return errors.New(controlErr.Message)
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("cannot decode response body: %w", err)
+	}
+
+	return nil
+}
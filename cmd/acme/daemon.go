@@ -0,0 +1,1020 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+)
+
+type Daemon struct {
+	Cfg *DaemonCfg
+	Log *log.Logger
+
+	client *acme.Client
+
+	certificates      map[string]*DaemonCertificate
+	certificatesMutex sync.Mutex
+
+	deployGroups      map[string]*deployGroup
+	deployGroupsMutex sync.Mutex
+
+	controlServer *ControlServer
+	metricsServer *MetricsServer
+	adminServer   *AdminServer
+
+	notifiers []Notifier
+
+	ready atomic.Bool // READY=1 sent to systemd
+
+	// The result of the last health check, see CachedHealth
+	healthErr       error
+	healthCheckTime time.Time
+	healthMutex     sync.Mutex
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type DaemonCertificate struct {
+	Log *log.Logger
+
+	cfg    atomic.Pointer[DaemonCertificateCfg]
+	daemon *Daemon
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Signaled when the certificate is paused, resumed or when a renewal is
+	// requested while the certificate worker is not running.
+	wakeUpChan chan struct{}
+
+	paused             bool
+	runCancel          context.CancelFunc
+	lastError          error
+	lastErrorTime      time.Time
+	lastDeployTime     time.Time
+	nextAttemptTime    time.Time
+	nbFailures         int    // consecutive
+	expirationNotified string // serial number of the last notified certificate
+	stateMutex         sync.Mutex
+
+	// Closed once the first certificate has been obtained and deployed (or
+	// its deployment failed).
+	available     chan struct{}
+	availableOnce sync.Once
+
+	// The time at which the processing of the current event started, or 0
+	// while waiting for events.
+	eventStartTime atomic.Int64 // Unix time in nanoseconds
+}
+
+// The maximal time spent processing a certificate event, i.e. deploying the
+// certificate and running hooks, before the certificate is considered stuck.
+const maxEventProcessingDuration = 10 * time.Minute
+
+// The maximal age of the result returned by CachedHealth.
+const healthCacheDuration = time.Minute
+
+func NewDaemon(cfg *DaemonCfg, logger *log.Logger) *Daemon {
+	d := Daemon{
+		Cfg: cfg,
+		Log: logger,
+
+		certificates: make(map[string]*DaemonCertificate),
+
+		deployGroups: make(map[string]*deployGroup),
+
+		stopChan: make(chan struct{}),
+	}
+
+	return &d
+}
+
+func (d *Daemon) Start() error {
+	d.Log.Info("using file system data store at %q", d.Cfg.DataStore)
+
+	dataStore, err := acme.NewFileSystemDataStore(d.Cfg.DataStore)
+	if err != nil {
+		return fmt.Errorf("cannot create data store: %w", err)
+	}
+
+	clientCfg := acme.ClientCfg{
+		Log:          d.Log,
+		DataStore:    dataStore,
+		DirectoryURI: d.Cfg.Server,
+		ContactURIs:  d.Cfg.ContactURIs,
+
+		AllowedResourceHosts: d.Cfg.AllowedResourceHosts,
+
+		GenerateAccountPrivateKey: acme.PrivateKeyGenerationFunc(
+			d.Cfg.AccountKeyType),
+		GenerateCertificatePrivateKey: acme.PrivateKeyGenerationFunc(
+			d.Cfg.CertificateKeyType),
+		CertificateRenewalTime: d.certificateRenewalTime,
+		PreferredChain:         d.Cfg.PreferredChain,
+		OmitValidityPeriod:     d.Cfg.OmitValidityPeriod,
+		OrderURIFromBody:       d.Cfg.OrderURIFromBody,
+		ServerPreset:           d.Cfg.ServerPreset,
+		AccountRecreation:      d.Cfg.AccountRecreation,
+
+		AdaptAccountKeyAlgorithm: d.Cfg.AdaptAccountKeyAlgorithm,
+
+		StartupWindow: time.Duration(d.Cfg.StartupWindow) * time.Second,
+
+		RenewalPolicy: acme.RenewalPolicy{
+			RetryInitialOrder: true,
+		},
+	}
+
+	if eabCfg := d.Cfg.ExternalAccountBinding; eabCfg != nil {
+		clientCfg.ExternalAccountBinding = &acme.ExternalAccountBindingCfg{
+			KeyId:   eabCfg.KeyId,
+			HMACKey: eabCfg.HMACKey,
+		}
+	}
+
+	var httpClientCfg acme.HTTPClientCfg
+
+	if hCfg := d.Cfg.HTTPClient; hCfg != nil {
+		httpClientCfg = acme.HTTPClientCfg{
+			EnableHTTP2:         hCfg.EnableHTTP2,
+			MaxIdleConns:        hCfg.MaxIdleConns,
+			MaxIdleConnsPerHost: hCfg.MaxIdleConnsPerHost,
+			TLSSessionCacheSize: hCfg.TLSSessionCacheSize,
+
+			PinnedPublicKeys:   hCfg.PinnedPublicKeys,
+			PinnedCertificates: hCfg.PinnedCertificates,
+		}
+
+		// Checked with the configuration
+		httpClientCfg.MinTLSVersion, _ = hCfg.TLSVersion()
+
+		clientCfg.ApplicationUserAgent = hCfg.ApplicationUserAgent
+
+		if len(hCfg.RequestHeader) > 0 {
+			clientCfg.RequestHeader = make(http.Header)
+			for name, value := range hCfg.RequestHeader {
+				clientCfg.RequestHeader.Set(name, value)
+			}
+		}
+	}
+
+	if d.Cfg.Pebble {
+		httpClientCfg.CACertPool = acme.PebbleCACertificatePool()
+	} else if d.Cfg.CACertificate != "" {
+		pool, err := acme.LoadCACertificatePool(d.Cfg.CACertificate)
+		if err != nil {
+			return fmt.Errorf("cannot load CA certificate: %w", err)
+		}
+
+		httpClientCfg.CACertPool = pool
+	}
+
+	clientCfg.HTTPClientCfg = &httpClientCfg
+
+	if sCfg := d.Cfg.HTTPChallengeSolver; sCfg != nil {
+		solverCfg := acme.HTTPChallengeSolverCfg{
+			Address:        sCfg.Address,
+			UpstreamURI:    sCfg.UpstreamURI,
+			PublicAddress:  sCfg.PublicAddress,
+			AllowedHosts:   sCfg.AllowedHosts,
+			ListenOnDemand: sCfg.ListenOnDemand,
+		}
+
+		if command := sCfg.AcquirePortCommand; command != "" {
+			solverCfg.AcquirePort = func() error {
+				return d.runPortCommand(command)
+			}
+		}
+
+		if command := sCfg.ReleasePortCommand; command != "" {
+			solverCfg.ReleasePort = func() {
+				if err := d.runPortCommand(command); err != nil {
+					d.Log.Error("%v", err)
+				}
+			}
+		}
+
+		clientCfg.HTTPChallengeSolver = &solverCfg
+	}
+
+	client, err := acme.NewClient(clientCfg)
+	if err != nil {
+		return fmt.Errorf("cannot create client: %w", err)
+	}
+
+	if err := client.Start(context.Background()); err != nil {
+		return fmt.Errorf("cannot start client: %w", err)
+	}
+
+	d.client = client
+
+	// An unreachable challenge solver is not fatal: it may depend on network
+	// configuration not available yet. But orders would fail, so better know
+	// it right now.
+	if err := d.Health(context.Background()); err != nil {
+		d.Log.Error("%v", err)
+	}
+
+	if nCfg := d.Cfg.Notifications; nCfg != nil {
+		d.notifiers = NewNotifiers(nCfg, http.DefaultClient)
+
+		d.wg.Add(1)
+		go d.watchExpiration()
+	}
+
+	initialCerts := make([]*DaemonCertificate, len(d.Cfg.Certificates))
+	for i, certCfg := range d.Cfg.Certificates {
+		initialCerts[i] = d.startCertificate(certCfg)
+	}
+
+	d.controlServer = NewControlServer(d)
+	if err := d.controlServer.Start(d.Cfg.ControlSocket); err != nil {
+		d.Stop()
+		return fmt.Errorf("cannot start control server: %w", err)
+	}
+
+	if d.Cfg.MetricsAddress != "" {
+		d.metricsServer = NewMetricsServer(d)
+		if err := d.metricsServer.Start(d.Cfg.MetricsAddress); err != nil {
+			d.metricsServer = nil
+			d.Stop()
+			return fmt.Errorf("cannot start metrics server: %w", err)
+		}
+	}
+
+	if d.Cfg.AdminAPI != nil {
+		d.adminServer = NewAdminServer(d, d.Cfg.AdminAPI)
+		if err := d.adminServer.Start(); err != nil {
+			d.adminServer = nil
+			d.Stop()
+			return fmt.Errorf("cannot start admin server: %w", err)
+		}
+	}
+
+	d.wg.Add(1)
+	go d.notifyReady(initialCerts)
+
+	watchdogInterval, err := sdWatchdogInterval()
+	if err != nil {
+		d.Log.Error("cannot read systemd watchdog settings: %v", err)
+	} else if watchdogInterval > 0 {
+		d.wg.Add(1)
+		go d.watchdog(watchdogInterval)
+	}
+
+	return nil
+}
+
+func (d *Daemon) Stop() {
+	if err := sdNotify("STOPPING=1"); err != nil {
+		d.Log.Error("cannot notify systemd: %v", err)
+	}
+
+	if d.adminServer != nil {
+		d.adminServer.Stop()
+	}
+
+	if d.metricsServer != nil {
+		d.metricsServer.Stop()
+	}
+
+	if d.controlServer != nil {
+		d.controlServer.Stop()
+	}
+
+	d.stopDeployGroups()
+
+	close(d.stopChan)
+
+	d.certificatesMutex.Lock()
+	for _, cert := range d.certificates {
+		cert.cancel()
+	}
+	d.certificatesMutex.Unlock()
+
+	d.client.Stop()
+
+	d.wg.Wait()
+}
+
+func (d *Daemon) runPortCommand(command string) error {
+	d.Log.Debug(1, "running port command %q", command)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command %q failed: %w\n%s", command, err, output)
+	}
+
+	return nil
+}
+
+func (d *Daemon) certificateRenewalTime(certData *acme.CertificateData) time.Time {
+	d.certificatesMutex.Lock()
+	cert := d.certificates[certData.Name]
+	d.certificatesMutex.Unlock()
+
+	if cert != nil {
+		if renewBefore := cert.Cfg().RenewBefore; renewBefore > 0 {
+			notAfter := certData.LeafCertificate().NotAfter
+			return notAfter.AddDate(0, 0, -renewBefore)
+		}
+	}
+
+	return acme.CertificateRenewalTime(certData)
+}
+
+// notifyReady tells systemd that the daemon is ready once all certificates
+// present at startup are available, so that units depending on them can be
+// ordered after the daemon.
+func (d *Daemon) notifyReady(certs []*DaemonCertificate) {
+	defer d.wg.Done()
+
+	for _, cert := range certs {
+		select {
+		case <-cert.available:
+		case <-d.stopChan:
+			return
+		}
+	}
+
+	d.Log.Info("all certificates available")
+
+	d.ready.Store(true)
+
+	if err := sdNotify("READY=1"); err != nil {
+		d.Log.Error("cannot notify systemd: %v", err)
+	}
+}
+
+// watchdog notifies systemd at regular intervals as long as the daemon is
+// healthy. If a certificate worker or the processing of its events is stuck,
+// notifications stop and systemd restarts the daemon.
+func (d *Daemon) watchdog(interval time.Duration) {
+	defer d.wg.Done()
+
+	d.Log.Debug(1, "notifying the systemd watchdog every %v", interval/2)
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		if err := d.checkHealth(); err != nil {
+			d.Log.Error("not notifying the systemd watchdog: %v", err)
+			continue
+		}
+
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			d.Log.Error("cannot notify systemd: %v", err)
+		}
+	}
+}
+
+// Health checks that the daemon is able to obtain certificates.
+func (d *Daemon) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return d.client.CheckChallengeSolvers(ctx)
+}
+
+// CachedHealth returns the result of the last health check run less than
+// healthCacheDuration ago, or runs a new one. It is used by endpoints which
+// are not authenticated so that their clients cannot make the daemon probe
+// challenge solvers on each request.
+func (d *Daemon) CachedHealth() error {
+	if err := d.checkHealth(); err != nil {
+		return err
+	}
+
+	// Concurrent callers wait for the same check
+	d.healthMutex.Lock()
+	defer d.healthMutex.Unlock()
+
+	if time.Since(d.healthCheckTime) > healthCacheDuration {
+		d.healthErr = d.Health(context.Background())
+		d.healthCheckTime = time.Now()
+	}
+
+	return d.healthErr
+}
+
+func (d *Daemon) checkHealth() error {
+	if names := d.client.StalledCertificateWorkers(); len(names) > 0 {
+		return fmt.Errorf("stalled certificate workers: %s",
+			strings.Join(names, ", "))
+	}
+
+	now := time.Now()
+
+	d.certificatesMutex.Lock()
+	defer d.certificatesMutex.Unlock()
+
+	for name, cert := range d.certificates {
+		if cert.stalled(now) {
+			return fmt.Errorf("certificate %q stalled while processing an "+
+				"event", name)
+		}
+	}
+
+	return nil
+}
+
+func (d *Daemon) startCertificate(cfg *DaemonCertificateCfg) *DaemonCertificate {
+	logger := d.Log.Child("certificate", log.Data{"certificate": cfg.Name})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cert := DaemonCertificate{
+		Log: logger,
+
+		daemon: d,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		wakeUpChan: make(chan struct{}, 1),
+
+		available: make(chan struct{}),
+	}
+
+	cert.cfg.Store(cfg)
+
+	d.certificatesMutex.Lock()
+	d.certificates[cfg.Name] = &cert
+	d.certificatesMutex.Unlock()
+
+	d.wg.Add(1)
+	go cert.main()
+
+	return &cert
+}
+
+// Reload applies a new configuration. Settings used to create the client
+// cannot be changed without restarting the daemon; certificates are added,
+// removed or updated as needed.
+func (d *Daemon) Reload(cfg *DaemonCfg) {
+	d.Log.Info("reloading configuration")
+
+	// If we are still waiting for initial certificates, systemd will be
+	// notified when they are available.
+	if d.ready.Load() {
+		if err := sdNotify("RELOADING=1"); err != nil {
+			d.Log.Error("cannot notify systemd: %v", err)
+		}
+
+		defer func() {
+			if err := sdNotify("READY=1"); err != nil {
+				d.Log.Error("cannot notify systemd: %v", err)
+			}
+		}()
+	}
+
+	// Contact URIs, the preferred chain and deploy groups can be changed on
+	// the fly; other client settings require a restart.
+	cfg2 := *cfg
+	cfg2.Certificates = d.Cfg.Certificates
+	cfg2.ContactURIs = d.Cfg.ContactURIs
+	cfg2.PreferredChain = d.Cfg.PreferredChain
+	cfg2.DeployGroups = d.Cfg.DeployGroups
+	if !reflect.DeepEqual(&cfg2, d.Cfg) {
+		d.Log.Error("client settings have changed, restart the daemon to " +
+			"apply them")
+	}
+
+	if !slices.Equal(cfg.ContactURIs, d.Cfg.ContactURIs) ||
+		cfg.PreferredChain != d.Cfg.PreferredChain {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			30*time.Second)
+		defer cancel()
+
+		err := d.client.UpdateConfig(ctx, func(clientCfg *acme.ClientCfg) {
+			clientCfg.ContactURIs = cfg.ContactURIs
+			clientCfg.PreferredChain = cfg.PreferredChain
+		})
+		if err == nil {
+			d.Cfg.ContactURIs = cfg.ContactURIs
+			d.Cfg.PreferredChain = cfg.PreferredChain
+		} else {
+			d.Log.Error("cannot update client configuration: %v", err)
+		}
+	}
+
+	certCfgs := make(map[string]*DaemonCertificateCfg)
+	for _, certCfg := range cfg.Certificates {
+		certCfgs[certCfg.Name] = certCfg
+	}
+
+	d.certificatesMutex.Lock()
+	certs := make(map[string]*DaemonCertificate)
+	for name, cert := range d.certificates {
+		certs[name] = cert
+	}
+	d.certificatesMutex.Unlock()
+
+	for name, cert := range certs {
+		certCfg := certCfgs[name]
+
+		switch {
+		case certCfg == nil:
+			d.Log.Info("removing certificate %q", name)
+			d.stopCertificate(cert)
+
+		case !sameCertificateRequest(certCfg, cert.Cfg()):
+			// The worker cannot be updated: we have to stop it and start a
+			// new one. A new certificate is ordered immediately if the
+			// identifiers or the validity have changed; other settings
+			// apply to the next renewal.
+			d.Log.Info("updating certificate %q", name)
+			d.stopCertificate(cert)
+			d.startCertificate(certCfg)
+
+		default:
+			cert.cfg.Store(certCfg)
+		}
+	}
+
+	for name, certCfg := range certCfgs {
+		if _, found := certs[name]; !found {
+			d.Log.Info("adding certificate %q", name)
+			d.startCertificate(certCfg)
+		}
+	}
+
+	d.setDeployGroupCfgs(cfg.DeployGroups)
+	d.Cfg.Certificates = cfg.Certificates
+}
+
+func sameCertificateRequest(cfg1, cfg2 *DaemonCertificateCfg) bool {
+	r1 := cfg1.CertificateRequest()
+	r2 := cfg2.CertificateRequest()
+
+	// Labels do not change the certificate, but the worker has to be
+	// restarted to update them; the current certificate is reused.
+	return slices.Equal(cfg1.Identifiers, cfg2.Identifiers) && r1.Equal(&r2) &&
+		maps.Equal(cfg1.Labels, cfg2.Labels)
+}
+
+func (d *Daemon) stopCertificate(cert *DaemonCertificate) {
+	cert.cancel()
+	<-cert.done
+
+	d.certificatesMutex.Lock()
+	if d.certificates[cert.Cfg().Name] == cert {
+		delete(d.certificates, cert.Cfg().Name)
+	}
+	d.certificatesMutex.Unlock()
+}
+
+func (d *Daemon) Certificate(name string) *DaemonCertificate {
+	d.certificatesMutex.Lock()
+	defer d.certificatesMutex.Unlock()
+
+	return d.certificates[name]
+}
+
+func (d *Daemon) CertificateStatuses() []*CertificateStatus {
+	d.certificatesMutex.Lock()
+	certs := make([]*DaemonCertificate, 0, len(d.certificates))
+	for _, cert := range d.certificates {
+		certs = append(certs, cert)
+	}
+	d.certificatesMutex.Unlock()
+
+	statuses := make([]*CertificateStatus, len(certs))
+	for i, cert := range certs {
+		statuses[i] = cert.Status()
+	}
+
+	slices.SortFunc(statuses, func(s1, s2 *CertificateStatus) int {
+		return strings.Compare(s1.Name, s2.Name)
+	})
+
+	return statuses
+}
+
+func (cert *DaemonCertificate) Cfg() *DaemonCertificateCfg {
+	return cert.cfg.Load()
+}
+
+func (cert *DaemonCertificate) Status() *CertificateStatus {
+	cfg := cert.Cfg()
+
+	status := CertificateStatus{
+		Name:        cfg.Name,
+		Identifiers: cfg.Identifiers,
+		Labels:      cfg.Labels,
+	}
+
+	if certData := cert.daemon.client.Certificate(cfg.Name); certData != nil {
+		leafCert := certData.LeafCertificate()
+
+		status.Fingerprint = certData.
+			FormatLeafCertificateFingerprint(acme.FingerprintFormat{})
+		status.NotBefore = leafCert.NotBefore
+		status.NotAfter = leafCert.NotAfter
+		status.RenewalTime = cert.daemon.certificateRenewalTime(certData)
+	}
+
+	if orderState, err := cert.daemon.client.CertificateOrderState(cfg.Name); err == nil {
+		status.OrderExpires = orderState.Expires
+		status.ExpiredOrders = orderState.ExpiredOrders
+	}
+
+	cert.stateMutex.Lock()
+	status.Paused = cert.paused
+	if cert.lastError != nil {
+		status.LastError = cert.lastError.Error()
+		status.LastErrorTime = cert.lastErrorTime
+		status.LastProblem = acme.ProblemDetailsFromError(cert.lastError)
+	}
+	status.LastDeployTime = cert.lastDeployTime
+	status.NextAttemptTime = cert.nextAttemptTime
+	cert.stateMutex.Unlock()
+
+	return &status
+}
+
+func (cert *DaemonCertificate) Pause() {
+	cert.stateMutex.Lock()
+	defer cert.stateMutex.Unlock()
+
+	if cert.paused {
+		return
+	}
+
+	cert.Log.Info("pausing certificate")
+
+	cert.paused = true
+	cert.nextAttemptTime = time.Time{}
+	if cert.runCancel != nil {
+		cert.runCancel()
+	}
+
+	cert.wakeUp()
+}
+
+func (cert *DaemonCertificate) Resume() {
+	cert.stateMutex.Lock()
+	defer cert.stateMutex.Unlock()
+
+	if !cert.paused {
+		return
+	}
+
+	cert.Log.Info("resuming certificate")
+
+	cert.paused = false
+	cert.wakeUp()
+}
+
+func (cert *DaemonCertificate) RenewNow() error {
+	cert.stateMutex.Lock()
+	defer cert.stateMutex.Unlock()
+
+	if cert.paused {
+		return fmt.Errorf("certificate is paused")
+	}
+
+	err := cert.daemon.client.RenewCertificateNow(cert.Cfg().Name)
+	if errors.Is(err, acme.ErrUnknownCertificate) {
+		// The worker is not running, we are waiting before restarting it
+		cert.wakeUp()
+		return nil
+	}
+
+	return err
+}
+
+// Revoke revokes the current certificate and, unless the certificate is
+// paused, immediately orders a new one since the revoked certificate must not
+// be served anymore.
+func (cert *DaemonCertificate) Revoke(ctx context.Context, reason acme.RevocationReason) error {
+	cfg := cert.Cfg()
+
+	// The private key may have been compromised, it must not be reused for
+	// the next certificate.
+	if cfg.ReuseKey {
+		return fmt.Errorf("cannot revoke a certificate whose private key " +
+			"is reused")
+	}
+
+	certData := cert.daemon.client.Certificate(cfg.Name)
+	if certData == nil {
+		return fmt.Errorf("no certificate available")
+	}
+
+	leafCert := certData.LeafCertificate()
+
+	if err := cert.daemon.client.RevokeCertificate(ctx, leafCert, reason); err != nil {
+		return fmt.Errorf("cannot revoke certificate: %w", err)
+	}
+
+	cert.Log.Info("certificate %s revoked (reason: %v)",
+		certData.FormatLeafCertificateFingerprint(acme.FingerprintFormat{}),
+		reason)
+
+	cert.stateMutex.Lock()
+	paused := cert.paused
+	cert.stateMutex.Unlock()
+
+	if paused {
+		return nil
+	}
+
+	if err := cert.RenewNow(); err != nil {
+		return fmt.Errorf("certificate revoked but cannot be renewed: %w", err)
+	}
+
+	return nil
+}
+
+func (cert *DaemonCertificate) wakeUp() {
+	select {
+	case cert.wakeUpChan <- struct{}{}:
+	default:
+	}
+}
+
+func (cert *DaemonCertificate) main() {
+	defer cert.daemon.wg.Done()
+	defer close(cert.done)
+
+	// Certificate workers keep retrying after failures, so they only stop when
+	// the certificate is paused or if the request itself failed. In the latter
+	// case we try again after a delay.
+	retryDelay := time.Minute
+
+	for {
+		cert.stateMutex.Lock()
+		paused := cert.paused
+		var ctx context.Context
+		if !paused {
+			ctx, cert.runCancel = context.WithCancel(cert.ctx)
+		}
+		cert.stateMutex.Unlock()
+
+		if paused {
+			select {
+			case <-cert.ctx.Done():
+				return
+			case <-cert.wakeUpChan:
+			}
+
+			continue
+		}
+
+		cert.run(ctx)
+
+		cert.stateMutex.Lock()
+		cert.runCancel()
+		cert.runCancel = nil
+		paused = cert.paused
+		cert.stateMutex.Unlock()
+
+		if paused {
+			continue
+		}
+
+		t := time.NewTimer(retryDelay)
+
+		select {
+		case <-cert.ctx.Done():
+			t.Stop()
+			return
+		case <-cert.wakeUpChan:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+func (cert *DaemonCertificate) run(ctx context.Context) {
+	client := cert.daemon.client
+
+	cfg := cert.Cfg()
+
+	eventChan, err := client.RequestCertificate(ctx, cfg.Name,
+		cfg.CertificateRequest())
+	if err != nil {
+		cert.Log.Error("cannot request certificate: %v", err)
+		cert.setLastError(err)
+		return
+	}
+
+	for ev := range eventChan {
+		cert.eventStartTime.Store(time.Now().UnixNano())
+		cert.processEvent(ev)
+		cert.eventStartTime.Store(0)
+	}
+}
+
+func (cert *DaemonCertificate) processEvent(ev *acme.CertificateEvent) {
+	if ev.Error != nil {
+		cert.Log.ErrorData(errorLogData(ev.Error),
+			"cannot obtain certificate: %v", ev.Error)
+		cert.setLastError(ev.Error)
+		cert.onFailure(ev.Error)
+
+		cert.stateMutex.Lock()
+		cert.nextAttemptTime = ev.NextAttemptTime
+		cert.stateMutex.Unlock()
+
+		return
+	}
+
+	cert.stateMutex.Lock()
+	cert.nbFailures = 0
+	cert.nextAttemptTime = time.Time{}
+	cert.stateMutex.Unlock()
+
+	err := cert.deploy(ev.CertificateData)
+
+	cert.availableOnce.Do(func() {
+		close(cert.available)
+	})
+
+	if err != nil {
+		cert.Log.Error("cannot deploy certificate: %v", err)
+		cert.setLastError(err)
+		return
+	}
+
+	cert.stateMutex.Lock()
+	cert.lastDeployTime = time.Now()
+	cert.stateMutex.Unlock()
+
+	cert.daemon.onCertificateDeployed(cert.Cfg())
+
+	if ev.Kind == acme.CertificateEventKindRenewed {
+		cert.daemon.propagateRenewal(cert.Cfg(), ev.CertificateData)
+	}
+}
+
+func (cert *DaemonCertificate) stalled(now time.Time) bool {
+	startTime := cert.eventStartTime.Load()
+	if startTime == 0 {
+		return false
+	}
+
+	return now.Sub(time.Unix(0, startTime)) > maxEventProcessingDuration
+}
+
+func (cert *DaemonCertificate) onFailure(err error) {
+	d := cert.daemon
+
+	nCfg := d.Cfg.Notifications
+	if nCfg == nil {
+		return
+	}
+
+	cert.stateMutex.Lock()
+	cert.nbFailures++
+	nbFailures := cert.nbFailures
+	cert.stateMutex.Unlock()
+
+	// Notify once when we reach the threshold, not for each failure after
+	if nbFailures != nCfg.FailureThreshold {
+		return
+	}
+
+	name := cert.Cfg().Name
+
+	d.notify(&Notification{
+		Type:        NotificationTypeRenewalFailure,
+		Certificate: name,
+		Message: fmt.Sprintf("certificate %q could not be obtained "+
+			"(%d consecutive failures): %v", name, nbFailures, err),
+		Problem: acme.ProblemDetailsFromError(err),
+	})
+}
+
+// errorLogData returns log data identifying ACME errors so that they can be
+// processed from JSON logs without parsing messages.
+func errorLogData(err error) log.Data {
+	code := acme.ErrorCode(err)
+	if code == "" {
+		return nil
+	}
+
+	return log.Data{"error_code": code}
+}
+
+func (cert *DaemonCertificate) setLastError(err error) {
+	cert.stateMutex.Lock()
+	cert.lastError = err
+	cert.lastErrorTime = time.Now()
+	cert.stateMutex.Unlock()
+}
+
+func (cert *DaemonCertificate) deploy(certData *acme.CertificateData) error {
+	cert.Log.Info("deploying certificate %s", certData.
+		FormatLeafCertificateFingerprint(acme.FingerprintFormat{}))
+
+	cfg := cert.Cfg()
+
+	certPath := cfg.CertificatePath
+	privateKeyPath := cfg.PrivateKeyPath
+
+	if certPath != "" {
+		chainData, err := certData.EncodePEMCertificateChain()
+		if err != nil {
+			return fmt.Errorf("cannot encode certificate chain: %w", err)
+		}
+
+		privateKeyData, err := certData.EncodePEMPrivateKey()
+		if err != nil {
+			return err
+		}
+
+		// Write the private key first: some servers watch the certificate
+		// file and reload both files when it changes.
+		if err := writeFileAtomically(privateKeyPath, privateKeyData, 0600); err != nil {
+			return err
+		}
+
+		if err := writeFileAtomically(certPath, []byte(chainData), 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, target := range cfg.DeployTargets {
+		sink, err := target.CertificateSink()
+		if err != nil {
+			return err
+		}
+
+		if err := sink.DeployCertificate(cert.ctx, certData); err != nil {
+			return err
+		}
+	}
+
+	env := append(os.Environ(),
+		"ACME_CERTIFICATE_NAME="+certData.Name,
+		"ACME_CERTIFICATE_PATH="+certPath,
+		"ACME_PRIVATE_KEY_PATH="+privateKeyPath)
+
+	for name, value := range cfg.Labels {
+		env = append(env, "ACME_CERTIFICATE_LABEL_"+strings.ToUpper(name)+
+			"="+value)
+	}
+
+	for _, hook := range cfg.DeployHooks {
+		cert.Log.Debug(1, "running deploy hook %q", hook)
+
+		cmd := exec.CommandContext(cert.ctx, "/bin/sh", "-c", hook)
+		cmd.Env = env
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("deploy hook %q failed: %w\n%s", hook, err,
+				output)
+		}
+	}
+
+	return nil
+}
+
+func writeFileAtomically(filePath string, data []byte, mode os.FileMode) error {
+	dirPath := path.Dir(filePath)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("cannot create directory %q: %w", dirPath, err)
+	}
+
+	tmpPath := filePath + ".tmp"
+
+	if err := os.WriteFile(tmpPath, data, mode); err != nil {
+		return fmt.Errorf("cannot write %q: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, filePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"go.n16f.net/acme"
+	"gopkg.in/yaml.v3"
+)
+
+type DaemonCfg struct {
+	Server      string   `yaml:"server"`
+	Pebble      bool     `yaml:"pebble"`
+	DataStore   string   `yaml:"data_store"`
+	ContactURIs []string `yaml:"contact_uris"`
+
+	// Hosts other than the host of the server on which the server can place
+	// resources (orders, certificates...).
+	AllowedResourceHosts []string `yaml:"allowed_resource_hosts"`
+
+	// For internal ACME servers: the preset adapting the client to the
+	// server (step-ca or vault) and the path of the root CA certificate of
+	// the server.
+	ServerPreset  acme.ServerPreset `yaml:"server_preset"`
+	CACertificate string            `yaml:"ca_certificate"`
+
+	ExternalAccountBinding *DaemonExternalAccountBindingCfg `yaml:"external_account_binding"`
+
+	ControlSocket  string `yaml:"control_socket"`
+	MetricsAddress string `yaml:"metrics_address"`
+
+	AdminAPI *DaemonAdminAPICfg `yaml:"admin_api"`
+
+	AccountKeyType     acme.KeyType `yaml:"account_key_type"`
+	CertificateKeyType acme.KeyType `yaml:"certificate_key_type"`
+	PreferredChain     string       `yaml:"preferred_chain"`
+
+	// Must be set for servers which do not support custom validity periods,
+	// e.g. Let's Encrypt.
+	OmitValidityPeriod bool `yaml:"omit_validity_period"`
+
+	// For servers returning the URI of new orders in the response body
+	// instead of the Location header field.
+	OrderURIFromBody bool `yaml:"order_uri_from_body"`
+
+	// Either same_key or new_key; by default the daemon fails if the
+	// account does not exist anymore.
+	AccountRecreation acme.AccountRecreationMode `yaml:"account_recreation"`
+
+	// If set, the account key type is changed when the server does not
+	// support the signature algorithm of account_key_type.
+	AdaptAccountKeyAlgorithm bool `yaml:"adapt_account_key_algorithm"`
+
+	// The period during which the first orders of certificates are spread
+	// when the daemon starts.
+	StartupWindow int `yaml:"startup_window"` // seconds
+
+	HTTPClient          *DaemonHTTPClientCfg          `yaml:"http_client"`
+	HTTPChallengeSolver *DaemonHTTPChallengeSolverCfg `yaml:"http_challenge_solver"`
+
+	Notifications *DaemonNotificationsCfg `yaml:"notifications"`
+
+	DeployGroups []*DaemonDeployGroupCfg `yaml:"deploy_groups"`
+	Certificates []*DaemonCertificateCfg `yaml:"certificates"`
+}
+
+// Certificates of a deploy group are renewed together: when one of them is
+// renewed, the others are renewed right after. The deploy hooks of the group
+// then run once after their deployment, e.g. to restart a service using all
+// of them.
+type DaemonDeployGroupCfg struct {
+	Name        string   `yaml:"name"`
+	DeployHooks []string `yaml:"deploy_hooks"`
+
+	// The time to wait after the deployment of a certificate of the group
+	// for other certificates before running deploy hooks.
+	Delay int `yaml:"delay"` // seconds, default: 300
+}
+
+type DaemonAdminAPICfg struct {
+	Address string `yaml:"address"`
+
+	// Clients must send the token in the Authorization header field
+	// ("Bearer <token>"). The token file is read again when it changes.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+
+	// If set, the API is served over HTTPS.
+	CertificatePath string `yaml:"certificate_path"`
+	PrivateKeyPath  string `yaml:"private_key_path"`
+}
+
+type DaemonNotificationsCfg struct {
+	// The number of consecutive failures after which a renewal failure is
+	// notified.
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// The number of days before expiration below which a certificate is
+	// considered in danger.
+	ExpirationThreshold int `yaml:"expiration_threshold"`
+
+	Webhooks []*DaemonWebhookCfg `yaml:"webhooks"`
+	SMTP     *DaemonSMTPCfg      `yaml:"smtp"`
+}
+
+type WebhookType string
+
+const (
+	WebhookTypeGeneric WebhookType = "generic"
+	WebhookTypeSlack   WebhookType = "slack"
+)
+
+type DaemonWebhookCfg struct {
+	URI  string      `yaml:"uri"`
+	Type WebhookType `yaml:"type"`
+}
+
+type DaemonSMTPCfg struct {
+	Address  string   `yaml:"address"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+type DaemonExternalAccountBindingCfg struct {
+	KeyId   string `yaml:"key_id"`
+	HMACKey string `yaml:"hmac_key"`
+}
+
+type DaemonHTTPClientCfg struct {
+	EnableHTTP2         bool `yaml:"enable_http2"`
+	MaxIdleConns        int  `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int  `yaml:"max_idle_conns_per_host"`
+	TLSSessionCacheSize int  `yaml:"tls_session_cache_size"`
+
+	// Appended to the user agent of the client, e.g. "myapp/1.2".
+	ApplicationUserAgent string `yaml:"application_user_agent"`
+
+	// Header fields added to all requests sent to the ACME server.
+	RequestHeader map[string]string `yaml:"request_header"`
+
+	// Either "1.2" or "1.3".
+	MinTLSVersion string `yaml:"min_tls_version"`
+
+	// Base64-encoded SHA-256 digests of public keys or certificates, one of
+	// which must be part of the certificate chain of the server.
+	PinnedPublicKeys   []string `yaml:"pinned_public_keys"`
+	PinnedCertificates []string `yaml:"pinned_certificates"`
+}
+
+func (cfg *DaemonHTTPClientCfg) TLSVersion() (uint16, error) {
+	switch cfg.MinTLSVersion {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("invalid TLS version %q", cfg.MinTLSVersion)
+}
+
+type DaemonHTTPChallengeSolverCfg struct {
+	Address       string   `yaml:"address"`
+	UpstreamURI   string   `yaml:"upstream_uri"`
+	PublicAddress string   `yaml:"public_address"`
+	AllowedHosts  []string `yaml:"allowed_hosts"`
+
+	// If set, the solver only listens during challenges. The acquire
+	// command is executed before listening, e.g. to stop a web server using
+	// the same port, and the release command after the port is released.
+	ListenOnDemand     bool   `yaml:"listen_on_demand"`
+	AcquirePortCommand string `yaml:"acquire_port_command"`
+	ReleasePortCommand string `yaml:"release_port_command"`
+}
+
+type DaemonCertificateCfg struct {
+	Name        string   `yaml:"name"`
+	Identifiers []string `yaml:"identifiers"`
+	Validity    int      `yaml:"validity"`     // days
+	RenewBefore int      `yaml:"renew_before"` // days
+
+	// If set, overrides validity.
+	ValidityDuration int `yaml:"validity_duration"` // seconds
+
+	KeyType        acme.KeyType `yaml:"key_type"` // default: certificate_key_type
+	Profile        string       `yaml:"profile"`
+	PreferredChain string       `yaml:"preferred_chain"` // default: preferred_chain
+	ReuseKey       bool         `yaml:"reuse_key"`
+
+	CertificatePath string   `yaml:"certificate_path"`
+	PrivateKeyPath  string   `yaml:"private_key_path"`
+	DeployHooks     []string `yaml:"deploy_hooks"`
+
+	DeployTargets []DaemonDeployTargetCfg `yaml:"deploy_targets"`
+
+	DeployGroup string `yaml:"deploy_group"`
+
+	// Arbitrary metadata (team, service...) reported in the status and in
+	// metrics, and passed to deploy hooks.
+	Labels map[string]string `yaml:"labels"`
+
+	// The names of certificates which must be renewed before this one. The
+	// certificate is renewed after them when they are renewed.
+	RenewAfter []string `yaml:"renew_after"`
+}
+
+type DaemonDeployTargetCfg struct {
+	KubernetesSecret *DaemonKubernetesSecretCfg `yaml:"kubernetes_secret"`
+	DockerSecret     *DaemonDockerSecretCfg     `yaml:"docker_secret"`
+
+	WindowsCertificateStore *DaemonWindowsCertificateStoreCfg `yaml:"windows_certificate_store"`
+	SSH                     *DaemonSSHCfg                     `yaml:"ssh"`
+}
+
+type DaemonKubernetesSecretCfg struct {
+	// If not set, the in-cluster configuration is used.
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+}
+
+type DaemonDockerSecretCfg struct {
+	Endpoint          string   `yaml:"endpoint"` // default: local socket
+	CertificateSecret string   `yaml:"certificate_secret"`
+	PrivateKeySecret  string   `yaml:"private_key_secret"`
+	Services          []string `yaml:"services"`
+}
+
+type DaemonWindowsCertificateStoreCfg struct {
+	Store         string   `yaml:"store"` // default: MY
+	Bindings      []string `yaml:"bindings"`
+	ApplicationId string   `yaml:"application_id"` // default: IIS
+}
+
+type DaemonSSHCfg struct {
+	Command         string   `yaml:"command"` // default: ssh
+	Options         []string `yaml:"options"`
+	Hosts           []string `yaml:"hosts"`
+	CertificatePath string   `yaml:"certificate_path"`
+	PrivateKeyPath  string   `yaml:"private_key_path"`
+	ReloadCommand   string   `yaml:"reload_command"`
+}
+
+func LoadDaemonCfg(filePath string) (*DaemonCfg, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	var cfg DaemonCfg
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %w", filePath, err)
+	}
+
+	if err := cfg.Check(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *DaemonCfg) Check() error {
+	if cfg.Server == "" {
+		if cfg.Pebble {
+			cfg.Server = "pebble"
+		} else {
+			cfg.Server = "letsencrypt-staging"
+		}
+	}
+
+	if cfg.Server == "pebble" {
+		cfg.Pebble = true
+	}
+
+	server, err := CADirectoryURI(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	cfg.Server = server
+
+	if cfg.ServerPreset != "" {
+		if err := cfg.ServerPreset.Validate(); err != nil {
+			return fmt.Errorf("server_preset: %w", err)
+		}
+	}
+
+	for _, uri := range cfg.ContactURIs {
+		if err := acme.ValidateContactURI(uri); err != nil {
+			return fmt.Errorf("contact_uris: %w", err)
+		}
+	}
+
+	if cfg.Pebble && cfg.CACertificate != "" {
+		return fmt.Errorf("ca_certificate cannot be used with Pebble")
+	}
+
+	if cfg.DataStore == "" {
+		cfg.DataStore = "acme"
+	}
+
+	if cfg.ControlSocket == "" {
+		cfg.ControlSocket = DefaultControlSocketPath(cfg.DataStore)
+	}
+
+	if cfg.AccountKeyType == "" {
+		cfg.AccountKeyType = acme.KeyTypeECDSAP256
+	}
+	if err := cfg.AccountKeyType.Validate(); err != nil {
+		return fmt.Errorf("account_key_type: %w", err)
+	}
+
+	if err := cfg.AccountRecreation.Validate(); err != nil {
+		return fmt.Errorf("account_recreation: %w", err)
+	}
+
+	if cfg.CertificateKeyType == "" {
+		cfg.CertificateKeyType = acme.KeyTypeECDSAP256
+	}
+	if err := cfg.CertificateKeyType.Validate(); err != nil {
+		return fmt.Errorf("certificate_key_type: %w", err)
+	}
+
+	if cfg.StartupWindow < 0 {
+		return fmt.Errorf("startup_window: invalid negative value")
+	}
+
+	if sCfg := cfg.HTTPChallengeSolver; sCfg != nil && !sCfg.ListenOnDemand {
+		if sCfg.AcquirePortCommand != "" || sCfg.ReleasePortCommand != "" {
+			return fmt.Errorf("http_challenge_solver: port commands " +
+				"require listen_on_demand")
+		}
+	}
+
+	if hCfg := cfg.HTTPClient; hCfg != nil {
+		if hCfg.MaxIdleConns < 0 || hCfg.MaxIdleConnsPerHost < 0 ||
+			hCfg.TLSSessionCacheSize < 0 {
+			return fmt.Errorf("http_client: invalid negative value")
+		}
+
+		if _, err := hCfg.TLSVersion(); err != nil {
+			return fmt.Errorf("http_client: %w", err)
+		}
+	}
+
+	if eabCfg := cfg.ExternalAccountBinding; eabCfg != nil {
+		if eabCfg.KeyId == "" {
+			return fmt.Errorf("external_account_binding: missing or empty " +
+				"key_id")
+		}
+
+		if eabCfg.HMACKey == "" {
+			return fmt.Errorf("external_account_binding: missing or empty " +
+				"hmac_key")
+		}
+	}
+
+	if cfg.AdminAPI != nil {
+		if err := cfg.AdminAPI.Check(); err != nil {
+			return fmt.Errorf("admin_api: %w", err)
+		}
+	}
+
+	if cfg.Notifications != nil {
+		if err := cfg.Notifications.Check(); err != nil {
+			return fmt.Errorf("notifications: %w", err)
+		}
+	}
+
+	groupNames := make(map[string]struct{})
+
+	for i, groupCfg := range cfg.DeployGroups {
+		if err := groupCfg.Check(); err != nil {
+			return fmt.Errorf("deploy_groups[%d]: %w", i, err)
+		}
+
+		if _, found := groupNames[groupCfg.Name]; found {
+			return fmt.Errorf("deploy_groups[%d]: duplicate group %q",
+				i, groupCfg.Name)
+		}
+
+		groupNames[groupCfg.Name] = struct{}{}
+	}
+
+	names := make(map[string]struct{})
+
+	for i, certCfg := range cfg.Certificates {
+		if err := certCfg.Check(); err != nil {
+			return fmt.Errorf("certificates[%d]: %w", i, err)
+		}
+
+		if _, found := names[certCfg.Name]; found {
+			return fmt.Errorf("certificates[%d]: duplicate certificate %q",
+				i, certCfg.Name)
+		}
+
+		names[certCfg.Name] = struct{}{}
+
+		if group := certCfg.DeployGroup; group != "" {
+			if _, found := groupNames[group]; !found {
+				return fmt.Errorf("certificates[%d]: unknown deploy group %q",
+					i, group)
+			}
+		}
+	}
+
+	for i, certCfg := range cfg.Certificates {
+		for _, name := range certCfg.RenewAfter {
+			if _, found := names[name]; !found {
+				return fmt.Errorf("certificates[%d]: renew_after: unknown "+
+					"certificate %q", i, name)
+			}
+		}
+	}
+
+	if name := cfg.renewalDependencyCycle(); name != "" {
+		return fmt.Errorf("renew_after: circular dependency involving "+
+			"certificate %q", name)
+	}
+
+	return nil
+}
+
+// renewalDependencyCycle returns the name of a certificate part of a cycle
+// of renew_after dependencies, or an empty string if there is none.
+func (cfg *DaemonCfg) renewalDependencyCycle() string {
+	deps := make(map[string][]string)
+	for _, certCfg := range cfg.Certificates {
+		deps[certCfg.Name] = certCfg.RenewAfter
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	states := make(map[string]int)
+
+	var visit func(string) string
+	visit = func(name string) string {
+		switch states[name] {
+		case visiting:
+			return name
+		case visited:
+			return ""
+		}
+
+		states[name] = visiting
+		for _, dep := range deps[name] {
+			if cycleName := visit(dep); cycleName != "" {
+				return cycleName
+			}
+		}
+		states[name] = visited
+
+		return ""
+	}
+
+	for _, certCfg := range cfg.Certificates {
+		if cycleName := visit(certCfg.Name); cycleName != "" {
+			return cycleName
+		}
+	}
+
+	return ""
+}
+
+func (cfg *DaemonDeployGroupCfg) Check() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("missing or empty name")
+	}
+
+	if cfg.Delay == 0 {
+		cfg.Delay = 300
+	} else if cfg.Delay < 0 {
+		return fmt.Errorf("invalid delay %d", cfg.Delay)
+	}
+
+	return nil
+}
+
+func (cfg *DaemonAdminAPICfg) Check() error {
+	if cfg.Address == "" {
+		return fmt.Errorf("missing or empty address")
+	}
+
+	if (cfg.Token == "") == (cfg.TokenFile == "") {
+		return fmt.Errorf("exactly one of token and token_file must be set")
+	}
+
+	if (cfg.CertificatePath == "") != (cfg.PrivateKeyPath == "") {
+		return fmt.Errorf("certificate_path and private_key_path must be " +
+			"set together")
+	}
+
+	return nil
+}
+
+func (cfg *DaemonNotificationsCfg) Check() error {
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = 3
+	} else if cfg.FailureThreshold < 0 {
+		return fmt.Errorf("invalid failure_threshold value %d",
+			cfg.FailureThreshold)
+	}
+
+	if cfg.ExpirationThreshold == 0 {
+		cfg.ExpirationThreshold = 7
+	} else if cfg.ExpirationThreshold < 0 {
+		return fmt.Errorf("invalid expiration_threshold value %d",
+			cfg.ExpirationThreshold)
+	}
+
+	for i, webhookCfg := range cfg.Webhooks {
+		if webhookCfg.URI == "" {
+			return fmt.Errorf("webhooks[%d]: missing or empty uri", i)
+		}
+
+		switch webhookCfg.Type {
+		case "":
+			webhookCfg.Type = WebhookTypeGeneric
+		case WebhookTypeGeneric, WebhookTypeSlack:
+		default:
+			return fmt.Errorf("webhooks[%d]: invalid type %q", i,
+				webhookCfg.Type)
+		}
+	}
+
+	if smtpCfg := cfg.SMTP; smtpCfg != nil {
+		if smtpCfg.Address == "" {
+			return fmt.Errorf("smtp: missing or empty address")
+		}
+
+		if smtpCfg.From == "" {
+			return fmt.Errorf("smtp: missing or empty from")
+		}
+
+		if len(smtpCfg.To) == 0 {
+			return fmt.Errorf("smtp: missing or empty to")
+		}
+	}
+
+	return nil
+}
+
+func (cfg *DaemonCertificateCfg) Check() error {
+	if cfg.Name == "" {
+		return fmt.Errorf("missing or empty name")
+	}
+
+	if len(cfg.Identifiers) == 0 {
+		return fmt.Errorf("missing or empty identifiers")
+	}
+
+	if cfg.Validity == 0 {
+		cfg.Validity = 30
+	} else if cfg.Validity < 0 {
+		return fmt.Errorf("invalid validity %d", cfg.Validity)
+	}
+
+	if cfg.ValidityDuration < 0 {
+		return fmt.Errorf("invalid validity_duration %d", cfg.ValidityDuration)
+	}
+
+	if cfg.RenewBefore < 0 {
+		return fmt.Errorf("invalid renew_before value %d", cfg.RenewBefore)
+	}
+
+	if cfg.KeyType != "" {
+		if err := cfg.KeyType.Validate(); err != nil {
+			return fmt.Errorf("invalid key_type: %w", err)
+		}
+	}
+
+	if (cfg.CertificatePath == "") != (cfg.PrivateKeyPath == "") {
+		return fmt.Errorf("certificate_path and private_key_path must be " +
+			"set together")
+	}
+
+	for i, target := range cfg.DeployTargets {
+		if err := target.Check(); err != nil {
+			return fmt.Errorf("invalid deploy target %d: %w", i+1, err)
+		}
+	}
+
+	request := cfg.CertificateRequest()
+	if err := request.Check(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	return nil
+}
+
+func (cfg *DaemonDeployTargetCfg) Check() error {
+	nbTypes := 0
+	if cfg.KubernetesSecret != nil {
+		nbTypes++
+	}
+	if cfg.DockerSecret != nil {
+		nbTypes++
+	}
+	if cfg.WindowsCertificateStore != nil {
+		nbTypes++
+	}
+	if cfg.SSH != nil {
+		nbTypes++
+	}
+
+	switch {
+	case nbTypes > 1:
+		return fmt.Errorf("multiple deploy target types")
+
+	case cfg.KubernetesSecret != nil:
+		if cfg.KubernetesSecret.Namespace == "" {
+			return fmt.Errorf("missing or empty kubernetes_secret namespace")
+		}
+
+		if cfg.KubernetesSecret.Name == "" {
+			return fmt.Errorf("missing or empty kubernetes_secret name")
+		}
+
+	case cfg.DockerSecret != nil:
+		if cfg.DockerSecret.CertificateSecret == "" {
+			return fmt.Errorf("missing or empty docker_secret " +
+				"certificate_secret")
+		}
+
+		if cfg.DockerSecret.PrivateKeySecret == "" {
+			return fmt.Errorf("missing or empty docker_secret " +
+				"private_key_secret")
+		}
+
+	case cfg.WindowsCertificateStore != nil:
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("windows_certificate_store is only supported " +
+				"on Windows")
+		}
+
+	case cfg.SSH != nil:
+		if len(cfg.SSH.Hosts) == 0 {
+			return fmt.Errorf("missing or empty ssh hosts")
+		}
+
+		if cfg.SSH.CertificatePath == "" || cfg.SSH.PrivateKeyPath == "" {
+			return fmt.Errorf("missing or empty ssh certificate_path or " +
+				"private_key_path")
+		}
+
+	default:
+		return fmt.Errorf("missing deploy target type")
+	}
+
+	return nil
+}
+
+func (cfg *DaemonDeployTargetCfg) CertificateSink() (acme.CertificateSink, error) {
+	if d := cfg.DockerSecret; d != nil {
+		sinkCfg := acme.DockerSecretSinkCfg{
+			Endpoint:          d.Endpoint,
+			CertificateSecret: d.CertificateSecret,
+			PrivateKeySecret:  d.PrivateKeySecret,
+			Services:          d.Services,
+		}
+
+		return acme.NewDockerSecretSink(sinkCfg)
+	}
+
+	if s := cfg.SSH; s != nil {
+		sinkCfg := acme.SSHSinkCfg{
+			Command:         s.Command,
+			Options:         s.Options,
+			Hosts:           s.Hosts,
+			CertificatePath: s.CertificatePath,
+			PrivateKeyPath:  s.PrivateKeyPath,
+			ReloadCommand:   s.ReloadCommand,
+		}
+
+		return acme.NewSSHSink(sinkCfg)
+	}
+
+	if w := cfg.WindowsCertificateStore; w != nil {
+		return windowsCertificateStoreSink(w)
+	}
+
+	k := cfg.KubernetesSecret
+
+	var kubernetesCfg *acme.KubernetesCfg
+	var err error
+
+	if k.Kubeconfig == "" {
+		kubernetesCfg, err = acme.InClusterKubernetesCfg()
+	} else {
+		kubernetesCfg, err = acme.LoadKubeconfig(k.Kubeconfig, k.Context)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load Kubernetes configuration: %w", err)
+	}
+
+	sinkCfg := acme.KubernetesSecretSinkCfg{
+		Kubernetes: *kubernetesCfg,
+		Namespace:  k.Namespace,
+		Name:       k.Name,
+	}
+
+	return acme.NewKubernetesSecretSink(sinkCfg)
+}
+
+func (cfg *DaemonCertificateCfg) AcmeIdentifiers() []acme.Identifier {
+	ids := make([]acme.Identifier, len(cfg.Identifiers))
+	for i, value := range cfg.Identifiers {
+		ids[i] = acme.DNSIdentifier(value)
+	}
+
+	return ids
+}
+
+func (cfg *DaemonCertificateCfg) CertificateRequest() acme.CertificateRequest {
+	return acme.CertificateRequest{
+		Identifiers:      cfg.AcmeIdentifiers(),
+		Validity:         cfg.Validity,
+		ValidityDuration: time.Duration(cfg.ValidityDuration) * time.Second,
+		KeyType:          cfg.KeyType,
+		Profile:          cfg.Profile,
+		PreferredChain:   cfg.PreferredChain,
+		ReuseKey:         cfg.ReuseKey,
+		Labels:           cfg.Labels,
+	}
+}
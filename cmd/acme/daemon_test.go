@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+)
+
+func TestWatchdog(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	socketPath := path.Join(t.TempDir(), "notify")
+
+	conn, err := net.ListenUnixgram("unixgram",
+		&net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(err)
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	notified := func(timeout time.Duration) bool {
+		buf := make([]byte, 64)
+
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return false
+		}
+
+		assert.Equal("WATCHDOG=1", string(buf[:n]))
+		return true
+	}
+
+	dataStore, err := acme.NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	client, err := acme.NewOfflineClient(dataStore)
+	require.NoError(err)
+	defer client.Stop()
+
+	d := NewDaemon(&DaemonCfg{}, log.DefaultLogger("test"))
+	d.client = client
+
+	var cert DaemonCertificate
+	cert.cfg.Store(&DaemonCertificateCfg{Name: "test"})
+	d.certificates["test"] = &cert
+
+	d.wg.Add(1)
+	go d.watchdog(20 * time.Millisecond)
+	defer d.wg.Wait()
+	defer close(d.stopChan)
+
+	assert.True(notified(time.Second))
+
+	// Block the processing of an event for longer than allowed
+	startTime := time.Now().Add(-maxEventProcessingDuration - time.Minute)
+	cert.eventStartTime.Store(startTime.UnixNano())
+
+	// A notification may already have been sent
+	notified(50 * time.Millisecond)
+
+	assert.False(notified(200 * time.Millisecond))
+
+	// Notifications resume once the event has been processed
+	cert.eventStartTime.Store(0)
+
+	assert.True(notified(time.Second))
+}
+
+func TestCachedHealth(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	dataStore, err := acme.NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	client, err := acme.NewOfflineClient(dataStore)
+	require.NoError(err)
+	defer client.Stop()
+
+	d := NewDaemon(&DaemonCfg{}, log.DefaultLogger("test"))
+	d.client = client
+
+	assert.NoError(d.CachedHealth())
+
+	// Recent results are returned without running a new check
+	d.healthErr = errors.New("unhealthy")
+	assert.EqualError(d.CachedHealth(), "unhealthy")
+
+	d.healthCheckTime = time.Now().Add(-healthCacheDuration - time.Second)
+	assert.NoError(d.CachedHealth())
+}
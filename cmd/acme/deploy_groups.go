@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.n16f.net/acme"
+)
+
+// Certificates whose validity period starts less than this margin before a
+// renewed certificate are not renewed with it.
+const renewalPropagationMargin = time.Hour
+
+type deployGroup struct {
+	certNames []string // deployed since deploy hooks were last executed
+	timer     *time.Timer
+}
+
+func allFunc[T any](values []T, fn func(T) bool) bool {
+	for _, value := range values {
+		if !fn(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// onCertificateDeployed schedules the execution of the deploy hooks of the
+// group of a certificate. Each deployment postpones execution so that hooks
+// run once after all certificates of the group have been renewed.
+func (d *Daemon) onCertificateDeployed(cfg *DaemonCertificateCfg) {
+	d.deployGroupsMutex.Lock()
+	defer d.deployGroupsMutex.Unlock()
+
+	if d.deployGroups == nil {
+		// The daemon is stopping
+		return
+	}
+
+	groupCfg := d.deployGroupCfg(cfg.DeployGroup)
+	if groupCfg == nil {
+		return
+	}
+
+	g := d.deployGroups[groupCfg.Name]
+	if g == nil {
+		g = &deployGroup{}
+		d.deployGroups[groupCfg.Name] = g
+	}
+
+	if !slices.Contains(g.certNames, cfg.Name) {
+		g.certNames = append(g.certNames, cfg.Name)
+	}
+
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+
+	delay := time.Duration(groupCfg.Delay) * time.Second
+
+	g.timer = time.AfterFunc(delay, func() {
+		d.runDeployGroupHooks(groupCfg.Name)
+	})
+}
+
+func (d *Daemon) runDeployGroupHooks(name string) {
+	d.deployGroupsMutex.Lock()
+	if d.deployGroups == nil {
+		d.deployGroupsMutex.Unlock()
+		return
+	}
+
+	g := d.deployGroups[name]
+	delete(d.deployGroups, name)
+
+	// The group may have been removed by a reload
+	groupCfg := d.deployGroupCfg(name)
+
+	d.wg.Add(1)
+	d.deployGroupsMutex.Unlock()
+
+	defer d.wg.Done()
+
+	if g == nil || groupCfg == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-d.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	env := append(os.Environ(),
+		"ACME_DEPLOY_GROUP="+name,
+		"ACME_CERTIFICATE_NAMES="+strings.Join(g.certNames, " "))
+
+	for _, hook := range groupCfg.DeployHooks {
+		d.Log.Debug(1, "running deploy hook %q of group %q", hook, name)
+
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+		cmd.Env = env
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			d.Log.Error("deploy hook %q of group %q failed: %v\n%s", hook,
+				name, err, output)
+			return
+		}
+	}
+}
+
+func (d *Daemon) stopDeployGroups() {
+	d.deployGroupsMutex.Lock()
+	defer d.deployGroupsMutex.Unlock()
+
+	for _, g := range d.deployGroups {
+		if g.timer != nil {
+			g.timer.Stop()
+		}
+	}
+
+	d.deployGroups = nil
+}
+
+// setDeployGroupCfgs is used on reload; group configurations are read by
+// certificate goroutines and timers.
+func (d *Daemon) setDeployGroupCfgs(groupCfgs []*DaemonDeployGroupCfg) {
+	d.deployGroupsMutex.Lock()
+	d.Cfg.DeployGroups = groupCfgs
+	d.deployGroupsMutex.Unlock()
+}
+
+// Must be called with d.deployGroupsMutex locked.
+func (d *Daemon) deployGroupCfg(name string) *DaemonDeployGroupCfg {
+	if name == "" {
+		return nil
+	}
+
+	for _, groupCfg := range d.Cfg.DeployGroups {
+		if groupCfg.Name == name {
+			return groupCfg
+		}
+	}
+
+	return nil
+}
+
+// propagateRenewal renews the certificates which must be renewed with a
+// certificate which has just been renewed, see renewalPropagationTargets.
+func (d *Daemon) propagateRenewal(cfg *DaemonCertificateCfg, certData *acme.CertificateData) {
+	certificateNotBefore := func(name string) (time.Time, bool) {
+		certData := d.client.Certificate(name)
+		if certData == nil {
+			return time.Time{}, false
+		}
+
+		return certData.LeafCertificate().NotBefore, true
+	}
+
+	names := renewalPropagationTargets(cfg,
+		certData.LeafCertificate().NotBefore, d.certificateCfgs(),
+		certificateNotBefore)
+
+	for _, name := range names {
+		cert := d.Certificate(name)
+		if cert == nil {
+			continue
+		}
+
+		cert.Log.Info("renewing certificate after %q", cfg.Name)
+
+		if err := cert.RenewNow(); err != nil {
+			cert.Log.Error("cannot renew certificate: %v", err)
+		}
+	}
+}
+
+// renewalPropagationTargets returns the names of the certificates to renew
+// after a certificate has been renewed: other certificates of its deploy
+// group and certificates listing it in renew_after. Certificates are renewed
+// in the order of their renew_after dependencies: a certificate is only
+// renewed once all its dependencies have been renewed, the renewal of the
+// last one propagating to it.
+//
+// Certificates obtained at about the same time as the renewed certificate
+// are considered up-to-date, so that renewals do not propagate back.
+//
+// The certificateNotBefore function returns the start of the validity period
+// of the current certificate of a configuration, or false if there is no
+// certificate yet.
+func renewalPropagationTargets(cfg *DaemonCertificateCfg, notBefore time.Time, cfgs []*DaemonCertificateCfg, certificateNotBefore func(string) (time.Time, bool)) []string {
+	minNotBefore := notBefore.Add(-renewalPropagationMargin)
+
+	upToDate := func(name string) bool {
+		notBefore2, found := certificateNotBefore(name)
+		return found && !notBefore2.Before(minNotBefore)
+	}
+
+	var names []string
+
+	for _, cfg2 := range cfgs {
+		if cfg2.Name == cfg.Name {
+			continue
+		}
+
+		sameGroup := cfg.DeployGroup != "" &&
+			cfg2.DeployGroup == cfg.DeployGroup
+
+		if !sameGroup && !slices.Contains(cfg2.RenewAfter, cfg.Name) {
+			continue
+		}
+
+		// Certificates without any certificate yet are being ordered
+		if _, found := certificateNotBefore(cfg2.Name); !found ||
+			upToDate(cfg2.Name) {
+			continue
+		}
+
+		if !allFunc(cfg2.RenewAfter, upToDate) {
+			continue
+		}
+
+		names = append(names, cfg2.Name)
+	}
+
+	return names
+}
+
+func (d *Daemon) certificateCfgs() []*DaemonCertificateCfg {
+	d.certificatesMutex.Lock()
+	defer d.certificatesMutex.Unlock()
+
+	cfgs := make([]*DaemonCertificateCfg, 0, len(d.certificates))
+	for _, cert := range d.certificates {
+		cfgs = append(cfgs, cert.Cfg())
+	}
+
+	return cfgs
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewalDependencyCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	cycle := func(deps map[string][]string) string {
+		var cfg DaemonCfg
+		for _, name := range []string{"a", "b", "c", "d"} {
+			cfg.Certificates = append(cfg.Certificates,
+				&DaemonCertificateCfg{Name: name, RenewAfter: deps[name]})
+		}
+
+		return cfg.renewalDependencyCycle()
+	}
+
+	assert.Equal("", cycle(nil))
+	assert.Equal("", cycle(map[string][]string{
+		"b": {"a"},
+		"c": {"a", "b"},
+		"d": {"c", "a"},
+	}))
+
+	assert.Equal("a", cycle(map[string][]string{"a": {"a"}}))
+	assert.NotEqual("", cycle(map[string][]string{
+		"a": {"d"},
+		"b": {"a"},
+		"c": {"b"},
+		"d": {"c"},
+	}))
+	assert.Equal("c", cycle(map[string][]string{
+		"b": {"a"},
+		"c": {"d"},
+		"d": {"c"},
+	}))
+}
+
+func TestRenewalPropagationTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+
+	cfgs := []*DaemonCertificateCfg{
+		{Name: "a", DeployGroup: "web"},
+		{Name: "b", DeployGroup: "web"},
+		{Name: "c", RenewAfter: []string{"a"}},
+		{Name: "d", RenewAfter: []string{"a", "e"}},
+		{Name: "e"},
+		{Name: "f", DeployGroup: "web"},
+		{Name: "g"},
+	}
+
+	targets := func(name string, notBefores map[string]time.Time) []string {
+		var cfg *DaemonCertificateCfg
+		for _, cfg2 := range cfgs {
+			if cfg2.Name == name {
+				cfg = cfg2
+			}
+		}
+
+		notBefore := func(name string) (time.Time, bool) {
+			t, found := notBefores[name]
+			return t, found
+		}
+
+		return renewalPropagationTargets(cfg, notBefores[name], cfgs,
+			notBefore)
+	}
+
+	// Group members and dependents are renewed; d waits for e, and f has no
+	// certificate yet.
+	assert.Equal([]string{"b", "c"}, targets("a", map[string]time.Time{
+		"a": now,
+		"b": old,
+		"c": old,
+		"d": old,
+		"e": old,
+		"g": old,
+	}))
+
+	// Once e is renewed, the renewal propagates to d
+	assert.Equal([]string{"d"}, targets("e", map[string]time.Time{
+		"a": now,
+		"b": now,
+		"c": now,
+		"d": old,
+		"e": now.Add(time.Minute),
+		"f": now,
+	}))
+
+	// Renewals do not propagate back to certificates which are up to date
+	assert.Empty(targets("b", map[string]time.Time{
+		"a": now.Add(-time.Minute),
+		"b": now,
+		"c": now,
+		"f": now,
+	}))
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+
+	"go.n16f.net/acme"
+)
+
+func windowsCertificateStoreSink(cfg *DaemonWindowsCertificateStoreCfg) (acme.CertificateSink, error) {
+	return nil, errors.New("unsupported platform")
+}
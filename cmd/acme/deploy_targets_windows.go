@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import (
+	"go.n16f.net/acme"
+)
+
+func windowsCertificateStoreSink(cfg *DaemonWindowsCertificateStoreCfg) (acme.CertificateSink, error) {
+	sinkCfg := acme.WindowsCertificateStoreSinkCfg{
+		Store:         cfg.Store,
+		Bindings:      cfg.Bindings,
+		ApplicationId: cfg.ApplicationId,
+	}
+
+	return acme.NewWindowsCertificateStoreSink(sinkCfg)
+}
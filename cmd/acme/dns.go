@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.n16f.net/acme"
+)
+
+// DNS providers are configured with credentials read from the environment
+// or from a credentials file containing KEY=VALUE lines. Values from the
+// credentials file have precedence over environment variables.
+//
+// Secrets such as API tokens can also be read, and read again when they
+// change, from a file (KEY_FILE=<path>) or from HashiCorp Vault
+// (KEY_VAULT=<path>#<field>, using VAULT_ADDR and VAULT_TOKEN).
+
+type DNSCredentials map[string]string
+
+type DNSProviderFactory func(DNSCredentials) (acme.DNSProvider, error)
+
+var dnsProviders = map[string]DNSProviderFactory{
+	"cloudflare": newCloudflareDNSProvider,
+	"pebble":     newPebbleDNSProvider,
+	"standalone": newStandaloneDNSProvider,
+}
+
+func dnsProviderNames() []string {
+	var names []string
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func NewDNSProvider(name string, credentials DNSCredentials) (acme.DNSProvider, error) {
+	factory, found := dnsProviders[name]
+	if !found {
+		return nil, fmt.Errorf("unknown DNS provider %q (available "+
+			"providers: %s)", name, strings.Join(dnsProviderNames(), ", "))
+	}
+
+	return factory(credentials)
+}
+
+func LoadDNSCredentials(filePath string) (DNSCredentials, error) {
+	credentials := make(DNSCredentials)
+
+	if filePath == "" {
+		return credentials, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: invalid line", filePath, lineNumber)
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+
+		credentials[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	return credentials, nil
+}
+
+func (c DNSCredentials) Value(key string) string {
+	if value, found := c[key]; found {
+		return value
+	}
+
+	return os.Getenv(key)
+}
+
+func (c DNSCredentials) RequiredValue(key string) (string, error) {
+	value := c.Value(key)
+	if value == "" {
+		return "", fmt.Errorf("missing credential %s", key)
+	}
+
+	return value, nil
+}
+
+func (c DNSCredentials) SecretSource(key string) (acme.SecretSource, error) {
+	if value := c.Value(key); value != "" {
+		return acme.StaticSecret(value), nil
+	}
+
+	if filePath := c.Value(key + "_FILE"); filePath != "" {
+		return acme.NewFileSecret(filePath), nil
+	}
+
+	if value := c.Value(key + "_VAULT"); value != "" {
+		secretPath, field, found := strings.Cut(value, "#")
+		if !found {
+			return nil, fmt.Errorf("invalid %s_VAULT value %q: missing field",
+				key, value)
+		}
+
+		address, err := c.RequiredValue("VAULT_ADDR")
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := acme.VaultSecretCfg{
+			Address: address,
+			Token:   c.Value("VAULT_TOKEN"),
+			Path:    secretPath,
+			Field:   field,
+		}
+
+		return acme.NewVaultSecret(cfg)
+	}
+
+	return nil, fmt.Errorf("missing credential %s", key)
+}
+
+func newCloudflareDNSProvider(credentials DNSCredentials) (acme.DNSProvider, error) {
+	token, err := credentials.SecretSource("CLOUDFLARE_API_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	zoneFinder, err := acme.NewDNSZoneFinder(acme.DNSZoneFinderCfg{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create DNS zone finder: %w", err)
+	}
+
+	cfg := acme.CloudflareDNSProviderCfg{
+		APITokenSource: token,
+		APIURI:         credentials.Value("CLOUDFLARE_API_URI"),
+		ZoneFinder:     zoneFinder,
+	}
+
+	if value := credentials.Value("CLOUDFLARE_TTL"); value != "" {
+		ttl, err := strconv.Atoi(value)
+		if err != nil || ttl < 1 {
+			return nil, fmt.Errorf("invalid CLOUDFLARE_TTL value %q", value)
+		}
+
+		cfg.TTL = ttl
+	}
+
+	return acme.NewCloudflareDNSProvider(cfg)
+}
+
+func newPebbleDNSProvider(credentials DNSCredentials) (acme.DNSProvider, error) {
+	cfg := acme.PebbleDNSProviderCfg{
+		ManagementURI: credentials.Value("PEBBLE_CHALLTESTSRV_URI"),
+	}
+
+	return acme.NewPebbleDNSProvider(cfg)
+}
+
+// The standalone provider is an embedded DNS server answering queries for
+// challenge names delegated to the host. It runs until the program exits.
+func newStandaloneDNSProvider(credentials DNSCredentials) (acme.DNSProvider, error) {
+	cfg := acme.DNSServerCfg{
+		Address:    credentials.Value("DNS_SERVER_ADDRESS"),
+		NameServer: credentials.Value("DNS_SERVER_NAME"),
+	}
+
+	server, err := acme.NewDNSServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
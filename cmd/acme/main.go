@@ -2,6 +2,11 @@ package main
 
 import (
 	"context"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"go.n16f.net/acme"
 	"go.n16f.net/log"
@@ -17,24 +22,66 @@ func main() {
 	// Program
 	p = program.NewProgram("acme", "ACME client")
 
-	p.AddOption("s", "server", "uri", acme.LetsEncryptStagingDirectoryURI,
-		"the directory URI of the ACME server")
+	p.AddOption("", "ca", "name", "letsencrypt-staging",
+		"the certificate authority, either one of "+
+			strings.Join(caNames(), ", ")+" or the URI of an ACME directory")
 	p.AddOption("d", "data-store", "path", "acme",
 		"the path of the data store directory")
-	p.AddOption("c", "contact", "URI", "",
-		"the contact URI for the ACME account")
+	p.AddOption("c", "contact", "URIs", "",
+		"a comma-separated list of contact URIs for the ACME account, e.g. "+
+			"mailto:a@example.com,mailto:b@example.com (the option cannot "+
+			"be repeated)")
 	p.AddOption("u", "upstream-uri", "uri", "",
 		"the URI of the server handling non-ACME requests received by the "+
 			"HTTP challenge solver")
-	p.AddFlag("", "pebble", "use Pebble as ACME server")
+	p.AddOption("", "eab-kid", "id", "",
+		"the key identifier for external account binding")
+	p.AddOption("", "eab-hmac-key", "key", "",
+		"the base64url-encoded HMAC key for external account binding")
+	p.AddFlag("", "pebble", "use Pebble as ACME server (same as --ca pebble)")
+	p.AddOption("", "ca-certificate", "path", "",
+		"the path of the root CA certificate of an internal ACME server")
+	p.AddOption("", "server-preset", "name", "",
+		"adapt the client to an internal ACME server (step-ca or vault)")
+	p.AddFlag("", "omit-validity-period",
+		"do not include the validity period of certificates in orders, for "+
+			"servers which reject it (always set for Let's Encrypt)")
+	p.AddOption("", "dns", "provider", "",
+		"solve DNS-01 challenges using a DNS provider (available providers: "+
+			strings.Join(dnsProviderNames(), ", ")+")")
+	p.AddOption("", "dns-credentials", "path", "",
+		"the path of a file containing KEY=VALUE credentials for the DNS "+
+			"provider, taking precedence over environment variables")
+	p.AddOption("", "dns-propagation-delay", "duration", "10s",
+		"the time to wait for DNS changes to propagate before validation")
+	p.AddFlag("", "dns-only",
+		"only use DNS-01 challenges, e.g. for servers behind a CDN (requires "+
+			"--dns)")
+	p.AddOption("", "dns-resolver", "resolver", "",
+		"wait for DNS changes to be visible with a resolver before "+
+			"validation (system, cloudflare, google or the URI of a "+
+			"DNS-over-HTTPS endpoint)")
 
 	addDirectoryCommand()
+	addAccountCommands()
 	addCertificateCommands()
+	addImportExportCommands()
 	addDemoCommand()
+	addDaemonCommand()
+	addControlCommands()
+	addCheckCommand()
+	addOrderLogCommand()
+	addMonitorCommand()
+	addPreflightCommand()
 
 	p.ParseCommandLine()
 
-	if p.CommandName() != "help" {
+	// The daemon creates its own client based on its configuration file, and
+	// control and monitoring commands do not talk to the ACME server.
+	switch p.CommandFullName() {
+	case "help", "daemon", "status", "renew-now", "pause", "resume", "check",
+		"order-log", "monitor":
+	default:
 		// Logger
 		logger := log.DefaultLogger("acme")
 		logger.DebugLevel = p.DebugLevel
@@ -49,29 +96,82 @@ func main() {
 		}
 
 		// ACME client
-		usePebble := p.IsOptionSet("pebble")
+		ca := p.OptionValue("ca")
+		if p.IsOptionSet("pebble") {
+			if p.IsOptionSet("ca") && ca != "pebble" {
+				p.Fatal("--pebble cannot be used with --ca %q", ca)
+			}
 
-		directoryURI := p.OptionValue("server")
-		if usePebble && !p.IsOptionSet("server") {
-			directoryURI = acme.PebbleDirectoryURI
+			ca = "pebble"
 		}
 
-		contactURI := p.OptionValue("contact")
+		usePebble := ca == "pebble"
+
+		directoryURI, err := CADirectoryURI(ca)
+		if err != nil {
+			p.Fatal("%v", err)
+		}
+
+		contactURIs := contactOptionValues()
 		if usePebble && !p.IsOptionSet("contact") {
-			contactURI = "mailto:test@example.com"
+			contactURIs = []string{"mailto:test@example.com"}
 		}
 
 		clientCfg := acme.ClientCfg{
 			Log:          logger,
 			DataStore:    dataStore,
 			DirectoryURI: directoryURI,
-			ContactURIs:  []string{contactURI},
+			ContactURIs:  contactURIs,
+
+			OmitValidityPeriod: p.IsOptionSet("omit-validity-period"),
+		}
+
+		eabKeyId := p.OptionValue("eab-kid")
+		eabHMACKey := p.OptionValue("eab-hmac-key")
+		if (eabKeyId == "") != (eabHMACKey == "") {
+			p.Fatal("--eab-kid and --eab-hmac-key must be set together")
+		}
+
+		if eabKeyId != "" {
+			clientCfg.ExternalAccountBinding = &acme.ExternalAccountBindingCfg{
+				KeyId:   eabKeyId,
+				HMACKey: eabHMACKey,
+			}
+		}
+
+		if p.IsOptionSet("server-preset") {
+			preset := acme.ServerPreset(p.OptionValue("server-preset"))
+			if err := preset.Validate(); err != nil {
+				p.Fatal("%v", err)
+			}
+
+			clientCfg.ServerPreset = preset
 		}
 
 		if usePebble {
 			clientCfg.HTTPClient =
 				acme.NewHTTPClient(acme.PebbleCACertificatePool())
+		} else if p.IsOptionSet("ca-certificate") {
+			pool, err := acme.LoadCACertificatePool(
+				p.OptionValue("ca-certificate"))
+			if err != nil {
+				p.Fatal("cannot load CA certificate: %v", err)
+			}
+
+			clientCfg.HTTPClient = acme.NewHTTPClient(pool)
+		}
+
+		if p.IsOptionSet("dns-only") {
+			if !p.IsOptionSet("dns") {
+				p.Fatal("--dns-only requires a DNS provider set with --dns")
+			}
+
+			clientCfg.DNSOnly = true
+		}
 
+		if p.IsOptionSet("dns") {
+			clientCfg.DNSChallengeSolver = dnsChallengeSolverCfg()
+		} else if usePebble {
 			clientCfg.HTTPChallengeSolver = &acme.HTTPChallengeSolverCfg{
 				Address:     acme.PebbleHTTPChallengeSolverAddress,
 				UpstreamURI: p.OptionValue("upstream-uri"),
@@ -91,3 +191,85 @@ func main() {
 	// Main
 	p.Run()
 }
+
+// contactOptionValues returns the URIs of the contact option. The command
+// line parser only keeps the last occurrence of an option, so repeating the
+// option is an error instead of silently dropping contacts.
+func contactOptionValues() []string {
+	if optionCount(os.Args[1:], "c", "contact") > 1 {
+		p.Fatal("--contact cannot be repeated; use a comma-separated list " +
+			"of URIs instead")
+	}
+
+	var values []string
+
+	for _, value := range strings.Split(p.OptionValue("contact"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// optionCount returns the number of occurrences of an option in command line
+// arguments, stopping at "--".
+func optionCount(args []string, names ...string) int {
+	var count int
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		if slices.Contains(names, strings.TrimLeft(arg, "-")) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func dnsChallengeSolverCfg() *acme.DNSChallengeSolverCfg {
+	credentials, err := LoadDNSCredentials(p.OptionValue("dns-credentials"))
+	if err != nil {
+		p.Fatal("cannot load DNS credentials: %v", err)
+	}
+
+	provider, err := NewDNSProvider(p.OptionValue("dns"), credentials)
+	if err != nil {
+		p.Fatal("cannot create DNS provider: %v", err)
+	}
+
+	delayString := p.OptionValue("dns-propagation-delay")
+	delay, err := time.ParseDuration(delayString)
+	if err != nil || delay < 0 {
+		p.Fatal("invalid DNS propagation delay %q", delayString)
+	}
+
+	cfg := acme.DNSChallengeSolverCfg{
+		Provider:         provider,
+		PropagationDelay: delay,
+	}
+
+	switch resolverName := p.OptionValue("dns-resolver"); resolverName {
+	case "":
+	case "system":
+		cfg.Resolver = net.DefaultResolver
+	default:
+		resolver, err := acme.NewDoHResolver(acme.DoHResolverCfg{
+			URI: acme.DNSResolverURI(resolverName),
+		})
+		if err != nil {
+			p.Fatal("invalid DNS resolver %q: %v", resolverName, err)
+		}
+
+		cfg.Resolver = resolver
+	}
+
+	return &cfg
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionCount(t *testing.T) {
+	assert := assert.New(t)
+
+	count := func(args ...string) int {
+		return optionCount(args, "c", "contact")
+	}
+
+	assert.Equal(0, count("account", "show"))
+	assert.Equal(1, count("-c", "mailto:a@example.com,mailto:b@example.com",
+		"account", "create"))
+	assert.Equal(2, count("-c", "mailto:a@example.com", "account", "create",
+		"--contact", "mailto:b@example.com"))
+	assert.Equal(1, count("--contact", "mailto:a@example.com", "--", "-c"))
+}
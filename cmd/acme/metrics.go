@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"go.n16f.net/acme"
+	"go.n16f.net/log"
+)
+
+var processStartTime = time.Now()
+
+type MetricsServer struct {
+	daemon *Daemon
+
+	server *http.Server
+	done   chan struct{}
+}
+
+func NewMetricsServer(d *Daemon) *MetricsServer {
+	s := MetricsServer{
+		daemon: d,
+
+		done: make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.hMetrics)
+	mux.HandleFunc("GET /health", s.hHealth)
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          d.Log.StdLogger(log.LevelError),
+	}
+
+	return &s
+}
+
+func (s *MetricsServer) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	s.daemon.Log.Info("serving metrics on %q", address)
+
+	go func() {
+		defer close(s.done)
+
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.daemon.Log.Error("cannot serve metrics: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *MetricsServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.server.Shutdown(ctx)
+
+	<-s.done
+}
+
+func (s *MetricsServer) hMetrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := s.daemon.client.WriteMetrics(w); err != nil {
+		s.daemon.Log.Error("cannot write metrics: %v", err)
+		return
+	}
+
+	if err := writeProcessMetrics(w); err != nil {
+		s.daemon.Log.Error("cannot write process metrics: %v", err)
+	}
+}
+
+// The health endpoint is served with metrics since it is meant for the same
+// consumers, e.g. load balancers and monitoring systems. The listener is not
+// authenticated, so the endpoint reports a cached result; active checks are
+// run on demand by the control server.
+func (s *MetricsServer) hHealth(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	if err := s.daemon.CachedHealth(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, err.Error()+"\n")
+		return
+	}
+
+	io.WriteString(w, "ok\n")
+}
+
+func writeProcessMetrics(w io.Writer) error {
+	mw := acme.NewMetricsWriter(w)
+
+	mw.WriteHeader("process_start_time_seconds", "gauge",
+		"the time at which the process started")
+	mw.WriteSample("process_start_time_seconds", nil,
+		float64(processStartTime.Unix()))
+
+	if cpuTime, err := processCPUTime(); err == nil {
+		mw.WriteHeader("process_cpu_seconds_total", "counter",
+			"the user and system CPU time spent by the process")
+		mw.WriteSample("process_cpu_seconds_total", nil, cpuTime.Seconds())
+	}
+
+	// The following metrics are only available on Linux
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := bytes.Fields(data)
+		if len(fields) > 1 {
+			nbPages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+			if err == nil {
+				mw.WriteHeader("process_resident_memory_bytes", "gauge",
+					"the resident memory size of the process")
+				mw.WriteSample("process_resident_memory_bytes", nil,
+					float64(nbPages*int64(os.Getpagesize())))
+			}
+		}
+	}
+
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		mw.WriteHeader("process_open_fds", "gauge",
+			"the number of open file descriptors")
+		mw.WriteSample("process_open_fds", nil, float64(len(entries)))
+	}
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	mw.WriteHeader("go_goroutines", "gauge",
+		"the number of goroutines that currently exist")
+	mw.WriteSample("go_goroutines", nil, float64(runtime.NumGoroutine()))
+
+	mw.WriteHeader("go_memstats_heap_alloc_bytes", "gauge",
+		"the number of heap bytes allocated and still in use")
+	mw.WriteSample("go_memstats_heap_alloc_bytes", nil,
+		float64(memStats.HeapAlloc))
+
+	return mw.Flush()
+}
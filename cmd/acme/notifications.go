@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.n16f.net/acme"
+)
+
+type NotificationType string
+
+const (
+	NotificationTypeRenewalFailure NotificationType = "renewal_failure"
+	NotificationTypeExpiration     NotificationType = "expiration"
+)
+
+type Notification struct {
+	Type        NotificationType `json:"type"`
+	Certificate string           `json:"certificate"`
+	Message     string           `json:"message"`
+	Time        time.Time        `json:"time"`
+
+	// Set for renewal failures caused by an error reported by the ACME server
+	Problem *acme.ProblemDetails `json:"problem,omitempty"`
+}
+
+type Notifier interface {
+	Notify(context.Context, *Notification) error
+}
+
+func NewNotifiers(cfg *DaemonNotificationsCfg, httpClient *http.Client) []Notifier {
+	var notifiers []Notifier
+
+	for _, webhookCfg := range cfg.Webhooks {
+		notifiers = append(notifiers, &WebhookNotifier{
+			Cfg:        webhookCfg,
+			HTTPClient: httpClient,
+		})
+	}
+
+	if cfg.SMTP != nil {
+		notifiers = append(notifiers, &SMTPNotifier{Cfg: cfg.SMTP})
+	}
+
+	return notifiers
+}
+
+type WebhookNotifier struct {
+	Cfg        *DaemonWebhookCfg
+	HTTPClient *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	var value any = notification
+	if n.Cfg.Type == WebhookTypeSlack {
+		// Slack incoming webhooks (and the many services compatible with
+		// them) only need a text field.
+		value = map[string]string{
+			"text": fmt.Sprintf("[acme] %s", notification.Message),
+		}
+	}
+
+	body, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", n.Cfg.URI,
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+type SMTPNotifier struct {
+	Cfg *DaemonSMTPCfg
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, notification *Notification) error {
+	cfg := n.Cfg
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %w", cfg.Address, err)
+		}
+
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	subject := fmt.Sprintf("[acme] %s: %s", notification.Certificate,
+		strings.ReplaceAll(string(notification.Type), "_", " "))
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", notification.Time.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", notification.Message)
+
+	// smtp.SendMail does not support contexts; run it in the background so
+	// that we do not block beyond the deadline.
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- smtp.SendMail(cfg.Address, auth, cfg.From, cfg.To,
+			msg.Bytes())
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			return fmt.Errorf("cannot send mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Daemon) notify(notification *Notification) {
+	notification.Time = time.Now()
+
+	d.Log.Info("sending %s notification for certificate %q",
+		notification.Type, notification.Certificate)
+
+	for _, notifier := range d.notifiers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(),
+				30*time.Second)
+			defer cancel()
+
+			if err := notifier.Notify(ctx, notification); err != nil {
+				d.Log.Error("cannot send notification: %v", err)
+			}
+		}()
+	}
+}
+
+func (d *Daemon) watchExpiration() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		d.checkExpiration()
+
+		select {
+		case <-d.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Daemon) checkExpiration() {
+	threshold := d.Cfg.Notifications.ExpirationThreshold
+
+	d.certificatesMutex.Lock()
+	certs := make([]*DaemonCertificate, 0, len(d.certificates))
+	for _, cert := range d.certificates {
+		certs = append(certs, cert)
+	}
+	d.certificatesMutex.Unlock()
+
+	now := time.Now()
+
+	for _, cert := range certs {
+		name := cert.Cfg().Name
+
+		certData := d.client.Certificate(name)
+		if certData == nil {
+			continue
+		}
+
+		notAfter := certData.LeafCertificate().NotAfter
+		if notAfter.Sub(now) >= time.Duration(threshold)*24*time.Hour {
+			continue
+		}
+
+		// Only notify once for each certificate
+		serialNumber := certData.SerialNumber
+
+		cert.stateMutex.Lock()
+		notified := cert.expirationNotified == serialNumber
+		cert.expirationNotified = serialNumber
+		cert.stateMutex.Unlock()
+
+		if notified {
+			continue
+		}
+
+		var msg string
+		if notAfter.Before(now) {
+			msg = fmt.Sprintf("certificate %q expired on %s", name,
+				notAfter.Format(time.RFC3339))
+		} else {
+			msg = fmt.Sprintf("certificate %q expires on %s (in %.1f days)",
+				name, notAfter.Format(time.RFC3339),
+				notAfter.Sub(now).Hours()/24)
+		}
+
+		d.notify(&Notification{
+			Type:        NotificationTypeExpiration,
+			Certificate: name,
+			Message:     msg,
+		})
+	}
+}
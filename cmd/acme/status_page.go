@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(
+	template.FuncMap{
+		"join":         strings.Join,
+		"formatTime":   formatStatusTime,
+		"formatLabels": formatLabels,
+	}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>acme</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 0.8em; text-align: left; vertical-align: top; }
+th { border-bottom: 2px solid #ccc; }
+td { border-bottom: 1px solid #eee; }
+.bar { width: 10em; height: 0.6em; background: #eee; margin-top: 0.3em; }
+.bar div { height: 100%; }
+.ok { background: #4caf50; }
+.warning { background: #ff9800; }
+.critical { background: #f44336; }
+.error { color: #c62828; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>Certificates</h1>
+<p class="muted">{{len .Certificates}} certificate(s), updated {{formatTime .Time}}</p>
+<table>
+<tr>
+<th>Name</th>
+<th>Identifiers</th>
+<th>State</th>
+<th>Expiration</th>
+<th>Next renewal</th>
+<th>Last error</th>
+</tr>
+{{- range .Certificates}}
+<tr>
+<td>{{.Name}}
+{{- with .Labels}}<br><span class="muted">{{formatLabels .}}</span>{{end}}</td>
+<td>{{join .Identifiers ", "}}</td>
+<td>{{.State}}</td>
+<td>
+{{- if .NotAfter.IsZero}}
+<span class="muted">no certificate</span>
+{{- else}}
+{{formatTime .NotAfter}} ({{.DaysLeft}} days)
+<div class="bar"><div class="{{.Level}}" style="width: {{.Remaining}}%"></div></div>
+{{- end}}
+</td>
+<td>{{formatTime .RenewalTime}}</td>
+<td>
+{{- if .LastError}}
+<span class="error">{{.LastError}}</span><br>
+<span class="muted">{{formatTime .LastErrorTime}}</span>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+type statusPageData struct {
+	Time         time.Time
+	Certificates []*statusPageCertificate
+}
+
+type statusPageCertificate struct {
+	*CertificateStatus
+
+	State       string
+	RenewalTime time.Time
+
+	// The percentage of the validity period remaining, and whether the
+	// certificate should have been renewed (warning) or is about to expire
+	// (critical).
+	Remaining int
+	DaysLeft  int
+	Level     string
+}
+
+func (s *AdminServer) hStatusPage(w http.ResponseWriter, req *http.Request) {
+	now := time.Now()
+
+	criticalDays := 7
+	if nCfg := s.daemon.Cfg.Notifications; nCfg != nil {
+		criticalDays = nCfg.ExpirationThreshold
+	}
+
+	data := statusPageData{Time: now}
+
+	for _, status := range s.daemon.CertificateStatuses() {
+		cert := statusPageCertificate{CertificateStatus: status}
+		cert.State, cert.RenewalTime = status.State()
+
+		if !status.NotAfter.IsZero() {
+			validity := status.NotAfter.Sub(status.NotBefore)
+			left := max(status.NotAfter.Sub(now), 0)
+
+			if validity > 0 {
+				cert.Remaining = int(100 * left / validity)
+			}
+
+			cert.DaysLeft = int(left / (24 * time.Hour))
+
+			switch {
+			case cert.DaysLeft < criticalDays:
+				cert.Level = "critical"
+			case !now.Before(status.RenewalTime):
+				cert.Level = "warning"
+			default:
+				cert.Level = "ok"
+			}
+		}
+
+		data.Certificates = append(data.Certificates, &cert)
+	}
+
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, &data); err != nil {
+		s.daemon.Log.Error("cannot render status page: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// See sd_notify(3). Notifications are ignored when the daemon is not run by
+// systemd, i.e. when NOTIFY_SOCKET is not set.
+
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+
+	// Abstract socket
+	if strings.HasPrefix(socketPath, "@") {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	addr := net.UnixAddr{Name: socketPath, Net: "unixgram"}
+
+	conn, err := net.DialUnix("unixgram", nil, &addr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %q: %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("cannot write to %q: %w", socketPath, err)
+	}
+
+	return nil
+}
+
+// sdWatchdogInterval returns the interval at which systemd expects watchdog
+// notifications, or 0 if the watchdog is not enabled for this process.
+func sdWatchdogInterval() (time.Duration, error) {
+	usecString := os.Getenv("WATCHDOG_USEC")
+	if usecString == "" {
+		return 0, nil
+	}
+
+	if pidString := os.Getenv("WATCHDOG_PID"); pidString != "" {
+		pid, err := strconv.Atoi(pidString)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WATCHDOG_PID value %q", pidString)
+		}
+
+		if pid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	usec, err := strconv.ParseInt(usecString, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC value %q", usecString)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
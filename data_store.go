@@ -7,6 +7,11 @@ import (
 var (
 	ErrAccountNotFound     = errors.New("account not found in data store")
 	ErrCertificateNotFound = errors.New("certificate not found in data store")
+
+	ErrCorruptedCertificateData = errors.New("corrupted certificate data")
+
+	ErrUnsupportedDataStoreOperation = errors.New("operation not supported " +
+		"by the data store")
 )
 
 type DataStore interface {
@@ -16,3 +21,39 @@ type DataStore interface {
 	LoadCertificateData(string) (*CertificateData, error)
 	StoreCertificateData(*CertificateData) error
 }
+
+// Data stores able to keep corrupted certificate data aside should implement
+// this interface: the client quarantines certificate data which cannot be
+// decoded or verified so that it can be inspected later, instead of silently
+// overwriting it with a new certificate.
+type CertificateDataQuarantiner interface {
+	QuarantineCertificateData(string) error
+}
+
+// Data stores able to keep the issuance log of the account should implement
+// this interface. Local rate limits (see RateLimitsCfg) are not checked
+// otherwise.
+type IssuanceLogStore interface {
+	LoadIssuanceLog() ([]*IssuanceLogEntry, error)
+	AppendIssuanceLogEntry(*IssuanceLogEntry) error
+}
+
+// Data stores able to keep the order log of each certificate should
+// implement this interface. Order events are not recorded otherwise.
+type OrderLogStore interface {
+	LoadOrderLog(string) ([]*OrderLogEntry, error)
+	AppendOrderLogEntry(string, *OrderLogEntry) error
+}
+
+// Data stores able to list the certificates they contain should implement
+// this interface. It is required for monitor-only clients (see
+// NewOfflineClient) and MonitorCertificates.
+type CertificateLister interface {
+	CertificateNames() ([]string, error)
+}
+
+// Data stores able to delete certificate data should implement this
+// interface, see Client.DeleteCertificateData.
+type CertificateDataDeleter interface {
+	DeleteCertificateData(string) error
+}
@@ -0,0 +1,178 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// basicDataStore only implements the methods required by the DataStore
+// interface, as a third-party data store would.
+type basicDataStore struct {
+	accountData []byte
+	certs       map[string][]byte
+	mutex       sync.Mutex
+}
+
+func newBasicDataStore() *basicDataStore {
+	return &basicDataStore{certs: make(map[string][]byte)}
+}
+
+func (s *basicDataStore) LoadAccountData() (*AccountData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.accountData == nil {
+		return nil, ErrAccountNotFound
+	}
+
+	var data AccountData
+	if err := json.Unmarshal(s.accountData, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (s *basicDataStore) StoreAccountData(data *AccountData) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.accountData = jsonData
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *basicDataStore) LoadCertificateData(name string) (*CertificateData, error) {
+	s.mutex.Lock()
+	jsonData := s.certs[name]
+	s.mutex.Unlock()
+
+	if jsonData == nil {
+		return nil, ErrCertificateNotFound
+	}
+
+	var data CertificateData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (s *basicDataStore) StoreCertificateData(data *CertificateData) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.certs[data.Name] = jsonData
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func TestDeleteCertificateData(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	certData := testCertificateData(t)
+
+	// Data store without deletion support
+	dataStore := newBasicDataStore()
+	require.NoError(dataStore.StoreCertificateData(certData))
+
+	c, err := NewClient(ClientCfg{DataStore: dataStore})
+	require.NoError(err)
+
+	err = c.DeleteCertificateData(certData.Name)
+	assert.ErrorIs(err, ErrUnsupportedDataStoreOperation)
+
+	// File system data store
+	fsDataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+	require.NoError(fsDataStore.StoreCertificateData(certData))
+
+	c2, err := NewClient(ClientCfg{DataStore: fsDataStore})
+	require.NoError(err)
+
+	require.NoError(c2.DeleteCertificateData(certData.Name))
+
+	_, err = fsDataStore.LoadCertificateData(certData.Name)
+	assert.ErrorIs(err, ErrCertificateNotFound)
+
+	err = c2.DeleteCertificateData(certData.Name)
+	assert.ErrorIs(err, ErrCertificateNotFound)
+}
+
+func TestCertificateLister(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	certData := testCertificateData(t)
+
+	// Monitoring requires listing certificates
+	dataStore := newBasicDataStore()
+	require.NoError(dataStore.StoreCertificateData(certData))
+
+	_, err := NewOfflineClient(dataStore)
+	assert.ErrorIs(err, ErrUnsupportedDataStoreOperation)
+
+	fsDataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+	require.NoError(fsDataStore.StoreCertificateData(certData))
+
+	c, err := NewOfflineClient(fsDataStore)
+	require.NoError(err)
+	defer c.Stop()
+
+	assert.NotNil(c.Certificate(certData.Name))
+}
+
+func TestOrderLogStore(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	ids := []Identifier{DNSIdentifier("example.com")}
+
+	// Orders are not logged if the data store does not support it
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+		cfg.DataStore = newBasicDataStore()
+	}, func(c *Client) {
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+
+		_, err = c.OrderLog("test")
+		assert.ErrorIs(err, ErrUnsupportedDataStoreOperation)
+	})
+
+	withFakeTestClient(t, s, func(c *Client) {
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			CertificateRequest{Identifiers: ids, Validity: 1})
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+
+		entries, err := c.OrderLog("test")
+		require.NoError(err)
+		require.NotEmpty(entries)
+		assert.Equal(OrderLogEventCertificateIssued,
+			entries[len(entries)-1].Event)
+	})
+}
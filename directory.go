@@ -3,8 +3,14 @@ package acme
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
 )
 
+const DefaultDirectoryRefreshInterval = 24 * time.Hour
+
 // RFC 8555 7.1.1. Directory
 type Directory struct {
 	NewNonce   string `json:"newNonce"`
@@ -22,20 +28,163 @@ type DirectoryMetadata struct {
 	Website                 string   `json:"website,omitempty"`
 	CAAIdentities           []string `json:"caaIdentities,omitempty"`
 	ExternalAccountRequired bool     `json:"externalAccountRequired,omitempty"`
+
+	// draft-aaron-acme-profiles: profile names and descriptions
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+func (d *Directory) resolveURIs(base *url.URL) error {
+	uris := []*string{&d.NewNonce, &d.NewAccount, &d.NewOrder, &d.NewAuthz,
+		&d.RevokeCert, &d.KeyChange}
+
+	for _, uri := range uris {
+		if err := resolveURI(base, uri); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Directory returns the last version of the directory fetched from the
+// server. Servers can change endpoint URIs at any time, so callers must not
+// keep the value for later requests.
+func (c *Client) Directory() *Directory {
+	return c.directory.Load()
+}
+
+// RefreshDirectory fetches the directory from the server and returns it, e.g.
+// to obtain metadata which may have changed since the last refresh.
+func (c *Client) RefreshDirectory(ctx context.Context) (*Directory, error) {
+	if err := c.updateDirectory(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.Directory(), nil
+}
+
+// TermsOfServiceURL returns the URI of the current terms of service of the
+// server, or an empty string if the server does not publish it or if the
+// directory has not been fetched yet.
+func (c *Client) TermsOfServiceURL() string {
+	return c.directoryMetadata().TermsOfService
+}
+
+// CAAIdentities returns the domain names which can be used in CAA records
+// (RFC 8659) to authorize the server to issue certificates.
+func (c *Client) CAAIdentities() []string {
+	return slices.Clone(c.directoryMetadata().CAAIdentities)
+}
+
+// ExternalAccountRequired indicates whether the server requires an external
+// account binding to create accounts.
+func (c *Client) ExternalAccountRequired() bool {
+	return c.directoryMetadata().ExternalAccountRequired
+}
+
+func (c *Client) directoryMetadata() DirectoryMetadata {
+	if d := c.Directory(); d != nil {
+		return d.Meta
+	}
+
+	return DirectoryMetadata{}
 }
 
 func (c *Client) updateDirectory(ctx context.Context) error {
-	c.Log.Debug(1, "updating directory from %q", c.Cfg.DirectoryURI)
+	c.Log.Debug(1, "updating directory from %q", c.Config().DirectoryURI)
 
 	var d Directory
 
-	_, err := c.sendRequestWithNonce(ctx, "GET", c.Cfg.DirectoryURI,
-		nil, &d, "")
+	_, err := c.sendRequestWithNonce(ctx, "GET", c.Config().DirectoryURI,
+		nil, &d, "", 0)
 	if err != nil {
-		return fmt.Errorf("cannot fetch %q: %w", c.Cfg.DirectoryURI, err)
+		return fmt.Errorf("cannot fetch %q: %w", c.Config().DirectoryURI, err)
 	}
 
-	c.Directory = &d
+	if oldDirectory := c.directory.Swap(&d); oldDirectory != nil {
+		if !oldDirectory.sameEndpoints(&d) {
+			c.Log.Info("directory endpoints have changed")
+		}
+
+		if tos := d.Meta.TermsOfService; tos != oldDirectory.Meta.TermsOfService {
+			c.Log.Info("terms of service have changed to %q", tos)
+		}
+
+		// Nonces are only guaranteed to be valid for the endpoint which
+		// issued them.
+		if oldDirectory.NewNonce != d.NewNonce {
+			c.clearNonces()
+		}
+	}
 
 	return nil
 }
+
+func (d *Directory) sameEndpoints(d2 *Directory) bool {
+	return d.NewNonce == d2.NewNonce &&
+		d.NewAccount == d2.NewAccount &&
+		d.NewOrder == d2.NewOrder &&
+		d.NewAuthz == d2.NewAuthz &&
+		d.RevokeCert == d2.RevokeCert &&
+		d.KeyChange == d2.KeyChange
+}
+
+func (c *Client) refreshDirectory() {
+	defer c.wg.Done()
+
+	for {
+		timer := time.NewTimer(c.Config().DirectoryRefreshInterval)
+
+		select {
+		case <-c.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := c.updateDirectory(ctx); err != nil {
+			c.Log.Error("cannot update directory: %v", err)
+		}
+		cancel()
+	}
+}
+
+// sendDirectoryRequest sends a request to a directory endpoint. If the
+// endpoint does not exist anymore, the directory is fetched again and the
+// request is retried if the endpoint URI has changed.
+func (c *Client) sendDirectoryRequest(ctx context.Context, method string, endpoint func(*Directory) string, reqBody, resBody any) (*http.Response, error) {
+	uri := endpoint(c.Directory())
+
+	res, err := c.sendRequest(ctx, method, uri, reqBody, resBody)
+	if !isNotFoundResponse(res, err) {
+		return res, err
+	}
+
+	if newURI := c.reloadDirectoryEndpoint(ctx, uri, endpoint); newURI != "" {
+		return c.sendRequest(ctx, method, newURI, reqBody, resBody)
+	}
+
+	return res, err
+}
+
+// reloadDirectoryEndpoint fetches the directory again and returns the new
+// URI of an endpoint, or an empty string if it has not changed.
+func (c *Client) reloadDirectoryEndpoint(ctx context.Context, uri string, endpoint func(*Directory) string) string {
+	c.Log.Info("endpoint %q not found, updating directory", uri)
+
+	if err := c.updateDirectory(ctx); err != nil {
+		c.Log.Error("cannot update directory: %v", err)
+		return ""
+	}
+
+	if newURI := endpoint(c.Directory()); newURI != uri {
+		return newURI
+	}
+
+	return ""
+}
+
+func isNotFoundResponse(res *http.Response, err error) bool {
+	return err != nil && res != nil && res.StatusCode == http.StatusNotFound
+}
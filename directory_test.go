@@ -0,0 +1,78 @@
+package acme
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryEndpointRotation(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		ctx := context.Background()
+
+		requestCertificate := func(name string) {
+			request := CertificateRequest{
+				Identifiers: []Identifier{DNSIdentifier("example.com")},
+				Validity:    1,
+			}
+
+			eventChan, err := c.RequestCertificate(ctx, name, request)
+			require.NoError(err)
+
+			ev := <-eventChan
+			require.NotNil(ev)
+			require.NoError(ev.Error)
+		}
+
+		requestCertificate("test1")
+		assert.Equal(1, s.Requests("directory"))
+
+		// Orders are submitted to the new endpoint after a directory update
+		s.RotateEndpoints("-2")
+
+		requestCertificate("test2")
+		assert.Equal(2, s.Requests("directory"))
+		assert.True(strings.HasSuffix(c.Directory().NewOrder, "/new-order-2"))
+
+		// Nonces obtained from the previous endpoint have been discarded and
+		// new ones are fetched from the new endpoint.
+		s.RotateEndpoints("-3")
+		c.clearNonces()
+
+		_, err := c.fetchNonce(ctx)
+		require.NoError(err)
+		assert.Equal(3, s.Requests("directory"))
+		assert.True(strings.HasSuffix(c.Directory().NewNonce, "/new-nonce-3"))
+	})
+}
+
+func TestDirectoryMetadata(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+	s.CAAIdentities = []string{"ca.example"}
+
+	withFakeTestClient(t, s, func(c *Client) {
+		assert.Equal([]string{"ca.example"}, c.CAAIdentities())
+		assert.Equal("", c.TermsOfServiceURL())
+		assert.False(c.ExternalAccountRequired())
+
+		s.mutex.Lock()
+		s.CAAIdentities = []string{"ca.example", "ca2.example"}
+		s.mutex.Unlock()
+
+		directory, err := c.RefreshDirectory(context.Background())
+		require.NoError(err)
+		assert.Equal(directory.Meta.CAAIdentities, c.CAAIdentities())
+		assert.Equal([]string{"ca.example", "ca2.example"}, c.CAAIdentities())
+	})
+}
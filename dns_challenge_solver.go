@@ -0,0 +1,218 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.n16f.net/log"
+)
+
+// A DNS provider manages TXT records for DNS-01 challenges. Names are fully
+// qualified domain names without trailing dot, e.g.
+// "_acme-challenge.example.com". Multiple records with the same name and
+// different values can exist at the same time, for example when a
+// certificate contains both "example.com" and "*.example.com".
+type DNSProvider interface {
+	SetTXTRecord(ctx context.Context, name, value string) error
+	DeleteTXTRecord(ctx context.Context, name, value string) error
+}
+
+// DNS providers which can list existing records should implement this
+// interface: the solver then verifies that challenge records have actually
+// been deleted, since leftover records cause confusing failures for
+// subsequent orders.
+type DNSRecordLister interface {
+	ListTXTRecords(ctx context.Context, name string) ([]string, error)
+}
+
+const (
+	dnsRecordDeletionAttempts   = 3
+	dnsRecordDeletionRetryDelay = time.Second
+
+	dnsPropagationCheckInterval = 2 * time.Second
+)
+
+const DefaultDNSPropagationTimeout = 2 * time.Minute
+
+type DNSChallengeSolverCfg struct {
+	Log      *log.Logger `json:"-"`
+	Provider DNSProvider `json:"-"`
+
+	// The time to wait after records have been created before asking the
+	// ACME server to validate the challenge, letting changes propagate to
+	// all authoritative servers.
+	PropagationDelay time.Duration `json:"propagation_delay,omitempty"`
+
+	// If set, the solver waits until records are visible with this resolver
+	// before applying the propagation delay and asking the ACME server to
+	// validate the challenge. Defaults to DefaultDNSPropagationTimeout.
+	Resolver           DNSResolver   `json:"-"`
+	PropagationTimeout time.Duration `json:"propagation_timeout,omitempty"`
+}
+
+type DNSChallengeSolver struct {
+	Cfg DNSChallengeSolverCfg
+	Log *log.Logger
+}
+
+// Validate returns ValidationErrors if the configuration is invalid.
+func (cfg *DNSChallengeSolverCfg) Validate() error {
+	var v validator
+
+	if cfg.Provider == nil {
+		v.add("Provider", "missing DNS provider")
+	}
+
+	if cfg.PropagationDelay < 0 {
+		v.add("PropagationDelay", "invalid negative delay")
+	}
+
+	if cfg.PropagationTimeout < 0 {
+		v.add("PropagationTimeout", "invalid negative timeout")
+	}
+
+	return v.err()
+}
+
+func NewDNSChallengeSolver(cfg DNSChallengeSolverCfg) (*DNSChallengeSolver, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := DNSChallengeSolver{
+		Cfg: cfg,
+		Log: cfg.Log.Child("dns_solver", nil),
+	}
+
+	return &s, nil
+}
+
+func (s *DNSChallengeSolver) setupChallenge(ctx context.Context, domain, token, accountThumbprint string) error {
+	name := dnsChallengeRecordName(domain)
+	value := dnsChallengeRecordValue(token, accountThumbprint)
+
+	s.Log.Debug(1, "creating TXT record %q", name)
+
+	if err := s.Cfg.Provider.SetTXTRecord(ctx, name, value); err != nil {
+		return fmt.Errorf("cannot create TXT record %q: %w", name, err)
+	}
+
+	if s.Cfg.Resolver != nil {
+		if err := s.waitForRecord(ctx, name, value); err != nil {
+			return err
+		}
+	}
+
+	if delay := s.Cfg.PropagationDelay; delay > 0 {
+		s.Log.Debug(1, "waiting %v for DNS propagation", delay)
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (s *DNSChallengeSolver) waitForRecord(ctx context.Context, name, value string) error {
+	timeout := s.Cfg.PropagationTimeout
+	if timeout == 0 {
+		timeout = DefaultDNSPropagationTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		// Lookup errors, NXDOMAIN in particular, are expected until the
+		// record has propagated.
+		values, err := s.Cfg.Resolver.LookupTXT(ctx, name)
+		if err != nil {
+			s.Log.Debug(1, "cannot lookup TXT record %q: %v", name, err)
+		} else if slices.Contains(values, value) {
+			s.Log.Debug(1, "TXT record %q visible", name)
+			return nil
+		}
+
+		if time.Now().Add(dnsPropagationCheckInterval).After(deadline) {
+			return fmt.Errorf("TXT record %q still not visible after %v",
+				name, timeout)
+		}
+
+		t := time.NewTimer(dnsPropagationCheckInterval)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *DNSChallengeSolver) teardownChallenge(ctx context.Context, domain, token, accountThumbprint string) error {
+	name := dnsChallengeRecordName(domain)
+	value := dnsChallengeRecordValue(token, accountThumbprint)
+
+	for attempt := 1; ; attempt++ {
+		s.Log.Debug(1, "deleting TXT record %q", name)
+
+		if err := s.Cfg.Provider.DeleteTXTRecord(ctx, name, value); err != nil {
+			return fmt.Errorf("cannot delete TXT record %q: %w", name, err)
+		}
+
+		lister, ok := s.Cfg.Provider.(DNSRecordLister)
+		if !ok {
+			return nil
+		}
+
+		values, err := lister.ListTXTRecords(ctx, name)
+		if err != nil {
+			return fmt.Errorf("cannot list TXT records %q: %w", name, err)
+		}
+
+		if !slices.Contains(values, value) {
+			return nil
+		}
+
+		if attempt >= dnsRecordDeletionAttempts {
+			return fmt.Errorf("TXT record %q still present after %d deletion "+
+				"attempts", name, attempt)
+		}
+
+		s.Log.Error("TXT record %q still present after deletion, retrying",
+			name)
+
+		t := time.NewTimer(dnsRecordDeletionRetryDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func dnsChallengeRecordName(domain string) string {
+	// RFC 8555 8.4. The wildcard prefix is not part of the identifier of the
+	// authorization, but we strip it anyway to be safe.
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.TrimSuffix(domain, ".")
+
+	return "_acme-challenge." + domain
+}
+
+func dnsChallengeRecordValue(token, accountThumbprint string) string {
+	keyAuthorization := token + "." + accountThumbprint
+	digest := sha256.Sum256([]byte(keyAuthorization))
+
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
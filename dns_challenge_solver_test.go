@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.n16f.net/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSChallengeSolverTeardown(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	provider := &fakeDNSProvider{records: make(map[string][]string)}
+
+	s, err := NewDNSChallengeSolver(DNSChallengeSolverCfg{
+		Log:      log.DefaultLogger("test"),
+		Provider: provider,
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+	name := "_acme-challenge.example.com"
+
+	// Deletion is retried if the record is still there
+	require.NoError(s.setupChallenge(ctx, "example.com", "token", "thumbprint"))
+	assert.Len(provider.TXTRecords(name), 1)
+
+	provider.IgnoredDeletions = 1
+	require.NoError(s.teardownChallenge(ctx, "example.com", "token",
+		"thumbprint"))
+	assert.Empty(provider.TXTRecords(name))
+
+	// But not forever
+	require.NoError(s.setupChallenge(ctx, "example.com", "token", "thumbprint"))
+
+	provider.IgnoredDeletions = dnsRecordDeletionAttempts
+	assert.Error(s.teardownChallenge(ctx, "example.com", "token",
+		"thumbprint"))
+	assert.Len(provider.TXTRecords(name), 1)
+}
+
+func TestDNSChallengeSolverPropagation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	provider := &fakeDNSProvider{records: make(map[string][]string)}
+
+	// A DNS-over-HTTPS server answering with the records of the provider
+	dohServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+
+		var msg dnsmessage.Message
+		if !assert.NoError(msg.Unpack(data)) || !assert.Len(msg.Questions, 1) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		question := msg.Questions[0]
+		name := strings.TrimSuffix(question.Name.String(), ".")
+
+		msg.Response = true
+
+		values := provider.TXTRecords(name)
+		if len(values) == 0 {
+			msg.RCode = dnsmessage.RCodeNameError
+		}
+
+		for _, value := range values {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{
+					Name:  question.Name,
+					Type:  dnsmessage.TypeTXT,
+					Class: dnsmessage.ClassINET,
+				},
+				Body: &dnsmessage.TXTResource{TXT: []string{value}},
+			})
+		}
+
+		resData, err := msg.Pack()
+		if !assert.NoError(err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(resData)
+	}))
+	defer dohServer.Close()
+
+	resolver, err := NewDoHResolver(DoHResolverCfg{URI: dohServer.URL})
+	require.NoError(err)
+
+	ctx := context.Background()
+	name := "_acme-challenge.example.com"
+
+	_, err = resolver.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	require.ErrorAs(err, &dnsErr)
+	assert.True(dnsErr.IsNotFound)
+
+	s, err := NewDNSChallengeSolver(DNSChallengeSolverCfg{
+		Log:                log.DefaultLogger("test"),
+		Provider:           provider,
+		Resolver:           resolver,
+		PropagationTimeout: time.Second,
+	})
+	require.NoError(err)
+
+	require.NoError(s.setupChallenge(ctx, "example.com", "token", "thumbprint"))
+
+	values, err := resolver.LookupTXT(ctx, name)
+	require.NoError(err)
+	assert.Equal(provider.TXTRecords(name), values)
+
+	// A record which never becomes visible
+	provider.IgnoredCreations = 1
+	assert.Error(s.setupChallenge(ctx, "example.org", "token", "thumbprint"))
+}
@@ -0,0 +1,314 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const CloudflareAPIURI = "https://api.cloudflare.com/client/v4"
+
+type CloudflareDNSProviderCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// An API token with the Zone.DNS edit permission on the relevant zones.
+	APIToken string `json:"api_token"`
+
+	// If set, the API token is obtained from this source for each request
+	// instead of using APIToken, so that it can be rotated.
+	APITokenSource SecretSource `json:"-"`
+
+	// Defaults to CloudflareAPIURI.
+	APIURI string `json:"api_uri,omitempty"`
+
+	// The TTL of TXT records in seconds; 1 means automatic. Defaults to 60,
+	// the minimum value accepted by Cloudflare for other values than 1.
+	TTL int `json:"ttl,omitempty"`
+
+	// If set, the zone containing records is detected with DNS queries
+	// instead of trying each parent domain with the Cloudflare API, saving
+	// API requests for deep subdomains.
+	ZoneFinder *DNSZoneFinder `json:"-"`
+}
+
+type CloudflareDNSProvider struct {
+	Cfg CloudflareDNSProviderCfg
+
+	zoneIds      map[string]string // name -> id
+	zoneIdsMutex sync.Mutex
+}
+
+type cloudflareResponse struct {
+	Success bool              `json:"success"`
+	Errors  []cloudflareError `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+type cloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cloudflareZone struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type cloudflareDNSRecord struct {
+	Id      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+func NewCloudflareDNSProvider(cfg CloudflareDNSProviderCfg) (*CloudflareDNSProvider, error) {
+	if cfg.APITokenSource == nil {
+		if cfg.APIToken == "" {
+			return nil, fmt.Errorf("missing API token")
+		}
+
+		cfg.APITokenSource = StaticSecret(cfg.APIToken)
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = NewHTTPClient(nil)
+	}
+
+	if cfg.APIURI == "" {
+		cfg.APIURI = CloudflareAPIURI
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = 60
+	}
+
+	p := CloudflareDNSProvider{
+		Cfg: cfg,
+
+		zoneIds: make(map[string]string),
+	}
+
+	return &p, nil
+}
+
+func (p *CloudflareDNSProvider) SetTXTRecord(ctx context.Context, name, value string) error {
+	zoneId, err := p.findZone(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	record := cloudflareDNSRecord{
+		Type:    "TXT",
+		Name:    name,
+		Content: value,
+		TTL:     p.Cfg.TTL,
+	}
+
+	uriPath := "/zones/" + url.PathEscape(zoneId) + "/dns_records"
+	return p.sendRequest(ctx, "POST", uriPath, nil, &record, nil)
+}
+
+func (p *CloudflareDNSProvider) DeleteTXTRecord(ctx context.Context, name, value string) error {
+	zoneId, err := p.findZone(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	uriPath := "/zones/" + url.PathEscape(zoneId) + "/dns_records"
+
+	records, err := p.listTXTRecords(ctx, zoneId, name)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		// Cloudflare may return TXT content between double quotes
+		if strings.Trim(record.Content, `"`) != value {
+			continue
+		}
+
+		recordPath := uriPath + "/" + url.PathEscape(record.Id)
+		if err := p.sendRequest(ctx, "DELETE", recordPath, nil, nil, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *CloudflareDNSProvider) ListTXTRecords(ctx context.Context, name string) ([]string, error) {
+	zoneId, err := p.findZone(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.listTXTRecords(ctx, zoneId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(records))
+	for i, record := range records {
+		values[i] = strings.Trim(record.Content, `"`)
+	}
+
+	return values, nil
+}
+
+func (p *CloudflareDNSProvider) listTXTRecords(ctx context.Context, zoneId, name string) ([]cloudflareDNSRecord, error) {
+	uriPath := "/zones/" + url.PathEscape(zoneId) + "/dns_records"
+
+	query := url.Values{}
+	query.Set("type", "TXT")
+	query.Set("name", name)
+
+	var records []cloudflareDNSRecord
+	if err := p.sendRequest(ctx, "GET", uriPath, query, nil, &records); err != nil {
+		return nil, fmt.Errorf("cannot list records: %w", err)
+	}
+
+	return records, nil
+}
+
+func (p *CloudflareDNSProvider) findZone(ctx context.Context, name string) (string, error) {
+	// If the zone cannot be detected with DNS queries, or if the zone found
+	// is not managed by the account (e.g. with split-horizon DNS), fall back
+	// to trying each parent domain, starting with the longest one, until we
+	// find a zone managed by the account.
+	if finder := p.Cfg.ZoneFinder; finder != nil {
+		if zoneName, err := finder.FindZone(ctx, name); err == nil {
+			zoneId, err := p.findZoneId(ctx, zoneName)
+			if err != nil {
+				return "", err
+			}
+
+			if zoneId != "" {
+				return zoneId, nil
+			}
+		}
+	}
+
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+
+	for i := 0; i < len(labels)-1; i++ {
+		zoneName := strings.Join(labels[i:], ".")
+
+		zoneId, err := p.findZoneId(ctx, zoneName)
+		if err != nil {
+			return "", err
+		}
+
+		if zoneId != "" {
+			return zoneId, nil
+		}
+	}
+
+	return "", fmt.Errorf("no zone found for %q", name)
+}
+
+func (p *CloudflareDNSProvider) findZoneId(ctx context.Context, zoneName string) (string, error) {
+	p.zoneIdsMutex.Lock()
+	zoneId, found := p.zoneIds[zoneName]
+	p.zoneIdsMutex.Unlock()
+
+	if found {
+		return zoneId, nil
+	}
+
+	query := url.Values{}
+	query.Set("name", zoneName)
+
+	var zones []cloudflareZone
+	if err := p.sendRequest(ctx, "GET", "/zones", query, nil, &zones); err != nil {
+		return "", fmt.Errorf("cannot list zones: %w", err)
+	}
+
+	if len(zones) == 0 {
+		return "", nil
+	}
+
+	p.zoneIdsMutex.Lock()
+	p.zoneIds[zoneName] = zones[0].Id
+	p.zoneIdsMutex.Unlock()
+
+	return zones[0].Id, nil
+}
+
+func (p *CloudflareDNSProvider) sendRequest(ctx context.Context, method, uriPath string, query url.Values, reqBody, resBody any) error {
+	uri := p.Cfg.APIURI + uriPath
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("cannot encode request body: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	token, err := p.Cfg.APITokenSource.Secret(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot obtain API token: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := p.Cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	var cfRes cloudflareResponse
+	if err := json.Unmarshal(data, &cfRes); err != nil {
+		return fmt.Errorf("cannot decode response body (status %d): %w",
+			res.StatusCode, err)
+	}
+
+	if !cfRes.Success {
+		var msgs []string
+		for _, e := range cfRes.Errors {
+			msgs = append(msgs, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+		}
+
+		if len(msgs) == 0 {
+			return fmt.Errorf("request failed with status %d",
+				res.StatusCode)
+		}
+
+		return errors.New(strings.Join(msgs, ", "))
+	}
+
+	if resBody != nil {
+		if err := json.Unmarshal(cfRes.Result, resBody); err != nil {
+			return fmt.Errorf("cannot decode result: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudflareDNSProvider(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	records := make(map[string]cloudflareDNSRecord)
+
+	reply := func(w http.ResponseWriter, result any) {
+		data, _ := json.Marshal(result)
+		json.NewEncoder(w).Encode(cloudflareResponse{
+			Success: true,
+			Result:  data,
+		})
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /zones", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal("Bearer token", req.Header.Get("Authorization"))
+
+		zones := []cloudflareZone{}
+		if req.URL.Query().Get("name") == "example.com" {
+			zones = append(zones, cloudflareZone{Id: "z1", Name: "example.com"})
+		}
+
+		reply(w, zones)
+	})
+
+	mux.HandleFunc("POST /zones/z1/dns_records", func(w http.ResponseWriter, req *http.Request) {
+		var record cloudflareDNSRecord
+		data, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(data, &record); !assert.NoError(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		assert.Equal(60, record.TTL)
+
+		record.Id = "r" + record.Content
+		records[record.Id] = record
+
+		reply(w, record)
+	})
+
+	mux.HandleFunc("GET /zones/z1/dns_records", func(w http.ResponseWriter, req *http.Request) {
+		var result []cloudflareDNSRecord
+		for _, record := range records {
+			if record.Name == req.URL.Query().Get("name") {
+				result = append(result, record)
+			}
+		}
+
+		reply(w, result)
+	})
+
+	mux.HandleFunc("DELETE /zones/z1/dns_records/{id}", func(w http.ResponseWriter, req *http.Request) {
+		delete(records, req.PathValue("id"))
+		reply(w, nil)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p, err := NewCloudflareDNSProvider(CloudflareDNSProviderCfg{
+		APIToken: "token",
+		APIURI:   server.URL,
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+	name := "_acme-challenge.www.example.com"
+
+	require.NoError(p.SetTXTRecord(ctx, name, "a"))
+	require.NoError(p.SetTXTRecord(ctx, name, "b"))
+	assert.Len(records, 2)
+
+	require.NoError(p.DeleteTXTRecord(ctx, name, "a"))
+	if assert.Len(records, 1) {
+		assert.Equal("b", records["rb"].Content)
+	}
+
+	values, err := p.ListTXTRecords(ctx, name)
+	require.NoError(err)
+	assert.Equal([]string{"b"}, values)
+
+	assert.Error(p.SetTXTRecord(ctx, "_acme-challenge.example.org", "c"))
+}
@@ -0,0 +1,138 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// PebbleDNSProvider manages TXT records with the management API of
+// pebble-challtestsrv. It is only meant to be used for tests.
+
+type PebbleDNSProviderCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// Defaults to PebbleChallTestSrvManagementURI.
+	ManagementURI string `json:"management_uri,omitempty"`
+}
+
+type PebbleDNSProvider struct {
+	Cfg PebbleDNSProviderCfg
+
+	// pebble-challtestsrv can only delete all the values of a record, so we
+	// keep track of them to restore the ones we did not delete.
+	records      map[string][]string
+	recordsMutex sync.Mutex
+}
+
+func NewPebbleDNSProvider(cfg PebbleDNSProviderCfg) (*PebbleDNSProvider, error) {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = NewHTTPClient(nil)
+	}
+
+	if cfg.ManagementURI == "" {
+		cfg.ManagementURI = PebbleChallTestSrvManagementURI
+	}
+
+	p := PebbleDNSProvider{
+		Cfg: cfg,
+
+		records: make(map[string][]string),
+	}
+
+	return &p, nil
+}
+
+func (p *PebbleDNSProvider) SetTXTRecord(ctx context.Context, name, value string) error {
+	p.recordsMutex.Lock()
+	defer p.recordsMutex.Unlock()
+
+	if err := p.addRecord(ctx, name, value); err != nil {
+		return err
+	}
+
+	p.records[name] = append(p.records[name], value)
+
+	return nil
+}
+
+func (p *PebbleDNSProvider) DeleteTXTRecord(ctx context.Context, name, value string) error {
+	p.recordsMutex.Lock()
+	defer p.recordsMutex.Unlock()
+
+	request := struct {
+		Host string `json:"host"`
+	}{
+		Host: name + ".",
+	}
+
+	if err := p.sendRequest(ctx, "/clear-txt", &request); err != nil {
+		return err
+	}
+
+	values := slices.DeleteFunc(p.records[name],
+		func(v string) bool { return v == value })
+
+	if len(values) == 0 {
+		delete(p.records, name)
+		return nil
+	}
+
+	p.records[name] = values
+
+	for _, v := range values {
+		if err := p.addRecord(ctx, name, v); err != nil {
+			return fmt.Errorf("cannot restore record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *PebbleDNSProvider) addRecord(ctx context.Context, name, value string) error {
+	request := struct {
+		Host  string `json:"host"`
+		Value string `json:"value"`
+	}{
+		Host:  name + ".",
+		Value: value,
+	}
+
+	return p.sendRequest(ctx, "/set-txt", &request)
+}
+
+func (p *PebbleDNSProvider) sendRequest(ctx context.Context, uriPath string, reqBody any) error {
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("cannot encode request body: %w", err)
+	}
+
+	uri := p.Cfg.ManagementURI + uriPath
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uri,
+		bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.Cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("request failed with status %d: %s",
+			res.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package acme
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestCertificateDNS01(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	withDNSTestClient(t,
+		func(c *Client) {
+			ctx := context.Background()
+
+			// Wildcard identifiers can only be validated with DNS-01
+			// challenges, and both identifiers share the same TXT record
+			// name.
+			ids := []Identifier{
+				DNSIdentifier("example.com"),
+				DNSIdentifier("*.example.com"),
+			}
+
+			eventChan, err := c.RequestCertificate(ctx, "test",
+				CertificateRequest{Identifiers: ids, Validity: 1})
+			require.NoError(err)
+
+			ev := <-eventChan
+
+			require.NotNil(ev)
+			require.NoError(ev.Error)
+
+			leaf := ev.CertificateData.LeafCertificate()
+			assert.ElementsMatch([]string{"example.com", "*.example.com"},
+				leaf.DNSNames)
+		})
+}
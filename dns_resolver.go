@@ -0,0 +1,255 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// A DNS resolver is used to check that challenge records are publicly
+// visible before asking the ACME server to validate them. *net.Resolver
+// implements this interface, but the system resolver is frequently useless
+// for this purpose with split-horizon DNS setups, hence DoHResolver.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+const (
+	CloudflareDoHURI = "https://cloudflare-dns.com/dns-query"
+	GoogleDoHURI     = "https://dns.google/dns-query"
+)
+
+// DNSResolverURI returns the URI of a well-known DNS-over-HTTPS service, or
+// the value itself if it is not the name of a known service.
+func DNSResolverURI(s string) string {
+	switch s {
+	case "cloudflare":
+		return CloudflareDoHURI
+	case "google":
+		return GoogleDoHURI
+	default:
+		return s
+	}
+}
+
+type DoHResolverCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// The URI of a RFC 8484 endpoint, e.g. CloudflareDoHURI.
+	URI string `json:"uri"`
+}
+
+// DoHResolver is a DNS-over-HTTPS (RFC 8484) resolver.
+type DoHResolver struct {
+	Cfg DoHResolverCfg
+
+	httpClient *http.Client
+	uri        string
+}
+
+func NewDoHResolver(cfg DoHResolverCfg) (*DoHResolver, error) {
+	uri, err := url.Parse(cfg.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI: %w", err)
+	}
+
+	if uri.Scheme != "https" && uri.Scheme != "http" {
+		return nil, fmt.Errorf("invalid URI scheme %q", uri.Scheme)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = NewHTTPClient(nil)
+	}
+
+	r := DoHResolver{
+		Cfg: cfg,
+
+		httpClient: httpClient,
+		uri:        uri.String(),
+	}
+
+	return &r, nil
+}
+
+func (r *DoHResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	msg, err := r.query(ctx, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+
+	for _, answer := range msg.Answers {
+		if body, ok := answer.Body.(*dnsmessage.TXTResource); ok {
+			values = append(values, strings.Join(body.TXT, ""))
+		}
+	}
+
+	return values, nil
+}
+
+// RFC 8659 CAA resource record
+type CAARecord struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+const dnsTypeCAA dnsmessage.Type = 257
+
+// LookupCAA returns the CAA records of a name, without climbing the domain
+// tree (see RelevantCAARecords).
+func (r *DoHResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	msg, err := r.query(ctx, name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []CAARecord
+
+	for _, answer := range msg.Answers {
+		body, ok := answer.Body.(*dnsmessage.UnknownResource)
+		if !ok || body.Type != dnsTypeCAA {
+			continue
+		}
+
+		record, err := parseCAARecord(body.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CAA record for %q: %w", name, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// RelevantCAARecords returns the CAA records applying to a name, i.e. the
+// records of the closest name in the domain tree which has some (RFC 8659
+// 3).
+func (r *DoHResolver) RelevantCAARecords(ctx context.Context, name string) (string, []CAARecord, error) {
+	name = strings.TrimSuffix(name, ".")
+
+	for name != "" {
+		records, err := r.LookupCAA(ctx, name)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				return "", nil, err
+			}
+		}
+
+		if len(records) > 0 {
+			return name, records, nil
+		}
+
+		_, name, _ = strings.Cut(name, ".")
+	}
+
+	return "", nil, nil
+}
+
+func parseCAARecord(data []byte) (CAARecord, error) {
+	var record CAARecord
+
+	if len(data) < 2 {
+		return record, fmt.Errorf("truncated data")
+	}
+
+	record.Flags = data[0]
+
+	tagLength := int(data[1])
+	if tagLength == 0 || len(data) < 2+tagLength {
+		return record, fmt.Errorf("invalid tag length")
+	}
+
+	record.Tag = strings.ToLower(string(data[2 : 2+tagLength]))
+	record.Value = string(data[2+tagLength:])
+
+	return record, nil
+}
+
+func (r *DoHResolver) query(ctx context.Context, name string, qType dnsmessage.Type) (*dnsmessage.Message, error) {
+	qName, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+
+	var idData [2]byte
+	if _, err := rand.Read(idData[:]); err != nil {
+		return nil, fmt.Errorf("cannot generate random data: %w", err)
+	}
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               binary.BigEndian.Uint16(idData[:]),
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{
+			Name:  qName,
+			Type:  qType,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+
+	queryData, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.uri,
+		bytes.NewReader(queryData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	res, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to %q: %w", r.uri, err)
+	}
+	defer res.Body.Close()
+
+	resData, err := io.ReadAll(newSizeLimitedReader(res.Body, 65535))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("request to %q failed with status %d", r.uri,
+			res.StatusCode)
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resData); err != nil {
+		return nil, fmt.Errorf("cannot decode response: %w", err)
+	}
+
+	if msg.ID != query.ID {
+		return nil, fmt.Errorf("response id does not match query id")
+	}
+
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name,
+			IsNotFound: true}
+	default:
+		return nil, fmt.Errorf("query failed with code %v", msg.RCode)
+	}
+
+	return &msg, nil
+}
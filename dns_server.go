@@ -0,0 +1,475 @@
+package acme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.n16f.net/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DefaultDNSServerAddress = ":53"
+	DefaultDNSServerTTL     = 10 // seconds
+
+	dnsUDPMessageSize = 512
+	dnsTCPTimeout     = 10 * time.Second
+)
+
+type DNSServerCfg struct {
+	Log *log.Logger `json:"-"`
+
+	// The address used for both UDP and TCP. Defaults to
+	// DefaultDNSServerAddress.
+	Address string `json:"address,omitempty"`
+
+	// The name of the server as used in NS records delegating challenge
+	// names. If set, the server answers SOA and NS queries for challenge
+	// names, which some resolvers send before TXT queries.
+	NameServer string `json:"name_server,omitempty"`
+
+	// The TTL of answers in seconds. Defaults to DefaultDNSServerTTL.
+	TTL int `json:"ttl,omitempty"`
+}
+
+// DNSServer is a minimal authoritative DNS server answering TXT queries for
+// challenge records. It is used as a DNS provider when challenge names are
+// delegated to the host running the client, removing the need for the API
+// of a DNS provider. For example, with the following record in the
+// example.com zone:
+//
+//	_acme-challenge.example.com. NS acme-dns.example.net.
+//
+// where acme-dns.example.net points to the host running the client, the
+// server answers the queries of the ACME server for the challenge records
+// of example.com. Queries for names without a "_acme-challenge" label are
+// refused.
+//
+// The server must be started with Start before being used.
+type DNSServer struct {
+	Cfg DNSServerCfg
+	Log *log.Logger
+
+	records      map[string][]string
+	recordsMutex sync.Mutex
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewDNSServer(cfg DNSServerCfg) (*DNSServer, error) {
+	if cfg.Log == nil {
+		cfg.Log = log.DefaultLogger("acme")
+	}
+
+	if cfg.Address == "" {
+		cfg.Address = DefaultDNSServerAddress
+	}
+
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultDNSServerTTL
+	}
+
+	var v validator
+
+	v.checkListenAddress("Address", cfg.Address)
+
+	if cfg.TTL < 0 {
+		v.add("TTL", "invalid negative TTL")
+	}
+
+	if cfg.NameServer != "" {
+		if _, err := dnsmessage.NewName(dnsFQDN(cfg.NameServer)); err != nil {
+			v.add("NameServer", "invalid name %q: %v", cfg.NameServer, err)
+		}
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	s := DNSServer{
+		Cfg: cfg,
+		Log: cfg.Log.Child("dns_server", nil),
+
+		records: make(map[string][]string),
+
+		stopChan: make(chan struct{}),
+	}
+
+	return &s, nil
+}
+
+func (s *DNSServer) Start() error {
+	udpConn, err := net.ListenPacket("udp", s.Cfg.Address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on UDP address %q: %w",
+			s.Cfg.Address, err)
+	}
+
+	// If the port was chosen by the system, TCP must use the same one
+	address := s.Cfg.Address
+	if host, port, err := net.SplitHostPort(address); err == nil && port == "0" {
+		_, udpPort, _ := net.SplitHostPort(udpConn.LocalAddr().String())
+		address = net.JoinHostPort(host, udpPort)
+	}
+
+	tcpListener, err := net.Listen("tcp", address)
+	if err != nil {
+		udpConn.Close()
+		return fmt.Errorf("cannot listen on TCP address %q: %w", address, err)
+	}
+
+	s.Log.Info("DNS server listening on %q", address)
+
+	s.udpConn = udpConn
+	s.tcpListener = tcpListener
+
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+
+	return nil
+}
+
+func (s *DNSServer) Stop() {
+	close(s.stopChan)
+
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+
+	if s.tcpListener != nil {
+		s.tcpListener.Close()
+	}
+
+	s.wg.Wait()
+}
+
+// Address returns the address the server listens on once started.
+func (s *DNSServer) Address() string {
+	if s.udpConn == nil {
+		return ""
+	}
+
+	return s.udpConn.LocalAddr().String()
+}
+
+func (s *DNSServer) SetTXTRecord(ctx context.Context, name, value string) error {
+	key := dnsRecordKey(name)
+
+	s.recordsMutex.Lock()
+	defer s.recordsMutex.Unlock()
+
+	if !slices.Contains(s.records[key], value) {
+		s.records[key] = append(s.records[key], value)
+	}
+
+	return nil
+}
+
+func (s *DNSServer) DeleteTXTRecord(ctx context.Context, name, value string) error {
+	key := dnsRecordKey(name)
+
+	s.recordsMutex.Lock()
+	defer s.recordsMutex.Unlock()
+
+	values := slices.DeleteFunc(s.records[key],
+		func(v string) bool { return v == value })
+	if len(values) == 0 {
+		delete(s.records, key)
+	} else {
+		s.records[key] = values
+	}
+
+	return nil
+}
+
+func (s *DNSServer) ListTXTRecords(ctx context.Context, name string) ([]string, error) {
+	s.recordsMutex.Lock()
+	defer s.recordsMutex.Unlock()
+
+	return slices.Clone(s.records[dnsRecordKey(name)]), nil
+}
+
+func (s *DNSServer) serveUDP() {
+	defer s.wg.Done()
+
+	buf := make([]byte, 65535)
+
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			if !s.stopping() {
+				s.Log.Error("cannot read UDP packet: %v", err)
+			}
+
+			return
+		}
+
+		res := s.answer(buf[:n], dnsUDPMessageSize)
+		if res == nil {
+			continue
+		}
+
+		if _, err := s.udpConn.WriteTo(res, addr); err != nil {
+			s.Log.Debug(1, "cannot send response to %v: %v", addr, err)
+		}
+	}
+}
+
+func (s *DNSServer) serveTCP() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			if !s.stopping() {
+				s.Log.Error("cannot accept TCP connection: %v", err)
+			}
+
+			return
+		}
+
+		s.wg.Add(1)
+		go s.serveTCPConnection(conn)
+	}
+}
+
+func (s *DNSServer) serveTCPConnection(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
+
+	// Connections must not outlive the server
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-s.stopChan:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	// RFC 1035 4.2.2. TCP usage: messages are prefixed with a two byte
+	// length field; a connection can carry multiple queries.
+	for {
+		conn.SetDeadline(time.Now().Add(dnsTCPTimeout))
+
+		var lengthData [2]byte
+		if _, err := io.ReadFull(conn, lengthData[:]); err != nil {
+			return
+		}
+
+		query := make([]byte, binary.BigEndian.Uint16(lengthData[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		res := s.answer(query, 65535)
+		if res == nil {
+			return
+		}
+
+		data := binary.BigEndian.AppendUint16(nil, uint16(len(res)))
+		if _, err := conn.Write(append(data, res...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *DNSServer) stopping() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// answer returns the response to a query, or nil if the query cannot even be
+// parsed enough to build an error response.
+func (s *DNSServer) answer(query []byte, maxSize int) []byte {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil
+	}
+
+	res := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:            header.ID,
+			Response:      true,
+			OpCode:        header.OpCode,
+			Authoritative: true,
+		},
+	}
+
+	if header.OpCode != 0 {
+		res.Header.RCode = dnsmessage.RCodeNotImplemented
+		return s.packResponse(&res, maxSize)
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil || len(questions) != 1 {
+		res.Header.RCode = dnsmessage.RCodeFormatError
+		return s.packResponse(&res, maxSize)
+	}
+
+	question := questions[0]
+	res.Questions = questions
+
+	s.answerQuestion(&res, question)
+
+	s.Log.Debug(2, "%v %s %v", question.Type, question.Name, res.Header.RCode)
+
+	return s.packResponse(&res, maxSize)
+}
+
+func (s *DNSServer) answerQuestion(res *dnsmessage.Message, question dnsmessage.Question) {
+	key := dnsRecordKey(question.Name.String())
+
+	if question.Class != dnsmessage.ClassINET ||
+		!strings.HasPrefix(key, "_acme-challenge.") {
+		res.Header.Authoritative = false
+		res.Header.RCode = dnsmessage.RCodeRefused
+		return
+	}
+
+	header := dnsmessage.ResourceHeader{
+		Name:  question.Name,
+		Class: dnsmessage.ClassINET,
+		TTL:   uint32(s.Cfg.TTL),
+	}
+
+	switch question.Type {
+	case dnsmessage.TypeTXT:
+		s.recordsMutex.Lock()
+		values := slices.Clone(s.records[key])
+		s.recordsMutex.Unlock()
+
+		for _, value := range values {
+			header.Type = dnsmessage.TypeTXT
+
+			res.Answers = append(res.Answers, dnsmessage.Resource{
+				Header: header,
+				Body:   &dnsmessage.TXTResource{TXT: dnsTXTStrings(value)},
+			})
+		}
+
+	case dnsmessage.TypeSOA:
+		if soa := s.soaResource(question.Name); soa != nil {
+			header.Type = dnsmessage.TypeSOA
+			res.Answers = append(res.Answers, dnsmessage.Resource{
+				Header: header,
+				Body:   soa,
+			})
+		}
+
+	case dnsmessage.TypeNS:
+		if s.Cfg.NameServer != "" {
+			header.Type = dnsmessage.TypeNS
+			res.Answers = append(res.Answers, dnsmessage.Resource{
+				Header: header,
+				Body: &dnsmessage.NSResource{
+					NS: dnsmessage.MustNewName(dnsFQDN(s.Cfg.NameServer)),
+				},
+			})
+		}
+	}
+
+	// Every challenge name exists as far as we are concerned: records are
+	// created and deleted all the time, and a negative answer could be
+	// cached by resolvers.
+	if len(res.Answers) == 0 {
+		if soa := s.soaResource(question.Name); soa != nil {
+			header.Type = dnsmessage.TypeSOA
+			res.Authorities = append(res.Authorities, dnsmessage.Resource{
+				Header: header,
+				Body:   soa,
+			})
+		}
+	}
+}
+
+func (s *DNSServer) soaResource(name dnsmessage.Name) *dnsmessage.SOAResource {
+	if s.Cfg.NameServer == "" {
+		return nil
+	}
+
+	ns := dnsFQDN(s.Cfg.NameServer)
+
+	soa := dnsmessage.SOAResource{
+		NS:      dnsmessage.MustNewName(ns),
+		MBox:    dnsmessage.MustNewName("hostmaster." + ns),
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		MinTTL:  uint32(s.Cfg.TTL),
+	}
+
+	return &soa
+}
+
+func (s *DNSServer) packResponse(res *dnsmessage.Message, maxSize int) []byte {
+	data, err := res.Pack()
+	if err != nil {
+		s.Log.Error("cannot encode response: %v", err)
+
+		res.Answers = nil
+		res.Authorities = nil
+		res.Header.RCode = dnsmessage.RCodeServerFailure
+
+		if data, err = res.Pack(); err != nil {
+			return nil
+		}
+	}
+
+	// RFC 1035 4.2.1. UDP usage: longer messages are truncated, and the
+	// client is expected to retry with TCP.
+	if len(data) > maxSize {
+		res.Answers = nil
+		res.Authorities = nil
+		res.Header.Truncated = true
+
+		if data, err = res.Pack(); err != nil {
+			return nil
+		}
+	}
+
+	return data
+}
+
+// dnsTXTStrings splits a value in character strings, which are limited to
+// 255 bytes (RFC 1035 3.3.14).
+func dnsTXTStrings(value string) []string {
+	var strs []string
+
+	for len(value) > 255 {
+		strs = append(strs, value[:255])
+		value = value[255:]
+	}
+
+	return append(strs, value)
+}
+
+func dnsRecordKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func dnsFQDN(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
@@ -0,0 +1,62 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.n16f.net/log"
+)
+
+func TestDNSServer(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	s, err := NewDNSServer(DNSServerCfg{
+		Log:        log.DefaultLogger("test"),
+		Address:    "127.0.0.1:0",
+		NameServer: "acme-dns.example.net",
+	})
+	require.NoError(err)
+	require.NoError(s.Start())
+	defer s.Stop()
+
+	resolver := func(network string) *net.Resolver {
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, s.Address())
+			},
+		}
+	}
+
+	name := "_acme-challenge.example.com"
+
+	require.NoError(s.SetTXTRecord(ctx, name, "foo"))
+	require.NoError(s.SetTXTRecord(ctx, name, "bar"))
+
+	for _, network := range []string{"udp", "tcp"} {
+		values, err := resolver(network).LookupTXT(ctx, "_ACME-challenge.example.com")
+		require.NoError(err, network)
+		assert.ElementsMatch([]string{"foo", "bar"}, values, network)
+	}
+
+	require.NoError(s.DeleteTXTRecord(ctx, name, "foo"))
+
+	values, err := s.ListTXTRecords(ctx, name)
+	require.NoError(err)
+	assert.Equal([]string{"bar"}, values)
+
+	values, err = resolver("udp").LookupTXT(ctx, name)
+	require.NoError(err)
+	assert.Equal([]string{"bar"}, values)
+
+	// Names which are not challenge names are refused
+	_, err = resolver("udp").LookupTXT(ctx, "example.com")
+	assert.Error(err)
+}
@@ -0,0 +1,235 @@
+package acme
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNS records used for DNS-01 challenges must be created in the zone
+// containing them, which is not always the parent of the record, e.g.
+// "_acme-challenge.a.b.example.com" may be part of the "example.com" or of
+// the "b.example.com" zone. The zone finder locates the apex of the zone by
+// sending SOA queries for each parent domain, starting with the longest one.
+
+type DNSZoneFinderCfg struct {
+	// Addresses of the nameservers to query (host:port). The nameservers
+	// listed in /etc/resolv.conf are used by default.
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// The timeout of each query; the default value is 5 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type DNSZoneFinder struct {
+	Cfg DNSZoneFinderCfg
+
+	zones      map[string]string // name -> zone
+	zonesMutex sync.Mutex
+}
+
+func NewDNSZoneFinder(cfg DNSZoneFinderCfg) (*DNSZoneFinder, error) {
+	if len(cfg.Nameservers) == 0 {
+		nameservers, err := systemNameservers()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read system nameservers: %w", err)
+		}
+
+		cfg.Nameservers = nameservers
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	f := DNSZoneFinder{
+		Cfg: cfg,
+
+		zones: make(map[string]string),
+	}
+
+	return &f, nil
+}
+
+// FindZone returns the name of the zone containing a domain name, without
+// trailing dot.
+func (f *DNSZoneFinder) FindZone(ctx context.Context, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	f.zonesMutex.Lock()
+	zone, found := f.zones[name]
+	f.zonesMutex.Unlock()
+
+	if found {
+		return zone, nil
+	}
+
+	labels := strings.Split(name, ".")
+
+	for i := 0; i < len(labels)-1; i++ {
+		candidate := strings.Join(labels[i:], ".")
+
+		isApex, err := f.isZoneApex(ctx, candidate)
+		if err != nil {
+			return "", fmt.Errorf("cannot query SOA record for %q: %w",
+				candidate, err)
+		}
+
+		if isApex {
+			f.zonesMutex.Lock()
+			f.zones[name] = candidate
+			f.zonesMutex.Unlock()
+
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("no zone found for %q", name)
+}
+
+func (f *DNSZoneFinder) isZoneApex(ctx context.Context, name string) (bool, error) {
+	var lastErr error
+
+	for _, nameserver := range f.Cfg.Nameservers {
+		msg, err := f.query(ctx, nameserver, name, dnsmessage.TypeSOA)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		switch msg.Header.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+		default:
+			lastErr = fmt.Errorf("nameserver %q returned %v", nameserver,
+				msg.Header.RCode)
+			continue
+		}
+
+		// A SOA record in the answer section whose owner is the name itself
+		// means that the name is the apex of a zone. For other names, the
+		// SOA record of the zone is in the authority section.
+		for _, answer := range msg.Answers {
+			if answer.Header.Type != dnsmessage.TypeSOA {
+				continue
+			}
+
+			owner := strings.TrimSuffix(answer.Header.Name.String(), ".")
+			if strings.EqualFold(owner, name) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, lastErr
+}
+
+func (f *DNSZoneFinder) query(ctx context.Context, nameserver, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name: %w", err)
+	}
+
+	id := uint16(rand.N(65536))
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               id,
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+
+	queryData, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode query: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.Cfg.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", nameserver)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %q: %w", nameserver, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(queryData); err != nil {
+		return nil, fmt.Errorf("cannot send query to %q: %w", nameserver, err)
+	}
+
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read response from %q: %w",
+				nameserver, err)
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			return nil, fmt.Errorf("cannot decode response from %q: %w",
+				nameserver, err)
+		}
+
+		// Ignore responses to other queries
+		if msg.Header.ID != id || !msg.Header.Response {
+			continue
+		}
+
+		if msg.Header.Truncated {
+			return nil, errors.New("truncated response")
+		}
+
+		return &msg, nil
+	}
+}
+
+func systemNameservers() ([]string, error) {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+
+	var nameservers []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers,
+				net.JoinHostPort(fields[1], "53"))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(nameservers) == 0 {
+		return nil, errors.New("no nameserver found in /etc/resolv.conf")
+	}
+
+	return nameservers, nil
+}
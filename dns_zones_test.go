@@ -0,0 +1,122 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSZoneFinder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	zones := []string{"b.example.com.", "example.com."}
+
+	address := startFakeDNSServer(t, zones)
+
+	finder, err := NewDNSZoneFinder(DNSZoneFinderCfg{
+		Nameservers: []string{address},
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		zone string
+	}{
+		{"example.com", "example.com"},
+		{"_acme-challenge.example.com", "example.com"},
+		{"_acme-challenge.a.example.com", "example.com"},
+		{"_acme-challenge.b.example.com", "b.example.com"},
+		{"_acme-challenge.c.b.example.com.", "b.example.com"},
+	}
+
+	for _, test := range tests {
+		zone, err := finder.FindZone(ctx, test.name)
+		if assert.NoError(err, test.name) {
+			assert.Equal(test.zone, zone, test.name)
+		}
+	}
+
+	_, err = finder.FindZone(ctx, "_acme-challenge.example.org")
+	assert.Error(err)
+}
+
+func startFakeDNSServer(t *testing.T, zones []string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	findZone := func(name string) string {
+		for _, zone := range zones {
+			if name == zone || strings.HasSuffix(name, "."+zone) {
+				return zone
+			}
+		}
+
+		return ""
+	}
+
+	soa := func(zone string) dnsmessage.Resource {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name:  dnsmessage.MustNewName(zone),
+				Type:  dnsmessage.TypeSOA,
+				Class: dnsmessage.ClassINET,
+			},
+			Body: &dnsmessage.SOAResource{
+				NS:   dnsmessage.MustNewName("ns." + zone),
+				MBox: dnsmessage.MustNewName("hostmaster." + zone),
+			},
+		}
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			res := dnsmessage.Message{
+				Header: dnsmessage.Header{
+					ID:       query.Header.ID,
+					Response: true,
+				},
+				Questions: query.Questions,
+			}
+
+			name := query.Questions[0].Name.String()
+
+			if zone := findZone(name); zone == "" {
+				res.Header.RCode = dnsmessage.RCodeNameError
+			} else if zone == name {
+				res.Answers = append(res.Answers, soa(zone))
+			} else {
+				res.Authorities = append(res.Authorities, soa(zone))
+			}
+
+			data, err := res.Pack()
+			if err != nil {
+				continue
+			}
+
+			conn.WriteTo(data, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
@@ -0,0 +1,881 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// fakeACMEServer is a minimal in-memory ACME server used to test the
+// behaviour of the client without Pebble. It only supports DNS-01
+// challenges, validated against the records of its own DNS provider, and
+// lets tests inject failures.
+type fakeACMEServer struct {
+	t      *testing.T
+	server *httptest.Server
+
+	DNSProvider *fakeDNSProvider
+
+	caKey         *ecdsa.PrivateKey
+	caCertificate *x509.Certificate
+
+	mutex sync.Mutex
+
+	nonces map[string]struct{}
+	nextId int
+
+	accounts     map[string]*jose.JSONWebKey
+	orders       map[string]*fakeOrder
+	authzs       map[string]*fakeAuthorization
+	challenges   map[string]*fakeAuthorization
+	certificates map[string][]byte // DER leaf certificates
+
+	requests map[string]int
+
+	// The number of next signed requests rejected with a badNonce error.
+	BadNonces int
+
+	// The number of next newOrder requests rejected with a rateLimited
+	// error.
+	RateLimitedOrders int
+
+	// If set, challenges stay in the processing state forever once
+	// submitted.
+	PendingForever bool
+
+	// The status of accounts, valid by default.
+	AccountStatus AccountStatus
+
+	// If set, certificates are downloaded in DER format, with a link to the
+	// issuer certificate, instead of PEM certificate chains.
+	DERCertificates bool
+
+	// The difference between the clock of the server and the system clock,
+	// applied to the validity period of certificates.
+	ClockOffset time.Duration
+
+	// Appended to the URIs of directory endpoints; changing it simulates
+	// a server rotating its endpoints, previous URIs returning 404.
+	EndpointSuffix string
+
+	// The number of next fetches of ready orders reporting them as
+	// processing.
+	ProcessingOrders int
+
+	// The lifetime of orders, one hour by default.
+	OrderLifetime time.Duration
+
+	// If set, requests signed with other algorithms are rejected with a
+	// badSignatureAlgorithm error.
+	SignatureAlgorithms []jose.SignatureAlgorithm
+
+	// If set, orders with notBefore or notAfter fields are rejected, as
+	// done by servers where the lifetime of certificates is fixed.
+	RejectValidityPeriod bool
+
+	// The validity of certificates when orders do not have a validity
+	// period, 90 days by default.
+	DefaultValidity time.Duration
+
+	// Published in the metadata of the directory.
+	CAAIdentities []string
+
+	// If set, the directory advertises that an external account binding is
+	// required, and new accounts without one are rejected.
+	ExternalAccountRequired bool
+
+	// How the URI of new orders is returned: in the Location header field by
+	// default, as a relative reference ("relative") or only in the "url"
+	// field of the response body ("body").
+	OrderLocation string
+
+	// The header of the last request received.
+	LastRequestHeader http.Header
+}
+
+var fakeDirectoryEndpoints = []string{"new-nonce", "new-account",
+	"new-order", "revoke-cert", "key-change"}
+
+type fakeOrder struct {
+	order  Order
+	authzs []*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	authz Authorization
+}
+
+type fakeDNSProvider struct {
+	records map[string][]string
+	mutex   sync.Mutex
+
+	// The number of creations which succeed without creating anything.
+	IgnoredCreations int
+
+	// The number of deletions which succeed without deleting anything.
+	IgnoredDeletions int
+}
+
+func newFakeACMEServer(t *testing.T) *fakeACMEServer {
+	s := newUnstartedFakeACMEServer(t)
+	s.server.Start()
+
+	return s
+}
+
+// newFakeTLSACMEServer returns a fake server using HTTPS with a certificate
+// which is not trusted by default, as internal ACME servers do.
+func newFakeTLSACMEServer(t *testing.T) *fakeACMEServer {
+	s := newUnstartedFakeACMEServer(t)
+	s.server.StartTLS()
+
+	return s
+}
+
+func newUnstartedFakeACMEServer(t *testing.T) *fakeACMEServer {
+	s := fakeACMEServer{
+		t: t,
+
+		DNSProvider: &fakeDNSProvider{records: make(map[string][]string)},
+
+		nonces: make(map[string]struct{}),
+
+		accounts:     make(map[string]*jose.JSONWebKey),
+		orders:       make(map[string]*fakeOrder),
+		authzs:       make(map[string]*fakeAuthorization),
+		challenges:   make(map[string]*fakeAuthorization),
+		certificates: make(map[string][]byte),
+
+		requests: make(map[string]int),
+	}
+
+	s.createCA()
+
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+
+	return &s
+}
+
+func (s *fakeACMEServer) DirectoryURI() string {
+	return s.server.URL + "/directory"
+}
+
+func (s *fakeACMEServer) RotateEndpoints(suffix string) {
+	s.mutex.Lock()
+	s.EndpointSuffix = suffix
+	s.mutex.Unlock()
+}
+
+// Requests returns the number of requests received for an endpoint, e.g.
+// "new-order".
+func (s *fakeACMEServer) Requests(endpoint string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[endpoint]
+}
+
+func (s *fakeACMEServer) createCA() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		s.t.Fatalf("cannot generate CA key: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake ACME root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, &template, &template,
+		key.Public(), key)
+	if err != nil {
+		s.t.Fatalf("cannot create CA certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		s.t.Fatalf("cannot parse CA certificate: %v", err)
+	}
+
+	s.caKey = key
+	s.caCertificate = cert
+}
+
+func (s *fakeACMEServer) handle(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.LastRequestHeader = req.Header.Clone()
+
+	w.Header().Set("Replay-Nonce", s.newNonce())
+
+	endpoint, id, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+
+	for _, name := range fakeDirectoryEndpoints {
+		if endpoint == name+s.EndpointSuffix {
+			endpoint = name
+			break
+		} else if strings.HasPrefix(endpoint, name) {
+			s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+				"unknown endpoint")
+			return
+		}
+	}
+
+	s.requests[endpoint]++
+
+	switch endpoint {
+	case "directory":
+		s.reply(w, http.StatusOK, s.directory())
+		return
+	case "new-nonce":
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if req.Method != "POST" {
+		s.replyError(w, http.StatusMethodNotAllowed, ErrorTypeMalformed,
+			"invalid method")
+		return
+	}
+
+	payload, key, ok := s.verifyRequest(w, req)
+	if !ok {
+		return
+	}
+
+	switch endpoint {
+	case "new-account":
+		s.handleNewAccount(w, key, payload)
+	case "account":
+		status := s.AccountStatus
+		if status == "" {
+			status = AccountStatusValid
+		}
+		s.reply(w, http.StatusOK, Account{Status: status})
+	case "new-order":
+		s.handleNewOrder(w, payload)
+	case "order":
+		s.handleOrder(w, id)
+	case "authz":
+		s.handleAuthorization(w, id)
+	case "challenge":
+		s.handleChallenge(w, id, payload)
+	case "finalize":
+		s.handleFinalize(w, id, payload)
+	case "certificate":
+		s.handleCertificate(w, id)
+	case "issuer":
+		s.handleIssuer(w)
+	default:
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown endpoint")
+	}
+}
+
+func (s *fakeACMEServer) verifyRequest(w http.ResponseWriter, req *http.Request) ([]byte, *jose.JSONWebKey, bool) {
+	algorithms := []jose.SignatureAlgorithm{jose.ES256, jose.ES384,
+		jose.ES512, jose.RS256, jose.EdDSA}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"cannot read body")
+		return nil, nil, false
+	}
+
+	jws, err := jose.ParseSigned(string(body), algorithms)
+	if err != nil || len(jws.Signatures) != 1 {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"invalid JWS")
+		return nil, nil, false
+	}
+
+	header := jws.Signatures[0].Protected
+
+	if _, found := s.nonces[header.Nonce]; !found || s.BadNonces > 0 {
+		s.BadNonces = max(s.BadNonces-1, 0)
+		s.replyError(w, http.StatusBadRequest, ErrorTypeBadNonce,
+			"invalid nonce")
+		return nil, nil, false
+	}
+	delete(s.nonces, header.Nonce)
+
+	if len(s.SignatureAlgorithms) > 0 &&
+		!slices.Contains(s.SignatureAlgorithms, jose.SignatureAlgorithm(header.Algorithm)) {
+		details := ProblemDetails{
+			Type:   ErrorTypeBadSignatureAlgorithm,
+			Status: http.StatusBadRequest,
+			Detail: "unsupported signature algorithm",
+		}
+
+		for _, algorithm := range s.SignatureAlgorithms {
+			details.Algorithms = append(details.Algorithms, string(algorithm))
+		}
+
+		s.replyProblem(w, &details)
+		return nil, nil, false
+	}
+
+	if uri, _ := header.ExtraHeaders["url"].(string); uri != s.server.URL+req.URL.Path {
+		s.replyError(w, http.StatusUnauthorized, ErrorTypeUnauthorized,
+			"invalid url header")
+		return nil, nil, false
+	}
+
+	key := header.JSONWebKey
+	if key == nil {
+		key = s.accounts[header.KeyID]
+		if key == nil {
+			s.replyError(w, http.StatusBadRequest,
+				ErrorTypeAccountDoesNotExist, "unknown account")
+			return nil, nil, false
+		}
+	}
+
+	payload, err := jws.Verify(key)
+	if err != nil {
+		s.replyError(w, http.StatusUnauthorized, ErrorTypeUnauthorized,
+			"invalid signature")
+		return nil, nil, false
+	}
+
+	return payload, key, true
+}
+
+func (s *fakeACMEServer) handleNewAccount(w http.ResponseWriter, key *jose.JSONWebKey, payload []byte) {
+	var newAccount NewAccount
+	if err := json.Unmarshal(payload, &newAccount); err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"invalid payload")
+		return
+	}
+
+	if s.ExternalAccountRequired && newAccount.ExternalAccountBinding == nil {
+		s.replyError(w, http.StatusUnauthorized,
+			ErrorTypeExternalAccountRequired,
+			"external account binding required")
+		return
+	}
+
+	uri := s.newURI("account")
+	s.accounts[uri] = key
+
+	w.Header().Set("Location", uri)
+	s.reply(w, http.StatusCreated, Account{Status: AccountStatusValid})
+}
+
+func (s *fakeACMEServer) handleNewOrder(w http.ResponseWriter, payload []byte) {
+	if s.RateLimitedOrders > 0 {
+		s.RateLimitedOrders--
+		w.Header().Set("Retry-After", "1")
+		s.replyError(w, http.StatusTooManyRequests, ErrorTypeRateLimited,
+			"too many orders")
+		return
+	}
+
+	var newOrder NewOrder
+	if err := json.Unmarshal(payload, &newOrder); err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"invalid payload")
+		return
+	}
+
+	if s.RejectValidityPeriod &&
+		(newOrder.NotBefore != nil || newOrder.NotAfter != nil) {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"notBefore and notAfter are not supported")
+		return
+	}
+
+	uri := s.newURI("order")
+
+	lifetime := s.OrderLifetime
+	if lifetime == 0 {
+		lifetime = time.Hour
+	}
+
+	order := fakeOrder{
+		order: Order{
+			Status:      OrderStatusPending,
+			Expires:     time.Now().Add(lifetime),
+			Identifiers: newOrder.Identifiers,
+			NotBefore:   newOrder.NotBefore,
+			NotAfter:    newOrder.NotAfter,
+			Finalize:    strings.Replace(uri, "/order/", "/finalize/", 1),
+		},
+	}
+
+	for _, id := range newOrder.Identifiers {
+		authzURI := s.newURI("authz")
+		challengeURI := s.newURI("challenge")
+
+		token := make([]byte, 16)
+		rand.Read(token)
+
+		authz := fakeAuthorization{
+			authz: Authorization{
+				Identifier: id,
+				Status:     AuthorizationStatusPending,
+				Challenges: []*Challenge{{
+					Type:   ChallengeTypeDNS01,
+					URL:    challengeURI,
+					Status: ChallengeStatusPending,
+					Data: &ChallengeDataDNS01{
+						Token: base64.RawURLEncoding.EncodeToString(token),
+					},
+				}},
+			},
+		}
+
+		s.authzs[authzURI] = &authz
+		s.challenges[challengeURI] = &authz
+
+		order.order.Authorizations = append(order.order.Authorizations,
+			authzURI)
+		order.authzs = append(order.authzs, &authz)
+	}
+
+	s.orders[uri] = &order
+
+	switch s.OrderLocation {
+	case "relative":
+		w.Header().Set("Location", strings.TrimPrefix(uri, s.server.URL))
+	case "body":
+		s.reply(w, http.StatusCreated, struct {
+			*Order
+			URL string `json:"url"`
+		}{&order.order, uri})
+		return
+	default:
+		w.Header().Set("Location", uri)
+	}
+
+	s.reply(w, http.StatusCreated, &order.order)
+}
+
+func (s *fakeACMEServer) handleOrder(w http.ResponseWriter, id string) {
+	order := s.orders[s.uri("order", id)]
+	if order == nil {
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown order")
+		return
+	}
+
+	if order.order.Status == OrderStatusPending {
+		ready := true
+		for _, authz := range order.authzs {
+			if authz.authz.Status != AuthorizationStatusValid {
+				ready = false
+			}
+		}
+
+		if ready {
+			order.order.Status = OrderStatusReady
+		}
+	}
+
+	if order.order.Status == OrderStatusReady && s.ProcessingOrders > 0 {
+		s.ProcessingOrders--
+
+		processingOrder := order.order
+		processingOrder.Status = OrderStatusProcessing
+
+		w.Header().Set("Retry-After", "0")
+		s.reply(w, http.StatusOK, &processingOrder)
+		return
+	}
+
+	w.Header().Set("Retry-After", "0")
+	s.reply(w, http.StatusOK, &order.order)
+}
+
+func (s *fakeACMEServer) handleAuthorization(w http.ResponseWriter, id string) {
+	authz := s.authzs[s.uri("authz", id)]
+	if authz == nil {
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown authorization")
+		return
+	}
+
+	w.Header().Set("Retry-After", "0")
+	s.reply(w, http.StatusOK, s.encodeAuthorization(authz))
+}
+
+func (s *fakeACMEServer) handleChallenge(w http.ResponseWriter, id string, payload []byte) {
+	authz := s.challenges[s.uri("challenge", id)]
+	if authz == nil {
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown challenge")
+		return
+	}
+
+	challenge := authz.authz.Challenges[0]
+
+	// An empty payload is a POST-as-GET request, an empty object asks the
+	// server to validate the challenge.
+	if len(payload) > 0 && challenge.Status == ChallengeStatusPending {
+		challenge.Status = ChallengeStatusProcessing
+
+		if !s.PendingForever {
+			s.validateChallenge(authz)
+		}
+	}
+
+	w.Header().Set("Retry-After", "1")
+	s.reply(w, http.StatusOK, s.encodeChallenge(challenge))
+}
+
+func (s *fakeACMEServer) validateChallenge(authz *fakeAuthorization) {
+	challenge := authz.authz.Challenges[0]
+	token := challenge.Data.(*ChallengeDataDNS01).Token
+
+	name := dnsChallengeRecordName(authz.authz.Identifier.Value)
+
+	challenge.ValidationRecord = []ValidationRecord{
+		{Hostname: authz.authz.Identifier.Value},
+	}
+
+	for _, key := range s.accounts {
+		data, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			s.t.Fatalf("cannot compute thumbprint: %v", err)
+		}
+		thumbprint := base64.RawURLEncoding.EncodeToString(data)
+
+		value := dnsChallengeRecordValue(token, thumbprint)
+		if slices.Contains(s.DNSProvider.TXTRecords(name), value) {
+			challenge.Status = ChallengeStatusValid
+			authz.authz.Status = AuthorizationStatusValid
+			return
+		}
+	}
+
+	challenge.Status = ChallengeStatusInvalid
+	challenge.Error = &ProblemDetails{
+		Type:   ErrorTypeIncorrectResponse,
+		Detail: fmt.Sprintf("no valid TXT record found for %q", name),
+	}
+	authz.authz.Status = AuthorizationStatusInvalid
+}
+
+func (s *fakeACMEServer) handleFinalize(w http.ResponseWriter, id string, payload []byte) {
+	order := s.orders[s.uri("order", id)]
+	if order == nil {
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown order")
+		return
+	}
+
+	if order.order.Status != OrderStatusReady {
+		s.replyError(w, http.StatusForbidden, ErrorTypeOrderNotReady,
+			"order not ready")
+		return
+	}
+
+	var finalization OrderFinalization
+	if err := json.Unmarshal(payload, &finalization); err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeMalformed,
+			"invalid payload")
+		return
+	}
+
+	csrData, err := base64.RawURLEncoding.DecodeString(finalization.CSR)
+	if err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeBadCSR,
+			"invalid CSR encoding")
+		return
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrData)
+	if err != nil {
+		s.replyError(w, http.StatusBadRequest, ErrorTypeBadCSR,
+			"invalid CSR")
+		return
+	}
+
+	notBefore := time.Now()
+	if order.order.NotBefore != nil {
+		notBefore = *order.order.NotBefore
+	}
+
+	notAfter := notBefore.AddDate(0, 0, 90)
+	if s.DefaultValidity > 0 {
+		notAfter = notBefore.Add(s.DefaultValidity)
+	}
+	if order.order.NotAfter != nil {
+		notAfter = *order.order.NotAfter
+	}
+
+	notBefore = notBefore.Add(s.ClockOffset)
+	notAfter = notAfter.Add(s.ClockOffset)
+
+	s.nextId++
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.nextId)),
+		DNSNames:     csr.DNSNames,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, &template,
+		s.caCertificate, csr.PublicKey, s.caKey)
+	if err != nil {
+		s.t.Fatalf("cannot create certificate: %v", err)
+	}
+
+	certificateURI := s.newURI("certificate")
+	s.certificates[certificateURI] = data
+
+	order.order.Status = OrderStatusValid
+	order.order.Certificate = &certificateURI
+
+	s.reply(w, http.StatusOK, &order.order)
+}
+
+func (s *fakeACMEServer) handleCertificate(w http.ResponseWriter, id string) {
+	data := s.certificates[s.uri("certificate", id)]
+	if data == nil {
+		s.replyError(w, http.StatusNotFound, ErrorTypeMalformed,
+			"unknown certificate")
+		return
+	}
+
+	if s.DERCertificates {
+		w.Header().Set("Link", "<"+s.uri("issuer", "1")+`>;rel="up"`)
+		w.Header().Set("Content-Type", "application/pkix-cert")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: data})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: s.caCertificate.Raw})...)
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chain)
+}
+
+func (s *fakeACMEServer) handleIssuer(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/pkix-cert")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.caCertificate.Raw)
+}
+
+func (s *fakeACMEServer) directory() *Directory {
+	return &Directory{
+		NewNonce:   s.server.URL + "/new-nonce" + s.EndpointSuffix,
+		NewAccount: s.server.URL + "/new-account" + s.EndpointSuffix,
+		NewOrder:   s.server.URL + "/new-order" + s.EndpointSuffix,
+		RevokeCert: s.server.URL + "/revoke-cert" + s.EndpointSuffix,
+		KeyChange:  s.server.URL + "/key-change" + s.EndpointSuffix,
+
+		Meta: DirectoryMetadata{
+			CAAIdentities:           s.CAAIdentities,
+			ExternalAccountRequired: s.ExternalAccountRequired,
+		},
+	}
+}
+
+func (s *fakeACMEServer) newNonce() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+
+	nonce := base64.RawURLEncoding.EncodeToString(data)
+	s.nonces[nonce] = struct{}{}
+
+	return nonce
+}
+
+func (s *fakeACMEServer) newURI(endpoint string) string {
+	s.nextId++
+	return s.uri(endpoint, fmt.Sprintf("%d", s.nextId))
+}
+
+func (s *fakeACMEServer) uri(endpoint, id string) string {
+	return s.server.URL + "/" + endpoint + "/" + id
+}
+
+func (s *fakeACMEServer) encodeAuthorization(authz *fakeAuthorization) json.RawMessage {
+	challenges := make([]json.RawMessage, len(authz.authz.Challenges))
+	for i, c := range authz.authz.Challenges {
+		challenges[i] = s.encodeChallenge(c)
+	}
+
+	value := struct {
+		Identifier Identifier          `json:"identifier"`
+		Status     AuthorizationStatus `json:"status"`
+		Challenges []json.RawMessage   `json:"challenges"`
+	}{
+		Identifier: authz.authz.Identifier,
+		Status:     authz.authz.Status,
+		Challenges: challenges,
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.t.Fatalf("cannot encode authorization: %v", err)
+	}
+
+	return data
+}
+
+func (s *fakeACMEServer) encodeChallenge(c *Challenge) json.RawMessage {
+	// Challenge data are not part of the JSON representation of challenges
+	// used by the client, we have to add the token ourselves.
+	value := struct {
+		*Challenge
+		Token string `json:"token"`
+	}{
+		Challenge: c,
+		Token:     c.Data.(*ChallengeDataDNS01).Token,
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.t.Fatalf("cannot encode challenge: %v", err)
+	}
+
+	return data
+}
+
+func (s *fakeACMEServer) reply(w http.ResponseWriter, status int, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.t.Fatalf("cannot encode response: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *fakeACMEServer) replyError(w http.ResponseWriter, status int, errType ErrorType, detail string) {
+	s.replyProblem(w, &ProblemDetails{
+		Type:   errType,
+		Status: status,
+		Detail: detail,
+	})
+}
+
+func (s *fakeACMEServer) replyProblem(w http.ResponseWriter, details *ProblemDetails) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		s.t.Fatalf("cannot encode problem details: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(details.Status)
+	w.Write(data)
+}
+
+func (p *fakeDNSProvider) SetTXTRecord(ctx context.Context, name, value string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.IgnoredCreations > 0 {
+		p.IgnoredCreations--
+		return nil
+	}
+
+	p.records[name] = append(p.records[name], value)
+
+	return nil
+}
+
+func (p *fakeDNSProvider) DeleteTXTRecord(ctx context.Context, name, value string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.IgnoredDeletions > 0 {
+		p.IgnoredDeletions--
+		return nil
+	}
+
+	p.records[name] = slices.DeleteFunc(p.records[name],
+		func(v string) bool { return v == value })
+
+	return nil
+}
+
+func (p *fakeDNSProvider) ListTXTRecords(ctx context.Context, name string) ([]string, error) {
+	return p.TXTRecords(name), nil
+}
+
+func (p *fakeDNSProvider) TXTRecords(name string) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return slices.Clone(p.records[name])
+}
+
+func withFakeTestClient(t *testing.T, s *fakeACMEServer, fn func(c *Client)) {
+	withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {}, fn)
+}
+
+func withFakeTestClientCfg(t *testing.T, s *fakeACMEServer, setup func(*ClientCfg), fn func(c *Client)) {
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("cannot create data store: %v", err)
+	}
+
+	dnsChallengeSolver := DNSChallengeSolverCfg{
+		Provider: s.DNSProvider,
+	}
+
+	clientCfg := ClientCfg{
+		HTTPClient:         s.server.Client(),
+		DataStore:          dataStore,
+		DirectoryURI:       s.DirectoryURI(),
+		DNSChallengeSolver: &dnsChallengeSolver,
+
+		// The fake server asks clients to poll again immediately
+		MinPollDelay: time.Millisecond,
+	}
+
+	setup(&clientCfg)
+
+	client, err := NewClient(clientCfg)
+	if err != nil {
+		t.Fatalf("cannot create client: %v", err)
+	}
+
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("cannot start client: %v", err)
+	}
+
+	defer client.Stop()
+
+	fn(client)
+}
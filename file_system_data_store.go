@@ -7,11 +7,19 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type FileSystemDataStore struct {
-	rootPath    string
-	accountPath string
+	rootPath        string
+	accountPath     string
+	issuanceLogPath string
+
+	orderLogMutex    sync.Mutex
+	issuanceLogMutex sync.Mutex
 }
 
 func NewFileSystemDataStore(rootPath string) (*FileSystemDataStore, error) {
@@ -20,13 +28,62 @@ func NewFileSystemDataStore(rootPath string) (*FileSystemDataStore, error) {
 	}
 
 	s := FileSystemDataStore{
-		rootPath:    rootPath,
-		accountPath: path.Join(rootPath, "account.json"),
+		rootPath:        rootPath,
+		accountPath:     path.Join(rootPath, "account.json"),
+		issuanceLogPath: path.Join(rootPath, "issuance-log.json"),
+	}
+
+	if err := s.deleteOrphanedTemporaryFiles(); err != nil {
+		return nil, err
 	}
 
 	return &s, nil
 }
 
+// Temporary files are left behind if the process is interrupted while
+// storing a file. Recent files are kept since they may be in use by another
+// process using the same data store.
+func (s *FileSystemDataStore) deleteOrphanedTemporaryFiles() error {
+	dirPaths := []string{
+		s.rootPath,
+		path.Join(s.rootPath, "certificates"),
+		path.Join(s.rootPath, "order-logs"),
+	}
+
+	now := time.Now()
+
+	for _, dirPath := range dirPaths {
+		entries, err := os.ReadDir(dirPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			return fmt.Errorf("cannot read directory %q: %w", dirPath, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() ||
+				!strings.HasSuffix(entry.Name(), ".tmp") {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil || now.Sub(info.ModTime()) < time.Minute {
+				continue
+			}
+
+			filePath := path.Join(dirPath, entry.Name())
+			if err := os.Remove(filePath); err != nil &&
+				!errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("cannot delete %q: %w", filePath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (s *FileSystemDataStore) LoadAccountData() (*AccountData, error) {
 	var data AccountData
 	if err := s.loadJSONFile(s.accountPath, &data); err != nil {
@@ -40,19 +97,67 @@ func (s *FileSystemDataStore) LoadAccountData() (*AccountData, error) {
 	return &data, nil
 }
 
+func (s *FileSystemDataStore) CertificateNames() ([]string, error) {
+	dirPath := path.Join(s.rootPath, "certificates")
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("cannot read directory %q: %w", dirPath, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if name, found := strings.CutSuffix(entry.Name(), ".json"); found {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
 func (s *FileSystemDataStore) LoadCertificateData(name string) (*CertificateData, error) {
-	var data CertificateData
-	if err := s.loadJSONFile(s.certificatePath(name), &data); err != nil {
+	filePath := s.certificatePath(name)
+
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return nil, ErrCertificateNotFound
 		}
 
-		return nil, err
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	var data CertificateData
+	if err := json.Unmarshal(fileData, &data); err != nil {
+		return nil, fmt.Errorf("%w: cannot decode %q: %w",
+			ErrCorruptedCertificateData, filePath, err)
 	}
 
 	return &data, nil
 }
 
+// QuarantineCertificateData renames the file containing certificate data so
+// that it is not loaded anymore but can still be inspected.
+func (s *FileSystemDataStore) QuarantineCertificateData(name string) error {
+	filePath := s.certificatePath(name)
+	newPath := filePath + ".corrupted-" +
+		time.Now().UTC().Format("20060102T150405Z")
+
+	if err := os.Rename(filePath, newPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrCertificateNotFound
+		}
+
+		return fmt.Errorf("cannot rename %q to %q: %w", filePath, newPath, err)
+	}
+
+	return nil
+}
+
 func (s *FileSystemDataStore) StoreAccountData(data *AccountData) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -71,10 +176,121 @@ func (s *FileSystemDataStore) StoreCertificateData(data *CertificateData) error
 	return s.storeFile(s.certificatePath(data.Name), jsonData)
 }
 
+func (s *FileSystemDataStore) DeleteCertificateData(name string) error {
+	filePath := s.certificatePath(name)
+
+	err := os.Remove(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete %q: %w", filePath, err)
+	}
+
+	// The order log is deleted even if the certificate does not exist
+	// anymore so that logs left by older versions can be removed.
+	if err := s.deleteOrderLog(name); err != nil {
+		return err
+	}
+
+	if err != nil {
+		return ErrCertificateNotFound
+	}
+
+	return nil
+}
+
+func (s *FileSystemDataStore) LoadOrderLog(name string) ([]*OrderLogEntry, error) {
+	var entries []*OrderLogEntry
+	if err := s.loadJSONFile(s.orderLogPath(name), &entries); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *FileSystemDataStore) deleteOrderLog(name string) error {
+	s.orderLogMutex.Lock()
+	defer s.orderLogMutex.Unlock()
+
+	filePath := s.orderLogPath(name)
+
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete %q: %w", filePath, err)
+	}
+
+	return nil
+}
+
+func (s *FileSystemDataStore) AppendOrderLogEntry(name string, entry *OrderLogEntry) error {
+	s.orderLogMutex.Lock()
+	defer s.orderLogMutex.Unlock()
+
+	entries, err := s.LoadOrderLog(name)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > MaxOrderLogEntries {
+		entries = entries[len(entries)-MaxOrderLogEntries:]
+	}
+
+	jsonData, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("cannot encode order log: %w", err)
+	}
+
+	return s.storeFile(s.orderLogPath(name), jsonData)
+}
+
+func (s *FileSystemDataStore) LoadIssuanceLog() ([]*IssuanceLogEntry, error) {
+	var entries []*IssuanceLogEntry
+	if err := s.loadJSONFile(s.issuanceLogPath, &entries); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *FileSystemDataStore) AppendIssuanceLogEntry(entry *IssuanceLogEntry) error {
+	s.issuanceLogMutex.Lock()
+	defer s.issuanceLogMutex.Unlock()
+
+	entries, err := s.LoadIssuanceLog()
+	if err != nil {
+		return err
+	}
+
+	minTime := entry.Time.Add(-IssuanceLogRetention)
+
+	entries = slices.DeleteFunc(entries, func(e *IssuanceLogEntry) bool {
+		return e.Time.Before(minTime)
+	})
+
+	entries = append(entries, entry)
+
+	jsonData, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("cannot encode issuance log: %w", err)
+	}
+
+	return s.storeFile(s.issuanceLogPath, jsonData)
+}
+
 func (s *FileSystemDataStore) certificatePath(name string) string {
 	return path.Join(s.rootPath, "certificates", name+".json")
 }
 
+func (s *FileSystemDataStore) orderLogPath(name string) string {
+	return path.Join(s.rootPath, "order-logs", name+".json")
+}
+
 func (s *FileSystemDataStore) loadFile(filePath string) ([]byte, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -105,13 +321,45 @@ func (s *FileSystemDataStore) storeFile(filePath string, data []byte) error {
 		return fmt.Errorf("cannot create directory %q: %w", dirPath, err)
 	}
 
-	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
-		return fmt.Errorf("cannot write %q: %w", tmpPath, err)
+	// Without synchronization, the rename can reach the disk before the
+	// content of the file, leaving an empty or truncated file after a power
+	// loss.
+	if err := writeFileSync(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
 	}
 
 	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("cannot rename %q to %q: %w", tmpPath, filePath, err)
 	}
 
+	if err := syncDirectory(dirPath); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeFileSync(filePath string, data []byte, mode os.FileMode) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", filePath, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("cannot write %q: %w", filePath, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("cannot synchronize %q: %w", filePath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("cannot close %q: %w", filePath, err)
+	}
+
 	return nil
 }
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package acme
+
+import (
+	"fmt"
+	"os"
+)
+
+// syncDirectory makes sure that changes to the entries of a directory, e.g.
+// the rename of a file, are written to disk.
+func syncDirectory(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", dirPath, err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("cannot synchronize %q: %w", dirPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package acme
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSystemDataStoreTemporaryFiles(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	rootPath := t.TempDir()
+
+	s, err := NewFileSystemDataStore(rootPath)
+	require.NoError(err)
+
+	certData := testCertificateData(t)
+	require.NoError(s.StoreCertificateData(certData))
+
+	certPath := s.certificatePath(certData.Name)
+	oldTmpPath := certPath + ".tmp"
+	newTmpPath := path.Join(rootPath, "account.json.tmp")
+
+	require.NoError(os.WriteFile(oldTmpPath, []byte(`{"na`), 0600))
+	require.NoError(os.WriteFile(newTmpPath, []byte(`{"na`), 0600))
+
+	oldTime := time.Now().Add(-time.Hour)
+	require.NoError(os.Chtimes(oldTmpPath, oldTime, oldTime))
+
+	s, err = NewFileSystemDataStore(rootPath)
+	require.NoError(err)
+
+	assert.NoFileExists(oldTmpPath)
+	assert.FileExists(newTmpPath)
+
+	certData2, err := s.LoadCertificateData(certData.Name)
+	require.NoError(err)
+	assert.NoError(certData2.Verify())
+}
+
+func TestFileSystemDataStoreOrderLog(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	certData := testCertificateData(t)
+	require.NoError(s.StoreCertificateData(certData))
+
+	entries, err := s.LoadOrderLog(certData.Name)
+	require.NoError(err)
+	assert.Empty(entries)
+
+	// Old entries are discarded once the log is full
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i := range MaxOrderLogEntries + 10 {
+		entry := OrderLogEntry{
+			Time:    now.Add(time.Duration(i) * time.Second),
+			Event:   OrderLogEventOrderSubmitted,
+			Message: strconv.Itoa(i),
+		}
+
+		require.NoError(s.AppendOrderLogEntry(certData.Name, &entry))
+	}
+
+	entries, err = s.LoadOrderLog(certData.Name)
+	require.NoError(err)
+	require.Len(entries, MaxOrderLogEntries)
+	assert.Equal("10", entries[0].Message)
+	assert.Equal(strconv.Itoa(MaxOrderLogEntries+9),
+		entries[len(entries)-1].Message)
+
+	// The log is deleted with the certificate
+	logPath := s.orderLogPath(certData.Name)
+	assert.FileExists(logPath)
+
+	require.NoError(s.DeleteCertificateData(certData.Name))
+	assert.NoFileExists(logPath)
+
+	entries, err = s.LoadOrderLog(certData.Name)
+	require.NoError(err)
+	assert.Empty(entries)
+
+	// Logs left without a certificate are deleted too
+	require.NoError(s.AppendOrderLogEntry(certData.Name,
+		&OrderLogEntry{Time: now, Event: OrderLogEventOrderFailed}))
+
+	err = s.DeleteCertificateData(certData.Name)
+	assert.ErrorIs(err, ErrCertificateNotFound)
+	assert.NoFileExists(logPath)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package acme
+
+// Directories cannot be synchronized on Windows; NTFS journals metadata
+// changes such as renames.
+func syncDirectory(dirPath string) error {
+	return nil
+}
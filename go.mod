@@ -9,16 +9,17 @@ require (
 	github.com/stretchr/testify v1.9.0
 	go.n16f.net/log v0.0.0-20240820155337-9eef10dcf842
 	go.n16f.net/program v0.0.0-20241014083959-8f6b1ea62841
+	golang.org/x/crypto v0.29.0
 	golang.org/x/net v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.4.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/crypto v0.29.0 // indirect
 	golang.org/x/exp v0.0.0-20241108190413-2d47ceb2692f // indirect
 	golang.org/x/sys v0.27.0 // indirect
 	golang.org/x/term v0.26.0 // indirect
 	golang.org/x/text v0.20.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,7 @@
+package acme
+
+const (
+	// Google Trust Services requires external account binding.
+	GoogleDirectoryURI        = "https://dv.acme-v02.api.pki.goog/directory"
+	GoogleStagingDirectoryURI = "https://dv.acme-v02.test-api.pki.goog/directory"
+)
@@ -0,0 +1,83 @@
+package acme
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+type identifierMatch int
+
+const (
+	identifierMatchNone identifierMatch = iota
+	identifierMatchExact
+	identifierMatchWildcard
+)
+
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+
+	host, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(host), nil
+}
+
+// normalizeHostPattern normalizes a host name which can start with a "*."
+// wildcard label.
+func normalizeHostPattern(pattern string) (string, error) {
+	host, wildcard := strings.CutPrefix(pattern, "*.")
+
+	host, err := normalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		return "", errors.New("empty host name")
+	}
+
+	if wildcard {
+		host = "*." + host
+	}
+
+	return host, nil
+}
+
+// matchIdentifier compares an identifier with a host normalized with
+// normalizeHost.
+func matchIdentifier(id Identifier, host string) identifierMatch {
+	if id.Type != IdentifierTypeDNS {
+		return identifierMatchNone
+	}
+
+	// RFC 6125 6.4.3. Checking of Wildcard Certificates: the wildcard only
+	// matches a single, complete, leftmost label.
+	if suffix, found := strings.CutPrefix(id.Value, "*."); found {
+		suffix, err := normalizeHost(suffix)
+		if err != nil {
+			return identifierMatchNone
+		}
+
+		label, rest, found := strings.Cut(host, ".")
+		if found && label != "" && rest == suffix {
+			return identifierMatchWildcard
+		}
+
+		return identifierMatchNone
+	}
+
+	value, err := normalizeHost(id.Value)
+	if err != nil {
+		return identifierMatchNone
+	}
+
+	if value == host {
+		return identifierMatchExact
+	}
+
+	return identifierMatchNone
+}
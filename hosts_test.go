@@ -0,0 +1,30 @@
+package acme
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchIdentifier(t *testing.T) {
+	assert := assert.New(t)
+
+	match := func(value, host string) identifierMatch {
+		host, err := normalizeHost(host)
+		if err != nil {
+			t.Fatalf("cannot normalize %q: %v", host, err)
+		}
+
+		return matchIdentifier(DNSIdentifier(value), host)
+	}
+
+	assert.Equal(identifierMatchExact, match("example.com", "example.com"))
+	assert.Equal(identifierMatchExact, match("example.com", "EXAMPLE.com."))
+	assert.Equal(identifierMatchExact, match("bücher.example", "xn--bcher-kva.example"))
+
+	assert.Equal(identifierMatchWildcard, match("*.example.com", "www.example.com"))
+	assert.Equal(identifierMatchNone, match("*.example.com", "example.com"))
+	assert.Equal(identifierMatchNone, match("*.example.com", "a.b.example.com"))
+
+	assert.Equal(identifierMatchNone, match("example.com", "example.org"))
+}
@@ -3,12 +3,16 @@ package acme
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,12 +21,54 @@ import (
 	"go.n16f.net/log"
 )
 
+const (
+	DefaultUpstreamDialTimeout  = 5 * time.Second
+	DefaultUpstreamDialAttempts = 3
+	DefaultUpstreamRetryDelay   = 10 * time.Second
+
+	// Orders usually expire after a couple hours at most. Tokens of orders
+	// without expiration date are not supposed to outlive them.
+	DefaultHTTPChallengeTokenTTL = 24 * time.Hour
+)
+
+var errUpstreamUnavailable = errors.New("upstream server unavailable")
+
 type HTTPChallengeSolverCfg struct {
 	Log               *log.Logger `json:"-"`
 	AccountThumbprint string      `json:"-"`
 
 	Address     string `json:"address"`
 	UpstreamURI string `json:"upstream_uri,omitempty"`
+
+	// Connections to the upstream server are attempted UpstreamDialAttempts
+	// times. If all attempts fail, requests are answered with a 502 status
+	// without contacting the upstream server for UpstreamRetryDelay.
+	UpstreamDialTimeout  time.Duration `json:"upstream_dial_timeout,omitempty"`
+	UpstreamDialAttempts int           `json:"upstream_dial_attempts,omitempty"`
+	UpstreamRetryDelay   time.Duration `json:"upstream_retry_delay,omitempty"`
+
+	// If set, only requests whose Host header field matches one of these
+	// hosts are answered or forwarded upstream; others are rejected with a
+	// 421 status. Hosts can contain a leading "*." wildcard label.
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+
+	// If set, the solver does not start its own HTTP server; challenge
+	// requests must be routed to the handler returned by Handler().
+	NoServer bool `json:"no_server,omitempty"`
+
+	// The address (host[:port]) at which ACME servers reach the solver, used
+	// by Healthy(). Defaults to the listening address, with an unspecified
+	// host replaced by the loopback address.
+	PublicAddress string `json:"public_address,omitempty"`
+
+	// If set, the solver only listens while it has challenge tokens to
+	// answer, so that the port can be shared with another server which
+	// binds lazily or can be paused. AcquirePort is called before listening
+	// (e.g. to pause the other server) and ReleasePort once the listener has
+	// been closed.
+	ListenOnDemand bool         `json:"listen_on_demand,omitempty"`
+	AcquirePort    func() error `json:"-"`
+	ReleasePort    func()       `json:"-"`
 }
 
 type HTTPChallengeSolver struct {
@@ -30,24 +76,115 @@ type HTTPChallengeSolver struct {
 	Log *log.Logger
 
 	httpServer        *http.Server
+	httpServerMutex   sync.Mutex
 	accountThumbprint string
-	challenges        map[string]struct{}
+	challenges        map[string]*HTTPChallengeToken
 	challengesMutex   sync.Mutex
 
-	upstreamURI    *url.URL
-	upstreamConn   net.Conn
-	upstreamReader *bufio.Reader
-	upstreamMutex  sync.Mutex
+	upstreamURI          *url.URL
+	upstreamConn         net.Conn
+	upstreamReader       *bufio.Reader
+	upstreamDisableTime  time.Time
+	upstreamDisableCause error
+	upstreamMutex        sync.Mutex
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type HTTPChallengeToken struct {
+	Token    string    `json:"token"`
+	Expires  time.Time `json:"expires"`
+	Requests int       `json:"requests"`
+}
+
+// Usually we default to localhost for default server addresses, but the very
+// point of the HTTP challenge solver is to be available from an external ACME
+// server.
+const defaultHTTPChallengeSolverAddress = "0.0.0.0:80"
+
+// Validate returns ValidationErrors if the configuration is invalid. Values
+// which have not been set are considered to have their default value.
+func (cfg *HTTPChallengeSolverCfg) Validate() error {
+	var v validator
+
+	if !cfg.NoServer {
+		address := cfg.Address
+		if address == "" {
+			address = defaultHTTPChallengeSolverAddress
+		}
+
+		v.checkListenAddress("Address", address)
+	}
+
+	if cfg.UpstreamURI != "" {
+		if _, err := url.Parse(cfg.UpstreamURI); err != nil {
+			v.add("UpstreamURI", "%v", err)
+		}
+	}
+
+	if cfg.UpstreamDialTimeout < 0 {
+		v.add("UpstreamDialTimeout", "invalid negative timeout")
+	}
+
+	if cfg.UpstreamDialAttempts < 0 {
+		v.add("UpstreamDialAttempts", "invalid negative number of attempts")
+	}
+
+	if cfg.UpstreamRetryDelay < 0 {
+		v.add("UpstreamRetryDelay", "invalid negative delay")
+	}
+
+	for i, host := range cfg.AllowedHosts {
+		if _, err := normalizeHostPattern(host); err != nil {
+			v.add(fmt.Sprintf("AllowedHosts[%d]", i), "invalid host %q: %v",
+				host, err)
+		}
+	}
+
+	if cfg.ListenOnDemand && cfg.NoServer {
+		v.add("ListenOnDemand", "on demand listening cannot be used without "+
+			"server")
+	}
+
+	if (cfg.AcquirePort != nil || cfg.ReleasePort != nil) &&
+		!cfg.ListenOnDemand {
+		v.add("ListenOnDemand", "port acquisition functions require on "+
+			"demand listening")
+	}
 
-	wg sync.WaitGroup
+	return v.err()
 }
 
 func NewHTTPChallengeSolver(cfg HTTPChallengeSolverCfg) (*HTTPChallengeSolver, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	if cfg.Address == "" {
-		// Usually we default to localhost for default server addresses, but the
-		// very point of the HTTP challenge solver is to be available from an
-		// external ACME server.
-		cfg.Address = "0.0.0.0:80"
+		cfg.Address = defaultHTTPChallengeSolverAddress
+	}
+
+	if cfg.UpstreamDialTimeout == 0 {
+		cfg.UpstreamDialTimeout = DefaultUpstreamDialTimeout
+	}
+
+	if cfg.UpstreamDialAttempts == 0 {
+		cfg.UpstreamDialAttempts = DefaultUpstreamDialAttempts
+	}
+
+	if cfg.UpstreamRetryDelay == 0 {
+		cfg.UpstreamRetryDelay = DefaultUpstreamRetryDelay
+	}
+
+	if len(cfg.AllowedHosts) > 0 {
+		// Checked with the configuration
+		allowedHosts := make([]string, len(cfg.AllowedHosts))
+		for i, host := range cfg.AllowedHosts {
+			allowedHosts[i], _ = normalizeHostPattern(host)
+		}
+		cfg.AllowedHosts = allowedHosts
 	}
 
 	logger := cfg.Log.Child("http_solver", nil)
@@ -56,16 +193,9 @@ func NewHTTPChallengeSolver(cfg HTTPChallengeSolverCfg) (*HTTPChallengeSolver, e
 		Cfg: cfg,
 		Log: logger,
 
-		challenges: make(map[string]struct{}),
-	}
-
-	s.httpServer = &http.Server{
-		Addr:     cfg.Address,
-		Handler:  &s,
-		ErrorLog: logger.StdLogger(log.LevelError),
+		challenges: make(map[string]*HTTPChallengeToken),
 
-		ReadHeaderTimeout: 5 * time.Second,
-		IdleTimeout:       10 * time.Second,
+		stopChan: make(chan struct{}),
 	}
 
 	if cfg.UpstreamURI != "" {
@@ -92,7 +222,53 @@ func NewHTTPChallengeSolver(cfg HTTPChallengeSolverCfg) (*HTTPChallengeSolver, e
 func (s *HTTPChallengeSolver) Start(accountThumbprint string) error {
 	s.accountThumbprint = accountThumbprint
 
-	s.Log.Info("forwarding non-ACME HTTP requests to %q", s.Cfg.UpstreamURI)
+	s.wg.Add(1)
+	go s.discardExpiredTokens()
+
+	if s.Cfg.NoServer || s.Cfg.ListenOnDemand {
+		return nil
+	}
+
+	s.httpServerMutex.Lock()
+	defer s.httpServerMutex.Unlock()
+
+	return s.listen()
+}
+
+// Stop can be called multiple times; calls after the first one do nothing.
+func (s *HTTPChallengeSolver) Stop() {
+	s.stopOnce.Do(s.stop)
+}
+
+func (s *HTTPChallengeSolver) stop() {
+	close(s.stopChan)
+
+	s.httpServerMutex.Lock()
+	if s.httpServer != nil {
+		s.shutdown()
+
+		if s.Cfg.ListenOnDemand && s.Cfg.ReleasePort != nil {
+			s.Cfg.ReleasePort()
+		}
+	}
+	s.httpServerMutex.Unlock()
+
+	s.wg.Wait()
+
+	s.upstreamMutex.Lock()
+	if s.upstreamConn != nil {
+		s.upstreamConn.Close()
+		s.upstreamConn = nil
+	}
+	s.upstreamMutex.Unlock()
+}
+
+// Must be called with s.httpServerMutex locked.
+func (s *HTTPChallengeSolver) listen() error {
+	if s.Cfg.UpstreamURI != "" {
+		s.Log.Info("forwarding non-ACME HTTP requests to %q",
+			s.Cfg.UpstreamURI)
+	}
 
 	listener, err := net.Listen("tcp", s.Cfg.Address)
 	if err != nil {
@@ -101,11 +277,23 @@ func (s *HTTPChallengeSolver) Start(accountThumbprint string) error {
 
 	s.Log.Info("HTTP challenge solver listening on %q", s.Cfg.Address)
 
+	// A server cannot be used again once shut down
+	server := &http.Server{
+		Addr:     s.Cfg.Address,
+		Handler:  s,
+		ErrorLog: s.Log.StdLogger(log.LevelError),
+
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       10 * time.Second,
+	}
+
+	s.httpServer = server
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 
-		if err := s.httpServer.Serve(listener); err != nil {
+		if err := server.Serve(listener); err != nil {
 			if err != http.ErrServerClosed {
 				s.Log.Error("HTTP server error: %v", err)
 			}
@@ -115,7 +303,8 @@ func (s *HTTPChallengeSolver) Start(accountThumbprint string) error {
 	return nil
 }
 
-func (s *HTTPChallengeSolver) Stop() {
+// Must be called with s.httpServerMutex locked.
+func (s *HTTPChallengeSolver) shutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
@@ -123,17 +312,119 @@ func (s *HTTPChallengeSolver) Stop() {
 		s.Log.Error("cannot shutdown server: %v", err)
 	}
 
-	s.wg.Wait()
+	s.httpServer = nil
+}
 
-	s.upstreamMutex.Lock()
-	if s.upstreamConn != nil {
-		s.upstreamConn.Close()
-		s.upstreamConn = nil
+// updateListener starts listening when the first token is added and stops
+// when the last one is discarded if ListenOnDemand is set.
+func (s *HTTPChallengeSolver) updateListener() error {
+	if !s.Cfg.ListenOnDemand {
+		return nil
 	}
-	s.upstreamMutex.Unlock()
+
+	s.httpServerMutex.Lock()
+	defer s.httpServerMutex.Unlock()
+
+	select {
+	case <-s.stopChan:
+		return nil
+	default:
+	}
+
+	s.challengesMutex.Lock()
+	nbTokens := len(s.challenges)
+	s.challengesMutex.Unlock()
+
+	switch {
+	case nbTokens > 0 && s.httpServer == nil:
+		if s.Cfg.AcquirePort != nil {
+			if err := s.Cfg.AcquirePort(); err != nil {
+				return fmt.Errorf("cannot acquire port: %w", err)
+			}
+		}
+
+		if err := s.listen(); err != nil {
+			if s.Cfg.ReleasePort != nil {
+				s.Cfg.ReleasePort()
+			}
+
+			return err
+		}
+
+	case nbTokens == 0 && s.httpServer != nil:
+		s.shutdown()
+
+		s.Log.Info("HTTP challenge solver not listening anymore")
+
+		if s.Cfg.ReleasePort != nil {
+			s.Cfg.ReleasePort()
+		}
+	}
+
+	return nil
+}
+
+// Handler returns a HTTP handler answering ACME challenges and forwarding
+// other requests to another handler. If this handler is nil, requests are
+// redirected to HTTPS.
+func (s *HTTPChallengeSolver) Handler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(redirectToHTTPS)
+	}
+
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		token, found := strings.CutPrefix(req.URL.Path,
+			"/.well-known/acme-challenge/")
+		if found {
+			if !s.hostAllowed(req.Host) {
+				w.WriteHeader(http.StatusMisdirectedRequest)
+				return
+			}
+
+			s.hChallenge(w, req, token)
+			return
+		}
+
+		fallback.ServeHTTP(w, req)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func redirectToHTTPS(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		http.Error(w, "Use HTTPS", http.StatusBadRequest)
+		return
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+
+		// IPv6 addresses must stay enclosed in brackets
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+
+	target := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     req.URL.Path,
+		RawQuery: req.URL.RawQuery,
+	}
+
+	http.Redirect(w, req, target.String(), http.StatusFound)
 }
 
 func (s *HTTPChallengeSolver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Without restriction, anyone could use the solver as a relay to reach
+	// any virtual host of the upstream server.
+	if !s.hostAllowed(req.Host) {
+		w.WriteHeader(http.StatusMisdirectedRequest)
+		return
+	}
+
 	token, found := strings.CutPrefix(req.URL.Path,
 		"/.well-known/acme-challenge/")
 	if found {
@@ -150,8 +441,11 @@ func (s *HTTPChallengeSolver) ServeHTTP(w http.ResponseWriter, req *http.Request
 	defer s.upstreamMutex.Unlock()
 
 	if err := s.ensureUpstreamConnection(); err != nil {
-		s.Log.Error("%v", err)
-		w.WriteHeader(500)
+		if !errors.Is(err, errUpstreamUnavailable) {
+			s.Log.Error("%v", err)
+		}
+
+		w.WriteHeader(502)
 		return
 	}
 
@@ -160,7 +454,7 @@ func (s *HTTPChallengeSolver) ServeHTTP(w http.ResponseWriter, req *http.Request
 		s.Log.Error("cannot forward request to upstream server: %v", err)
 		s.upstreamConn.Close()
 		s.upstreamConn = nil
-		w.WriteHeader(500)
+		w.WriteHeader(502)
 		return
 	}
 	defer res.Body.Close()
@@ -176,6 +470,29 @@ func (s *HTTPChallengeSolver) ServeHTTP(w http.ResponseWriter, req *http.Request
 	}
 }
 
+func (s *HTTPChallengeSolver) hostAllowed(host string) bool {
+	if len(s.Cfg.AllowedHosts) == 0 {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host, err := normalizeHost(host)
+	if err != nil {
+		return false
+	}
+
+	for _, allowedHost := range s.Cfg.AllowedHosts {
+		if matchIdentifier(DNSIdentifier(allowedHost), host) != identifierMatchNone {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *HTTPChallengeSolver) sendUpstreamRequest(req *http.Request) (*http.Response, error) {
 	req = req.Clone(context.Background())
 
@@ -219,27 +536,245 @@ func (s *HTTPChallengeSolver) ensureUpstreamConnection() error {
 		return nil
 	}
 
-	conn, err := net.Dial("tcp", s.upstreamURI.Host)
+	// If we recently failed to connect, do not make every single request
+	// wait for connection attempts which are very likely to fail too.
+	if time.Now().Before(s.upstreamDisableTime) {
+		return fmt.Errorf("%w: %w", errUpstreamUnavailable,
+			s.upstreamDisableCause)
+	}
+
+	dialer := net.Dialer{Timeout: s.Cfg.UpstreamDialTimeout}
+
+	var err error
+
+	for i := range s.Cfg.UpstreamDialAttempts {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 100 * time.Millisecond)
+		}
+
+		var conn net.Conn
+		conn, err = dialer.Dial("tcp", s.upstreamURI.Host)
+		if err == nil {
+			s.upstreamConn = conn
+			s.upstreamReader = bufio.NewReader(conn)
+			s.upstreamDisableTime = time.Time{}
+			s.upstreamDisableCause = nil
+			return nil
+		}
+	}
+
+	err = fmt.Errorf("cannot connect to %q: %w", s.upstreamURI.Host, err)
+
+	s.upstreamDisableTime = time.Now().Add(s.Cfg.UpstreamRetryDelay)
+	s.upstreamDisableCause = err
+
+	return err
+}
+
+// Healthy checks that the solver answers challenge requests sent to its public
+// address. It registers a temporary token, fetches it the same way an ACME
+// server would and checks the key authorization returned.
+//
+// With ListenOnDemand, the check is skipped: we do not want to take over the
+// port outside of challenges.
+func (s *HTTPChallengeSolver) Healthy(ctx context.Context) error {
+	if s.Cfg.ListenOnDemand {
+		return nil
+	}
+
+	address, err := s.publicAddress()
+	if err != nil {
+		return err
+	}
+
+	// ACME servers send the identifier being validated, which must be allowed
+	var host string
+	if len(s.Cfg.AllowedHosts) > 0 {
+		host = strings.Replace(s.Cfg.AllowedHosts[0], "*", "health", 1)
+	}
+
+	return s.probe(ctx, address, host)
+}
+
+// probe registers a temporary token, fetches it the same way an ACME server
+// would and checks the key authorization returned. If host is not empty, it
+// is used as Host header field.
+func (s *HTTPChallengeSolver) probe(ctx context.Context, address, host string) error {
+	var tokenData [16]byte
+	if _, err := rand.Read(tokenData[:]); err != nil {
+		return fmt.Errorf("cannot generate random data: %w", err)
+	}
+	token := "health-" + base64.RawURLEncoding.EncodeToString(tokenData[:])
+
+	if err := s.addToken(token, time.Now().Add(time.Minute)); err != nil {
+		return err
+	}
+	defer s.discardToken(token)
+
+	uri := "http://" + address + "/.well-known/acme-challenge/" + token
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	if host != "" {
+		req.Host = host
+	}
+
+	// Do not use the HTTP client of the ACME client: we want a fresh
+	// connection to the public address without any proxy.
+	transport := http.Transport{DisableKeepAlives: true}
+	defer transport.CloseIdleConnections()
+
+	httpClient := http.Client{
+		Transport: &transport,
+		Timeout:   10 * time.Second,
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request to %q: %w", uri, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4096))
 	if err != nil {
-		return fmt.Errorf("cannot connect to %q: %w", s.upstreamURI.Host, err)
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		return fmt.Errorf("request to %q failed with status %d", uri,
+			res.StatusCode)
 	}
 
-	s.upstreamConn = conn
-	s.upstreamReader = bufio.NewReader(conn)
+	s.challengesMutex.Lock()
+	keyAuthorization := token + "." + s.accountThumbprint
+	s.challengesMutex.Unlock()
+
+	if strings.TrimSpace(string(body)) != keyAuthorization {
+		return fmt.Errorf("invalid key authorization returned by %q", uri)
+	}
 
 	return nil
 }
 
-func (s *HTTPChallengeSolver) addToken(token string) {
+func (s *HTTPChallengeSolver) publicAddress() (string, error) {
+	if address := s.Cfg.PublicAddress; address != "" {
+		return address, nil
+	}
+
+	if s.Cfg.NoServer {
+		return "", fmt.Errorf("missing public address")
+	}
+
+	host, port, err := net.SplitHostPort(s.Cfg.Address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", s.Cfg.Address, err)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func (s *HTTPChallengeSolver) setAccountThumbprint(thumbprint string) {
+	s.challengesMutex.Lock()
+	s.accountThumbprint = thumbprint
+	s.challengesMutex.Unlock()
+}
+
+// Tokens returns the tokens currently answered by the solver.
+func (s *HTTPChallengeSolver) Tokens() []HTTPChallengeToken {
+	s.challengesMutex.Lock()
+	defer s.challengesMutex.Unlock()
+
+	tokens := make([]HTTPChallengeToken, 0, len(s.challenges))
+	for _, token := range s.challenges {
+		tokens = append(tokens, *token)
+	}
+
+	slices.SortFunc(tokens, func(t1, t2 HTTPChallengeToken) int {
+		return t1.Expires.Compare(t2.Expires)
+	})
+
+	return tokens
+}
+
+func (s *HTTPChallengeSolver) addToken(token string, expires time.Time) error {
+	if expires.IsZero() {
+		expires = time.Now().Add(DefaultHTTPChallengeTokenTTL)
+	}
+
 	s.challengesMutex.Lock()
-	s.challenges[token] = struct{}{}
+	s.challenges[token] = &HTTPChallengeToken{Token: token, Expires: expires}
 	s.challengesMutex.Unlock()
+
+	if err := s.updateListener(); err != nil {
+		s.discardToken(token)
+		return err
+	}
+
+	return nil
 }
 
 func (s *HTTPChallengeSolver) discardToken(token string) {
 	s.challengesMutex.Lock()
 	delete(s.challenges, token)
 	s.challengesMutex.Unlock()
+
+	s.updateListener()
+}
+
+func (s *HTTPChallengeSolver) tokenRequests(token string) int {
+	s.challengesMutex.Lock()
+	defer s.challengesMutex.Unlock()
+
+	if t := s.challenges[token]; t != nil {
+		return t.Requests
+	}
+
+	return 0
+}
+
+// Tokens are normally discarded when the challenge is torn down, but a
+// worker could fail to do so, e.g. after a panic.
+func (s *HTTPChallengeSolver) discardExpiredTokens() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+
+		case <-ticker.C:
+			s.discardExpiredTokensOnce(time.Now())
+
+			if err := s.updateListener(); err != nil {
+				s.Log.Error("%v", err)
+			}
+		}
+	}
+}
+
+func (s *HTTPChallengeSolver) discardExpiredTokensOnce(now time.Time) {
+	s.challengesMutex.Lock()
+	defer s.challengesMutex.Unlock()
+
+	for token, t := range s.challenges {
+		if now.After(t.Expires) {
+			s.Log.Info("discarding expired challenge token %q", token)
+			delete(s.challenges, token)
+		}
+	}
 }
 
 func (s *HTTPChallengeSolver) hChallenge(w http.ResponseWriter, req *http.Request, token string) {
@@ -262,11 +797,14 @@ func (s *HTTPChallengeSolver) hChallenge(w http.ResponseWriter, req *http.Reques
 	s.challengesMutex.Lock()
 	defer s.challengesMutex.Unlock()
 
-	if _, found := s.challenges[token]; !found {
+	t := s.challenges[token]
+	if t == nil || time.Now().After(t.Expires) {
 		reply(400, "unknown token")
 		return
 	}
 
+	t.Requests++
+
 	// RFC 8555 8.3. HTTP Challenge: "A client fulfills this challenge by
 	// constructing a key authorization from the "token" value provided in the
 	// challenge and the client's account key". Do not ask what format should
@@ -0,0 +1,259 @@
+package acme
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.n16f.net/log"
+)
+
+func TestHTTPChallengeSolverHealthy(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:      log.DefaultLogger("test"),
+		NoServer: true,
+	})
+	require.NoError(err)
+	require.NoError(s.Start("thumbprint"))
+	defer s.Stop()
+
+	assert.Error(s.Healthy(ctx))
+
+	server := httptest.NewServer(s.Handler(nil))
+	defer server.Close()
+
+	s.Cfg.PublicAddress = strings.TrimPrefix(server.URL, "http://")
+	assert.NoError(s.Healthy(ctx))
+
+	// The probe token must not be left behind
+	s.challengesMutex.Lock()
+	assert.Empty(s.challenges)
+	s.challengesMutex.Unlock()
+
+	// Something else answering on the public address
+	otherServer := httptest.NewServer(http.NotFoundHandler())
+	defer otherServer.Close()
+
+	s.Cfg.PublicAddress = strings.TrimPrefix(otherServer.URL, "http://")
+	assert.Error(s.Healthy(ctx))
+}
+
+func TestHTTPChallengeSolverUpstreamUnavailable(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:                 log.DefaultLogger("test"),
+		NoServer:            true,
+		UpstreamURI:         "http://" + address,
+		UpstreamDialTimeout: time.Second,
+		UpstreamRetryDelay:  time.Hour,
+	})
+	require.NoError(err)
+
+	sendRequest := func() int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Code
+	}
+
+	assert.Equal(502, sendRequest())
+	assert.False(s.upstreamDisableTime.IsZero())
+
+	// The upstream server is not contacted again before the retry delay
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	s.upstreamURI.Host = strings.TrimPrefix(server.URL, "http://")
+	assert.Equal(502, sendRequest())
+
+	s.upstreamDisableTime = time.Time{}
+	assert.Equal(200, sendRequest())
+
+	s.Stop()
+}
+
+func TestHTTPChallengeSolverAllowedHosts(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {}))
+	defer upstream.Close()
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:          log.DefaultLogger("test"),
+		NoServer:     true,
+		UpstreamURI:  upstream.URL,
+		AllowedHosts: []string{"Example.com.", "*.EXAMPLE.org"},
+	})
+	require.NoError(err)
+	assert.Equal([]string{"example.com", "*.example.org"},
+		s.Cfg.AllowedHosts)
+	require.NoError(s.Start("thumbprint"))
+	defer s.Stop()
+
+	s.addToken("abc", time.Time{})
+
+	sendRequest := func(host, path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(200, sendRequest("example.com", "/"))
+	assert.Equal(200, sendRequest("Example.COM:80", "/"))
+	assert.Equal(200, sendRequest("www.example.org", "/"))
+	assert.Equal(421, sendRequest("example.org", "/"))
+	assert.Equal(421, sendRequest("example.net", "/"))
+
+	assert.Equal(200, sendRequest("example.com",
+		"/.well-known/acme-challenge/abc"))
+	assert.Equal(421, sendRequest("example.net",
+		"/.well-known/acme-challenge/abc"))
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	s.Cfg.PublicAddress = strings.TrimPrefix(server.URL, "http://")
+	assert.NoError(s.Healthy(context.Background()))
+
+	_, err = NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		NoServer:     true,
+		AllowedHosts: []string{"*."},
+	})
+	assert.Error(err)
+}
+
+func TestHTTPChallengeSolverTokenExpiration(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:      log.DefaultLogger("test"),
+		NoServer: true,
+	})
+	require.NoError(err)
+	require.NoError(s.Start("thumbprint"))
+	defer s.Stop()
+
+	now := time.Now()
+
+	s.addToken("abc", now.Add(-time.Second))
+	s.addToken("def", now.Add(time.Hour))
+
+	sendRequest := func(token string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET",
+			"/.well-known/acme-challenge/"+token, nil))
+		return w.Code
+	}
+
+	assert.Equal(400, sendRequest("abc"))
+	assert.Equal(200, sendRequest("def"))
+
+	s.discardExpiredTokensOnce(now)
+
+	tokens := s.Tokens()
+	require.Len(tokens, 1)
+	assert.Equal("def", tokens[0].Token)
+	assert.Equal(1, tokens[0].Requests)
+}
+
+func TestHTTPChallengeSolverListenOnDemand(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	var events []string
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:            log.DefaultLogger("test"),
+		Address:        address,
+		ListenOnDemand: true,
+		AcquirePort: func() error {
+			events = append(events, "acquire")
+			return nil
+		},
+		ReleasePort: func() {
+			events = append(events, "release")
+		},
+	})
+	require.NoError(err)
+	require.NoError(s.Start("thumbprint"))
+	defer s.Stop()
+
+	fetchToken := func(token string) (int, error) {
+		res, err := http.Get("http://" + address +
+			"/.well-known/acme-challenge/" + token)
+		if err != nil {
+			return 0, err
+		}
+		defer res.Body.Close()
+
+		return res.StatusCode, nil
+	}
+
+	_, err = fetchToken("abc")
+	assert.Error(err)
+
+	require.NoError(s.addToken("abc", time.Time{}))
+	require.NoError(s.addToken("def", time.Time{}))
+
+	status, err := fetchToken("abc")
+	require.NoError(err)
+	assert.Equal(200, status)
+
+	// The port is only released with the last token
+	s.discardToken("abc")
+
+	status, err = fetchToken("def")
+	require.NoError(err)
+	assert.Equal(200, status)
+
+	s.discardToken("def")
+
+	_, err = fetchToken("def")
+	assert.Error(err)
+
+	assert.Equal([]string{"acquire", "release"}, events)
+}
+
+func TestHTTPChallengeSolverStop(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s, err := NewHTTPChallengeSolver(HTTPChallengeSolverCfg{
+		Log:     log.DefaultLogger("test"),
+		Address: "127.0.0.1:0",
+	})
+	require.NoError(err)
+	require.NoError(s.Start("thumbprint"))
+
+	s.Stop()
+	assert.NotPanics(s.Stop)
+}
@@ -0,0 +1,43 @@
+package acme
+
+import (
+	"time"
+)
+
+// The issuance log keeps track of the orders submitted and certificates
+// issued for the account, across all certificates, so that we can evaluate
+// server rate limits locally (see rate_limits.go).
+
+// Entries older than this are removed from the log. Rate limits with a longer
+// period cannot be evaluated.
+const IssuanceLogRetention = 7 * 24 * time.Hour
+
+type IssuanceLogEvent string
+
+const (
+	IssuanceLogEventOrderSubmitted    IssuanceLogEvent = "order_submitted"
+	IssuanceLogEventCertificateIssued IssuanceLogEvent = "certificate_issued"
+)
+
+type IssuanceLogEntry struct {
+	Time        time.Time        `json:"time"`
+	Event       IssuanceLogEvent `json:"event"`
+	Identifiers []Identifier     `json:"identifiers"`
+}
+
+func (c *Client) logIssuanceEvent(event IssuanceLogEvent, ids []Identifier) {
+	store, ok := c.dataStore.(IssuanceLogStore)
+	if !ok {
+		return
+	}
+
+	entry := IssuanceLogEntry{
+		Time:        time.Now(),
+		Event:       event,
+		Identifiers: ids,
+	}
+
+	if err := store.AppendIssuanceLogEntry(&entry); err != nil {
+		c.Log.Error("cannot store issuance log entry: %v", err)
+	}
+}
@@ -1,57 +1,173 @@
 package acme
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rsa"
+	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/go-jose/go-jose/v4"
 )
 
-func (c *Client) signPayload(data []byte, uri, nonce string) ([]byte, error) {
+func (c *Client) signPayload(data []byte, uri, nonce string, accountData *AccountData) ([]byte, error) {
+	signer, err := c.accountJWSSigner(accountData.PrivateKey, accountData.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.sign(data, uri, nonce)
+}
+
+// accountJWSSigner returns the signer used for requests. It is kept until the
+// private key or the URI of the account changes.
+func (c *Client) accountJWSSigner(privateKey crypto.Signer, keyId string) (*jwsSigner, error) {
+	c.jwsSignerMutex.Lock()
+	defer c.jwsSignerMutex.Unlock()
+
+	if s := c.jwsSigner; s != nil && s.privateKey == privateKey &&
+		s.keyId == keyId {
+		return s, nil
+	}
+
+	signer, err := newJWSSigner(privateKey, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	c.jwsSigner = signer
+
+	return signer, nil
+}
+
+func signJWS(data []byte, uri, nonce string, privateKey crypto.Signer, keyId string) ([]byte, error) {
+	signer, err := newJWSSigner(privateKey, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.sign(data, uri, nonce)
+}
+
+// jwsSigner signs requests with a private key and an optional key id. Building
+// a jose.Signer and encoding the public key for the "jwk" header is done once;
+// the "url" and "nonce" headers change for every request and are set in the
+// header map shared with the jose.Signer, which reads it each time it signs
+// an object.
+type jwsSigner struct {
+	privateKey crypto.Signer
+	keyId      string
+
+	signer  jose.Signer
+	headers map[jose.HeaderKey]any
+	mutex   sync.Mutex
+}
+
+func newJWSSigner(privateKey crypto.Signer, keyId string) (*jwsSigner, error) {
 	// RFC 8555 6.2. Request Authentication
 
-	algorithm, err := c.signatureAlgorithm()
+	algorithm, err := signatureAlgorithm(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("cannot identify signature algorithm: %w", err)
 	}
 
-	jwk := jose.JSONWebKey{
-		Key: c.accountData.PrivateKey,
+	s := jwsSigner{
+		privateKey: privateKey,
+		keyId:      keyId,
+
+		headers: make(map[jose.HeaderKey]any),
 	}
 
-	if uri := c.accountData.URI; uri != "" {
-		jwk.KeyID = uri
+	// The "jwk" and "kid" headers are mutually exclusive. We set them
+	// ourselves instead of signing with a jose.JSONWebKey, so that the public
+	// key is not encoded again for each request.
+	if keyId == "" {
+		jwk := jose.JSONWebKey{Key: privateKey.Public()}
+
+		jwkData, err := jwk.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode public key: %w", err)
+		}
+
+		s.headers["jwk"] = json.RawMessage(jwkData)
+	} else {
+		s.headers["kid"] = keyId
 	}
 
 	signingKey := jose.SigningKey{
 		Algorithm: algorithm,
-		Key:       &jwk,
+		Key:       privateKey,
 	}
 
 	options := jose.SignerOptions{
-		NonceSource:  &staticNonceSource{nonce: nonce},
-		ExtraHeaders: make(map[jose.HeaderKey]any),
-	}
-
-	options.ExtraHeaders["url"] = uri
-
-	if jwk.KeyID == "" {
-		options.EmbedJWK = true // set the "jwk" claim
+		ExtraHeaders: s.headers,
 	}
 
-	signer, err := jose.NewSigner(signingKey, &options)
+	s.signer, err = jose.NewSigner(signingKey, &options)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create signer: %w", err)
 	}
 
+	return &s, nil
+}
+
+func (s *jwsSigner) sign(data []byte, uri, nonce string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.headers["url"] = uri
+
+	// Nonces are mandatory for all requests sent to the server, but the
+	// inner JWS of key change requests must not have one (RFC 8555 7.3.5).
+	if nonce == "" {
+		delete(s.headers, "nonce")
+	} else {
+		s.headers["nonce"] = nonce
+	}
+
 	// Go is stupid
 	if data == nil {
 		data = []byte{}
 	}
 
-	signedData, err := signer.Sign(data)
+	signedData, err := s.signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(signedData.FullSerialize()), nil
+}
+
+func signExternalAccountBinding(accountKey crypto.PublicKey, uri, keyId string, hmacKey []byte) ([]byte, error) {
+	// RFC 8555 7.3.4. External Account Binding
+
+	jwk := jose.JSONWebKey{Key: accountKey}
+
+	payload, err := jwk.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode account key: %w", err)
+	}
+
+	signingKey := jose.SigningKey{
+		Algorithm: jose.HS256,
+		Key:       hmacKey,
+	}
+
+	options := jose.SignerOptions{
+		ExtraHeaders: map[jose.HeaderKey]any{
+			"kid": keyId,
+			"url": uri,
+		},
+	}
+
+	signer, err := jose.NewSigner(signingKey, &options)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create signer: %w", err)
+	}
+
+	signedData, err := signer.Sign(payload)
 	if err != nil {
 		return nil, err
 	}
@@ -59,10 +175,10 @@ func (c *Client) signPayload(data []byte, uri, nonce string) ([]byte, error) {
 	return []byte(signedData.FullSerialize()), nil
 }
 
-func (c *Client) signatureAlgorithm() (jose.SignatureAlgorithm, error) {
+func signatureAlgorithm(privateKey crypto.Signer) (jose.SignatureAlgorithm, error) {
 	var algorithm jose.SignatureAlgorithm
 
-	switch key := c.accountData.PrivateKey.(type) {
+	switch key := privateKey.(type) {
 	case *rsa.PrivateKey:
 		algorithm = jose.RS256
 
@@ -85,17 +201,37 @@ func (c *Client) signatureAlgorithm() (jose.SignatureAlgorithm, error) {
 	return algorithm, nil
 }
 
-type staticNonceSource struct {
-	nonce string
-}
+// adaptPrivateKeyType returns the type of private key to use for the first
+// supported algorithm of a list sent by the server in a badSignatureAlgorithm
+// error. It fails if the list contains the algorithm of the current key, so
+// that an inconsistent server cannot cause an infinite loop.
+func adaptPrivateKeyType(privateKey crypto.Signer, algorithms []string) (KeyType, error) {
+	if len(algorithms) == 0 {
+		return "", fmt.Errorf("server did not list supported algorithms")
+	}
+
+	currentAlgorithm, err := signatureAlgorithm(privateKey)
+	if err != nil {
+		return "", err
+	}
 
-func (s *staticNonceSource) Nonce() (string, error) {
-	if s.nonce == "" {
-		return "", fmt.Errorf("nonce already used")
+	for _, algorithm := range algorithms {
+		if jose.SignatureAlgorithm(algorithm) == currentAlgorithm {
+			return "", fmt.Errorf("server listed algorithm %q as supported "+
+				"after rejecting it", algorithm)
+		}
 	}
 
-	nonce := s.nonce
-	s.nonce = ""
+	for _, algorithm := range algorithms {
+		switch jose.SignatureAlgorithm(algorithm) {
+		case jose.ES256:
+			return KeyTypeECDSAP256, nil
+		case jose.ES384:
+			return KeyTypeECDSAP384, nil
+		case jose.RS256:
+			return KeyTypeRSA2048, nil
+		}
+	}
 
-	return nonce, nil
+	return "", fmt.Errorf("no supported algorithm in %q", algorithms)
 }
@@ -0,0 +1,106 @@
+package acme
+
+import (
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWSSigner(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(err)
+
+	algorithms := []jose.SignatureAlgorithm{jose.ES256}
+
+	parse := func(data []byte) jose.Header {
+		jws, err := jose.ParseSigned(string(data), algorithms)
+		require.NoError(err)
+
+		_, err = jws.Verify(privateKey.Public())
+		require.NoError(err)
+
+		return jws.Signatures[0].Protected
+	}
+
+	// Headers specific to each request must not leak into the next one
+	s, err := newJWSSigner(privateKey, "https://acme.example.com/account/42")
+	require.NoError(err)
+
+	data, err := s.sign(nil, "https://acme.example.com/a", "nonce1")
+	require.NoError(err)
+
+	header := parse(data)
+	assert.Equal("https://acme.example.com/account/42", header.KeyID)
+	assert.Nil(header.JSONWebKey)
+	assert.Equal("nonce1", header.Nonce)
+	assert.Equal("https://acme.example.com/a", header.ExtraHeaders["url"])
+
+	data, err = s.sign(nil, "https://acme.example.com/b", "")
+	require.NoError(err)
+
+	header = parse(data)
+	assert.Empty(header.Nonce)
+	assert.Equal("https://acme.example.com/b", header.ExtraHeaders["url"])
+
+	// Without key id, the public key is embedded
+	s, err = newJWSSigner(privateKey, "")
+	require.NoError(err)
+
+	data, err = s.sign([]byte(`{}`), "https://acme.example.com/c", "nonce2")
+	require.NoError(err)
+
+	header = parse(data)
+	assert.Empty(header.KeyID)
+	require.NotNil(header.JSONWebKey)
+	assert.Equal(privateKey.Public(), header.JSONWebKey.Key)
+	assert.Equal("nonce2", header.Nonce)
+}
+
+func BenchmarkSignJWS(b *testing.B) {
+	keyTypes := []KeyType{KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeRSA2048}
+
+	for _, keyType := range keyTypes {
+		privateKey, err := GeneratePrivateKey(keyType)
+		if err != nil {
+			b.Fatalf("cannot generate private key: %v", err)
+		}
+
+		data := []byte(`{"identifiers":[{"type":"dns","value":"example.com"}]}`)
+		uri := "https://acme.example.com/new-order"
+		keyId := "https://acme.example.com/account/42"
+
+		b.Run(string(keyType), func(b *testing.B) {
+			for range b.N {
+				if _, err := signJWS(data, uri, "nonce", privateKey, keyId); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(string(keyType)+"-jwk", func(b *testing.B) {
+			for range b.N {
+				if _, err := signJWS(data, uri, "nonce", privateKey, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(string(keyType)+"-cached", func(b *testing.B) {
+			s, err := newJWSSigner(privateKey, "")
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for range b.N {
+				if _, err := s.sign(data, uri, "nonce"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
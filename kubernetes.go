@@ -0,0 +1,366 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A minimal Kubernetes API client, so that we do not depend on client-go for
+// the handful of requests we need.
+
+const (
+	kubernetesServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+type KubernetesCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// The URI of the API server, e.g. "https://10.0.0.1:6443".
+	APIServerURI string `json:"api_server_uri"`
+
+	// A bearer token; not required if the HTTP client authenticates with a
+	// client certificate.
+	Token SecretSource `json:"-"`
+}
+
+type KubernetesClient struct {
+	Cfg KubernetesCfg
+}
+
+type kubernetesStatus struct {
+	Kind    string `json:"kind"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Code    int    `json:"code"`
+}
+
+func NewKubernetesClient(cfg KubernetesCfg) (*KubernetesClient, error) {
+	if cfg.APIServerURI == "" {
+		return nil, fmt.Errorf("missing API server URI")
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = NewHTTPClient(nil)
+	}
+
+	c := KubernetesClient{
+		Cfg: cfg,
+	}
+
+	return &c, nil
+}
+
+// InClusterKubernetesCfg returns the configuration used to access the API
+// server from a pod, using the credentials of its service account.
+func InClusterKubernetesCfg() (*KubernetesCfg, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster")
+	}
+
+	caFilePath := path.Join(kubernetesServiceAccountPath, "ca.crt")
+
+	caCertPool, err := loadCACertificatePool(caFilePath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenFilePath := path.Join(kubernetesServiceAccountPath, "token")
+
+	cfg := KubernetesCfg{
+		HTTPClient:   NewHTTPClient(caCertPool),
+		APIServerURI: "https://" + net.JoinHostPort(host, port),
+		Token:        NewFileSecret(tokenFilePath),
+	}
+
+	return &cfg, nil
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Exec                  any    `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// LoadKubeconfig reads a kubeconfig file and returns the configuration
+// corresponding to a context, or to the current context if contextName is
+// empty. Authentication with tokens and client certificates is supported;
+// exec and auth provider plugins are not.
+func LoadKubeconfig(filePath, contextName string) (*KubernetesCfg, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+	}
+
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("cannot decode %q: %w", filePath, err)
+	}
+
+	// Relative paths are relative to the directory of the kubeconfig file
+	dirPath := path.Dir(filePath)
+	resolvePath := func(p string) string {
+		if p == "" || path.IsAbs(p) {
+			return p
+		}
+
+		return path.Join(dirPath, p)
+	}
+
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+
+	var clusterName, userName string
+	found := false
+
+	for _, c := range kc.Contexts {
+		if c.Name == contextName {
+			clusterName = c.Context.Cluster
+			userName = c.Context.User
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown context %q", contextName)
+	}
+
+	var cfg KubernetesCfg
+	var tlsCfg tls.Config
+
+	found = false
+
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+
+		cluster := c.Cluster
+
+		cfg.APIServerURI = cluster.Server
+		tlsCfg.InsecureSkipVerify = cluster.InsecureSkipTLSVerify
+
+		caData, err := decodeKubeconfigData(cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate authority data: %w",
+				err)
+		}
+
+		if caData != nil || cluster.CertificateAuthority != "" {
+			pool, err := loadCACertificatePool(
+				resolvePath(cluster.CertificateAuthority), caData)
+			if err != nil {
+				return nil, err
+			}
+
+			tlsCfg.RootCAs = pool
+		}
+
+		found = true
+		break
+	}
+
+	if !found {
+		return nil, fmt.Errorf("unknown cluster %q", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+
+		user := u.User
+
+		if user.Exec != nil {
+			return nil, fmt.Errorf("exec authentication plugins are not " +
+				"supported")
+		}
+
+		switch {
+		case user.Token != "":
+			cfg.Token = StaticSecret(user.Token)
+		case user.TokenFile != "":
+			cfg.Token = NewFileSecret(resolvePath(user.TokenFile))
+		}
+
+		certData, err := decodeKubeconfigData(user.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate data: %w", err)
+		}
+
+		keyData, err := decodeKubeconfigData(user.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client key data: %w", err)
+		}
+
+		if certData == nil && user.ClientCertificate != "" {
+			filePath := resolvePath(user.ClientCertificate)
+			if certData, err = os.ReadFile(filePath); err != nil {
+				return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+			}
+		}
+
+		if keyData == nil && user.ClientKey != "" {
+			filePath := resolvePath(user.ClientKey)
+			if keyData, err = os.ReadFile(filePath); err != nil {
+				return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+			}
+		}
+
+		if certData != nil {
+			cert, err := tls.X509KeyPair(certData, keyData)
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate: %w", err)
+			}
+
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+
+		break
+	}
+
+	httpClient := NewHTTPClient(tlsCfg.RootCAs)
+
+	transport := httpClient.Transport.(*http.Transport)
+	transport.DialTLSContext = nil
+	transport.TLSClientConfig = &tlsCfg
+
+	cfg.HTTPClient = httpClient
+
+	return &cfg, nil
+}
+
+func decodeKubeconfigData(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func loadCACertificatePool(filePath string, data []byte) (*x509.CertPool, error) {
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(filePath); err != nil {
+			return nil, fmt.Errorf("cannot read %q: %w", filePath, err)
+		}
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no valid CA certificate found")
+	}
+
+	return pool, nil
+}
+
+func (c *KubernetesClient) sendRequest(ctx context.Context, method, uriPath string, header http.Header, reqBody, resBody any) error {
+	uri := strings.TrimSuffix(c.Cfg.APIServerURI, "/") + uriPath
+
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("cannot encode request body: %w", err)
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if c.Cfg.Token != nil {
+		token, err := c.Cfg.Token.Secret(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot obtain token: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := c.Cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(newSizeLimitedReader(res.Body,
+		DefaultMaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var status kubernetesStatus
+		if err := json.Unmarshal(data, &status); err == nil &&
+			status.Message != "" {
+			return fmt.Errorf("request failed with status %d: %s",
+				res.StatusCode, status.Message)
+		}
+
+		return fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	if resBody != nil {
+		if err := json.Unmarshal(data, resBody); err != nil {
+			return fmt.Errorf("cannot decode response body: %w", err)
+		}
+	}
+
+	return nil
+}
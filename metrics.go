@@ -0,0 +1,376 @@
+package acme
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics are exposed using the Prometheus text exposition format. We do not
+// depend on the Prometheus client library: the format is trivial and the
+// number of metrics small.
+
+type nonceMetrics struct {
+	fetched   uint64 // obtained from the newNonce endpoint
+	consumed  uint64 // used to sign a request
+	rejected  uint64 // rejected with a badNonce error
+	discarded uint64 // discarded without being used
+}
+
+type certificateMetrics struct {
+	orders          uint64
+	orderFailures   uint64
+	lastOrderTime   time.Time
+	lastFailureTime time.Time
+	renewalTime     time.Time
+	workerPanics    uint64
+}
+
+// Histograms of durations use exponential buckets, suited to durations
+// ranging from a second for internal servers to tens of minutes for DNS
+// challenges with long propagation delays.
+var durationHistogramBounds = exponentialBounds(1, 2, 12) // 1s to 2048s
+
+type durationHistogram struct {
+	counts []uint64 // one per bound, the last one for +Inf
+	sum    float64
+}
+
+func exponentialBounds(start, factor float64, n int) []float64 {
+	bounds := make([]float64, n)
+
+	bound := start
+	for i := range bounds {
+		bounds[i] = bound
+		bound *= factor
+	}
+
+	return bounds
+}
+
+func (h *durationHistogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationHistogramBounds)+1)
+	}
+
+	value := d.Seconds()
+
+	i, _ := slices.BinarySearch(durationHistogramBounds, value)
+	h.counts[i]++
+	h.sum += value
+}
+
+func (h *durationHistogram) clone() durationHistogram {
+	return durationHistogram{counts: slices.Clone(h.counts), sum: h.sum}
+}
+
+// Must be called with c.metricsMutex locked.
+func (c *Client) certificateMetrics(name string) *certificateMetrics {
+	m := c.metrics[name]
+	if m == nil {
+		m = &certificateMetrics{}
+		c.metrics[name] = m
+	}
+
+	return m
+}
+
+func (c *Client) recordOrder(name string, err error) {
+	c.metricsMutex.Lock()
+	defer c.metricsMutex.Unlock()
+
+	m := c.certificateMetrics(name)
+
+	now := time.Now()
+
+	m.orders++
+	m.lastOrderTime = now
+
+	if err != nil {
+		m.orderFailures++
+		m.lastFailureTime = now
+	}
+}
+
+// recordIssuanceDuration records the time between the submission of an order
+// and the storage of the certificate.
+func (c *Client) recordIssuanceDuration(d time.Duration) {
+	c.metricsMutex.Lock()
+	c.issuanceDurations.observe(d)
+	c.metricsMutex.Unlock()
+}
+
+func (c *Client) recordOrderPhaseDuration(phase OrderPhase, d time.Duration) {
+	c.metricsMutex.Lock()
+	defer c.metricsMutex.Unlock()
+
+	h := c.orderPhaseDurations[phase]
+	if h == nil {
+		h = &durationHistogram{}
+		c.orderPhaseDurations[phase] = h
+	}
+
+	h.observe(d)
+}
+
+func (c *Client) recordRenewalTime(name string, t time.Time) {
+	c.metricsMutex.Lock()
+	c.certificateMetrics(name).renewalTime = t
+	c.metricsMutex.Unlock()
+}
+
+func (c *Client) recordPanic(name string) {
+	c.metricsMutex.Lock()
+	c.certificateMetrics(name).workerPanics++
+	c.metricsMutex.Unlock()
+}
+
+// MetricsHandler returns an HTTP handler serving the metrics of the client,
+// typically at /metrics.
+func (c *Client) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		if err := c.WriteMetrics(w); err != nil {
+			c.Log.Error("cannot write metrics: %v", err)
+		}
+	})
+}
+
+// WriteMetrics writes the metrics of the client using the Prometheus text
+// exposition format.
+func (c *Client) WriteMetrics(w io.Writer) error {
+	mw := NewMetricsWriter(w)
+
+	// Certificates are also stored under their aliases; we only report them
+	// under their own name.
+	certs := make(map[string]*CertificateData)
+	for name, certData := range *c.certificates.Load() {
+		if certData.Name == name {
+			certs[name] = certData
+		}
+	}
+
+	certNames := slices.Sorted(maps.Keys(certs))
+
+	mw.WriteHeader("acme_certificate_expiration_timestamp_seconds", "gauge",
+		"the time at which the certificate expires")
+	for _, name := range certNames {
+		notAfter := certs[name].LeafCertificate().NotAfter
+		mw.WriteSample("acme_certificate_expiration_timestamp_seconds",
+			MetricLabels{"certificate": name}, timestampValue(notAfter))
+	}
+
+	// Labels are exported in a separate metric so that they can be joined
+	// with other metrics without changing their series.
+	mw.WriteHeader("acme_certificate_labels", "gauge",
+		"the labels of the certificate")
+	for _, name := range certNames {
+		labels := MetricLabels{"certificate": name}
+		for labelName, value := range certs[name].Labels {
+			labels["label_"+labelName] = value
+		}
+
+		mw.WriteSample("acme_certificate_labels", labels, 1)
+	}
+
+	c.metricsMutex.Lock()
+	metrics := make(map[string]certificateMetrics)
+	for name, m := range c.metrics {
+		metrics[name] = *m
+	}
+	c.metricsMutex.Unlock()
+
+	metricNames := slices.Sorted(maps.Keys(metrics))
+
+	writeMetric := func(name, metricType, description string, value func(*certificateMetrics) float64) {
+		mw.WriteHeader(name, metricType, description)
+		for _, certName := range metricNames {
+			m := metrics[certName]
+			mw.WriteSample(name, MetricLabels{"certificate": certName},
+				value(&m))
+		}
+	}
+
+	writeMetric("acme_certificate_renewal_timestamp_seconds", "gauge",
+		"the time at which the certificate will be renewed",
+		func(m *certificateMetrics) float64 {
+			return timestampValue(m.renewalTime)
+		})
+
+	writeMetric("acme_certificate_orders_total", "counter",
+		"the number of orders submitted for the certificate",
+		func(m *certificateMetrics) float64 {
+			return float64(m.orders)
+		})
+
+	writeMetric("acme_certificate_order_failures_total", "counter",
+		"the number of orders which failed for the certificate",
+		func(m *certificateMetrics) float64 {
+			return float64(m.orderFailures)
+		})
+
+	writeMetric("acme_certificate_last_order_failure_timestamp_seconds",
+		"gauge", "the time of the last order failure for the certificate",
+		func(m *certificateMetrics) float64 {
+			return timestampValue(m.lastFailureTime)
+		})
+
+	writeMetric("acme_certificate_worker_panics_total", "counter",
+		"the number of times the certificate worker panicked and was "+
+			"restarted",
+		func(m *certificateMetrics) float64 {
+			return float64(m.workerPanics)
+		})
+
+	c.metricsMutex.Lock()
+	issuanceDurations := c.issuanceDurations.clone()
+	phaseDurations := make(map[OrderPhase]durationHistogram)
+	for phase, h := range c.orderPhaseDurations {
+		phaseDurations[phase] = h.clone()
+	}
+	c.metricsMutex.Unlock()
+
+	mw.WriteHeader("acme_certificate_issuance_duration_seconds", "histogram",
+		"the time between the submission of an order and the storage of "+
+			"the certificate")
+	mw.WriteHistogram("acme_certificate_issuance_duration_seconds", nil,
+		durationHistogramBounds, issuanceDurations.counts,
+		issuanceDurations.sum)
+
+	mw.WriteHeader("acme_order_phase_duration_seconds", "histogram",
+		"the duration of successful order phases")
+	for _, phase := range []OrderPhase{OrderPhaseAuthorization,
+		OrderPhaseFinalization, OrderPhaseDownload} {
+		h := phaseDurations[phase]
+		mw.WriteHistogram("acme_order_phase_duration_seconds",
+			MetricLabels{"phase": string(phase)}, durationHistogramBounds,
+			h.counts, h.sum)
+	}
+
+	c.noncesMutex.Lock()
+	nm := c.nonceMetrics
+	c.noncesMutex.Unlock()
+
+	mw.WriteHeader("acme_nonces_fetched_total", "counter",
+		"the number of nonces obtained from the newNonce endpoint")
+	mw.WriteSample("acme_nonces_fetched_total", nil, float64(nm.fetched))
+
+	mw.WriteHeader("acme_nonces_consumed_total", "counter",
+		"the number of nonces used to sign requests")
+	mw.WriteSample("acme_nonces_consumed_total", nil, float64(nm.consumed))
+
+	mw.WriteHeader("acme_nonces_rejected_total", "counter",
+		"the number of nonces rejected by the server")
+	mw.WriteSample("acme_nonces_rejected_total", nil, float64(nm.rejected))
+
+	mw.WriteHeader("acme_nonces_discarded_total", "counter",
+		"the number of nonces discarded as stale without being used")
+	mw.WriteSample("acme_nonces_discarded_total", nil,
+		float64(nm.discarded))
+
+	return mw.Flush()
+}
+
+type MetricLabels map[string]string
+
+// MetricsWriter writes metrics using the Prometheus text exposition format.
+// Write errors are sticky and reported by Flush.
+type MetricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewMetricsWriter(w io.Writer) *MetricsWriter {
+	return &MetricsWriter{w: bufio.NewWriter(w)}
+}
+
+func (mw *MetricsWriter) WriteHeader(name, metricType, description string) {
+	mw.printf("# HELP %s %s\n", name, escapeMetricHelp(description))
+	mw.printf("# TYPE %s %s\n", name, metricType)
+}
+
+func (mw *MetricsWriter) WriteSample(name string, labels MetricLabels, value float64) {
+	mw.printf("%s", name)
+
+	if len(labels) > 0 {
+		mw.printf("{")
+		for i, label := range slices.Sorted(maps.Keys(labels)) {
+			if i > 0 {
+				mw.printf(",")
+			}
+
+			mw.printf("%s=\"%s\"", label, escapeMetricLabelValue(labels[label]))
+		}
+		mw.printf("}")
+	}
+
+	mw.printf(" %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// WriteHistogram writes the samples of a histogram. Counts are not cumulative:
+// there is one per bound, and a last one for values greater than all bounds.
+// A nil counts slice is treated as a histogram without any observation.
+func (mw *MetricsWriter) WriteHistogram(name string, labels MetricLabels, bounds []float64, counts []uint64, sum float64) {
+	bucketLabels := maps.Clone(labels)
+	if bucketLabels == nil {
+		bucketLabels = make(MetricLabels)
+	}
+
+	var count uint64
+
+	for i := range len(bounds) + 1 {
+		if i < len(counts) {
+			count += counts[i]
+		}
+
+		if i < len(bounds) {
+			bucketLabels["le"] = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+		} else {
+			bucketLabels["le"] = "+Inf"
+		}
+
+		mw.WriteSample(name+"_bucket", bucketLabels, float64(count))
+	}
+
+	mw.WriteSample(name+"_sum", labels, sum)
+	mw.WriteSample(name+"_count", labels, float64(count))
+}
+
+func (mw *MetricsWriter) Flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
+
+	return mw.w.Flush()
+}
+
+func (mw *MetricsWriter) printf(format string, args ...any) {
+	if mw.err != nil {
+		return
+	}
+
+	_, mw.err = fmt.Fprintf(mw.w, format, args...)
+}
+
+func timestampValue(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return float64(t.UnixMilli()) / 1000.0
+}
+
+func escapeMetricHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeMetricLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+
+	mw := NewMetricsWriter(&buf)
+
+	mw.WriteHeader("foo_total", "counter", "the number of\nfoos")
+	mw.WriteSample("foo_total", MetricLabels{"b": "x", "a": `"y"\`}, 42)
+	mw.WriteHeader("bar", "gauge", "a gauge")
+	mw.WriteSample("bar", nil, 0.5)
+
+	assert.NoError(mw.Flush())
+
+	assert.Equal(`# HELP foo_total the number of\nfoos
+# TYPE foo_total counter
+foo_total{a="\"y\"\\",b="x"} 42
+# HELP bar a gauge
+# TYPE bar gauge
+bar 0.5
+`, buf.String())
+}
+
+func TestMetricsWriterHistogram(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+
+	mw := NewMetricsWriter(&buf)
+
+	mw.WriteHistogram("foo_seconds", MetricLabels{"a": "x"},
+		[]float64{0.5, 1, 2}, []uint64{1, 0, 2, 1}, 7.25)
+	mw.WriteHistogram("bar_seconds", nil, []float64{1}, nil, 0)
+
+	assert.NoError(mw.Flush())
+
+	assert.Equal(`foo_seconds_bucket{a="x",le="0.5"} 1
+foo_seconds_bucket{a="x",le="1"} 1
+foo_seconds_bucket{a="x",le="2"} 3
+foo_seconds_bucket{a="x",le="+Inf"} 4
+foo_seconds_sum{a="x"} 7.25
+foo_seconds_count{a="x"} 4
+bar_seconds_bucket{le="1"} 0
+bar_seconds_bucket{le="+Inf"} 0
+bar_seconds_sum 0
+bar_seconds_count 0
+`, buf.String())
+}
+
+func TestIssuanceDurationMetrics(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(context.Background(), "test",
+			request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NoError(ev.Error)
+
+		var buf bytes.Buffer
+		require.NoError(c.WriteMetrics(&buf))
+
+		metrics := buf.String()
+		assert.Contains(metrics,
+			"\nacme_certificate_issuance_duration_seconds_count 1\n")
+		assert.Contains(metrics,
+			`acme_certificate_issuance_duration_seconds_bucket{le="+Inf"} 1`)
+		assert.Contains(metrics, `acme_order_phase_duration_seconds_count{`+
+			`phase="authorization"} 1`)
+		assert.Contains(metrics, `acme_order_phase_duration_seconds_count{`+
+			`phase="finalization"} 1`)
+		assert.Contains(metrics, `acme_order_phase_duration_seconds_count{`+
+			`phase="download"} 1`)
+	})
+}
@@ -0,0 +1,117 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// In monitor-only mode, the client never contacts the ACME server: it serves
+// and reports on certificates obtained by another instance sharing or
+// replicating the data store.
+
+var ErrMonitorOnly = errors.New("client is in monitor-only mode")
+
+type CertificateReport struct {
+	Name        string       `json:"name"`
+	Identifiers []Identifier `json:"identifiers"`
+	NotAfter    time.Time    `json:"not_after"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Only set if OCSP checks were requested.
+	OCSP      *OCSPResult `json:"ocsp,omitempty"`
+	OCSPError error       `json:"-"`
+}
+
+func (r *CertificateReport) TimeLeft(now time.Time) time.Duration {
+	return r.NotAfter.Sub(now)
+}
+
+// NewOfflineClient creates and starts a client in monitor-only mode which
+// serves the certificates stored in a data store, e.g. in air-gapped
+// environments or in processes using a replica of the data store of another
+// instance. The client never uses the network; MonitorCertificates loads
+// certificates added or renewed in the data store since the client was
+// started, waking up callers of WaitForCertificate.
+func NewOfflineClient(dataStore DataStore) (*Client, error) {
+	c, err := NewClient(ClientCfg{
+		DataStore:   dataStore,
+		MonitorOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Start(context.Background()); err != nil {
+		return nil, fmt.Errorf("cannot load certificates: %w", err)
+	}
+
+	return c, nil
+}
+
+// MonitorCertificates loads all certificates from the data store, making
+// them available to TLS servers using the client, and returns a report for
+// each of them. If checkOCSP is set, the OCSP responder of the issuer of each
+// certificate is queried.
+func (c *Client) MonitorCertificates(ctx context.Context, checkOCSP bool) ([]*CertificateReport, error) {
+	certs, err := c.loadStoredCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*CertificateReport, len(certs))
+
+	for i, certData := range certs {
+		report := CertificateReport{
+			Name:        certData.Name,
+			Identifiers: certData.Identifiers,
+			NotAfter:    certData.LeafCertificate().NotAfter,
+			Labels:      certData.Labels,
+		}
+
+		if checkOCSP {
+			httpClient := c.Config().HTTPClient
+
+			report.OCSP, report.OCSPError = CheckOCSPStatus(ctx, httpClient,
+				certData)
+		}
+
+		reports[i] = &report
+	}
+
+	return reports, nil
+}
+
+func (c *Client) loadStoredCertificates() ([]*CertificateData, error) {
+	store, ok := c.dataStore.(CertificateLister)
+	if !ok {
+		return nil, fmt.Errorf("%w: certificate listing",
+			ErrUnsupportedDataStoreOperation)
+	}
+
+	names, err := store.CertificateNames()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list certificates: %w", err)
+	}
+
+	var certs []*CertificateData
+
+	for _, name := range names {
+		certData, err := c.dataStore.LoadCertificateData(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load certificate %q: %w", name, err)
+		}
+
+		if !certData.ContainsCertificate() {
+			continue
+		}
+
+		c.storeCertificate(certData)
+
+		certs = append(certs, certData)
+	}
+
+	return certs, nil
+}
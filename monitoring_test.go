@@ -0,0 +1,181 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestMonitorOnly(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caData, err := x509.CreateCertificate(rand.Reader, &caTemplate,
+		&caTemplate, caKey.Public(), caKey)
+	require.NoError(err)
+	caCert, err := x509.ParseCertificate(caData)
+	require.NoError(err)
+
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+
+	ocspServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqData, _ := io.ReadAll(req.Body)
+
+		ocspReq, err := ocsp.ParseRequest(reqData)
+		if !assert.NoError(err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		template := ocsp.Response{
+			Status:           ocsp.Revoked,
+			SerialNumber:     ocspReq.SerialNumber,
+			ThisUpdate:       time.Now().Add(-time.Minute),
+			NextUpdate:       time.Now().Add(time.Hour),
+			RevokedAt:        revokedAt,
+			RevocationReason: ocsp.KeyCompromise,
+		}
+
+		resData, err := ocsp.CreateResponse(caCert, caCert, template, caKey)
+		if !assert.NoError(err) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resData)
+	}))
+	defer ocspServer.Close()
+
+	privateKey, err := GeneratePrivateKey(KeyTypeECDSAP256)
+	require.NoError(err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 30),
+		OCSPServer:   []string{ocspServer.URL},
+	}
+
+	certData, err := x509.CreateCertificate(rand.Reader, &template, caCert,
+		privateKey.Public(), caKey)
+	require.NoError(err)
+	cert, err := x509.ParseCertificate(certData)
+	require.NoError(err)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	require.NoError(dataStore.StoreCertificateData(&CertificateData{
+		Name: "example",
+		CertificateRequest: CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+		},
+		PrivateKey:  privateKey,
+		Certificate: []*x509.Certificate{cert, caCert},
+	}))
+
+	// The directory URI is not reachable: the client must not try to use it
+	client, err := NewClient(ClientCfg{
+		DataStore:    dataStore,
+		DirectoryURI: "https://localhost:1/directory",
+		MonitorOnly:  true,
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+
+	require.NoError(client.Start(ctx))
+	defer client.Stop()
+
+	assert.NotNil(client.Certificate("example"))
+
+	_, err = client.RequestCertificate(ctx, "other", CertificateRequest{
+		Identifiers: []Identifier{DNSIdentifier("example.org")},
+	})
+	assert.ErrorIs(err, ErrMonitorOnly)
+
+	reports, err := client.MonitorCertificates(ctx, true)
+	require.NoError(err)
+	require.Len(reports, 1)
+
+	report := reports[0]
+	assert.Equal("example", report.Name)
+	assert.Equal(cert.NotAfter, report.NotAfter)
+
+	require.NoError(report.OCSPError)
+	assert.Equal(OCSPStatusRevoked, report.OCSP.Status)
+	assert.Equal(revokedAt, report.OCSP.RevokedAt)
+	assert.Equal(RevocationReasonKeyCompromise, report.OCSP.RevocationReason)
+}
+
+func TestOfflineClient(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	certData := testCertificateData(t)
+	certData.Identifiers = []Identifier{DNSIdentifier("example.com")}
+	require.NoError(dataStore.StoreCertificateData(certData))
+
+	client, err := NewOfflineClient(dataStore)
+	require.NoError(err)
+	defer client.Stop()
+
+	getCertificate := client.GetTLSCertificateFunc("example")
+
+	cert, err := getCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	require.NoError(err)
+	assert.Equal(certData.LeafCertificate().Raw, cert.Leaf.Raw)
+
+	// Certificates stored later are obtained when reloading the data store
+	certData2 := testCertificateData(t)
+	certData2.Name = "example2"
+
+	waitChan := make(chan *CertificateData)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		waitChan <- client.WaitForCertificate(ctx, "example2")
+	}()
+
+	require.NoError(dataStore.StoreCertificateData(certData2))
+
+	_, err = client.MonitorCertificates(context.Background(), false)
+	require.NoError(err)
+
+	certData3 := <-waitChan
+	require.NotNil(certData3)
+	assert.Equal(certData2.Checksum(), certData3.Checksum())
+}
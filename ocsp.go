@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var ErrNoOCSPServer = errors.New("certificate does not have any OCSP server")
+
+type OCSPStatus string
+
+const (
+	OCSPStatusGood    OCSPStatus = "good"
+	OCSPStatusRevoked OCSPStatus = "revoked"
+	OCSPStatusUnknown OCSPStatus = "unknown"
+)
+
+type OCSPResult struct {
+	Status           OCSPStatus       `json:"status"`
+	ProducedAt       time.Time        `json:"produced_at"`
+	NextUpdate       time.Time        `json:"next_update"`
+	RevokedAt        time.Time        `json:"revoked_at"`
+	RevocationReason RevocationReason `json:"revocation_reason,omitempty"`
+}
+
+// CheckOCSPStatus queries the OCSP responder of the issuer of a certificate.
+// The certificate chain must contain the issuer certificate.
+func CheckOCSPStatus(ctx context.Context, httpClient *http.Client, certData *CertificateData) (*OCSPResult, error) {
+	if len(certData.Certificate) < 2 {
+		return nil, fmt.Errorf("missing issuer certificate")
+	}
+
+	cert := certData.Certificate[0]
+	issuer := certData.Certificate[1]
+
+	if len(cert.OCSPServer) == 0 {
+		return nil, ErrNoOCSPServer
+	}
+
+	reqData, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OCSP request: %w", err)
+	}
+
+	uri := cert.OCSPServer[0]
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uri,
+		bytes.NewReader(reqData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot send request to %q: %w", uri, err)
+	}
+	defer res.Body.Close()
+
+	resData, err := io.ReadAll(newSizeLimitedReader(res.Body,
+		DefaultMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("request to %q failed with status %d", uri,
+			res.StatusCode)
+	}
+
+	ocspRes, err := ocsp.ParseResponseForCert(resData, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse OCSP response: %w", err)
+	}
+
+	result := OCSPResult{
+		ProducedAt: ocspRes.ProducedAt,
+		NextUpdate: ocspRes.NextUpdate,
+	}
+
+	switch ocspRes.Status {
+	case ocsp.Good:
+		result.Status = OCSPStatusGood
+	case ocsp.Revoked:
+		result.Status = OCSPStatusRevoked
+		result.RevokedAt = ocspRes.RevokedAt
+		result.RevocationReason = RevocationReason(ocspRes.RevocationReason)
+	default:
+		result.Status = OCSPStatusUnknown
+	}
+
+	return &result, nil
+}
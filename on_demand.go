@@ -0,0 +1,168 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrOnDemandRateLimited = errors.New("on-demand issuance rate limited")
+
+// A host policy returns an error if a certificate must not be obtained for a
+// host. The host is always normalized: lowercase, ASCII encoded and without
+// trailing dot.
+type HostPolicy func(ctx context.Context, host string) error
+
+type OnDemandCfg struct {
+	HostPolicy HostPolicy `json:"-"`
+
+	Validity int `json:"validity"` // days
+
+	// The minimal interval between two issuance attempts for the same host.
+	// Successful issuances are never attempted again since the resulting
+	// certificate is renewed automatically.
+	MinAttemptInterval time.Duration `json:"min_attempt_interval,omitempty"`
+}
+
+type onDemandHost struct {
+	lastAttempt time.Time
+	done        chan struct{}
+	err         error
+}
+
+func HostWhitelist(hosts ...string) HostPolicy {
+	normalizedHosts := make(map[string]struct{})
+	for _, host := range hosts {
+		if host2, err := normalizeHost(host); err == nil {
+			normalizedHosts[host2] = struct{}{}
+		}
+	}
+
+	return func(ctx context.Context, host string) error {
+		if _, found := normalizedHosts[host]; !found {
+			return fmt.Errorf("host %q not allowed", host)
+		}
+
+		return nil
+	}
+}
+
+func (c *Client) obtainOnDemandCertificate(ctx context.Context, serverName string) (*CertificateData, error) {
+	cfg := c.Config().OnDemand
+
+	host, err := normalizeHost(serverName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server name %q: %w", serverName, err)
+	} else if host == "" {
+		return nil, fmt.Errorf("missing server name")
+	}
+
+	if cfg.HostPolicy == nil {
+		return nil, fmt.Errorf("host %q not allowed", host)
+	}
+
+	if err := cfg.HostPolicy(ctx, host); err != nil {
+		return nil, err
+	}
+
+	c.onDemandHostsMutex.Lock()
+
+	h := c.onDemandHosts[host]
+	if h == nil {
+		h = &onDemandHost{}
+		c.onDemandHosts[host] = h
+	}
+
+	done := h.done
+
+	if done == nil {
+		if time.Since(h.lastAttempt) < cfg.MinAttemptInterval {
+			err := h.err
+			c.onDemandHostsMutex.Unlock()
+
+			if err == nil {
+				return nil, ErrOnDemandRateLimited
+			}
+
+			return nil, fmt.Errorf("%w: %w", ErrOnDemandRateLimited, err)
+		}
+
+		done = make(chan struct{})
+
+		h.lastAttempt = time.Now()
+		h.done = done
+		h.err = nil
+
+		if err := c.startOnDemandIssuance(host, h, done); err != nil {
+			h.done = nil
+			h.err = err
+			c.onDemandHostsMutex.Unlock()
+			close(done)
+			return nil, err
+		}
+	}
+
+	c.onDemandHostsMutex.Unlock()
+
+	select {
+	case <-done:
+	case <-c.stopChan:
+		return nil, ErrVerificationInterrupted
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.onDemandHostsMutex.Lock()
+	err = h.err
+	c.onDemandHostsMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	certData := c.Certificate(host)
+	if certData == nil {
+		return nil, fmt.Errorf("no certificate available")
+	}
+
+	return certData, nil
+}
+
+func (c *Client) startOnDemandIssuance(host string, h *onDemandHost, done chan struct{}) error {
+	c.Log.Info("requesting on-demand certificate for %q", host)
+
+	request := CertificateRequest{
+		Identifiers: []Identifier{DNSIdentifier(host)},
+		Validity:    c.Config().OnDemand.Validity,
+	}
+
+	// The worker must outlive the TLS handshake which triggered the issuance
+	// since it will then take care of renewal.
+	eventChan, err := c.RequestCertificate(context.Background(), host,
+		request)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := errors.New("certificate worker stopped")
+
+		if ev, ok := <-eventChan; ok {
+			err = ev.Error
+		}
+
+		c.onDemandHostsMutex.Lock()
+		h.done = nil
+		h.err = err
+		c.onDemandHostsMutex.Unlock()
+
+		close(done)
+
+		// Keep reading events so that the worker never blocks
+		for range eventChan {
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostWhitelist(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := HostWhitelist("Example.COM.", "bücher.example")
+
+	ctx := context.Background()
+
+	assert.NoError(policy(ctx, "example.com"))
+	assert.NoError(policy(ctx, "xn--bcher-kva.example"))
+	assert.Error(policy(ctx, "www.example.com"))
+	assert.Error(policy(ctx, ""))
+}
+
+func TestOnDemandIssuance(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	setup := func(cfg *ClientCfg) {
+		cfg.OnDemand = &OnDemandCfg{
+			HostPolicy: HostWhitelist("example.com", "rate.example.com"),
+			Validity:   1,
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		getCertificate := c.GetAnyTLSCertificateFunc()
+
+		// Allowed hosts obtain a certificate during the handshake
+		cert, err := tlsHandshake(getCertificate, "EXAMPLE.com")
+		require.NoError(err)
+		assert.Equal([]string{"example.com"}, cert.DNSNames)
+		assert.NotNil(c.Certificate("example.com"))
+		assert.Equal(1, s.Requests("new-order"))
+
+		cert2, err := tlsHandshake(getCertificate, "example.com")
+		require.NoError(err)
+		assert.Equal(cert.SerialNumber, cert2.SerialNumber)
+		assert.Equal(1, s.Requests("new-order"))
+
+		// Other hosts are rejected without any order
+		_, err = tlsHandshake(getCertificate, "www.example.com")
+		assert.ErrorContains(err, "not allowed")
+		assert.Nil(c.Certificate("www.example.com"))
+		assert.Equal(1, s.Requests("new-order"))
+
+		// After a failure, issuance is not attempted again for some time
+		s.mutex.Lock()
+		s.RateLimitedOrders = 1
+		s.mutex.Unlock()
+
+		_, err = tlsHandshake(getCertificate, "rate.example.com")
+		require.Error(err)
+		assert.NotErrorIs(err, ErrOnDemandRateLimited)
+		assert.Equal(2, s.Requests("new-order"))
+
+		_, err = tlsHandshake(getCertificate, "rate.example.com")
+		assert.ErrorIs(err, ErrOnDemandRateLimited)
+		assert.Equal(2, s.Requests("new-order"))
+	})
+}
+
+// tlsHandshake performs a TLS handshake with a server using a
+// GetTLSCertificateFunc, returning the leaf certificate sent by the server or
+// the error of the server.
+func tlsHandshake(getCertificate GetTLSCertificateFunc, serverName string) (*x509.Certificate, error) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, &tls.Config{
+		GetCertificate:         getCertificate,
+		SessionTicketsDisabled: true,
+	})
+
+	client := tls.Client(clientConn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		serverErrChan <- server.Handshake()
+	}()
+
+	clientErr := client.Handshake()
+
+	if err := <-serverErrChan; err != nil {
+		return nil, err
+	}
+
+	if clientErr != nil {
+		return nil, clientErr
+	}
+
+	return client.ConnectionState().PeerCertificates[0], nil
+}
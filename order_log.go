@@ -0,0 +1,78 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The order log keeps track of the orders submitted for a certificate and of
+// their outcome, including problem details returned by the server, so that
+// failed issuances can be diagnosed after the fact.
+
+const MaxOrderLogEntries = 100
+
+type OrderLogEvent string
+
+const (
+	OrderLogEventOrderSubmitted       OrderLogEvent = "order_submitted"
+	OrderLogEventAuthorizationValid   OrderLogEvent = "authorization_valid"
+	OrderLogEventAuthorizationInvalid OrderLogEvent = "authorization_invalid"
+	OrderLogEventCertificateIssued    OrderLogEvent = "certificate_issued"
+	OrderLogEventOrderFailed          OrderLogEvent = "order_failed"
+)
+
+type OrderLogEntry struct {
+	Time          time.Time       `json:"time"`
+	Event         OrderLogEvent   `json:"event"`
+	OrderURI      string          `json:"order_uri,omitempty"`
+	Identifier    string          `json:"identifier,omitempty"`
+	ChallengeType ChallengeType   `json:"challenge_type,omitempty"`
+	Message       string          `json:"message,omitempty"`
+	Problem       *ProblemDetails `json:"problem,omitempty"`
+
+	ValidationRecord []ValidationRecord `json:"validation_record,omitempty"`
+}
+
+// OrderLog returns the order log of a certificate. It returns
+// ErrUnsupportedDataStoreOperation if the data store does not implement
+// OrderLogStore.
+func (c *Client) OrderLog(name string) ([]*OrderLogEntry, error) {
+	store, ok := c.Config().DataStore.(OrderLogStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: order log", ErrUnsupportedDataStoreOperation)
+	}
+
+	return store.LoadOrderLog(name)
+}
+
+func (w *CertificateWorker) logOrderEvent(entry *OrderLogEntry, err error) {
+	store, ok := w.Client.Config().DataStore.(OrderLogStore)
+	if !ok {
+		return
+	}
+
+	entry.Time = time.Now()
+
+	if entry.OrderURI == "" {
+		entry.OrderURI = w.orderURI
+	}
+
+	if err != nil {
+		var problem *ProblemDetails
+		if errors.As(err, &problem) {
+			entry.Problem = problem
+		}
+
+		var challengeErr *ChallengeError
+		if errors.As(err, &challengeErr) {
+			entry.ValidationRecord = challengeErr.ValidationRecord
+		}
+
+		entry.Message = err.Error()
+	}
+
+	if err := store.AppendOrderLogEntry(w.name, entry); err != nil {
+		w.Log.Error("cannot store order log entry: %v", err)
+	}
+}
@@ -1,15 +1,26 @@
 package acme
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"time"
 )
 
+var ErrOrderExpired = errors.New("order expired")
+
+// Some servers report orders as processing before they become ready, e.g.
+// while validating authorizations asynchronously. We wait for them to become
+// ready, but not forever.
+const maxOrderProcessingDelay = 5 * time.Minute
+
 type OrderStatus string
 
 const (
@@ -24,6 +35,7 @@ type IdentifierType string
 
 const (
 	IdentifierTypeDNS IdentifierType = "dns"
+	IdentifierTypeIP  IdentifierType = "ip" // RFC 8738
 )
 
 type Identifier struct {
@@ -35,6 +47,10 @@ func DNSIdentifier(value string) Identifier {
 	return Identifier{Type: IdentifierTypeDNS, Value: value}
 }
 
+func IPIdentifier(addr netip.Addr) Identifier {
+	return Identifier{Type: IdentifierTypeIP, Value: addr.Unmap().String()}
+}
+
 func (id Identifier) String() string {
 	return fmt.Sprintf("%s:%s", id.Type, id.Value)
 }
@@ -43,6 +59,9 @@ type NewOrder struct {
 	Identifiers []Identifier `json:"identifiers"`
 	NotBefore   *time.Time   `json:"notBefore,omitempty"`
 	NotAfter    *time.Time   `json:"notAfter,omitempty"`
+
+	// draft-aaron-acme-profiles
+	Profile string `json:"profile,omitempty"`
 }
 
 type Order struct {
@@ -55,21 +74,70 @@ type Order struct {
 	Authorizations []string        `json:"authorizations"`
 	Finalize       string          `json:"finalize"`
 	Certificate    *string         `json:"certificate,omitempty"`
+	Profile        string          `json:"profile,omitempty"`
+}
+
+func (o *Order) resolveURIs(base *url.URL) error {
+	for i := range o.Authorizations {
+		if err := resolveURI(base, &o.Authorizations[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveURI(base, &o.Finalize); err != nil {
+		return err
+	}
+
+	if o.Certificate != nil {
+		return resolveURI(base, o.Certificate)
+	}
+
+	return nil
 }
 
 type OrderFinalization struct {
 	CSR string `json:"csr"`
 }
 
+// Some non-conforming servers return the URI of new orders in the response
+// body instead of the Location header field.
+type newOrderResponse struct {
+	URL string `json:"url"`
+}
+
 func (c *Client) submitOrder(ctx context.Context, newOrder *NewOrder) (string, error) {
 	c.Log.Debug(1, "creating order")
 
-	res, err := c.sendRequest(ctx, "POST", c.Directory.NewOrder, &newOrder, nil)
+	var orderRes newOrderResponse
+
+	var resBody any
+	if c.Config().OrderURIFromBody {
+		resBody = &orderRes
+	}
+
+	res, err := c.sendDirectoryRequest(ctx, "POST",
+		func(d *Directory) string { return d.NewOrder }, &newOrder, resBody)
 	if err != nil {
 		return "", err
 	}
 
-	location := res.Header.Get("Location")
+	location, err := responseLocation(res)
+	if err != nil {
+		return "", err
+	}
+
+	if location == "" && orderRes.URL != "" {
+		c.Log.Debug(1, "using order URI from response body")
+
+		uri, err := res.Request.URL.Parse(orderRes.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid order URI %q: %w", orderRes.URL,
+				err)
+		}
+
+		location = uri.String()
+	}
+
 	if location == "" {
 		return "", fmt.Errorf("missing or empty Location header field")
 	}
@@ -88,7 +156,9 @@ func (c *Client) fetchOrder(ctx context.Context, uri string) (*Order, *http.Resp
 	return &order, res, nil
 }
 
-func (c *Client) waitForOrderReady(ctx context.Context, uri string) (*Order, error) {
+func (c *Client) waitForOrderReady(ctx context.Context, uri string, expires time.Time) (*Order, error) {
+	var processingStart time.Time
+
 	for {
 		order, res, err := c.fetchOrder(ctx, uri)
 		if err != nil {
@@ -104,7 +174,12 @@ func (c *Client) waitForOrderReady(ctx context.Context, uri string) (*Order, err
 			return order, nil
 
 		case OrderStatusProcessing:
-			return nil, fmt.Errorf("unexpected order status %q", order.Status)
+			if processingStart.IsZero() {
+				processingStart = time.Now()
+			} else if time.Since(processingStart) > maxOrderProcessingDelay {
+				return nil, fmt.Errorf("order still processing after %v",
+					maxOrderProcessingDelay)
+			}
 
 		case OrderStatusValid:
 			return nil, fmt.Errorf("unexpected order status %q", order.Status)
@@ -119,13 +194,13 @@ func (c *Client) waitForOrderReady(ctx context.Context, uri string) (*Order, err
 			return nil, fmt.Errorf("unknown order status %q", order.Status)
 		}
 
-		if err := c.waitForVerification(ctx, delay); err != nil {
+		if err := c.waitForVerification(ctx, delay, expires); err != nil {
 			return nil, err
 		}
 	}
 }
 
-func (c *Client) waitForOrderValid(ctx context.Context, uri string) (*Order, error) {
+func (c *Client) waitForOrderValid(ctx context.Context, uri string, expires time.Time) (*Order, error) {
 	for {
 		order, res, err := c.fetchOrder(ctx, uri)
 		if err != nil {
@@ -155,7 +230,7 @@ func (c *Client) waitForOrderValid(ctx context.Context, uri string) (*Order, err
 			return nil, fmt.Errorf("unknown order status %q", order.Status)
 		}
 
-		if err := c.waitForVerification(ctx, delay); err != nil {
+		if err := c.waitForVerification(ctx, delay, expires); err != nil {
 			return nil, err
 		}
 	}
@@ -176,16 +251,86 @@ func (c *Client) finalizeOrder(ctx context.Context, uri string, csr []byte) (*Or
 	return &order, nil
 }
 
-func (c *Client) downloadCertificate(ctx context.Context, uri string) ([]*x509.Certificate, error) {
-	var data []byte
-	if _, err := c.sendRequest(ctx, "POST", uri, nil, &data); err != nil {
-		return nil, err
+func (c *Client) downloadCertificate(ctx context.Context, uri string) ([]*x509.Certificate, []string, error) {
+	var body certificateChainResponse
+	res, err := c.sendRequest(ctx, "POST", uri, nil, &body)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	chain, err := decodePEMCertificateChain(data)
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse certificate chain: %w", err)
+	var chain []*x509.Certificate
+
+	mediaType, _, _ := mime.ParseMediaType(body.ContentType)
+
+	switch mediaType {
+	case "application/pkix-cert":
+		// Some non-conforming servers return the leaf certificate in DER
+		// format; issuer certificates are then available with "up" links.
+		chain, err = c.downloadDERCertificateChain(ctx, body.Data, res.Header,
+			uri)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	default:
+		chain, err = decodePEMCertificateChain(body.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse certificate chain: %w",
+				err)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, nil, fmt.Errorf("empty certificate chain")
+	}
+
+	alternateURIs := alternateLinks(res.Header, uri)
+
+	return chain, alternateURIs, nil
+}
+
+func (c *Client) downloadDERCertificateChain(ctx context.Context, data []byte, header http.Header, uri string) ([]*x509.Certificate, error) {
+	// Protect ourselves against loops
+	const maxChainLength = 8
+
+	var chain []*x509.Certificate
+
+	for {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse certificate: %w", err)
+		}
+
+		chain = append(chain, cert)
+
+		upURIs := headerLinks(header, "up", uri)
+		if len(upURIs) == 0 || isSelfSignedCertificate(cert) {
+			break
+		}
+
+		if len(chain) >= maxChainLength {
+			return nil, fmt.Errorf("certificate chain too long")
+		}
+
+		uri = upURIs[0]
+
+		c.Log.Debug(1, "downloading issuer certificate %q", uri)
+
+		var body certificateChainResponse
+		res, err := c.sendRequest(ctx, "POST", uri, nil, &body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot download issuer certificate: %w",
+				err)
+		}
+
+		data = body.Data
+		header = res.Header
 	}
 
 	return chain, nil
 }
+
+func isSelfSignedCertificate(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignatureFrom(cert) == nil
+}
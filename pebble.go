@@ -14,6 +14,10 @@ import (
 const (
 	PebbleDirectoryURI               = "https://localhost:14000/dir"
 	PebbleHTTPChallengeSolverAddress = ":5002"
+
+	// pebble-challtestsrv is the DNS server used by Pebble for DNS-01
+	// challenges when started with "-dnsserver 127.0.0.1:8053".
+	PebbleChallTestSrvManagementURI = "http://localhost:8055"
 )
 
 //go:embed data/pebble-ca.crt
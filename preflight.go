@@ -0,0 +1,239 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Preflight checks run on the client side everything that can be checked
+// before submitting an order, so that setup problems do not consume
+// rate-limited orders.
+
+type PreflightStatus string
+
+const (
+	PreflightStatusOK      PreflightStatus = "ok"
+	PreflightStatusWarning PreflightStatus = "warning"
+	PreflightStatusError   PreflightStatus = "error"
+)
+
+type PreflightCheck struct {
+	Identifier string          `json:"identifier"`
+	Name       string          `json:"name"`
+	Status     PreflightStatus `json:"status"`
+	Message    string          `json:"message"`
+}
+
+type PreflightCfg struct {
+	// The resolver used for CAA records. Defaults to the resolver of the DNS
+	// challenge solver if it is a DoH resolver, or to Cloudflare.
+	Resolver *DoHResolver `json:"-"`
+
+	// The timeout of each network check. Defaults to 10 seconds.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Preflight checks that certificates can be obtained for a set of domains
+// with the current configuration of the client: normalization of
+// internationalized names, availability of a challenge solver (DNS-01 is
+// required for wildcards), resolution of the name, CAA records and
+// reachability of the HTTP challenge solver through port 80.
+func (c *Client) Preflight(ctx context.Context, domains []string, cfg PreflightCfg) ([]PreflightCheck, error) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.Resolver == nil {
+		if dnsSolver := c.dnsSolver(); dnsSolver != nil {
+			cfg.Resolver, _ = dnsSolver.Cfg.Resolver.(*DoHResolver)
+		}
+	}
+
+	if cfg.Resolver == nil {
+		resolver, err := NewDoHResolver(DoHResolverCfg{URI: CloudflareDoHURI})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create DNS resolver: %w", err)
+		}
+
+		cfg.Resolver = resolver
+	}
+
+	var checks []PreflightCheck
+
+	for _, domain := range domains {
+		checks = append(checks, c.preflightDomain(ctx, domain, &cfg)...)
+	}
+
+	return checks, nil
+}
+
+func (c *Client) preflightDomain(ctx context.Context, domain string, cfg *PreflightCfg) []PreflightCheck {
+	var checks []PreflightCheck
+
+	addCheck := func(name string, status PreflightStatus, format string, args ...any) {
+		checks = append(checks, PreflightCheck{
+			Identifier: domain,
+			Name:       name,
+			Status:     status,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	withTimeout := func(fn func(context.Context)) {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+
+		fn(ctx)
+	}
+
+	// Name
+	baseName, wildcard := strings.CutPrefix(domain, "*.")
+
+	host, err := normalizeHost(baseName)
+	if err != nil || host == "" {
+		addCheck("name", PreflightStatusError, "invalid domain name")
+		return checks
+	}
+
+	if host != strings.ToLower(strings.TrimSuffix(baseName, ".")) {
+		addCheck("name", PreflightStatusOK, "normalized to %q", host)
+	} else {
+		addCheck("name", PreflightStatusOK, "valid domain name")
+	}
+
+	// Challenges
+	cCfg := c.Config()
+
+	useDNS := c.dnsSolver() != nil
+	useHTTP := c.httpChallengeSolver != nil && !cCfg.DNSOnly && !wildcard
+
+	switch {
+	case wildcard && !useDNS:
+		addCheck("challenge", PreflightStatusError,
+			"wildcard identifiers require a DNS challenge solver")
+	case useDNS:
+		addCheck("challenge", PreflightStatusOK, "DNS-01 challenge")
+	case useHTTP:
+		addCheck("challenge", PreflightStatusOK, "HTTP-01 challenge")
+	default:
+		addCheck("challenge", PreflightStatusError, "no challenge solver")
+	}
+
+	// Resolution
+	var addrs []net.IPAddr
+
+	withTimeout(func(ctx context.Context) {
+		addrs, err = net.DefaultResolver.LookupIPAddr(ctx, host)
+	})
+
+	switch {
+	case err != nil && useHTTP && !useDNS:
+		addCheck("dns", PreflightStatusError, "%v", err)
+	case err != nil:
+		addCheck("dns", PreflightStatusWarning, "%v", err)
+	default:
+		addrStrings := make([]string, len(addrs))
+		for i, addr := range addrs {
+			addrStrings[i] = addr.String()
+		}
+
+		addCheck("dns", PreflightStatusOK, "%s", strings.Join(addrStrings, ", "))
+	}
+
+	// CAA
+	withTimeout(func(ctx context.Context) {
+		status, message := c.preflightCAA(ctx, cfg.Resolver, host, wildcard)
+		addCheck("caa", status, "%s", message)
+	})
+
+	// Reachability
+	if useHTTP && len(addrs) > 0 {
+		withTimeout(func(ctx context.Context) {
+			err := c.httpChallengeSolver.probe(ctx, net.JoinHostPort(host, "80"),
+				host)
+			if err != nil {
+				addCheck("http", PreflightStatusError, "%v", err)
+			} else {
+				addCheck("http", PreflightStatusOK,
+					"challenge solver reachable on port 80")
+			}
+		})
+	}
+
+	if len(addrs) > 0 {
+		withTimeout(func(ctx context.Context) {
+			var dialer net.Dialer
+
+			conn, err := dialer.DialContext(ctx, "tcp",
+				net.JoinHostPort(host, "443"))
+			if err != nil {
+				addCheck("https", PreflightStatusWarning,
+					"port 443 not reachable: %v", err)
+				return
+			}
+			conn.Close()
+
+			addCheck("https", PreflightStatusOK, "port 443 reachable")
+		})
+	}
+
+	return checks
+}
+
+func (c *Client) preflightCAA(ctx context.Context, resolver *DoHResolver, host string, wildcard bool) (PreflightStatus, string) {
+	name, records, err := resolver.RelevantCAARecords(ctx, host)
+	if err != nil {
+		return PreflightStatusWarning,
+			fmt.Sprintf("cannot fetch CAA records: %v", err)
+	}
+
+	if len(records) == 0 {
+		return PreflightStatusOK, "no CAA record, any CA can issue"
+	}
+
+	// RFC 8659 4.3: issuewild records have precedence over issue records for
+	// wildcard names.
+	tag := "issue"
+	if wildcard && slices.ContainsFunc(records, func(r CAARecord) bool {
+		return r.Tag == "issuewild"
+	}) {
+		tag = "issuewild"
+	}
+
+	var issuers []string
+	for _, record := range records {
+		if record.Tag == tag {
+			issuer, _, _ := strings.Cut(record.Value, ";")
+			issuers = append(issuers, strings.TrimSpace(issuer))
+		}
+	}
+
+	if len(issuers) == 0 {
+		return PreflightStatusOK,
+			fmt.Sprintf("no %s CAA record for %q, any CA can issue", tag, name)
+	}
+
+	caaIdentities := c.CAAIdentities()
+
+	if len(caaIdentities) == 0 {
+		return PreflightStatusWarning,
+			fmt.Sprintf("CAA records for %q allow %s, but the server does "+
+				"not publish its CAA identities", name,
+				strings.Join(issuers, ", "))
+	}
+
+	for _, issuer := range issuers {
+		if slices.Contains(caaIdentities, strings.ToLower(issuer)) {
+			return PreflightStatusOK,
+				fmt.Sprintf("CAA records for %q allow %q", name, issuer)
+		}
+	}
+
+	return PreflightStatusError,
+		fmt.Sprintf("CAA records for %q only allow %s", name,
+			strings.Join(issuers, ", "))
+}
@@ -0,0 +1,93 @@
+package acme
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestPreflight(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	caaRecords := map[string]string{
+		"a.test.": "ca.example",
+		"b.test.": "other-ca.example",
+	}
+
+	dohServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			data, _ := io.ReadAll(req.Body)
+
+			var query dnsmessage.Message
+			if err := query.Unpack(data); err != nil {
+				w.WriteHeader(400)
+				return
+			}
+
+			question := query.Questions[0]
+
+			res := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+
+			if issuer, found := caaRecords[question.Name.String()]; found &&
+				question.Type == dnsTypeCAA {
+				data := append([]byte{0, 5}, "issue"+issuer...)
+
+				res.Answers = append(res.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{
+						Name:  question.Name,
+						Type:  dnsTypeCAA,
+						Class: dnsmessage.ClassINET,
+					},
+					Body: &dnsmessage.UnknownResource{
+						Type: dnsTypeCAA,
+						Data: data,
+					},
+				})
+			} else {
+				res.Header.RCode = dnsmessage.RCodeNameError
+			}
+
+			resData, _ := res.Pack()
+			w.Write(resData)
+		}))
+	defer dohServer.Close()
+
+	resolver, err := NewDoHResolver(DoHResolverCfg{URI: dohServer.URL})
+	require.NoError(err)
+
+	s := newFakeACMEServer(t)
+	s.CAAIdentities = []string{"ca.example"}
+
+	withFakeTestClient(t, s, func(c *Client) {
+		checks, err := c.Preflight(context.Background(),
+			[]string{"*.www.a.test", "www.b.test", "-invalid-.test"},
+			PreflightCfg{Resolver: resolver, Timeout: time.Second})
+		require.NoError(err)
+
+		status := func(domain, name string) PreflightStatus {
+			for _, check := range checks {
+				if check.Identifier == domain && check.Name == name {
+					return check.Status
+				}
+			}
+
+			return ""
+		}
+
+		assert.Equal(PreflightStatusOK, status("*.www.a.test", "challenge"))
+		assert.Equal(PreflightStatusOK, status("*.www.a.test", "caa"))
+		assert.Equal(PreflightStatusError, status("www.b.test", "caa"))
+		assert.Equal(PreflightStatusError, status("-invalid-.test", "name"))
+	})
+}
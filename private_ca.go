@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Internal ACME servers differ from public ones in a few ways:
+//
+//   - The lifetime of certificates is set by the provisioner (step-ca) or the
+//     role (Vault), and orders requesting a longer validity period are
+//     rejected.
+//   - Validation usually takes a few milliseconds since the server runs on
+//     the same network, so the default polling delays are too long.
+//
+// Each server also has its own requirements, see serverPresetSettings.
+
+type ServerPreset string
+
+const (
+	ServerPresetStepCA ServerPreset = "step-ca"
+	ServerPresetVault  ServerPreset = "vault"
+)
+
+var ServerPresets = []ServerPreset{
+	ServerPresetStepCA,
+	ServerPresetVault,
+}
+
+const (
+	PrivateCAMinPollDelay = 250 * time.Millisecond
+	PrivateCAMaxPollDelay = 10 * time.Second
+)
+
+type serverPresetSettings struct {
+	// The ACME endpoint is served with a certificate signed by the private
+	// root CA of the server, which must be trusted by the HTTP client (see
+	// LoadCACertificatePool).
+	privateRootCA bool
+
+	// New accounts must be bound to an external account.
+	externalAccountRequired bool
+}
+
+var serverPresetSettingsTable = map[ServerPreset]serverPresetSettings{
+	// step-ca always serves its API with a certificate issued by its own
+	// intermediate CA. External account binding is optional and configured
+	// per provisioner.
+	ServerPresetStepCA: {
+		privateRootCA: true,
+	},
+
+	// The TLS certificate of the Vault API listener is independent from the
+	// PKI secrets engine and is usually trusted by the system. Vault
+	// recommends requiring external account binding (eab_policy set to
+	// "always-required"), and EAB credentials are bound to the directory
+	// they were created for.
+	ServerPresetVault: {
+		externalAccountRequired: true,
+	},
+}
+
+func (p ServerPreset) Validate() error {
+	for _, p2 := range ServerPresets {
+		if p == p2 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown server preset %q", p)
+}
+
+// apply modifies a client configuration for the server and checks that it
+// contains the settings required by the server. Polling delays are only set
+// if they have not been set explicitly.
+func (p ServerPreset) apply(cfg *ClientCfg, v *validator) {
+	settings := serverPresetSettingsTable[p]
+
+	if settings.privateRootCA && cfg.HTTPClient == nil &&
+		(cfg.HTTPClientCfg == nil || cfg.HTTPClientCfg.CACertPool == nil) {
+		v.add("HTTPClientCfg.CACertPool", "missing root CA certificate "+
+			"required by server preset %q", p)
+	}
+
+	if settings.externalAccountRequired && cfg.ExternalAccountBinding == nil {
+		v.add("ExternalAccountBinding", "missing external account binding "+
+			"required by server preset %q", p)
+	}
+
+	cfg.OmitValidityPeriod = true
+
+	if cfg.MinPollDelay == 0 {
+		cfg.MinPollDelay = PrivateCAMinPollDelay
+	}
+
+	if cfg.MaxPollDelay == 0 {
+		cfg.MaxPollDelay = PrivateCAMaxPollDelay
+	}
+}
+
+// StepCADirectoryURI returns the URI of the directory of a step-ca ACME
+// provisioner, e.g. StepCADirectoryURI("https://ca.example.com:9000", "acme").
+func StepCADirectoryURI(baseURI, provisioner string) string {
+	return strings.TrimSuffix(baseURI, "/") + "/acme/" +
+		url.PathEscape(provisioner) + "/directory"
+}
+
+// VaultDirectoryURI returns the URI of the ACME directory of a Vault PKI
+// secrets engine mounted on mountPath. If role is not empty, certificates
+// are issued with this role instead of the default one.
+func VaultDirectoryURI(baseURI, mountPath, role string) string {
+	uri := strings.TrimSuffix(baseURI, "/") + "/v1/" + strings.Trim(mountPath, "/")
+
+	if role != "" {
+		uri += "/roles/" + url.PathEscape(role)
+	}
+
+	return uri + "/acme/directory"
+}
+
+// LoadCACertificatePool loads a PEM file containing one or more CA
+// certificates, e.g. the root CA of an internal ACME server.
+func LoadCACertificatePool(filePath string) (*x509.CertPool, error) {
+	return loadCACertificatePool(filePath, nil)
+}
@@ -0,0 +1,120 @@
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerPresets(t *testing.T) {
+	eabCfg := ExternalAccountBindingCfg{
+		KeyId:   "kid-1",
+		HMACKey: "zWNDZM6eQGHWpSRTPal5eIUYFTu7EajVIoguysqZ9wG44nMEtx3MUAsUDkMTQ12W",
+	}
+
+	tests := []struct {
+		preset    ServerPreset
+		newServer func(*testing.T) *fakeACMEServer
+		setup     func(*ClientCfg, *fakeACMEServer)
+		errField  string // reported if setup is not applied
+	}{
+		{
+			preset: ServerPresetStepCA,
+			newServer: func(t *testing.T) *fakeACMEServer {
+				return newFakeTLSACMEServer(t)
+			},
+			setup: func(cfg *ClientCfg, s *fakeACMEServer) {
+				pool := x509.NewCertPool()
+				pool.AddCert(s.server.Certificate())
+
+				cfg.HTTPClientCfg = &HTTPClientCfg{CACertPool: pool}
+			},
+			errField: "HTTPClientCfg.CACertPool",
+		},
+		{
+			preset: ServerPresetVault,
+			newServer: func(t *testing.T) *fakeACMEServer {
+				s := newFakeACMEServer(t)
+				s.ExternalAccountRequired = true
+				return s
+			},
+			setup: func(cfg *ClientCfg, s *fakeACMEServer) {
+				cfg.ExternalAccountBinding = &eabCfg
+			},
+			errField: "ExternalAccountBinding",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.preset), func(t *testing.T) {
+			require := require.New(t)
+			assert := assert.New(t)
+
+			// Internal servers issue short-lived certificates whose
+			// lifetime is set by the server, and reject orders with a
+			// validity period.
+			s := test.newServer(t)
+			s.RejectValidityPeriod = true
+			s.DefaultValidity = 24 * time.Hour
+
+			dataStore, err := NewFileSystemDataStore(t.TempDir())
+			require.NoError(err)
+
+			// Settings required by the server
+			_, err = NewClient(ClientCfg{
+				DataStore:    dataStore,
+				DirectoryURI: s.DirectoryURI(),
+				ServerPreset: test.preset,
+			})
+			var errs ValidationErrors
+			require.ErrorAs(err, &errs)
+			require.Len(errs, 1)
+			assert.Equal(test.errField, errs[0].Field)
+
+			withFakeTestClientCfg(t, s, func(cfg *ClientCfg) {
+				cfg.HTTPClient = nil
+				cfg.ServerPreset = test.preset
+				test.setup(cfg, s)
+			}, func(c *Client) {
+				ids := []Identifier{DNSIdentifier("example.com")}
+
+				eventChan, err := c.RequestCertificate(context.Background(),
+					"test", CertificateRequest{Identifiers: ids, Validity: 30})
+				require.NoError(err)
+
+				ev := <-eventChan
+				require.NotNil(ev)
+				require.NoError(ev.Error)
+
+				leaf := ev.CertificateData.LeafCertificate()
+
+				// The requested validity must not cause the certificate
+				// to be renewed immediately.
+				renewalTime := CertificateRenewalTime(ev.CertificateData)
+				assert.Equal(leaf.NotBefore.Add(12*time.Hour), renewalTime)
+
+				// Explicit poll delays are kept
+				assert.Equal(time.Millisecond, c.Config().MinPollDelay)
+				assert.Equal(PrivateCAMaxPollDelay, c.Config().MaxPollDelay)
+			})
+		})
+	}
+}
+
+func TestPrivateCADirectoryURIs(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("https://ca.example.com:9000/acme/acme/directory",
+		StepCADirectoryURI("https://ca.example.com:9000/", "acme"))
+	assert.Equal("https://ca.example.com/acme/my%20acme/directory",
+		StepCADirectoryURI("https://ca.example.com", "my acme"))
+
+	assert.Equal("https://vault.example.com:8200/v1/pki/acme/directory",
+		VaultDirectoryURI("https://vault.example.com:8200", "pki", ""))
+	assert.Equal("https://vault.example.com:8200/v1/pki_int/roles/web/acme/directory",
+		VaultDirectoryURI("https://vault.example.com:8200", "/pki_int/", "web"))
+}
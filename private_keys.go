@@ -0,0 +1,54 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+type KeyType string
+
+const (
+	KeyTypeECDSAP256 KeyType = "ecdsa-p256"
+	KeyTypeECDSAP384 KeyType = "ecdsa-p384"
+	KeyTypeRSA2048   KeyType = "rsa-2048"
+	KeyTypeRSA3072   KeyType = "rsa-3072"
+	KeyTypeRSA4096   KeyType = "rsa-4096"
+)
+
+func (t KeyType) Validate() error {
+	switch t {
+	case KeyTypeECDSAP256, KeyTypeECDSAP384:
+	case KeyTypeRSA2048, KeyTypeRSA3072, KeyTypeRSA4096:
+	default:
+		return fmt.Errorf("unknown key type %q", t)
+	}
+
+	return nil
+}
+
+func GeneratePrivateKey(keyType KeyType) (crypto.Signer, error) {
+	switch keyType {
+	case KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+}
+
+func PrivateKeyGenerationFunc(keyType KeyType) func() (crypto.Signer, error) {
+	return func() (crypto.Signer, error) {
+		return GeneratePrivateKey(keyType)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package acme
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const capNetBindService = 10
+
+// privilegedPortError returns a message explaining how to let the process
+// listen on a port, or an empty string if it can or if we cannot tell.
+func privilegedPortError(port int) string {
+	if port == 0 || port >= unprivilegedPortStart() ||
+		hasEffectiveCapability(capNetBindService) {
+		return ""
+	}
+
+	return fmt.Sprintf("port %d requires CAP_NET_BIND_SERVICE (e.g. "+
+		"\"setcap cap_net_bind_service=+ep\" on the executable or "+
+		"\"AmbientCapabilities=CAP_NET_BIND_SERVICE\" in the systemd unit)",
+		port)
+}
+
+func unprivilegedPortStart() int {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start")
+	if err != nil {
+		return 1024
+	}
+
+	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 1024
+	}
+
+	return port
+}
+
+func hasEffectiveCapability(capability uint) bool {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return true
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		value, found := strings.CutPrefix(line, "CapEff:")
+		if !found {
+			continue
+		}
+
+		capabilities, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return true
+		}
+
+		return capabilities&(1<<capability) != 0
+	}
+
+	return true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package acme
+
+// privilegedPortError returns a message explaining how to let the process
+// listen on a port, or an empty string if it can or if we cannot tell.
+func privilegedPortError(port int) string {
+	return ""
+}
@@ -0,0 +1,186 @@
+package acme
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Servers such as Let's Encrypt enforce rate limits, and exceeding some of
+// them means being locked out for days. We keep track of our own orders and
+// issuances in the issuance log so that we can stop before reaching a limit
+// instead of finding out when the server rejects an order. This requires a
+// data store implementing IssuanceLogStore.
+
+type RateLimit struct {
+	// The maximum number of events in any period; 0 disables the limit.
+	Count  int           `json:"count"`
+	Period time.Duration `json:"period"`
+}
+
+type RateLimitsCfg struct {
+	// If set, orders which would exceed a limit are deferred until they
+	// would not anymore. If not, a warning is logged and the order is
+	// submitted anyway.
+	Defer bool `json:"defer,omitempty"`
+
+	NewOrdersPerAccount             RateLimit `json:"new_orders_per_account"`
+	CertificatesPerRegisteredDomain RateLimit `json:"certificates_per_registered_domain"`
+
+	// Certificates for the exact same set of identifiers.
+	DuplicateCertificates RateLimit `json:"duplicate_certificates"`
+}
+
+type RateLimitError struct {
+	Limit     string
+	RetryTime time.Time
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("local rate limit reached (%s), next order possible "+
+		"at %v", err.Limit, err.RetryTime.Format(time.RFC3339))
+}
+
+// See https://letsencrypt.org/docs/rate-limits/.
+func LetsEncryptRateLimitsCfg() *RateLimitsCfg {
+	week := 7 * 24 * time.Hour
+
+	return &RateLimitsCfg{
+		Defer: true,
+
+		NewOrdersPerAccount:             RateLimit{300, 3 * time.Hour},
+		CertificatesPerRegisteredDomain: RateLimit{50, week},
+		DuplicateCertificates:           RateLimit{5, week},
+	}
+}
+
+func (cfg *RateLimitsCfg) Check() error {
+	limits := []RateLimit{
+		cfg.NewOrdersPerAccount,
+		cfg.CertificatesPerRegisteredDomain,
+		cfg.DuplicateCertificates,
+	}
+
+	for _, limit := range limits {
+		if limit.Count < 0 {
+			return fmt.Errorf("invalid negative rate limit count")
+		}
+
+		if limit.Period > IssuanceLogRetention {
+			return fmt.Errorf("rate limit periods cannot be longer than %v",
+				IssuanceLogRetention)
+		}
+	}
+
+	return nil
+}
+
+// checkRateLimits returns a *RateLimitError if submitting an order for a set
+// of identifiers would exceed one of the limits. Limits are not checked if
+// the data store does not keep an issuance log.
+func (c *Client) checkRateLimits(cfg *RateLimitsCfg, ids []Identifier) error {
+	store, ok := c.dataStore.(IssuanceLogStore)
+	if !ok {
+		return nil
+	}
+
+	entries, err := store.LoadIssuanceLog()
+	if err != nil {
+		return fmt.Errorf("cannot load issuance log: %w", err)
+	}
+
+	now := time.Now()
+
+	// The retry time is the time at which the oldest event in the period
+	// leaves it.
+	check := func(name string, limit RateLimit, match func(*IssuanceLogEntry) bool) error {
+		if limit.Count == 0 {
+			return nil
+		}
+
+		minTime := now.Add(-limit.Period)
+
+		var times []time.Time
+		for _, e := range entries {
+			if e.Time.After(minTime) && match(e) {
+				times = append(times, e.Time)
+			}
+		}
+
+		if len(times) < limit.Count {
+			return nil
+		}
+
+		slices.SortFunc(times, time.Time.Compare)
+		retryTime := times[len(times)-limit.Count].Add(limit.Period)
+
+		return &RateLimitError{Limit: name, RetryTime: retryTime}
+	}
+
+	isOrder := func(e *IssuanceLogEntry) bool {
+		return e.Event == IssuanceLogEventOrderSubmitted
+	}
+
+	isDuplicate := func(e *IssuanceLogEntry) bool {
+		return e.Event == IssuanceLogEventCertificateIssued &&
+			sameIdentifierSet(e.Identifiers, ids)
+	}
+
+	err = check("new orders per account", cfg.NewOrdersPerAccount, isOrder)
+	if err != nil {
+		return err
+	}
+
+	err = check("duplicate certificates", cfg.DuplicateCertificates,
+		isDuplicate)
+	if err != nil {
+		return err
+	}
+
+	// Renewals, i.e. certificates for a set of identifiers we already
+	// obtained a certificate for, do not count against the limit per
+	// registered domain.
+	if !slices.ContainsFunc(entries, isDuplicate) {
+		for _, domain := range registeredDomains(ids) {
+			isDomainCertificate := func(e *IssuanceLogEntry) bool {
+				return e.Event == IssuanceLogEventCertificateIssued &&
+					slices.Contains(registeredDomains(e.Identifiers), domain)
+			}
+
+			name := "certificates per registered domain " + domain
+			limit := cfg.CertificatesPerRegisteredDomain
+
+			if err := check(name, limit, isDomainCertificate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func registeredDomains(ids []Identifier) []string {
+	var domains []string
+
+	for _, id := range ids {
+		if id.Type != IdentifierTypeDNS {
+			continue
+		}
+
+		name := strings.TrimPrefix(id.Value, "*.")
+
+		domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+		if err != nil {
+			domain = name
+		}
+
+		if !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
@@ -0,0 +1,103 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimits(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	setup := func(cfg *ClientCfg) {
+		cfg.RateLimits = &RateLimitsCfg{
+			Defer: true,
+
+			CertificatesPerRegisteredDomain: RateLimit{2, time.Hour},
+			DuplicateCertificates:           RateLimit{1, time.Hour},
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		ctx := context.Background()
+
+		requestCertificate := func(name string, domains ...string) error {
+			var ids []Identifier
+			for _, domain := range domains {
+				ids = append(ids, DNSIdentifier(domain))
+			}
+
+			request := CertificateRequest{Identifiers: ids, Validity: 1}
+
+			eventChan, err := c.RequestCertificate(ctx, name, request)
+			require.NoError(err)
+
+			ev := <-eventChan
+			require.NotNil(ev)
+			return ev.Error
+		}
+
+		require.NoError(requestCertificate("a", "a.example.com"))
+		require.NoError(requestCertificate("b", "b.example.com"))
+
+		var rlErr *RateLimitError
+
+		// Exact same set of identifiers
+		err := requestCertificate("a2", "a.example.com")
+		require.True(errors.As(err, &rlErr))
+		assert.Equal("duplicate certificates", rlErr.Limit)
+		assert.WithinDuration(time.Now().Add(time.Hour), rlErr.RetryTime,
+			time.Minute)
+
+		// Same registered domain
+		err = requestCertificate("c", "c.example.com")
+		require.True(errors.As(err, &rlErr))
+		assert.Equal("certificates per registered domain example.com",
+			rlErr.Limit)
+
+		// Another registered domain
+		require.NoError(requestCertificate("d", "example.org"))
+
+		assert.Equal(3, s.Requests("new-order"))
+	})
+}
+
+func TestRateLimitsWithoutIssuanceLog(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	// Limits cannot be checked without an issuance log, orders are submitted
+	setup := func(cfg *ClientCfg) {
+		cfg.DataStore = newBasicDataStore()
+		cfg.RateLimits = &RateLimitsCfg{
+			Defer: true,
+
+			DuplicateCertificates: RateLimit{1, time.Hour},
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		ids := []Identifier{DNSIdentifier("example.com")}
+
+		for _, name := range []string{"a", "b"} {
+			eventChan, err := c.RequestCertificate(context.Background(), name,
+				CertificateRequest{Identifiers: ids, Validity: 1})
+			require.NoError(err)
+
+			ev := <-eventChan
+			require.NotNil(ev)
+			require.NoError(ev.Error)
+		}
+
+		assert.Equal(2, s.Requests("new-order"))
+	})
+}
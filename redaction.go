@@ -0,0 +1,123 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+)
+
+// Request and response bodies are logged at the highest debug level. They
+// must go through redactLogData so that key material never ends up in logs:
+// PEM blocks are removed, and so are private JWK members and secrets in JSON
+// documents, including in the payload of JWS objects.
+
+const redactedValue = "[redacted]"
+
+var (
+	pemBlockRE          = regexp.MustCompile(`(?s)-----BEGIN ([^-\n]+)-----.*?-----END [^-\n]+-----`)
+	truncatedPEMBlockRE = regexp.MustCompile(`(?s)-----BEGIN ([^-\n]+)-----.*`)
+)
+
+var redactedJSONMembers = map[string]struct{}{
+	// RFC 7518 6.2.2 and 6.3.2: private EC and RSA key parameters
+	"d":   {},
+	"p":   {},
+	"q":   {},
+	"dp":  {},
+	"dq":  {},
+	"qi":  {},
+	"oth": {},
+
+	// RFC 7518 6.4.1: symmetric keys (e.g. EAB HMAC keys)
+	"k": {},
+
+	"private_key_data": {},
+	"hmac_key":         {},
+	"api_token":        {},
+	"password":         {},
+}
+
+func redactLogData(data []byte) string {
+	if !json.Valid(data) {
+		return redactPEMBlocks(string(data))
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var value any
+	if err := d.Decode(&value); err != nil {
+		return redactPEMBlocks(string(data))
+	}
+
+	redactedData, err := json.Marshal(redactJSONValue(value))
+	if err != nil {
+		return redactedValue
+	}
+
+	return string(redactedData)
+}
+
+func redactJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if _, found := redactedJSONMembers[key]; found {
+				v[key] = redactedValue
+				continue
+			}
+
+			v[key] = redactJSONValue(member)
+		}
+
+		// JWS objects (RFC 7515 7.2.2): the payload is a base64url-encoded
+		// document, possibly containing another JWS object (e.g. external
+		// account bindings or key changes).
+		if _, isJWS := v["signature"]; isJWS {
+			if payload, ok := v["payload"].(string); ok {
+				v["payload"] = redactJWSPayload(payload)
+			}
+		}
+
+		return v
+
+	case []any:
+		for i, element := range v {
+			v[i] = redactJSONValue(element)
+		}
+
+		return v
+
+	case string:
+		return redactPEMBlocks(v)
+
+	default:
+		return v
+	}
+}
+
+func redactJWSPayload(payload string) any {
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return redactedValue
+	}
+
+	if len(data) == 0 {
+		return ""
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return redactedValue
+	}
+
+	return redactJSONValue(value)
+}
+
+func redactPEMBlocks(s string) string {
+	s = pemBlockRE.ReplaceAllString(s, "[redacted $1]")
+	s = truncatedPEMBlockRE.ReplaceAllString(s, "[redacted $1]")
+
+	return s
+}
@@ -0,0 +1,130 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.n16f.net/log"
+)
+
+type captureLogBackend struct {
+	messages []string
+	mutex    sync.Mutex
+}
+
+func (b *captureLogBackend) Log(msg log.Message) {
+	b.mutex.Lock()
+	b.messages = append(b.messages, msg.Message)
+	b.mutex.Unlock()
+}
+
+func (b *captureLogBackend) Output() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return strings.Join(b.messages, "\n")
+}
+
+func assertNoKeyMaterial(t *testing.T, output string) {
+	assert.NotContains(t, output, "-----BEGIN")
+	assert.NotRegexp(t, `"(d|p|q|dp|dq|qi|k)":"[^[]`, output)
+}
+
+func TestRedactLogData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey, err := GenerateECDSAP256PrivateKey()
+	require.NoError(err)
+
+	keyData, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(err)
+
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: keyData,
+	}))
+
+	jwk := jose.JSONWebKey{Key: privateKey.(*ecdsa.PrivateKey)}
+	jwkData, err := json.Marshal(jwk)
+	require.NoError(err)
+
+	// PEM blocks, including truncated ones
+	output := redactLogData([]byte("key: " + keyPEM))
+	assertNoKeyMaterial(t, output)
+	assert.Equal("key: [redacted PRIVATE KEY]\n", output)
+
+	output = redactLogData([]byte(keyPEM[:100]))
+	assertNoKeyMaterial(t, output)
+
+	// JSON documents
+	output = redactLogData(fmt.Appendf(nil, `{"key": %s, "pem": %q}`,
+		jwkData, keyPEM))
+	assertNoKeyMaterial(t, output)
+	assert.Contains(output, `"crv":"P-256"`)
+
+	// JWS payloads
+	payload := base64.RawURLEncoding.EncodeToString(
+		fmt.Appendf(nil, `{"jwk": %s}`, jwkData))
+	output = redactLogData(fmt.Appendf(nil,
+		`{"protected": "", "payload": %q, "signature": ""}`, payload))
+	assertNoKeyMaterial(t, output)
+	assert.Contains(output, `"crv":"P-256"`)
+}
+
+func TestRedactedDebugOutput(t *testing.T) {
+	require := require.New(t)
+
+	s := newFakeACMEServer(t)
+
+	var backend captureLogBackend
+
+	setup := func(cfg *ClientCfg) {
+		cfg.Log = &log.Logger{
+			Backend:    &backend,
+			Domain:     "acme",
+			Data:       log.Data{},
+			DebugLevel: bodyDebugLevel,
+		}
+
+		cfg.ExternalAccountBinding = &ExternalAccountBindingCfg{
+			KeyId:   "kid-1",
+			HMACKey: "zWNDZM6eQGHWpSRTPal5eIUYFTu7EajVIoguysqZ9wG44nMEtx3MUAsUDkMTQ12W",
+		}
+	}
+
+	withFakeTestClientCfg(t, s, setup, func(c *Client) {
+		ctx := context.Background()
+
+		request := CertificateRequest{
+			Identifiers: []Identifier{DNSIdentifier("example.com")},
+			Validity:    1,
+		}
+
+		eventChan, err := c.RequestCertificate(ctx, "test", request)
+		require.NoError(err)
+
+		ev := <-eventChan
+		require.NotNil(ev)
+		require.NoError(ev.Error)
+	})
+
+	output := backend.Output()
+
+	require.Contains(output, "request body: ")
+	require.Contains(output, "response body: ")
+	assertNoKeyMaterial(t, output)
+	require.NotContains(output,
+		"zWNDZM6eQGHWpSRTPal5eIUYFTu7EajVIoguysqZ9wG44nMEtx3MUAsUDkMTQ12W")
+}
@@ -0,0 +1,135 @@
+package acme
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestInfo contains information about a HTTP request sent to the ACME
+// server. It is passed to ClientCfg.RequestHook once the request is done.
+type RequestInfo struct {
+	Method string
+	URI    string
+
+	// The index of the attempt, starting at 0. Requests are sent again when
+	// the server rejects their nonce.
+	Attempt int
+
+	// The status code of the response, or 0 if no response was received.
+	StatusCode int
+
+	// The error returned for the request if it failed.
+	Error error
+
+	ConnectionReused bool
+
+	// Durations are zero for steps which did not happen, e.g. DNS resolution
+	// and connection establishment when reusing a connection.
+	DNSDuration          time.Duration
+	ConnectDuration      time.Duration
+	TLSHandshakeDuration time.Duration
+	FirstByteDuration    time.Duration // since the start of the request
+	Duration             time.Duration
+}
+
+type RequestHookFunc func(*RequestInfo)
+
+type requestTrace struct {
+	info RequestInfo
+
+	start          time.Time
+	dnsStart       time.Time
+	connectStart   time.Time
+	handshakeStart time.Time
+
+	mutex sync.Mutex
+}
+
+func newRequestTrace(method, uri string, attempt int) *requestTrace {
+	return &requestTrace{
+		info: RequestInfo{
+			Method:  method,
+			URI:     uri,
+			Attempt: attempt,
+		},
+
+		start: time.Now(),
+	}
+}
+
+func (t *requestTrace) ClientTrace() *httptrace.ClientTrace {
+	// Callbacks can be called concurrently, e.g. when dialing multiple
+	// addresses.
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mutex.Lock()
+			t.dnsStart = time.Now()
+			t.mutex.Unlock()
+		},
+
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mutex.Lock()
+			t.info.DNSDuration = time.Since(t.dnsStart)
+			t.mutex.Unlock()
+		},
+
+		ConnectStart: func(string, string) {
+			t.mutex.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mutex.Unlock()
+		},
+
+		ConnectDone: func(network, address string, err error) {
+			t.mutex.Lock()
+			if err == nil {
+				t.info.ConnectDuration = time.Since(t.connectStart)
+			}
+			t.mutex.Unlock()
+		},
+
+		TLSHandshakeStart: func() {
+			t.mutex.Lock()
+			t.handshakeStart = time.Now()
+			t.mutex.Unlock()
+		},
+
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mutex.Lock()
+			t.info.TLSHandshakeDuration = time.Since(t.handshakeStart)
+			t.mutex.Unlock()
+		},
+
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mutex.Lock()
+			t.info.ConnectionReused = info.Reused
+			t.mutex.Unlock()
+		},
+
+		GotFirstResponseByte: func() {
+			t.mutex.Lock()
+			t.info.FirstByteDuration = time.Since(t.start)
+			t.mutex.Unlock()
+		},
+	}
+}
+
+func (t *requestTrace) Finish(res *http.Response, err error) *RequestInfo {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if res != nil {
+		t.info.StatusCode = res.StatusCode
+	}
+
+	t.info.Error = err
+	t.info.Duration = time.Since(t.start)
+
+	info := t.info
+	return &info
+}
@@ -0,0 +1,81 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A secret source provides a secret such as an API token. Secrets are
+// obtained each time they are needed so that sources can return new values
+// when secrets are rotated, without having to restart the program.
+type SecretSource interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// StaticSecret is a secret source always returning the same value.
+type StaticSecret string
+
+func (s StaticSecret) Secret(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// EnvSecret is a secret source reading the value of an environment variable.
+type EnvSecret string
+
+func (s EnvSecret) Secret(ctx context.Context) (string, error) {
+	value := os.Getenv(string(s))
+	if value == "" {
+		return "", fmt.Errorf("missing or empty environment variable %s",
+			string(s))
+	}
+
+	return value, nil
+}
+
+// FileSecret is a secret source reading the content of a file, ignoring
+// leading and trailing space characters. The file is read again when its
+// modification time changes.
+type FileSecret struct {
+	Path string
+
+	value   string
+	modTime time.Time
+	mutex   sync.Mutex
+}
+
+func NewFileSecret(filePath string) *FileSecret {
+	return &FileSecret{Path: filePath}
+}
+
+func (s *FileSecret) Secret(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("cannot stat %q: %w", s.Path, err)
+	}
+
+	if s.value != "" && info.ModTime().Equal(s.modTime) {
+		return s.value, nil
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %q: %w", s.Path, err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("empty secret file %q", s.Path)
+	}
+
+	s.value = value
+	s.modTime = info.ModTime()
+
+	return value, nil
+}
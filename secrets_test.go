@@ -0,0 +1,107 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx := context.Background()
+
+	filePath := path.Join(t.TempDir(), "token")
+	require.NoError(os.WriteFile(filePath, []byte("abc\n"), 0600))
+
+	s := NewFileSecret(filePath)
+
+	value, err := s.Secret(ctx)
+	require.NoError(err)
+	assert.Equal("abc", value)
+
+	// Rotation
+	require.NoError(os.WriteFile(filePath, []byte("def\n"), 0600))
+	modTime := time.Now().Add(time.Second)
+	require.NoError(os.Chtimes(filePath, modTime, modTime))
+
+	value, err = s.Secret(ctx)
+	require.NoError(err)
+	assert.Equal("def", value)
+}
+
+func TestVaultSecret(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	token := "abc"
+	nbRequests := 0
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v1/secret/data/cloudflare", func(w http.ResponseWriter, req *http.Request) {
+		nbRequests++
+
+		if req.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(vaultSecretResponse{
+				Errors: []string{"permission denied"},
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"data":     map[string]any{"token": token},
+				"metadata": map[string]any{"version": 1},
+			},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	s, err := NewVaultSecret(VaultSecretCfg{
+		Address:         server.URL,
+		Token:           "vault-token",
+		Path:            "secret/data/cloudflare",
+		Field:           "token",
+		RefreshInterval: time.Hour,
+	})
+	require.NoError(err)
+
+	value, err := s.Secret(ctx)
+	require.NoError(err)
+	assert.Equal("abc", value)
+
+	// The value is cached until the refresh interval has elapsed
+	token = "def"
+
+	value, err = s.Secret(ctx)
+	require.NoError(err)
+	assert.Equal("abc", value)
+	assert.Equal(1, nbRequests)
+
+	s.Cfg.RefreshInterval = 0
+
+	value, err = s.Secret(ctx)
+	require.NoError(err)
+	assert.Equal("def", value)
+
+	// Errors
+	s.Cfg.Token = "invalid"
+
+	_, err = s.Secret(ctx)
+	assert.ErrorContains(err, "permission denied")
+}
@@ -0,0 +1,146 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type VaultSecretCfg struct {
+	HTTPClient *http.Client `json:"-"`
+
+	// The address of the Vault server, e.g. "https://vault.example.com:8200".
+	Address string `json:"address"`
+	Token   string `json:"token"`
+
+	// The path of the secret, e.g. "secret/data/cloudflare" for a KV version
+	// 2 secrets engine mounted on "secret", and the field containing the
+	// value in the secret.
+	Path  string `json:"path"`
+	Field string `json:"field"`
+
+	// The time after which the secret is fetched again. The default value is
+	// 5 minutes.
+	RefreshInterval time.Duration `json:"refresh_interval,omitempty"`
+}
+
+// VaultSecret is a secret source reading a field of a secret stored in
+// HashiCorp Vault. Both KV version 1 and version 2 secrets engines are
+// supported.
+type VaultSecret struct {
+	Cfg VaultSecretCfg
+
+	value     string
+	fetchTime time.Time
+	mutex     sync.Mutex
+}
+
+type vaultSecretResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []string       `json:"errors"`
+}
+
+func NewVaultSecret(cfg VaultSecretCfg) (*VaultSecret, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("missing address")
+	}
+
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	if cfg.Field == "" {
+		return nil, fmt.Errorf("missing field")
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = NewHTTPClient(nil)
+	}
+
+	if cfg.RefreshInterval == 0 {
+		cfg.RefreshInterval = 5 * time.Minute
+	}
+
+	s := VaultSecret{
+		Cfg: cfg,
+	}
+
+	return &s, nil
+}
+
+func (s *VaultSecret) Secret(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.value != "" && time.Since(s.fetchTime) < s.Cfg.RefreshInterval {
+		return s.value, nil
+	}
+
+	value, err := s.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot fetch Vault secret %q: %w",
+			s.Cfg.Path, err)
+	}
+
+	s.value = value
+	s.fetchTime = time.Now()
+
+	return value, nil
+}
+
+func (s *VaultSecret) fetch(ctx context.Context) (string, error) {
+	uri := strings.TrimSuffix(s.Cfg.Address, "/") + "/v1/" +
+		strings.TrimPrefix(s.Cfg.Path, "/")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request: %w", err)
+	}
+
+	if s.Cfg.Token != "" {
+		req.Header.Set("X-Vault-Token", s.Cfg.Token)
+	}
+
+	res, err := s.Cfg.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var vaultRes vaultSecretResponse
+	body := newSizeLimitedReader(res.Body, DefaultMaxResponseSize)
+	if err := json.NewDecoder(body).Decode(&vaultRes); err != nil {
+		return "", fmt.Errorf("cannot decode response body (status %d): %w",
+			res.StatusCode, err)
+	}
+
+	if res.StatusCode != 200 {
+		if len(vaultRes.Errors) > 0 {
+			return "", fmt.Errorf("request failed with status %d: %s",
+				res.StatusCode, strings.Join(vaultRes.Errors, ", "))
+		}
+
+		return "", fmt.Errorf("request failed with status %d",
+			res.StatusCode)
+	}
+
+	// KV version 2 secrets are wrapped in a second data object along with
+	// metadata.
+	data := vaultRes.Data
+	if nestedData, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nestedData
+		}
+	}
+
+	value, ok := data[s.Cfg.Field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("missing or invalid field %q", s.Cfg.Field)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,184 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"slices"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+func GenerateSelfSignedCertificate(ids []Identifier, privateKey crypto.Signer, validity time.Duration) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate serial number: %w", err)
+	}
+
+	now := time.Now()
+
+	tpl := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "go-acme fallback certificate"},
+
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(validity),
+
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+
+		BasicConstraintsValid: true,
+	}
+
+	for _, id := range ids {
+		switch id.Type {
+		case IdentifierTypeDNS:
+			encodedName, err := idna.ToASCII(id.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot encode dns name %q: %w",
+					id.Value, err)
+			}
+
+			tpl.DNSNames = append(tpl.DNSNames, encodedName)
+
+		case IdentifierTypeIP:
+			addr, err := netip.ParseAddr(id.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip address %q: %w",
+					id.Value, err)
+			}
+
+			tpl.IPAddresses = append(tpl.IPAddresses, addr.AsSlice())
+
+		default:
+			return nil, fmt.Errorf("unhandled identifier type %q", id.Type)
+		}
+	}
+
+	data, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl,
+		privateKey.Public(), privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(data)
+}
+
+// The fallback certificate is only used until the real certificate is
+// available, so there is no point in making it valid for a long time. It is
+// generated again when half of its validity period has elapsed so that
+// clients never see an expired certificate if the real one takes a long time
+// to obtain.
+const fallbackCertificateValidity = 24 * time.Hour
+
+func (c *Client) createFallbackCertificate(name string, ids []Identifier) error {
+	c.fallbackCertificatesMutex.Lock()
+	defer c.fallbackCertificatesMutex.Unlock()
+
+	if certData := c.fallbackCertificates[name]; certData != nil {
+		if slices.Equal(certData.Identifiers, ids) &&
+			!fallbackCertificateExpiring(certData) {
+			return nil
+		}
+	}
+
+	_, err := c.generateFallbackCertificate(name, ids)
+	return err
+}
+
+// Must be called with c.fallbackCertificatesMutex locked.
+func (c *Client) generateFallbackCertificate(name string, ids []Identifier) (*CertificateData, error) {
+	c.Log.Debug(1, "generating self-signed fallback certificate for %q", name)
+
+	privateKey, err := c.Config().GenerateCertificatePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate private key: %w", err)
+	}
+
+	cert, err := GenerateSelfSignedCertificate(ids, privateKey,
+		fallbackCertificateValidity)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate certificate: %w", err)
+	}
+
+	certData := CertificateData{
+		Name: name,
+
+		CertificateRequest: CertificateRequest{
+			Identifiers: slices.Clone(ids),
+		},
+
+		PrivateKey:  privateKey,
+		Certificate: []*x509.Certificate{cert},
+	}
+
+	c.fallbackCertificates[name] = &certData
+
+	return &certData, nil
+}
+
+// Must be called with c.fallbackCertificatesMutex locked.
+func (c *Client) refreshFallbackCertificate(certData *CertificateData) *CertificateData {
+	if !fallbackCertificateExpiring(certData) {
+		return certData
+	}
+
+	certData2, err := c.generateFallbackCertificate(certData.Name,
+		certData.Identifiers)
+	if err != nil {
+		// The current certificate may still be valid for a while
+		c.Log.Error("cannot regenerate fallback certificate for %q: %v",
+			certData.Name, err)
+		return certData
+	}
+
+	return certData2
+}
+
+func fallbackCertificateExpiring(certData *CertificateData) bool {
+	notAfter := certData.LeafCertificate().NotAfter
+	return time.Until(notAfter) < fallbackCertificateValidity/2
+}
+
+func (c *Client) fallbackCertificate(name string) *CertificateData {
+	c.fallbackCertificatesMutex.Lock()
+	defer c.fallbackCertificatesMutex.Unlock()
+
+	certData := c.fallbackCertificates[name]
+	if certData == nil {
+		return nil
+	}
+
+	return c.refreshFallbackCertificate(certData)
+}
+
+func (c *Client) findFallbackCertificateForHost(host string) *CertificateData {
+	host, err := normalizeHost(host)
+	if err != nil || host == "" {
+		return nil
+	}
+
+	c.fallbackCertificatesMutex.Lock()
+	defer c.fallbackCertificatesMutex.Unlock()
+
+	for _, certData := range c.fallbackCertificates {
+		for _, id := range certData.Identifiers {
+			if matchIdentifier(id, host) != identifierMatchNone {
+				return c.refreshFallbackCertificate(certData)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) discardFallbackCertificate(name string) {
+	c.fallbackCertificatesMutex.Lock()
+	delete(c.fallbackCertificates, name)
+	c.fallbackCertificatesMutex.Unlock()
+}
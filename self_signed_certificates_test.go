@@ -0,0 +1,77 @@
+package acme
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackCertificate(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	dataStore, err := NewFileSystemDataStore(t.TempDir())
+	require.NoError(err)
+
+	c, err := NewOfflineClient(dataStore)
+	require.NoError(err)
+	defer c.Stop()
+
+	ids := []Identifier{DNSIdentifier("example.com")}
+
+	require.NoError(c.createFallbackCertificate("example", ids))
+
+	certData := c.fallbackCertificate("example")
+	require.NotNil(certData)
+	assert.Equal(ids, certData.Identifiers)
+	assert.NoError(certData.Verify())
+
+	cert := certData.LeafCertificate()
+	assert.Equal([]string{"example.com"}, cert.DNSNames)
+	assert.WithinDuration(time.Now().Add(fallbackCertificateValidity),
+		cert.NotAfter, time.Minute)
+
+	// The certificate is reused as long as it is not about to expire
+	require.NoError(c.createFallbackCertificate("example", ids))
+	assert.Same(certData, c.fallbackCertificate("example"))
+	assert.Same(certData, c.findFallbackCertificateForHost("EXAMPLE.com."))
+	assert.Nil(c.findFallbackCertificateForHost("example.org"))
+
+	// Replace the certificate by one expiring soon
+	expiringCert, err := GenerateSelfSignedCertificate(ids,
+		certData.PrivateKey, fallbackCertificateValidity/4)
+	require.NoError(err)
+
+	c.fallbackCertificatesMutex.Lock()
+	c.fallbackCertificates["example"] = &CertificateData{
+		Name:               "example",
+		CertificateRequest: CertificateRequest{Identifiers: ids},
+		PrivateKey:         certData.PrivateKey,
+		Certificate:        []*x509.Certificate{expiringCert},
+	}
+	c.fallbackCertificatesMutex.Unlock()
+
+	certData2 := c.findFallbackCertificateForHost("example.com")
+	require.NotNil(certData2)
+	assert.Equal(ids, certData2.Identifiers)
+	assert.True(certData2.LeafCertificate().NotAfter.After(
+		expiringCert.NotAfter))
+	assert.Same(certData2, c.fallbackCertificate("example"))
+
+	// Same thing when looking up the certificate by name
+	c.fallbackCertificatesMutex.Lock()
+	c.fallbackCertificates["example"].Certificate =
+		[]*x509.Certificate{expiringCert}
+	c.fallbackCertificatesMutex.Unlock()
+
+	certData3 := c.fallbackCertificate("example")
+	require.NotNil(certData3)
+	assert.True(certData3.LeafCertificate().NotAfter.After(
+		expiringCert.NotAfter))
+
+	c.discardFallbackCertificate("example")
+	assert.Nil(c.fallbackCertificate("example"))
+}
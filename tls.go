@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// TLSConfig returns a TLS configuration using the certificates of the client.
+// If no name is provided, the certificate is selected among all certificates
+// based on the server name sent by the client. If multiple names are provided,
+// the selection is restricted to the certificates with these names.
+func (c *Client) TLSConfig(names ...string) *tls.Config {
+	var getCertificate GetTLSCertificateFunc
+
+	switch len(names) {
+	case 0:
+		getCertificate = c.GetAnyTLSCertificateFunc()
+	case 1:
+		getCertificate = c.GetTLSCertificateFunc(names[0])
+	default:
+		getCertificate = c.getNamedTLSCertificateFunc(names)
+	}
+
+	return newTLSConfig(getCertificate)
+}
+
+// SNITLSConfig returns a TLS configuration selecting certificates by name
+// based on the server name sent by the client, e.g. for a listener
+// terminating TLS for unrelated domains. Routes map server name patterns,
+// either host names or wildcards ("*.example.com") matching a single label,
+// to certificate names. Patterns are normalized the same way as server names,
+// and equivalent patterns must route to the same certificate. Exact patterns
+// win over wildcard patterns. The default certificate, if not empty, is used
+// when no pattern matches.
+func (c *Client) SNITLSConfig(routes map[string]string, defaultName string) (*tls.Config, error) {
+	patterns := make(map[string]string, len(routes))
+
+	for pattern, name := range routes {
+		host, err := normalizeHostPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server name pattern %q: %w",
+				pattern, err)
+		}
+
+		if name2, found := patterns[host]; found && name2 != name {
+			return nil, fmt.Errorf("conflicting routes for server name "+
+				"pattern %q", host)
+		}
+
+		patterns[host] = name
+	}
+
+	getCertificate := func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		name := defaultName
+
+		if host, err := normalizeHost(info.ServerName); err == nil && host != "" {
+			var exactName, wildcardName string
+
+			for pattern, patternName := range patterns {
+				switch matchIdentifier(DNSIdentifier(pattern), host) {
+				case identifierMatchExact:
+					exactName = patternName
+				case identifierMatchWildcard:
+					wildcardName = patternName
+				}
+			}
+
+			switch {
+			case exactName != "":
+				name = exactName
+			case wildcardName != "":
+				name = wildcardName
+			}
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("no certificate available for %q",
+				info.ServerName)
+		}
+
+		return c.GetTLSCertificateFunc(name)(info)
+	}
+
+	return newTLSConfig(getCertificate), nil
+}
+
+func newTLSConfig(getCertificate GetTLSCertificateFunc) *tls.Config {
+	cfg := tls.Config{
+		GetCertificate: getCertificate,
+
+		MinVersion: tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+			tls.CurveP384,
+		},
+
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	return &cfg
+}
+
+// Listen returns a TLS listener using a TLS configuration created with
+// TLSConfig.
+func (c *Client) Listen(address string, names ...string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %q: %w", address, err)
+	}
+
+	return tls.NewListener(listener, c.TLSConfig(names...)), nil
+}
+
+func (c *Client) getNamedTLSCertificateFunc(names []string) GetTLSCertificateFunc {
+	return func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		host, err := normalizeHost(info.ServerName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server name %q: %w",
+				info.ServerName, err)
+		}
+
+		// Without any server name or certificate matching it, we fall back to
+		// the first available certificate.
+		var exactMatch, wildcardMatch, defaultMatch *CertificateData
+
+	loop:
+		for _, name := range names {
+			certData := c.Certificate(name)
+			if certData == nil {
+				continue
+			}
+
+			if defaultMatch == nil {
+				defaultMatch = certData
+			}
+
+			for _, id := range certData.Identifiers {
+				switch matchIdentifier(id, host) {
+				case identifierMatchExact:
+					exactMatch = certData
+					break loop
+				case identifierMatchWildcard:
+					if wildcardMatch == nil {
+						wildcardMatch = certData
+					}
+				}
+			}
+		}
+
+		for _, certData := range []*CertificateData{exactMatch, wildcardMatch, defaultMatch} {
+			if certData != nil {
+				return certData.TLSCertificate(), nil
+			}
+		}
+
+		return nil, fmt.Errorf("no certificate available")
+	}
+}
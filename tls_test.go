@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSNITLSConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newFakeACMEServer(t)
+
+	withFakeTestClient(t, s, func(c *Client) {
+		requests := map[string][]Identifier{
+			"tenant-a": {DNSIdentifier("a.example.com")},
+			"tenant-b": {DNSIdentifier("*.example.org")},
+			"default":  {DNSIdentifier("example.net")},
+		}
+
+		for name, ids := range requests {
+			eventChan, err := c.RequestCertificate(context.Background(), name,
+				CertificateRequest{Identifiers: ids, Validity: 1})
+			require.NoError(t, err)
+
+			ev := <-eventChan
+			require.NotNil(t, ev)
+			require.NoError(t, ev.Error)
+		}
+
+		_, err := c.SNITLSConfig(map[string]string{"*.": "tenant-a"}, "")
+		assert.Error(err)
+
+		_, err = c.SNITLSConfig(map[string]string{
+			"a.example.com":  "tenant-a",
+			"A.Example.com.": "tenant-b",
+		}, "")
+		assert.Error(err)
+
+		cfg, err := c.SNITLSConfig(map[string]string{
+			"A.Example.com.":   "tenant-a",
+			"*.EXAMPLE.org":    "tenant-b",
+			"shop.example.org": "tenant-a",
+		}, "default")
+		require.NoError(t, err)
+
+		certName := func(serverName string) string {
+			cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{
+				ServerName: serverName,
+			})
+			if !assert.NoError(err) {
+				return ""
+			}
+
+			for name := range requests {
+				tlsCert := c.Certificate(name).TLSCertificate()
+				if tlsCert.Leaf.Equal(cert.Leaf) {
+					return name
+				}
+			}
+
+			return ""
+		}
+
+		assert.Equal("tenant-a", certName("a.example.com"))
+		assert.Equal("tenant-b", certName("www.example.org"))
+		assert.Equal("tenant-a", certName("shop.example.org"))
+		assert.Equal("default", certName("unknown.example.com"))
+		assert.Equal("default", certName(""))
+	})
+}
@@ -0,0 +1,108 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ValidationError is a problem with a configuration value. Field is the path
+// of the value, e.g. "HTTPChallengeSolver.Address".
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (err *ValidationError) Error() string {
+	if err.Field == "" {
+		return err.Message
+	}
+
+	return err.Field + ": " + err.Message
+}
+
+// ValidationErrors is returned by NewClient and solver constructors when
+// their configuration is invalid, so that all problems are reported at once
+// instead of one at a time or later when the client is started.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (errs ValidationErrors) Unwrap() []error {
+	errs2 := make([]error, len(errs))
+	for i, err := range errs {
+		errs2[i] = err
+	}
+
+	return errs2
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check records an error returned by the validation of a value. Validation
+// errors of nested configurations are prefixed with the name of the field.
+func (v *validator) check(field string, err error) {
+	if err == nil {
+		return
+	}
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		v.add(field, "%v", err)
+		return
+	}
+
+	for _, err := range errs {
+		nestedField := err.Field
+		if field != "" && nestedField != "" {
+			nestedField = field + "." + nestedField
+		} else if field != "" {
+			nestedField = field
+		}
+
+		v.add(nestedField, "%s", err.Message)
+	}
+}
+
+func (v *validator) checkListenAddress(field, address string) {
+	_, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		v.add(field, "%v", err)
+		return
+	}
+
+	port, err := net.LookupPort("tcp", portString)
+	if err != nil {
+		v.add(field, "invalid port %q", portString)
+		return
+	}
+
+	if message := privilegedPortError(port); message != "" {
+		v.add(field, "%s", message)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
@@ -0,0 +1,6 @@
+package acme
+
+const (
+	// ZeroSSL requires external account binding.
+	ZeroSSLDirectoryURI = "https://acme.zerossl.com/v2/DV90"
+)